@@ -27,17 +27,23 @@ import { RdioScannerAdminComponent } from './admin.component';
 import { RdioScannerAdminService } from './admin.service';
 import { RdioScannerAdminConfigComponent } from './config/config.component';
 import { RdioScannerAdminAccessComponent } from './config/access/access.component';
+import { RdioScannerAdminAlertRulesComponent } from './config/alert-rules/alert-rules.component';
 import { RdioScannerAdminApiKeysComponent } from './config/api-keys/api-keys.component';
+import { RdioScannerAdminBucketWatchComponent } from './config/bucket-watch/bucket-watch.component';
 import { RdioScannerAdminDirWatchComponent } from './config/dir-watch/dir-watch.component';
 import { RdioScannerAdminDownstreamsComponent } from './config/downstreams/downstreams.component';
 import { RdioScannerAdminGroupsComponent } from './config/groups/groups.component';
 import { RdioScannerAdminOptionsComponent } from './config/options/options.component';
+import { RdioScannerAdminProfilesComponent } from './config/profiles/profiles.component';
+import { RdioScannerAdminRetentionRulesComponent } from './config/retention-rules/retention-rules.component';
+import { RdioScannerAdminAudioFiltersComponent } from './config/systems/audio-filters/audio-filters.component';
 import { RdioScannerAdminSystemsSelectComponent } from './config/systems/select/select.component';
 import { RdioScannerAdminSystemComponent } from './config/systems/system/system.component';
 import { RdioScannerAdminSystemsComponent } from './config/systems/systems.component';
 import { RdioScannerAdminTalkgroupComponent } from './config/systems/talkgroup/talkgroup.component';
 import { RdioScannerAdminUnitComponent } from './config/systems/unit/unit.component';
 import { RdioScannerAdminTagsComponent } from './config/tags/tags.component';
+import { RdioScannerAdminToneSetsComponent } from './config/tone-sets/tone-sets.component';
 import { RdioScannerAdminLoginComponent } from './login/login.component';
 import { RdioScannerAdminLogsComponent } from './logs/logs.component';
 import { RdioScannerAdminTodosComponent } from './todos/todos.component';
@@ -51,7 +57,10 @@ import { RdioScannerAdminPasswordComponent } from './tools/password/password.com
         RdioScannerAdminComponent,
         RdioScannerAdminConfigComponent,
         RdioScannerAdminAccessComponent,
+        RdioScannerAdminAlertRulesComponent,
         RdioScannerAdminApiKeysComponent,
+        RdioScannerAdminAudioFiltersComponent,
+        RdioScannerAdminBucketWatchComponent,
         RdioScannerAdminDirWatchComponent,
         RdioScannerAdminDownstreamsComponent,
         RdioScannerAdminGroupsComponent,
@@ -62,12 +71,15 @@ import { RdioScannerAdminPasswordComponent } from './tools/password/password.com
         RdioScannerAdminLogsComponent,
         RdioScannerAdminOptionsComponent,
         RdioScannerAdminPasswordComponent,
+        RdioScannerAdminProfilesComponent,
+        RdioScannerAdminRetentionRulesComponent,
         RdioScannerAdminSystemComponent,
         RdioScannerAdminSystemsComponent,
         RdioScannerAdminSystemsSelectComponent,
         RdioScannerAdminTagsComponent,
         RdioScannerAdminTalkgroupComponent,
         RdioScannerAdminTodosComponent,
+        RdioScannerAdminToneSetsComponent,
         RdioScannerAdminToolsComponent,
         RdioScannerAdminUnitComponent,
     ],
@@ -45,6 +45,25 @@ export interface AdminEvent {
     passwordNeedChange?: boolean;
 }
 
+export interface AlertRule {
+    _id?: number;
+    disabled?: boolean;
+    groups?: number[];
+    label?: string;
+    matchTalkgroup?: boolean;
+    matchTranscript?: boolean;
+    matchUnits?: boolean;
+    order?: number;
+    pattern?: string;
+    regex?: boolean;
+    systems?: {
+        id: number;
+        talkgroups: number[] | '*';
+    }[] | '*';
+    tags?: number[];
+    webhook?: string | null;
+}
+
 export interface ApiKey {
     _id?: string;
     disabled?: boolean;
@@ -55,17 +74,52 @@ export interface ApiKey {
         id: number;
         talkgroups: number[] | '*';
     }[] | number[] | '*';
+    timeZone?: string;
+}
+
+export interface AudioFilters {
+    gain?: number | null;
+    highpass?: number | null;
+    loudnorm?: 'ebu' | 'loud' | 'norm' | 'off' | null;
+    lowpass?: number | null;
+    noiseReduction?: boolean | null;
+}
+
+export interface BucketWatch {
+    _id?: string;
+    accessKey?: string;
+    afterIngest?: 'delete' | 'tag';
+    bucket?: string;
+    disabled?: boolean;
+    endpoint?: string;
+    extension?: string;
+    frequency?: number;
+    interval?: number;
+    mask?: string;
+    order?: number;
+    prefix?: string;
+    region?: string;
+    secretKey?: string;
+    systemId?: number;
+    talkgroupId?: number;
+    timeZone?: string;
+    type?: string;
 }
 
 export interface Config {
     access?: Access[];
+    alertRules?: AlertRule[];
     apiKeys?: ApiKey[];
+    bucketWatch?: BucketWatch[];
     dirWatch?: DirWatch[];
     downstreams?: Downstream[];
     groups?: Group[];
     options?: Options;
+    profiles?: Profile[];
+    retentionRules?: RetentionRule[];
     systems?: System[];
     tags?: Tag[];
+    toneSets?: ToneSet[];
 }
 
 export interface DirWatch {
@@ -80,6 +134,7 @@ export interface DirWatch {
     order?: number;
     systemId?: number;
     talkgroupId?: number;
+    timeZone?: string;
     type?: string;
 }
 
@@ -131,11 +186,23 @@ export interface Options {
     afsSystems?: string;
     audioConversion?: 0 | 1 | 2 | 3;
     audioBitrate?: number;
+    audioConversionFailure?: 0 | 1;
     autoPopulate?: boolean;
+    backupCalls?: boolean;
+    backupInterval?: number;
+    backupKeep?: number;
+    backupLogs?: boolean;
+    bestCopyWindow?: number;
     branding?: string;
     dimmerDelay?: number;
     disableDuplicateDetection?: boolean;
+    duplicateDetectionMatchFrequency?: boolean;
+    duplicateDetectionMatchSource?: boolean;
+    duplicateDetectionMode?: 0 | 1;
     duplicateDetectionTimeFrame?: number;
+    ffmpegTimeout?: number;
+    ffmpegWorkers?: number;
+    keepOriginalAudio?: boolean;
     keypadBeeps?: string;
     maxClients?: number;
     playbackGoesLive?: boolean;
@@ -146,17 +213,52 @@ export interface Options {
     sortTalkgroups?: boolean;
     tagsToggle?: boolean;
     time12hFormat?: boolean;
+    timeZone?: string;
+    transcriptionApiKey?: string;
+    transcriptionBackend?: '' | 'http';
+    transcriptionLanguage?: string;
+    transcriptionModel?: string;
+    transcriptionUrl?: string;
+}
+
+export interface Profile {
+    _id?: number;
+    bitrate?: number | null;
+    channels?: number | null;
+    codec?: string;
+    container?: string | null;
+    filters?: string | null;
+    label?: string;
+    order?: number | null;
+    sampleRate?: number | null;
+}
+
+export interface RetentionRule {
+    _id?: number;
+    days?: number;
+    disabled?: boolean;
+    groupId?: number | null;
+    keepForever?: boolean;
+    label?: string;
+    order?: number | null;
+    systemId?: number | null;
+    tagId?: number | null;
+    talkgroupId?: number | null;
 }
 
 export interface System {
     _id?: number;
+    audioFilters?: AudioFilters | null;
     autoPopulate?: boolean;
     blacklists?: string;
     id?: number;
     label?: string;
     led?: string | null;
+    minVoiceDuration?: number | null;
     order?: number | null;
+    profileId?: number | null;
     talkgroups?: Talkgroup[];
+    trimSilence?: boolean;
     units?: Unit[];
 }
 
@@ -166,6 +268,7 @@ export interface Tag {
 }
 
 export interface Talkgroup {
+    audioFilters?: AudioFilters | null;
     frequency?: number | null;
     groupId?: number;
     id?: number;
@@ -173,9 +276,25 @@ export interface Talkgroup {
     led?: string | null;
     name?: string;
     order?: number;
+    profileId?: number | null;
     tagId?: number;
 }
 
+export interface ToneSet {
+    _id?: number;
+    aDuration?: number;
+    aTone?: number;
+    bDuration?: number | null;
+    bTone?: number | null;
+    label?: string;
+    order?: number;
+    systems?: {
+        id: number;
+        talkgroups: number[] | '*';
+    }[] | '*';
+    tolerance?: number | null;
+}
+
 export interface Unit {
     id?: number | null;
     label?: string;
@@ -388,6 +507,24 @@ export class RdioScannerAdminService implements OnDestroy {
         });
     }
 
+    newAlertRuleForm(alertRule?: AlertRule): UntypedFormGroup {
+        return this.ngFormBuilder.group({
+            _id: [alertRule?._id],
+            disabled: [alertRule?.disabled],
+            groups: [alertRule?.groups || []],
+            label: [alertRule?.label, Validators.required],
+            matchTalkgroup: [alertRule?.matchTalkgroup],
+            matchTranscript: [alertRule?.matchTranscript],
+            matchUnits: [alertRule?.matchUnits],
+            order: [alertRule?.order],
+            pattern: [alertRule?.pattern, [Validators.required, this.validateAlertRulePattern()]],
+            regex: [alertRule?.regex],
+            systems: [alertRule?.systems || [], this.validateAlertRuleScope()],
+            tags: [alertRule?.tags || []],
+            webhook: [alertRule?.webhook, this.validateUrl()],
+        });
+    }
+
     newApiKeyForm(apiKey?: ApiKey): UntypedFormGroup {
         return this.ngFormBuilder.group({
             _id: [apiKey?._id],
@@ -396,19 +533,58 @@ export class RdioScannerAdminService implements OnDestroy {
             key: [apiKey?.key, [Validators.required, this.validateApiKey()]],
             order: [apiKey?.order],
             systems: [apiKey?.systems, Validators.required],
+            timeZone: [apiKey?.timeZone, this.validateTimeZone()],
+        });
+    }
+
+    newAudioFiltersForm(audioFilters?: AudioFilters | null): UntypedFormGroup {
+        return this.ngFormBuilder.group({
+            gain: [audioFilters?.gain, [Validators.min(-30), Validators.max(30)]],
+            highpass: [audioFilters?.highpass, [Validators.min(0), Validators.max(20000)]],
+            loudnorm: [audioFilters?.loudnorm ?? null],
+            lowpass: [audioFilters?.lowpass, [Validators.min(0), Validators.max(20000)]],
+            noiseReduction: [audioFilters?.noiseReduction ?? null],
+        });
+    }
+
+    newBucketWatchForm(bucketWatch?: BucketWatch): UntypedFormGroup {
+        return this.ngFormBuilder.group({
+            _id: [bucketWatch?._id],
+            accessKey: [bucketWatch?.accessKey],
+            afterIngest: [bucketWatch?.afterIngest],
+            bucket: [bucketWatch?.bucket, Validators.required],
+            disabled: [bucketWatch?.disabled],
+            endpoint: [bucketWatch?.endpoint, Validators.required],
+            extension: [bucketWatch?.extension, this.validateExtension()],
+            frequency: [bucketWatch?.frequency, Validators.min(0)],
+            interval: [bucketWatch?.interval, Validators.min(10)],
+            mask: [bucketWatch?.mask, this.validateMask()],
+            order: [bucketWatch?.order],
+            prefix: [bucketWatch?.prefix],
+            region: [bucketWatch?.region],
+            secretKey: [bucketWatch?.secretKey],
+            systemId: [bucketWatch?.systemId, this.validateDirwatchSystemId()],
+            talkgroupId: [bucketWatch?.talkgroupId, this.validateDirwatchTalkgroupId()],
+            timeZone: [bucketWatch?.timeZone, this.validateTimeZone()],
+            type: [bucketWatch?.type],
         });
     }
 
     newConfigForm(config?: Config): UntypedFormGroup {
         return this.ngFormBuilder.group({
             access: this.ngFormBuilder.array(config?.access?.map((access) => this.newAccessForm(access)) || []),
+            alertRules: this.ngFormBuilder.array(config?.alertRules?.map((alertRule) => this.newAlertRuleForm(alertRule)) || []),
             apiKeys: this.ngFormBuilder.array(config?.apiKeys?.map((apiKey) => this.newApiKeyForm(apiKey)) || []),
+            bucketWatch: this.ngFormBuilder.array(config?.bucketWatch?.map((bucketWatch) => this.newBucketWatchForm(bucketWatch)) || []),
             dirWatch: this.ngFormBuilder.array(config?.dirWatch?.map((dirWatch) => this.newDirWatchForm(dirWatch)) || []),
             downstreams: this.ngFormBuilder.array(config?.downstreams?.map((downstream) => this.newDownstreamForm(downstream)) || []),
             groups: this.ngFormBuilder.array(config?.groups?.map((group) => this.newGroupForm(group)) || []),
             options: this.newOptionsForm(config?.options),
+            profiles: this.ngFormBuilder.array(config?.profiles?.map((profile) => this.newProfileForm(profile)) || []),
+            retentionRules: this.ngFormBuilder.array(config?.retentionRules?.map((retentionRule) => this.newRetentionRuleForm(retentionRule)) || []),
             systems: this.ngFormBuilder.array(config?.systems?.map((system) => this.newSystemForm(system)) || []),
             tags: this.ngFormBuilder.array(config?.tags?.map((tag) => this.newTagForm(tag)) || []),
+            toneSets: this.ngFormBuilder.array(config?.toneSets?.map((toneSet) => this.newToneSetForm(toneSet)) || []),
         });
     }
 
@@ -425,6 +601,7 @@ export class RdioScannerAdminService implements OnDestroy {
             order: [dirWatch?.order],
             systemId: [dirWatch?.systemId, this.validateDirwatchSystemId()],
             talkgroupId: [dirWatch?.talkgroupId, this.validateDirwatchTalkgroupId()],
+            timeZone: [dirWatch?.timeZone, this.validateTimeZone()],
             type: [dirWatch?.type],
         });
     }
@@ -454,22 +631,56 @@ export class RdioScannerAdminService implements OnDestroy {
         });
     }
 
+    newProfileForm(profile?: Profile): UntypedFormGroup {
+        return this.ngFormBuilder.group({
+            _id: [profile?._id],
+            bitrate: [profile?.bitrate, [Validators.min(6), Validators.max(320)]],
+            channels: [profile?.channels ?? null],
+            codec: [profile?.codec, Validators.required],
+            container: [profile?.container ?? null],
+            filters: [profile?.filters],
+            label: [profile?.label, [Validators.required, this.validateProfileLabel()]],
+            order: [profile?.order],
+            sampleRate: [profile?.sampleRate, [Validators.min(8000), Validators.max(48000)]],
+        });
+    }
+
+    newRetentionRuleForm(retentionRule?: RetentionRule): UntypedFormGroup {
+        return this.ngFormBuilder.group({
+            _id: [retentionRule?._id],
+            days: [retentionRule?.days, [Validators.min(1), this.validateRetentionDays()]],
+            disabled: [retentionRule?.disabled],
+            groupId: [retentionRule?.groupId ?? null, this.validateGroup()],
+            keepForever: [retentionRule?.keepForever],
+            label: [retentionRule?.label, Validators.required],
+            order: [retentionRule?.order],
+            systemId: [retentionRule?.systemId ?? null, this.validateRetentionSystemId()],
+            tagId: [retentionRule?.tagId ?? null, this.validateTag()],
+            talkgroupId: [retentionRule?.talkgroupId ?? null],
+        });
+    }
+
     newSystemForm(system?: System): UntypedFormGroup {
         return this.ngFormBuilder.group({
             _id: [system?._id],
+            audioFilters: this.newAudioFiltersForm(system?.audioFilters),
             autoPopulate: [system?.autoPopulate],
             blacklists: [system?.blacklists, this.validateBlacklists()],
             id: [system?.id, [Validators.required, Validators.min(1), this.validateId()]],
             label: [system?.label, Validators.required],
             led: [system?.led],
+            minVoiceDuration: [system?.minVoiceDuration, Validators.min(0)],
             order: [system?.order],
+            profileId: [system?.profileId],
             talkgroups: this.ngFormBuilder.array(system?.talkgroups?.map((talkgroup) => this.newTalkgroupForm(talkgroup)) || []),
+            trimSilence: [system?.trimSilence],
             units: this.ngFormBuilder.array(system?.units?.map((unit) => this.newUnitForm(unit)) || []),
         });
     }
 
     newTalkgroupForm(talkgroup?: Talkgroup): UntypedFormGroup {
         return this.ngFormBuilder.group({
+            audioFilters: this.newAudioFiltersForm(talkgroup?.audioFilters),
             frequency: [talkgroup?.frequency, Validators.min(0)],
             groupId: [talkgroup?.groupId, [Validators.required, this.validateGroup()]],
             id: [talkgroup?.id, [Validators.required, Validators.min(1), this.validateId()]],
@@ -477,10 +688,25 @@ export class RdioScannerAdminService implements OnDestroy {
             led: [talkgroup?.led],
             name: [talkgroup?.name, Validators.required],
             order: [talkgroup?.order],
+            profileId: [talkgroup?.profileId],
             tagId: [talkgroup?.tagId, [Validators.required, this.validateTag()]],
         });
     }
 
+    newToneSetForm(toneSet?: ToneSet): UntypedFormGroup {
+        return this.ngFormBuilder.group({
+            _id: [toneSet?._id],
+            aDuration: [toneSet?.aDuration, [Validators.required, Validators.min(100)]],
+            aTone: [toneSet?.aTone, [Validators.required, Validators.min(100), Validators.max(4000)]],
+            bDuration: [toneSet?.bDuration, [Validators.min(100), this.validateToneSetB()]],
+            bTone: [toneSet?.bTone, [Validators.min(100), Validators.max(4000)]],
+            label: [toneSet?.label, Validators.required],
+            order: [toneSet?.order],
+            systems: [toneSet?.systems, Validators.required],
+            tolerance: [toneSet?.tolerance, [Validators.min(0), Validators.max(10)]],
+        });
+    }
+
     newUnitForm(unit?: Unit): UntypedFormGroup {
         return this.ngFormBuilder.group({
             id: [unit?.id, [Validators.required, Validators.min(0), this.validateId()]],
@@ -494,11 +720,23 @@ export class RdioScannerAdminService implements OnDestroy {
             afsSystems: [options?.afsSystems, this.validateAfsSystems()],
             audioConversion: [options?.audioConversion],
             audioBitrate: [options?.audioBitrate, [Validators.required, Validators.min(6), Validators.max(128)]],
+            audioConversionFailure: [options?.audioConversionFailure],
             autoPopulate: [options?.autoPopulate],
+            backupCalls: [options?.backupCalls],
+            backupInterval: [options?.backupInterval, [Validators.required, Validators.min(0)]],
+            backupKeep: [options?.backupKeep, [Validators.required, Validators.min(0)]],
+            backupLogs: [options?.backupLogs],
+            bestCopyWindow: [options?.bestCopyWindow, Validators.min(0)],
             branding: [options?.branding],
             dimmerDelay: [options?.dimmerDelay, [Validators.required, Validators.min(0)]],
             disableDuplicateDetection: [options?.disableDuplicateDetection],
+            duplicateDetectionMatchFrequency: [options?.duplicateDetectionMatchFrequency],
+            duplicateDetectionMatchSource: [options?.duplicateDetectionMatchSource],
+            duplicateDetectionMode: [options?.duplicateDetectionMode],
             duplicateDetectionTimeFrame: [options?.duplicateDetectionTimeFrame, [Validators.required, Validators.min(0)]],
+            ffmpegTimeout: [options?.ffmpegTimeout, [Validators.required, Validators.min(0)]],
+            ffmpegWorkers: [options?.ffmpegWorkers, [Validators.required, Validators.min(1)]],
+            keepOriginalAudio: [options?.keepOriginalAudio],
             keypadBeeps: [options?.keypadBeeps, Validators.required],
             maxClients: [options?.maxClients, [Validators.required, Validators.min(1)]],
             playbackGoesLive: [options?.playbackGoesLive],
@@ -509,6 +747,12 @@ export class RdioScannerAdminService implements OnDestroy {
             sortTalkgroups: [options?.sortTalkgroups],
             tagsToggle: [options?.tagsToggle],
             time12hFormat: [options?.time12hFormat],
+            timeZone: [options?.timeZone, this.validateTimeZone()],
+            transcriptionApiKey: [options?.transcriptionApiKey],
+            transcriptionBackend: [options?.transcriptionBackend],
+            transcriptionLanguage: [options?.transcriptionLanguage],
+            transcriptionModel: [options?.transcriptionModel],
+            transcriptionUrl: [options?.transcriptionUrl],
         });
     }
 
@@ -607,6 +851,43 @@ export class RdioScannerAdminService implements OnDestroy {
         };
     }
 
+    private validateAlertRulePattern(): ValidatorFn {
+        return (control: AbstractControl): ValidationErrors | null => {
+            if (typeof control.value !== 'string' || !control.value.length) {
+                return null;
+            }
+
+            const alertRule = control.parent?.getRawValue() || {};
+
+            if (!alertRule.matchTalkgroup && !alertRule.matchTranscript && !alertRule.matchUnits) {
+                return { fields: true };
+            }
+
+            if (alertRule.regex) {
+                try {
+                    new RegExp(control.value);
+
+                } catch {
+                    return { invalid: true };
+                }
+            }
+
+            return null;
+        };
+    }
+
+    private validateAlertRuleScope(): ValidatorFn {
+        return (control: AbstractControl): ValidationErrors | null => {
+            const alertRule = control.parent?.getRawValue() || {};
+
+            if (control.value === '*' || (Array.isArray(control.value) && control.value.length)) {
+                return null;
+            }
+
+            return alertRule.groups?.length || alertRule.tags?.length ? null : { required: true };
+        };
+    }
+
     private validateApiKey(): ValidatorFn {
         return (control: AbstractControl): ValidationErrors | null => {
             if (typeof control.value !== 'string' || !control.value.length) {
@@ -741,6 +1022,40 @@ export class RdioScannerAdminService implements OnDestroy {
         };
     }
 
+    private validateProfileLabel(): ValidatorFn {
+        return (control: AbstractControl): ValidationErrors | null => {
+            if (typeof control.value !== 'string' || !control.value.length) {
+                return null;
+            }
+
+            const profiles: Profile[] = control.parent?.parent?.getRawValue() || [];
+
+            const count = profiles.reduce((c, p) => c += p.label === control.value ? 1 : 0, 0);
+
+            return count > 1 ? { duplicate: true } : null;
+        };
+    }
+
+    private validateRetentionDays(): ValidatorFn {
+        return (control: AbstractControl): ValidationErrors | null => {
+            const retentionRule = control.parent?.getRawValue() || {};
+
+            return retentionRule.keepForever || typeof control.value === 'number' ? null : { required: true };
+        };
+    }
+
+    private validateRetentionSystemId(): ValidatorFn {
+        return (control: AbstractControl): ValidationErrors | null => {
+            const retentionRule = control.parent?.getRawValue() || {};
+
+            if (control.value !== null) {
+                return null;
+            }
+
+            return retentionRule.talkgroupId === null && (retentionRule.groupId !== null || retentionRule.tagId !== null) ? null : { required: true };
+        };
+    }
+
     private validateTag(): ValidatorFn {
         return (control: AbstractControl): ValidationErrors | null => {
             if (typeof control.value !== 'number') {
@@ -753,6 +1068,31 @@ export class RdioScannerAdminService implements OnDestroy {
         };
     }
 
+    private validateTimeZone(): ValidatorFn {
+        return (control: AbstractControl): ValidationErrors | null => {
+            if (typeof control.value !== 'string' || !control.value.length) {
+                return null;
+            }
+
+            try {
+                new Intl.DateTimeFormat(undefined, { timeZone: control.value });
+
+                return null;
+
+            } catch {
+                return { invalid: true };
+            }
+        };
+    }
+
+    private validateToneSetB(): ValidatorFn {
+        return (control: AbstractControl): ValidationErrors | null => {
+            const bTone = control.parent?.get('bTone')?.value;
+
+            return typeof bTone === 'number' && typeof control.value !== 'number' ? { required: true } : null;
+        };
+    }
+
     private validateUrl(): ValidatorFn {
         return (control: AbstractControl): ValidationErrors | null => {
             if (typeof control.value !== 'string' || !control.value.length) {
@@ -0,0 +1,131 @@
+/*
+ * *****************************************************************************
+ * Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>
+ * ****************************************************************************
+ */
+
+import { CdkDragDrop, moveItemInArray } from '@angular/cdk/drag-drop';
+import { Component, Input, OnChanges, QueryList, ViewChildren, inject } from '@angular/core';
+import { MatDialog } from '@angular/material/dialog';
+import { UntypedFormArray, UntypedFormGroup } from '@angular/forms';
+import { MatExpansionPanel } from '@angular/material/expansion';
+import { RdioScannerAdminService } from '../../admin.service';
+import { RdioScannerAdminSystemsSelectComponent } from '../systems/select/select.component';
+
+@Component({
+    selector: 'rdio-scanner-admin-alert-rules',
+    templateUrl: './alert-rules.component.html',
+})
+export class RdioScannerAdminAlertRulesComponent implements OnChanges {
+    private adminService = inject(RdioScannerAdminService)
+    private matDialog = inject(MatDialog)
+
+    @Input() form: UntypedFormArray | undefined;
+
+    get alertRules(): UntypedFormGroup[] {
+        return this.form?.controls
+            .sort((a, b) => a.value.order - b.value.order) as UntypedFormGroup[];
+    }
+
+    get groups(): UntypedFormGroup[] {
+        const groups = this.form?.root.get('groups') as UntypedFormArray;
+
+        return groups.controls as UntypedFormGroup[];
+    }
+
+    get tags(): UntypedFormGroup[] {
+        const tags = this.form?.root.get('tags') as UntypedFormArray;
+
+        return tags.controls as UntypedFormGroup[];
+    }
+
+    @ViewChildren(MatExpansionPanel) private panels: QueryList<MatExpansionPanel> | undefined;
+
+    ngOnChanges(): void {
+        if (this.form) {
+            this.alertRules.forEach((control) => {
+                this.registerOnChanges(control);
+
+                this.validate(control);
+            });
+        }
+    }
+
+    add(): void {
+        const alertRule = this.adminService.newAlertRuleForm({
+            matchTranscript: true,
+            systems: '*',
+        });
+
+        this.registerOnChanges(alertRule);
+
+        this.validate(alertRule);
+
+        alertRule.markAllAsTouched();
+
+        this.form?.insert(0, alertRule);
+
+        this.form?.markAsDirty();
+    }
+
+    closeAll(): void {
+        this.panels?.forEach((panel) => panel.close());
+    }
+
+    drop(event: CdkDragDrop<UntypedFormGroup[]>): void {
+        if (event.previousIndex !== event.currentIndex) {
+            moveItemInArray(event.container.data, event.previousIndex, event.currentIndex);
+
+            event.container.data.forEach((dat, idx) => dat.get('order')?.setValue(idx + 1, { emitEvent: false }));
+
+            this.form?.markAsDirty();
+        }
+    }
+
+    remove(index: number): void {
+        this.form?.removeAt(index);
+
+        this.form?.markAsDirty();
+    }
+
+    select(alertRule: UntypedFormGroup): void {
+        const matDialogRef = this.matDialog.open(RdioScannerAdminSystemsSelectComponent, { data: alertRule });
+
+        matDialogRef.afterClosed().subscribe((data) => {
+            if (data) {
+                alertRule.get('systems')?.setValue(data);
+
+                alertRule.markAsDirty();
+            }
+        });
+    }
+
+    private registerOnChanges(control: UntypedFormGroup): void {
+        ['groups', 'matchTalkgroup', 'matchTranscript', 'matchUnits', 'regex', 'systems', 'tags'].forEach((name) => {
+            control.get(name)?.valueChanges.subscribe(() => this.validate(control));
+        });
+    }
+
+    private validate(control: UntypedFormGroup): void {
+        const pattern = control.get('pattern');
+        const systems = control.get('systems');
+
+        pattern?.updateValueAndValidity({ emitEvent: false });
+        pattern?.markAsTouched();
+
+        systems?.updateValueAndValidity({ emitEvent: false });
+    }
+}
@@ -43,10 +43,18 @@ export class RdioScannerAdminConfigComponent implements OnDestroy, OnInit {
         return this.form?.get('access') as UntypedFormArray;
     }
 
+    get alertRules(): UntypedFormArray {
+        return this.form?.get('alertRules') as UntypedFormArray;
+    }
+
     get apiKeys(): UntypedFormArray {
         return this.form?.get('apiKeys') as UntypedFormArray;
     }
 
+    get bucketWatch(): UntypedFormArray {
+        return this.form?.get('bucketWatch') as UntypedFormArray;
+    }
+
     get dirWatch(): UntypedFormArray {
         return this.form?.get('dirWatch') as UntypedFormArray;
     }
@@ -63,6 +71,14 @@ export class RdioScannerAdminConfigComponent implements OnDestroy, OnInit {
         return this.form?.get('options') as UntypedFormGroup;
     }
 
+    get profiles(): UntypedFormArray {
+        return this.form?.get('profiles') as UntypedFormArray;
+    }
+
+    get retentionRules(): UntypedFormArray {
+        return this.form?.get('retentionRules') as UntypedFormArray;
+    }
+
     get systems(): UntypedFormArray {
         return this.form?.get('systems') as UntypedFormArray;
     }
@@ -71,6 +87,10 @@ export class RdioScannerAdminConfigComponent implements OnDestroy, OnInit {
         return this.form?.get('tags') as UntypedFormArray;
     }
 
+    get toneSets(): UntypedFormArray {
+        return this.form?.get('toneSets') as UntypedFormArray;
+    }
+
     private config: Config | undefined;
 
     private eventSubscription = this.adminService.event.subscribe(async (event: AdminEvent) => {
@@ -0,0 +1,105 @@
+/*
+ * *****************************************************************************
+ * Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>
+ * ****************************************************************************
+ */
+
+import { CdkDragDrop, moveItemInArray } from '@angular/cdk/drag-drop';
+import { Component, Input, OnChanges, QueryList, ViewChildren, inject } from '@angular/core';
+import { UntypedFormArray, UntypedFormControl, UntypedFormGroup } from '@angular/forms';
+import { MatExpansionPanel } from '@angular/material/expansion';
+import { RdioScannerAdminService } from '../../admin.service';
+
+@Component({
+    selector: 'rdio-scanner-admin-profiles',
+    templateUrl: './profiles.component.html',
+})
+export class RdioScannerAdminProfilesComponent implements OnChanges {
+    private adminService = inject(RdioScannerAdminService)
+
+    @Input() form: UntypedFormArray | undefined;
+
+    containers: { [codec: string]: { label: string, value: string }[] } = {
+        aac: [{ label: 'M4A', value: 'm4a' }, { label: 'ADTS', value: 'adts' }],
+        mp3: [{ label: 'MP3', value: 'mp3' }],
+        opus: [{ label: 'Ogg', value: 'ogg' }],
+    };
+
+    get profiles(): UntypedFormGroup[] {
+        return this.form?.controls
+            .sort((a, b) => a.value.order - b.value.order) as UntypedFormGroup[];
+    }
+
+    @ViewChildren(MatExpansionPanel) private panels: QueryList<MatExpansionPanel> | undefined;
+
+    ngOnChanges(): void {
+        if (this.form) {
+            this.profiles.forEach((control) => this.registerOnChanges(control));
+        }
+    }
+
+    add(): void {
+        // given an id right away so that the systems and talkgroups can select it before saving
+        const id = this.profiles.reduce((pv, cv) => cv.value._id >= pv ? cv.value._id + 1 : pv, 1);
+
+        const profile = this.adminService.newProfileForm({
+            _id: id,
+            codec: 'opus',
+            container: 'ogg',
+        });
+
+        profile.markAllAsTouched();
+
+        this.registerOnChanges(profile);
+
+        this.form?.insert(0, profile);
+
+        this.form?.markAsDirty();
+    }
+
+    closeAll(): void {
+        this.panels?.forEach((panel) => panel.close());
+    }
+
+    drop(event: CdkDragDrop<UntypedFormGroup[]>): void {
+        if (event.previousIndex !== event.currentIndex) {
+            moveItemInArray(event.container.data, event.previousIndex, event.currentIndex);
+
+            event.container.data.forEach((dat, idx) => dat.get('order')?.setValue(idx + 1, { emitEvent: false }));
+
+            this.form?.markAsDirty();
+        }
+    }
+
+    remove(index: number): void {
+        this.form?.removeAt(index);
+
+        this.form?.markAsDirty();
+    }
+
+    private registerOnChanges(control: UntypedFormGroup): void {
+        const codec = control.get('codec') as UntypedFormControl;
+        const container = control.get('container') as UntypedFormControl;
+
+        codec.valueChanges.subscribe((value) => {
+            const containers = this.containers[value] || [];
+
+            if (!containers.some((c) => c.value === container.value)) {
+                container.setValue(containers[0]?.value ?? null);
+            }
+        });
+    }
+}
@@ -21,7 +21,7 @@ import { CdkDragDrop, moveItemInArray } from '@angular/cdk/drag-drop';
 import { Component, EventEmitter, Input, Output, QueryList, ViewChildren, inject, OnChanges } from '@angular/core';
 import { UntypedFormArray, UntypedFormControl, UntypedFormGroup } from '@angular/forms';
 import { MatExpansionPanel } from '@angular/material/expansion';
-import { RdioScannerAdminService, Group, Tag } from '../../../admin.service';
+import { RdioScannerAdminService, Group, Profile, Tag } from '../../../admin.service';
 
 @Component({
     selector: 'rdio-scanner-admin-system',
@@ -40,10 +40,18 @@ export class RdioScannerAdminSystemComponent implements OnChanges {
 
     @Output() remove = new EventEmitter<void>();
 
+    get audioFilters(): UntypedFormGroup {
+        return this.form.get('audioFilters') as UntypedFormGroup;
+    }
+
     get led(): UntypedFormControl {
         return this.form.get('led') as UntypedFormControl;
     }
 
+    get profiles(): Profile[] {
+        return this.form.root.get('profiles')?.value as Profile[] || [];
+    }
+
     get talkgroups(): UntypedFormGroup[] {
         const talkgroups = this.form.get('talkgroups') as UntypedFormArray;
 
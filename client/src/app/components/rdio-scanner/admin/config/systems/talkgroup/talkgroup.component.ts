@@ -19,7 +19,7 @@
 
 import { Component, EventEmitter, Input, Output, inject } from '@angular/core';
 import { UntypedFormGroup, UntypedFormControl } from '@angular/forms';
-import { RdioScannerAdminService, Group, Tag } from '../../../admin.service';
+import { RdioScannerAdminService, Group, Profile, Tag } from '../../../admin.service';
 
 @Component({
     selector: 'rdio-scanner-admin-talkgroup',
@@ -34,6 +34,10 @@ export class RdioScannerAdminTalkgroupComponent {
 
     @Output() remove = new EventEmitter<void>();
 
+    get audioFilters(): UntypedFormGroup {
+        return this.form?.get('audioFilters') as UntypedFormGroup;
+    }
+
     get led(): UntypedFormControl {
         return this.form?.get('led') as UntypedFormControl;
     }
@@ -42,6 +46,10 @@ export class RdioScannerAdminTalkgroupComponent {
         return this.form?.root.get('groups')?.value as Group[];
     }
 
+    get profiles(): Profile[] {
+        return this.form?.root.get('profiles')?.value as Profile[] || [];
+    }
+
     get tags(): Tag[] {
         return this.form?.root.get('tags')?.value as Tag[];
     }
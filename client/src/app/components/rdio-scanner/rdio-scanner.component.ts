@@ -127,6 +127,16 @@ export class RdioScannerComponent implements OnDestroy {
     }
 
     private eventHandler(event: RdioScannerEvent): void {
+        if (event.alert) {
+            const alert = event.alert;
+
+            this.rdioScannerService.beep();
+
+            this.matSnackBar.open(`${alert.alert.label}: ${alert.alert.matched}`, 'Play', { duration: 10000 })
+                .onAction()
+                .subscribe(() => this.rdioScannerService.loadAndPlay(alert.call));
+        }
+
         if (event.livefeedMode) {
             this.livefeedMode = event.livefeedMode;
         }
@@ -51,6 +51,7 @@ enum WebsocketCallFlag {
 }
 
 enum WebsocketCommand {
+    Alert = 'ALT',
     Call = 'CAL',
     Config = 'CFG',
     Expired = 'XPR',
@@ -59,17 +60,22 @@ enum WebsocketCommand {
     LivefeedMap = 'LFM',
     Max = 'MAX',
     Pin = 'PIN',
+    Tones = 'TON',
+    Transcript = 'TRN',
     Version = 'VER',
 }
 
 @Injectable()
 export class RdioScannerService implements OnDestroy {
+    static LOCAL_STORAGE_KEY_ALERTS = 'rdio-scanner-alerts';
     static LOCAL_STORAGE_KEY_LEGACY = 'rdio-scanner';
     static LOCAL_STORAGE_KEY_LFM = 'rdio-scanner-lfm';
     static LOCAL_STORAGE_KEY_PIN = 'rdio-scanner-pin';
 
     event = new EventEmitter<RdioScannerEvent>();
 
+    private alertRules: number[] = [];
+
     private audioContext: AudioContext | undefined;
 
     private audioSource: AudioBufferSourceNode | undefined;
@@ -122,6 +128,8 @@ export class RdioScannerService implements OnDestroy {
 
         this.initializeInstanceId();
 
+        this.readAlertRules();
+
         this.readLivefeedMap();
 
         this.openWebsocket();
@@ -569,6 +577,16 @@ export class RdioScannerService implements OnDestroy {
         this.sendtoWebsocket(WebsocketCommand.ListCall, options);
     }
 
+    subscribeAlerts(ids: number[]): void {
+        this.alertRules = ids.slice();
+
+        this.saveAlertRules();
+
+        this.sendtoWebsocket(WebsocketCommand.Alert, this.alertRules);
+
+        this.event.emit({ alertRules: this.alertRules.slice() });
+    }
+
     skip(options?: { delay?: boolean }): void {
         const play = () => {
             if (this.livefeedMode === RdioScannerLivefeedMode.Playback) {
@@ -885,6 +903,21 @@ export class RdioScannerService implements OnDestroy {
 
         if (Array.isArray(message)) {
             switch (message[0]) {
+                case WebsocketCommand.Alert:
+                    if (message[1] !== null && typeof message[1] === 'object') {
+                        const alert = message[1];
+
+                        this.event.emit({
+                            alert: {
+                                ...alert,
+                                alert: { ...alert.alert, dateTime: new Date(alert.alert?.dateTime) },
+                                dateTime: new Date(alert.dateTime),
+                            },
+                        });
+                    }
+
+                    break;
+
                 case WebsocketCommand.Call:
                     if (message[1] !== null) {
                         const call: RdioScannerCall = message[1];
@@ -909,6 +942,7 @@ export class RdioScannerService implements OnDestroy {
                     const config = message[1];
 
                     this.config = {
+                        alertRules: Array.isArray(config.alertRules) ? config.alertRules.slice() : [],
                         branding: typeof config.branding === 'string' ? config.branding : '',
                         dimmerDelay: typeof config.dimmerDelay === 'number' ? config.dimmerDelay : 5000,
                         groups: typeof config.groups !== null && typeof config.groups === 'object' ? config.groups : {},
@@ -919,6 +953,7 @@ export class RdioScannerService implements OnDestroy {
                         tags: typeof config.tags !== null && typeof config.tags === 'object' ? config.tags : {},
                         tagsToggle: typeof config.tagsToggle === 'boolean' ? config.tagsToggle : false,
                         time12hFormat: typeof config.time12hFormat === 'boolean' ? config.time12hFormat : false,
+                        toneSets: Array.isArray(config.toneSets) ? config.toneSets.slice() : [],
                     };
 
                     if (typeof config.afs === 'string' && config.afs.length) {
@@ -927,11 +962,20 @@ export class RdioScannerService implements OnDestroy {
 
                     this.rebuildLivefeedMap();
 
+                    if (this.alertRules.length) {
+                        this.alertRules = this.alertRules.filter((id) => this.config.alertRules?.some((alertRule) => alertRule.id === id));
+
+                        this.saveAlertRules();
+
+                        this.sendtoWebsocket(WebsocketCommand.Alert, this.alertRules);
+                    }
+
                     if (this.livefeedMode === RdioScannerLivefeedMode.Online) {
                         this.startLivefeed();
                     }
 
                     this.event.emit({
+                        alertRules: this.alertRules.slice(),
                         auth: false,
                         categories: this.categories,
                         config: this.config,
@@ -978,6 +1022,28 @@ export class RdioScannerService implements OnDestroy {
 
                     break;
 
+                case WebsocketCommand.Tones:
+                    if (message[1] !== null && typeof message[1] === 'object') {
+                        this.event.emit({ tones: { ...message[1], dateTime: new Date(message[1].dateTime) } });
+                    }
+
+                    break;
+
+                case WebsocketCommand.Transcript:
+                    if (message[1] !== null && typeof message[1] === 'object') {
+                        const { call, transcript } = message[1];
+
+                        [this.call, ...this.callQueue].forEach((queued) => {
+                            if (queued?.id === call) {
+                                queued.transcript = transcript;
+                            }
+                        });
+
+                        this.event.emit({ transcript: { call, transcript } });
+                    }
+
+                    break;
+
                 case WebsocketCommand.Version: {
                     const data = message[1];
 
@@ -1062,6 +1128,23 @@ export class RdioScannerService implements OnDestroy {
         }
     }
 
+    private readAlertRules(): void {
+        try {
+            const store = window?.localStorage?.getItem(`${RdioScannerService.LOCAL_STORAGE_KEY_ALERTS}-${this.instanceId}`);
+
+            if (store !== null) {
+                const ids = JSON.parse(store);
+
+                if (Array.isArray(ids)) {
+                    this.alertRules = ids.filter((id) => typeof id === 'number');
+                }
+            }
+
+        } catch (_) {
+            //
+        }
+    }
+
     private readLivefeedMap(): void {
         try {
             let lfm: { [key: number]: { [key: number]: boolean } } = {};
@@ -1162,6 +1245,10 @@ export class RdioScannerService implements OnDestroy {
         this.openWebsocket();
     }
 
+    private saveAlertRules(): void {
+        window?.localStorage?.setItem(`${RdioScannerService.LOCAL_STORAGE_KEY_ALERTS}-${this.instanceId}`, JSON.stringify(this.alertRules));
+    }
+
     private saveLivefeedMap(): void {
         const lfm = Object.keys(this.livefeedMap).reduce((sysMap: { [key: number]: { [key: number]: boolean } }, sys: string) => {
             sysMap[+sys] = Object.keys(this.livefeedMap[+sys]).reduce((tgMap: { [key: number]: boolean }, tg: string) => {
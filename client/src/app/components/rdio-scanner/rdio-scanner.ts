@@ -19,6 +19,29 @@
 
 import { Subscription } from "rxjs";
 
+export interface RdioScannerAlert {
+    alert: {
+        _id?: number;
+        alertRule: number;
+        call: number;
+        dateTime: Date;
+        field: 'talkgroup' | 'transcript' | 'unit';
+        label: string;
+        matched: string;
+        system: number;
+        talkgroup: number;
+    };
+    call: number;
+    dateTime: Date;
+    system: number;
+    talkgroup: number;
+}
+
+export interface RdioScannerAlertRule {
+    id: number;
+    label: string;
+}
+
 export interface RdioScannerAvoidOptions {
     all?: boolean;
     call?: RdioScannerCall;
@@ -59,6 +82,14 @@ export interface RdioScannerCall {
     talkgroup: number;
     talkgroupData?: RdioScannerTalkgroup;
     systemData?: RdioScannerSystem;
+    toneSets?: number[];
+    transcript?: RdioScannerTranscript | null;
+    waveform?: number[] | null;
+}
+
+export interface RdioScannerCallTranscript {
+    call: number;
+    transcript: RdioScannerTranscript;
 }
 
 export interface RdioScannerCallFrequency {
@@ -93,6 +124,7 @@ export enum RdioScannerCategoryType {
 
 export interface RdioScannerConfig {
     afs?: string;
+    alertRules?: RdioScannerAlertRule[];
     branding?: string;
     dimmerDelay: number | false;
     groups: { [key: string]: { [key: number]: number[] } };
@@ -103,9 +135,12 @@ export interface RdioScannerConfig {
     tags: { [key: string]: { [key: number]: number[] } };
     tagsToggle: boolean;
     time12hFormat: boolean;
+    toneSets?: RdioScannerToneSet[];
 }
 
 export interface RdioScannerEvent {
+    alert?: RdioScannerAlert;
+    alertRules?: number[];
     auth?: boolean;
     categories?: RdioScannerCategory[];
     call?: RdioScannerCall;
@@ -122,7 +157,9 @@ export interface RdioScannerEvent {
     playbackPending?: number;
     queue?: number;
     time?: number;
+    tones?: RdioScannerTones;
     tooMany?: boolean;
+    transcript?: RdioScannerCallTranscript;
 }
 
 export interface RdioScannerKeypadBeeps {
@@ -166,6 +203,7 @@ export interface RdioScannerSearchOptions {
     system?: number;
     tag?: string;
     talkgroup?: number;
+    toneSet?: number;
 }
 
 export interface RdioScannerSystem {
@@ -187,6 +225,31 @@ export interface RdioScannerTalkgroup {
     tag: string;
 }
 
+export interface RdioScannerToneSet {
+    id: number;
+    label: string;
+}
+
+export interface RdioScannerTones {
+    call: number;
+    dateTime: Date;
+    system: number;
+    talkgroup: number;
+    toneSets: RdioScannerToneSet[];
+}
+
+export interface RdioScannerTranscript {
+    language?: string;
+    segments?: RdioScannerTranscriptSegment[];
+    text: string;
+}
+
+export interface RdioScannerTranscriptSegment {
+    end: number;
+    start: number;
+    text: string;
+}
+
 export interface RdioScannerUnit {
     id: number;
     label: string;
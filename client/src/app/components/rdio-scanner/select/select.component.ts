@@ -19,6 +19,7 @@
 
 import { Component, OnDestroy, inject } from '@angular/core';
 import {
+    RdioScannerAlertRule,
     RdioScannerAvoidOptions,
     RdioScannerBeepStyle,
     RdioScannerCategory,
@@ -40,6 +41,8 @@ import { RdioScannerService } from '../rdio-scanner.service';
 export class RdioScannerSelectComponent implements OnDestroy {
     private rdioScannerService = inject(RdioScannerService)
 
+    alertRules: RdioScannerAlertRule[] | undefined;
+
     categories: RdioScannerCategory[] | undefined;
 
     map: RdioScannerLivefeedMap = {};
@@ -48,8 +51,20 @@ export class RdioScannerSelectComponent implements OnDestroy {
 
     tagsToggle: boolean | undefined;
 
+    subscribedAlertRules: number[] = [];
+
     private eventSubscription = this.rdioScannerService.event.subscribe((event: RdioScannerEvent) => this.eventHandler(event));
 
+    alert(alertRule: RdioScannerAlertRule): void {
+        const subscribed = this.subscribedAlertRules.includes(alertRule.id);
+
+        this.rdioScannerService.beep(subscribed ? RdioScannerBeepStyle.Deactivate : RdioScannerBeepStyle.Activate);
+
+        this.rdioScannerService.subscribeAlerts(subscribed
+            ? this.subscribedAlertRules.filter((id) => id !== alertRule.id)
+            : this.subscribedAlertRules.concat(alertRule.id));
+    }
+
     avoid(options?: RdioScannerAvoidOptions): void {
         if (options?.all == true) {
             this.rdioScannerService.beep(RdioScannerBeepStyle.Activate);
@@ -84,7 +99,9 @@ export class RdioScannerSelectComponent implements OnDestroy {
     }
 
     private eventHandler(event: RdioScannerEvent): void {
+        if (event.alertRules) this.subscribedAlertRules = event.alertRules;
         if (event.config) {
+            this.alertRules = event.config.alertRules;
             this.tagsToggle = event.config.tagsToggle;
             this.systems = event.config.systems;
         }
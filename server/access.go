@@ -19,7 +19,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 )
@@ -225,11 +224,7 @@ func (accesses *Accesses) Read(db *Database) error {
 		return fmt.Errorf("accesses.read: %v", err)
 	}
 
-	query := "select `_id`, `code`, `expiration`, `ident`, `limit`, `order`, `systems` from `rdioScannerAccesses`"
-	if db.Config.DbType == DbTypePostgresql {
-		query = "select _id, code, expiration, ident, \"limit\", \"order\", systems from rdioScannerAccesses"
-	}
-	if rows, err = db.Sql.Query(query); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `code`, `expiration`, `ident`, `limit`, `order`, `systems` from `rdioScannerAccesses`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -301,7 +296,7 @@ func (accesses *Accesses) Write(db *Database) error {
 		count   uint
 		err     error
 		rows    *sql.Rows
-		rowIds  = []uint{}
+		rowIds  = []any{}
 		systems any
 	)
 
@@ -312,11 +307,7 @@ func (accesses *Accesses) Write(db *Database) error {
 		return fmt.Errorf("accesses.write: %v", err)
 	}
 
-	query := "select `_id` from `rdioScannerAccesses`"
-	if db.Config.DbType == DbTypePostgresql {
-		query = "select _id from rdioScannerAccesses"
-	}
-	if rows, err = db.Sql.Query(query); err != nil {
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerAccesses`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -344,17 +335,8 @@ func (accesses *Accesses) Write(db *Database) error {
 	}
 
 	if len(rowIds) > 0 {
-		if b, err := json.Marshal(rowIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerAccesses` where `_id` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerAccesses where _id in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerAccesses` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
@@ -366,37 +348,30 @@ func (accesses *Accesses) Write(db *Database) error {
 			systems = access.Systems
 		}
 
-		q := "select count(*) from `rdioScannerAccesses` where `_id` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerAccesses where _id = $1"
-		}
-		if err = db.Sql.QueryRow(q, access.Id).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerAccesses` where `_id` = ?", access.Id).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerAccesses (code, expiration, ident, \"limit\", \"order\", systems) values ($1, $2, $3, $4, $5, $6)"
-				if _, err = db.Sql.Exec(q, access.Code, access.Expiration, access.Ident, access.Limit, access.Order, systems); err != nil {
-					break
-				}
-			} else {
-				q = "insert into `rdioScannerAccesses` (`_id`, `code`, `expiration`, `ident`, `limit`, `order`, `systems`) values (?, ?, ?, ?, ?, ?, ?)"
-				if _, err = db.Sql.Exec(q, access.Id, access.Code, access.Expiration, access.Ident, access.Limit, access.Order, systems); err != nil {
-					break
-				}
+			query := db.NewQuery("insert into `rdioScannerAccesses` (`code`, `expiration`, `ident`, `limit`, `order`, `systems`", access.Code, access.Expiration, access.Ident, access.Limit, access.Order, systems)
+			if access.Id != nil {
+				query.Append(", `_id`", access.Id)
 			}
-		} else {
-			q := "update `rdioScannerAccesses` set `_id` = ?, `code` = ?, `expiration` = ?, `ident` = ?, `limit` = ?, `order` = ?, `systems` = ? where `_id` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerAccesses set _id = $1, code = $2, expiration = $3, ident = $4, \"limit\" = $5, \"order\" = $6, systems = $7 where _id = $8"
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
 			}
-			if _, err = db.Sql.Exec(q, access.Id, access.Code, access.Expiration, access.Ident, access.Limit, access.Order, systems, access.Id); err != nil {
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerAccesses` set `_id` = ?, `code` = ?, `expiration` = ?, `ident` = ?, `limit` = ?, `order` = ?, `systems` = ? where `_id` = ?", access.Id, access.Code, access.Expiration, access.Ident, access.Limit, access.Order, systems, access.Id).Exec(); err != nil {
 				break
 			}
 		}
 	}
 
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerAccesses"))
+	}
+
 	if err != nil {
 		return formatError(err)
 	}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -67,6 +69,78 @@ func NewAdmin(controller *Controller) *Admin {
 	}
 }
 
+func (admin *Admin) AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	t := admin.GetAuthorization(r)
+	if !admin.ValidateToken(t) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		m := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		searchOptions := NewAlertsSearchOptions().FromMap(m)
+
+		r, err := admin.Controller.Alerts.Search(searchOptions, admin.Controller.Database)
+		if err != nil {
+			admin.Controller.Logs.LogEvent(LogLevelError, err.Error())
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		b, err := json.Marshal(r)
+		if err != nil {
+			admin.Controller.Logs.LogEvent(LogLevelError, err.Error())
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		w.Write(b)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (admin *Admin) AudioMigrateHandler(w http.ResponseWriter, r *http.Request) {
+	t := admin.GetAuthorization(r)
+	if !admin.ValidateToken(t) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		count, err := admin.Controller.MigrateAudio()
+		if errors.Is(err, ErrAudioMigrateRunning) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		} else if err != nil {
+			admin.Controller.Logs.LogEvent(LogLevelError, err.Error())
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		b, err := json.Marshal(map[string]any{"count": count, "store": admin.Controller.Database.AudioStore.Type})
+		if err != nil {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		// the audio is moved in the background
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(b)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (admin *Admin) BroadcastConfig() {
 	if b, err := json.Marshal(admin.GetConfig()); err == nil {
 		for conn := range admin.Conns {
@@ -75,6 +149,169 @@ func (admin *Admin) BroadcastConfig() {
 	}
 }
 
+func (admin *Admin) CallOriginalHandler(w http.ResponseWriter, r *http.Request) {
+	t := admin.GetAuthorization(r)
+	if !admin.ValidateToken(t) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		audio, audioName, audioType, err := admin.Controller.Calls.GetOriginalAudio(uint(id), admin.Controller.Database)
+		if err != nil || len(audio) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if len(audioName) == 0 {
+			audioName = fmt.Sprintf("%d", id)
+		}
+
+		if len(audioType) == 0 {
+			audioType = "application/octet-stream"
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(audioName)))
+		w.Header().Set("Content-Type", audioType)
+		w.Write(audio)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (admin *Admin) CallTranscodeHandler(w http.ResponseWriter, r *http.Request) {
+	t := admin.GetAuthorization(r)
+	if !admin.ValidateToken(t) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var (
+			from    time.Time
+			profile *Profile
+			systems = []uint{}
+			to      time.Time
+		)
+
+		m := map[string]any{}
+		err := json.NewDecoder(r.Body).Decode(&m)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch v := m["from"].(type) {
+		case string:
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch v := m["to"].(type) {
+		case string:
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch v := m["systems"].(type) {
+		case []any:
+			for _, s := range v {
+				switch s := s.(type) {
+				case float64:
+					systems = append(systems, uint(s))
+				}
+			}
+		}
+
+		switch v := m["profile"].(type) {
+		case float64:
+			p, ok := admin.Controller.Profiles.GetProfile(uint(v))
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			profile = p
+		case string:
+			p, ok := admin.Controller.Profiles.GetProfile(v)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			profile = p
+		}
+
+		count, err := admin.Controller.TranscodeCalls(from, to, systems, profile)
+		if errors.Is(err, ErrTranscodeRunning) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		} else if err != nil {
+			admin.Controller.Logs.LogEvent(LogLevelError, err.Error())
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		b, err := json.Marshal(map[string]any{"count": count})
+		if err != nil {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		// the calls are transcoded in the background
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(b)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (admin *Admin) CallsReindexHandler(w http.ResponseWriter, r *http.Request) {
+	t := admin.GetAuthorization(r)
+	if !admin.ValidateToken(t) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		count, err := admin.Controller.ReindexCalls()
+		if errors.Is(err, ErrReindexRunning) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		} else if err != nil {
+			admin.Controller.Logs.LogEvent(LogLevelError, err.Error())
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		b, err := json.Marshal(map[string]any{"count": count})
+		if err != nil {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		// the calls are reindexed in the background
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(b)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (admin *Admin) ChangePassword(currentPassword any, newPassword string) error {
 	var (
 		err  error
@@ -112,6 +349,40 @@ func (admin *Admin) ChangePassword(currentPassword any, newPassword string) erro
 	return nil
 }
 
+// checkTimeZones returns an error for the first time zone of the config which
+// is unknown to the server.
+func checkTimeZones(m map[string]any) error {
+	check := func(f any) error {
+		if _, err := loadLocation(f); err != nil {
+			return fmt.Errorf("invalid time zone %v", f)
+		}
+		return nil
+	}
+
+	switch v := m["options"].(type) {
+	case map[string]any:
+		if err := check(v["timeZone"]); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range []string{"apiKeys", "bucketWatch", "dirWatch"} {
+		switch v := m[key].(type) {
+		case []any:
+			for _, f := range v {
+				switch v := f.(type) {
+				case map[string]any:
+					if err := check(v["timeZone"]); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func (admin *Admin) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 	if strings.EqualFold(r.Header.Get("upgrade"), "websocket") {
 		upgrader := websocket.Upgrader{}
@@ -165,9 +436,16 @@ func (admin *Admin) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			if err = checkTimeZones(m); err != nil {
+				logError(err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
 			admin.mutex.Lock()
 			defer admin.mutex.Unlock()
 
+			admin.Controller.Bucketwatches.Stop()
 			admin.Controller.Dirwatches.Stop()
 
 			switch v := m["access"].(type) {
@@ -184,6 +462,20 @@ func (admin *Admin) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			switch v := m["alertRules"].(type) {
+			case []any:
+				admin.Controller.AlertRules.FromMap(v)
+				err = admin.Controller.AlertRules.Write(admin.Controller.Database)
+				if err != nil {
+					logError(err)
+				} else {
+					err = admin.Controller.AlertRules.Read(admin.Controller.Database)
+					if err != nil {
+						logError(err)
+					}
+				}
+			}
+
 			switch v := m["apiKeys"].(type) {
 			case []any:
 				admin.Controller.Apikeys.FromMap(v)
@@ -198,6 +490,21 @@ func (admin *Admin) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			switch v := m["bucketWatch"].(type) {
+			case []any:
+				admin.Controller.Bucketwatches.FromMap(v)
+				err = admin.Controller.Bucketwatches.Write(admin.Controller.Database)
+				if err != nil {
+					logError(err)
+				}
+			}
+
+			// reloaded even when the config has no bucket watches, as stopping them emptied the list
+			err = admin.Controller.Bucketwatches.Read(admin.Controller.Database)
+			if err != nil {
+				logError(err)
+			}
+
 			switch v := m["dirWatch"].(type) {
 			case []any:
 				admin.Controller.Dirwatches.FromMap(v)
@@ -247,6 +554,35 @@ func (admin *Admin) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 				if err != nil {
 					logError(err)
 				}
+				admin.Controller.FFMpeg.SetLimits(admin.Controller.Options.FFMpegWorkers, time.Duration(admin.Controller.Options.FFMpegTimeout)*time.Second)
+			}
+
+			switch v := m["profiles"].(type) {
+			case []any:
+				admin.Controller.Profiles.FromMap(v)
+				err = admin.Controller.Profiles.Write(admin.Controller.Database)
+				if err != nil {
+					logError(err)
+				} else {
+					err = admin.Controller.Profiles.Read(admin.Controller.Database)
+					if err != nil {
+						logError(err)
+					}
+				}
+			}
+
+			switch v := m["retentionRules"].(type) {
+			case []any:
+				admin.Controller.RetentionRules.FromMap(v)
+				err = admin.Controller.RetentionRules.Write(admin.Controller.Database)
+				if err != nil {
+					logError(err)
+				} else {
+					err = admin.Controller.RetentionRules.Read(admin.Controller.Database)
+					if err != nil {
+						logError(err)
+					}
+				}
 			}
 
 			switch v := m["systems"].(type) {
@@ -277,7 +613,22 @@ func (admin *Admin) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			switch v := m["toneSets"].(type) {
+			case []any:
+				admin.Controller.ToneSets.FromMap(v)
+				err = admin.Controller.ToneSets.Write(admin.Controller.Database)
+				if err != nil {
+					logError(err)
+				} else {
+					err = admin.Controller.ToneSets.Read(admin.Controller.Database)
+					if err != nil {
+						logError(err)
+					}
+				}
+			}
+
 			admin.Controller.EmitConfig()
+			admin.Controller.Bucketwatches.Start(admin.Controller)
 			admin.Controller.Dirwatches.Start(admin.Controller)
 
 			admin.SendConfig(w)
@@ -298,27 +649,36 @@ func (admin *Admin) GetConfig() map[string]any {
 	systems := []map[string]any{}
 	for _, system := range admin.Controller.Systems.List {
 		systems = append(systems, map[string]any{
-			"_id":          system.RowId,
-			"autoPopulate": system.AutoPopulate,
-			"blacklists":   system.Blacklists,
-			"id":           system.Id,
-			"label":        system.Label,
-			"led":          system.Led,
-			"order":        system.Order,
-			"talkgroups":   system.Talkgroups.List,
-			"units":        system.Units.List,
+			"_id":              system.RowId,
+			"audioFilters":     system.AudioFilters,
+			"autoPopulate":     system.AutoPopulate,
+			"blacklists":       system.Blacklists,
+			"id":               system.Id,
+			"label":            system.Label,
+			"led":              system.Led,
+			"minVoiceDuration": system.MinVoiceDuration,
+			"order":            system.Order,
+			"profileId":        system.ProfileId,
+			"talkgroups":       system.Talkgroups.List,
+			"trimSilence":      system.TrimSilence,
+			"units":            system.Units.List,
 		})
 	}
 
 	return map[string]any{
-		"access":      admin.Controller.Accesses.List,
-		"apiKeys":     admin.Controller.Apikeys.List,
-		"dirWatch":    admin.Controller.Dirwatches.List,
-		"downstreams": admin.Controller.Downstreams.List,
-		"groups":      admin.Controller.Groups.List,
-		"options":     admin.Controller.Options,
-		"systems":     systems,
-		"tags":        admin.Controller.Tags.List,
+		"access":         admin.Controller.Accesses.List,
+		"alertRules":     admin.Controller.AlertRules.List,
+		"apiKeys":        admin.Controller.Apikeys.List,
+		"bucketWatch":    admin.Controller.Bucketwatches.List,
+		"dirWatch":       admin.Controller.Dirwatches.List,
+		"downstreams":    admin.Controller.Downstreams.List,
+		"groups":         admin.Controller.Groups.List,
+		"options":        admin.Controller.Options,
+		"profiles":       admin.Controller.Profiles.List,
+		"retentionRules": admin.Controller.RetentionRules.List,
+		"systems":        systems,
+		"tags":           admin.Controller.Tags.List,
+		"toneSets":       admin.Controller.ToneSets.List,
 	}
 }
 
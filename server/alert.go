@@ -0,0 +1,790 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	AlertFieldTalkgroup  = "talkgroup"
+	AlertFieldTranscript = "transcript"
+	AlertFieldUnit       = "unit"
+)
+
+// AlertRule matches a keyword, or a regular expression, against the metadata
+// and the transcript of the calls within its scope of systems, groups or tags.
+type AlertRule struct {
+	Id              any    `json:"_id"`
+	Disabled        bool   `json:"disabled"`
+	Groups          any    `json:"groups"`
+	Label           string `json:"label"`
+	MatchTalkgroup  bool   `json:"matchTalkgroup"`
+	MatchTranscript bool   `json:"matchTranscript"`
+	MatchUnits      bool   `json:"matchUnits"`
+	Order           any    `json:"order"`
+	Pattern         string `json:"pattern"`
+	Regex           bool   `json:"regex"`
+	Systems         any    `json:"systems"`
+	Tags            any    `json:"tags"`
+	Webhook         any    `json:"webhook"`
+	regexp          *regexp.Regexp
+}
+
+func NewAlertRule() *AlertRule {
+	return &AlertRule{
+		Groups:  []any{},
+		Systems: []any{},
+		Tags:    []any{},
+	}
+}
+
+func (alertRule *AlertRule) FromMap(m map[string]any) *AlertRule {
+	switch v := m["_id"].(type) {
+	case float64:
+		alertRule.Id = uint(v)
+	}
+
+	switch v := m["disabled"].(type) {
+	case bool:
+		alertRule.Disabled = v
+	}
+
+	switch v := m["groups"].(type) {
+	case []any:
+		alertRule.Groups = v
+	}
+
+	switch v := m["label"].(type) {
+	case string:
+		alertRule.Label = v
+	}
+
+	switch v := m["matchTalkgroup"].(type) {
+	case bool:
+		alertRule.MatchTalkgroup = v
+	}
+
+	switch v := m["matchTranscript"].(type) {
+	case bool:
+		alertRule.MatchTranscript = v
+	}
+
+	switch v := m["matchUnits"].(type) {
+	case bool:
+		alertRule.MatchUnits = v
+	}
+
+	switch v := m["order"].(type) {
+	case float64:
+		alertRule.Order = uint(v)
+	}
+
+	switch v := m["pattern"].(type) {
+	case string:
+		alertRule.Pattern = v
+	}
+
+	switch v := m["regex"].(type) {
+	case bool:
+		alertRule.Regex = v
+	}
+
+	switch v := m["systems"].(type) {
+	case []any:
+		alertRule.Systems = v
+	case string:
+		alertRule.Systems = v
+	}
+
+	switch v := m["tags"].(type) {
+	case []any:
+		alertRule.Tags = v
+	}
+
+	switch v := m["webhook"].(type) {
+	case string:
+		if len(v) > 0 {
+			alertRule.Webhook = v
+		}
+	}
+
+	return alertRule
+}
+
+// HasScope tells whether the call talkgroup is within the systems, the groups
+// or the tags of the rule.
+func (alertRule *AlertRule) HasScope(call *Call, talkgroup *Talkgroup) bool {
+	switch v := alertRule.Systems.(type) {
+	case []any:
+		for _, f := range v {
+			switch v := f.(type) {
+			case map[string]any:
+				switch id := v["id"].(type) {
+				case float64:
+					if id == float64(call.System) {
+						switch tg := v["talkgroups"].(type) {
+						case string:
+							if tg == "*" {
+								return true
+							}
+						case []any:
+							for _, f := range tg {
+								switch tg := f.(type) {
+								case float64:
+									if tg == float64(call.Talkgroup) {
+										return true
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+
+	case string:
+		if v == "*" {
+			return true
+		}
+	}
+
+	if talkgroup == nil {
+		return false
+	}
+
+	switch v := alertRule.Groups.(type) {
+	case []any:
+		for _, f := range v {
+			if id, ok := f.(float64); ok && id == float64(talkgroup.GroupId) {
+				return true
+			}
+		}
+	}
+
+	switch v := alertRule.Tags.(type) {
+	case []any:
+		for _, f := range v {
+			if id, ok := f.(float64); ok && id == float64(talkgroup.TagId) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Match returns the first part of the text matching the rule. Keywords match
+// whole words regardless of case.
+func (alertRule *AlertRule) Match(text string) (string, bool) {
+	if alertRule.regexp == nil {
+		return "", false
+	}
+
+	if m := alertRule.regexp.FindString(text); len(m) > 0 {
+		return m, true
+	}
+
+	return "", false
+}
+
+func (alertRule *AlertRule) compile() error {
+	alertRule.regexp = nil
+
+	if len(alertRule.Pattern) == 0 {
+		return nil
+	}
+
+	pattern := alertRule.Pattern
+	if !alertRule.Regex {
+		pattern = fmt.Sprintf(`(?i)\b%s\b`, regexp.QuoteMeta(pattern))
+	}
+
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("alert rule %v: %v", alertRule.Label, err)
+	}
+
+	alertRule.regexp = r
+
+	return nil
+}
+
+type AlertRules struct {
+	List  []*AlertRule
+	mutex sync.Mutex
+}
+
+func NewAlertRules() *AlertRules {
+	return &AlertRules{
+		List:  []*AlertRule{},
+		mutex: sync.Mutex{},
+	}
+}
+
+func (alertRules *AlertRules) FromMap(f []any) *AlertRules {
+	alertRules.mutex.Lock()
+	defer alertRules.mutex.Unlock()
+
+	alertRules.List = []*AlertRule{}
+
+	for _, r := range f {
+		switch m := r.(type) {
+		case map[string]any:
+			alertRule := NewAlertRule().FromMap(m)
+			alertRules.List = append(alertRules.List, alertRule)
+		}
+	}
+
+	return alertRules
+}
+
+// GetAlertRulesList returns the identifiers and labels of the enabled rules,
+// for the clients to subscribe to them.
+func (alertRules *AlertRules) GetAlertRulesList() []map[string]any {
+	alertRules.mutex.Lock()
+	defer alertRules.mutex.Unlock()
+
+	list := []map[string]any{}
+	for _, alertRule := range alertRules.List {
+		if !alertRule.Disabled {
+			list = append(list, map[string]any{"id": alertRule.Id, "label": alertRule.Label})
+		}
+	}
+
+	return list
+}
+
+func (alertRules *AlertRules) Read(db *Database) error {
+	var (
+		err     error
+		groups  string
+		id      sql.NullFloat64
+		order   sql.NullFloat64
+		rows    *sql.Rows
+		systems string
+		tags    string
+		webhook sql.NullString
+	)
+
+	alertRules.mutex.Lock()
+	defer alertRules.mutex.Unlock()
+
+	alertRules.List = []*AlertRule{}
+
+	formatError := func(err error) error {
+		return fmt.Errorf("alertrules.read: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id`, `disabled`, `groups`, `label`, `matchTalkgroup`, `matchTranscript`, `matchUnits`, `order`, `pattern`, `regex`, `systems`, `tags`, `webhook` from `rdioScannerAlertRules`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		alertRule := NewAlertRule()
+
+		if err = rows.Scan(&id, &alertRule.Disabled, &groups, &alertRule.Label, &alertRule.MatchTalkgroup, &alertRule.MatchTranscript, &alertRule.MatchUnits, &order, &alertRule.Pattern, &alertRule.Regex, &systems, &tags, &webhook); err != nil {
+			break
+		}
+
+		if id.Valid && id.Float64 > 0 {
+			alertRule.Id = uint(id.Float64)
+		}
+
+		if err := json.Unmarshal([]byte(groups), &alertRule.Groups); err != nil {
+			alertRule.Groups = []any{}
+		}
+
+		if order.Valid && order.Float64 > 0 {
+			alertRule.Order = uint(order.Float64)
+		}
+
+		if err := json.Unmarshal([]byte(systems), &alertRule.Systems); err != nil {
+			alertRule.Systems = []any{}
+		}
+
+		if err := json.Unmarshal([]byte(tags), &alertRule.Tags); err != nil {
+			alertRule.Tags = []any{}
+		}
+
+		if webhook.Valid && len(webhook.String) > 0 {
+			alertRule.Webhook = webhook.String
+		}
+
+		// patterns are validated on write, an invalid one simply never matches
+		alertRule.compile()
+
+		alertRules.List = append(alertRules.List, alertRule)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+func (alertRules *AlertRules) Write(db *Database) error {
+	var (
+		count   uint
+		err     error
+		groups  string
+		rows    *sql.Rows
+		rowIds  = []any{}
+		systems any
+		tags    string
+	)
+
+	alertRules.mutex.Lock()
+	defer alertRules.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("alertrules.write: %v", err)
+	}
+
+	for _, alertRule := range alertRules.List {
+		if err = alertRule.compile(); err != nil {
+			return formatError(err)
+		}
+	}
+
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerAlertRules`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		var rowId uint
+		if err = rows.Scan(&rowId); err != nil {
+			break
+		}
+		remove := true
+		for _, alertRule := range alertRules.List {
+			if alertRule.Id == nil || alertRule.Id == rowId {
+				remove = false
+				break
+			}
+		}
+		if remove {
+			rowIds = append(rowIds, rowId)
+		}
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	if len(rowIds) > 0 {
+		if _, err = db.NewQuery("delete from `rdioScannerAlertRules` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
+		}
+	}
+
+	marshal := func(f any) string {
+		switch v := f.(type) {
+		case string:
+			return v
+		}
+		if b, err := json.Marshal(f); err == nil {
+			return string(b)
+		}
+		return "[]"
+	}
+
+	for _, alertRule := range alertRules.List {
+		groups = marshal(alertRule.Groups)
+		tags = marshal(alertRule.Tags)
+
+		switch v := alertRule.Systems.(type) {
+		case []any:
+			if b, err := json.Marshal(v); err == nil {
+				systems = string(b)
+			} else {
+				systems = "[]"
+			}
+		case string:
+			if v == "*" {
+				systems = `"*"`
+			} else {
+				systems = v
+			}
+		default:
+			systems = "[]"
+		}
+
+		if err = db.NewQuery("select count(*) from `rdioScannerAlertRules` where `_id` = ?", alertRule.Id).QueryRow().Scan(&count); err != nil {
+			break
+		}
+
+		if count == 0 {
+			query := db.NewQuery("insert into `rdioScannerAlertRules` (`disabled`, `groups`, `label`, `matchTalkgroup`, `matchTranscript`, `matchUnits`, `order`, `pattern`, `regex`, `systems`, `tags`, `webhook`", alertRule.Disabled, groups, alertRule.Label, alertRule.MatchTalkgroup, alertRule.MatchTranscript, alertRule.MatchUnits, alertRule.Order, alertRule.Pattern, alertRule.Regex, systems, tags, alertRule.Webhook)
+			if alertRule.Id != nil {
+				query.Append(", `_id`", alertRule.Id)
+			}
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
+			}
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerAlertRules` set `_id` = ?, `disabled` = ?, `groups` = ?, `label` = ?, `matchTalkgroup` = ?, `matchTranscript` = ?, `matchUnits` = ?, `order` = ?, `pattern` = ?, `regex` = ?, `systems` = ?, `tags` = ?, `webhook` = ? where `_id` = ?", alertRule.Id, alertRule.Disabled, groups, alertRule.Label, alertRule.MatchTalkgroup, alertRule.MatchTranscript, alertRule.MatchUnits, alertRule.Order, alertRule.Pattern, alertRule.Regex, systems, tags, alertRule.Webhook, alertRule.Id).Exec(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerAlertRules"))
+	}
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+// Alert is the record of a rule matching a call.
+type Alert struct {
+	Id        any       `json:"_id"`
+	AlertRule uint      `json:"alertRule"`
+	Call      uint      `json:"call"`
+	DateTime  time.Time `json:"dateTime"`
+	Field     string    `json:"field"`
+	Label     string    `json:"label"`
+	Matched   string    `json:"matched"`
+	System    uint      `json:"system"`
+	Talkgroup uint      `json:"talkgroup"`
+}
+
+type Alerts struct {
+	controller *Controller
+	mutex      sync.Mutex
+}
+
+func NewAlerts(controller *Controller) *Alerts {
+	return &Alerts{
+		controller: controller,
+		mutex:      sync.Mutex{},
+	}
+}
+
+// Check matches the given texts of the call, keyed by field, against the
+// enabled rules in scope. Each rule raises at most one alert per field.
+func (alerts *Alerts) Check(call *Call, texts map[string][]string) {
+	var talkgroup *Talkgroup
+
+	controller := alerts.controller
+
+	if system, ok := controller.Systems.GetSystem(call.System); ok {
+		talkgroup, _ = system.Talkgroups.GetTalkgroup(call.Talkgroup)
+	}
+
+	controller.AlertRules.mutex.Lock()
+	rules := append([]*AlertRule{}, controller.AlertRules.List...)
+	controller.AlertRules.mutex.Unlock()
+
+	for _, alertRule := range rules {
+		if alertRule.Disabled || !alertRule.HasScope(call, talkgroup) {
+			continue
+		}
+
+		for field, list := range texts {
+			if (field == AlertFieldTalkgroup && !alertRule.MatchTalkgroup) ||
+				(field == AlertFieldTranscript && !alertRule.MatchTranscript) ||
+				(field == AlertFieldUnit && !alertRule.MatchUnits) {
+				continue
+			}
+
+			for _, text := range list {
+				if matched, ok := alertRule.Match(text); ok {
+					alerts.raise(call, alertRule, field, matched)
+					break
+				}
+			}
+		}
+	}
+}
+
+func (alerts *Alerts) Search(searchOptions *AlertsSearchOptions, db *Database) (*AlertsSearchResults, error) {
+	var (
+		alertRule sql.NullFloat64
+		dateTime  any
+		err       error
+		id        sql.NullFloat64
+		limit     uint
+		offset    uint
+		rows      *sql.Rows
+	)
+
+	alerts.mutex.Lock()
+	defer alerts.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("alerts.search: %v", err)
+	}
+
+	searchResults := &AlertsSearchResults{
+		Alerts:  []Alert{},
+		Options: searchOptions,
+	}
+
+	where := db.NewQuery("true")
+
+	switch v := searchOptions.AlertRule.(type) {
+	case uint:
+		where.Append(" and `alertRuleId` = ?", v)
+	}
+
+	switch v := searchOptions.Limit.(type) {
+	case uint:
+		limit = uint(math.Min(float64(500), float64(v)))
+	default:
+		limit = 200
+	}
+
+	switch v := searchOptions.Offset.(type) {
+	case uint:
+		offset = v
+	}
+
+	query := db.NewQuery("select count(*) from `rdioScannerAlerts` where ").AppendQuery(where)
+	if err = query.QueryRow().Scan(&searchResults.Count); err != nil && err != sql.ErrNoRows {
+		return nil, formatError(fmt.Errorf("%v, %v", err, query.String()))
+	}
+
+	query = db.NewQuery("select `_id`, `alertRuleId`, `callId`, `dateTime`, `field`, `label`, `matched`, `system`, `talkgroup` from `rdioScannerAlerts` where ").AppendQuery(where)
+	query.Append(" order by `dateTime` desc limit ? offset ?", limit, offset)
+	if rows, err = query.Query(); err != nil {
+		return nil, formatError(fmt.Errorf("%v, %v", err, query.String()))
+	}
+
+	for rows.Next() {
+		alert := Alert{}
+
+		if err = rows.Scan(&id, &alertRule, &alert.Call, &dateTime, &alert.Field, &alert.Label, &alert.Matched, &alert.System, &alert.Talkgroup); err != nil {
+			break
+		}
+
+		if id.Valid && id.Float64 > 0 {
+			alert.Id = uint(id.Float64)
+		}
+
+		if alertRule.Valid && alertRule.Float64 > 0 {
+			alert.AlertRule = uint(alertRule.Float64)
+		}
+
+		if t, err := db.ParseDateTime(dateTime); err == nil {
+			alert.DateTime = t
+		} else {
+			continue
+		}
+
+		searchResults.Alerts = append(searchResults.Alerts, alert)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	return searchResults, nil
+}
+
+func (alerts *Alerts) raise(call *Call, alertRule *AlertRule, field string, matched string) {
+	var (
+		callId uint
+		ruleId uint
+	)
+
+	controller := alerts.controller
+
+	switch v := call.Id.(type) {
+	case uint:
+		callId = v
+	}
+
+	switch v := alertRule.Id.(type) {
+	case uint:
+		ruleId = v
+	}
+
+	alert := &Alert{
+		AlertRule: ruleId,
+		Call:      callId,
+		DateTime:  time.Now().UTC(),
+		Field:     field,
+		Label:     alertRule.Label,
+		Matched:   matched,
+		System:    call.System,
+		Talkgroup: call.Talkgroup,
+	}
+
+	if err := alerts.write(alert); err != nil {
+		controller.Logs.LogEvent(LogLevelError, err.Error())
+	}
+
+	controller.logCall(call, LogLevelInfo, fmt.Sprintf("alert %v raised on %v by %q", alertRule.Label, field, matched))
+
+	controller.Clients.EmitAlert(call, alert, controller.Accesses.IsRestricted())
+
+	switch v := alertRule.Webhook.(type) {
+	case string:
+		go func() {
+			if err := alerts.sendWebhook(v, call, alert); err != nil {
+				controller.Logs.LogEvent(LogLevelError, err.Error())
+			}
+		}()
+	}
+}
+
+func (alerts *Alerts) sendWebhook(url string, call *Call, alert *Alert) error {
+	formatError := func(err error) error {
+		return fmt.Errorf("alerts.sendwebhook: %v to %v", err, url)
+	}
+
+	b, err := json.Marshal(map[string]any{
+		"alert":          alert,
+		"dateTime":       call.DateTime.Format(time.RFC3339),
+		"systemLabel":    call.systemLabel,
+		"talkgroupLabel": call.talkgroupLabel,
+		"talkgroupName":  call.talkgroupName,
+		"transcript":     call.Transcript,
+	})
+	if err != nil {
+		return formatError(err)
+	}
+
+	c := http.Client{Timeout: 10 * time.Second}
+
+	res, err := c.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return formatError(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return formatError(fmt.Errorf("bad status: %s", res.Status))
+	}
+
+	return nil
+}
+
+func (alerts *Alerts) write(alert *Alert) error {
+	var (
+		db  = alerts.controller.Database
+		err error
+		id  uint
+	)
+
+	alerts.mutex.Lock()
+	defer alerts.mutex.Unlock()
+
+	query := db.NewQuery("insert into `rdioScannerAlerts` (`alertRuleId`, `callId`, `dateTime`, `field`, `label`, `matched`, `system`, `talkgroup`) values (?, ?, ?, ?, ?, ?, ?, ?)", alert.AlertRule, alert.Call, alert.DateTime, alert.Field, alert.Label, alert.Matched, alert.System, alert.Talkgroup)
+	if id, err = query.ExecInsert("_id"); err != nil {
+		return fmt.Errorf("alerts.write: %v", err)
+	}
+
+	alert.Id = id
+
+	return nil
+}
+
+type AlertsSearchOptions struct {
+	AlertRule any `json:"alertRule,omitempty"`
+	Limit     any `json:"limit,omitempty"`
+	Offset    any `json:"offset,omitempty"`
+}
+
+func NewAlertsSearchOptions() *AlertsSearchOptions {
+	return &AlertsSearchOptions{}
+}
+
+func (searchOptions *AlertsSearchOptions) FromMap(m map[string]any) *AlertsSearchOptions {
+	switch v := m["alertRule"].(type) {
+	case float64:
+		searchOptions.AlertRule = uint(v)
+	}
+
+	switch v := m["limit"].(type) {
+	case float64:
+		searchOptions.Limit = uint(v)
+	}
+
+	switch v := m["offset"].(type) {
+	case float64:
+		searchOptions.Offset = uint(v)
+	}
+
+	return searchOptions
+}
+
+type AlertsSearchResults struct {
+	Alerts  []Alert              `json:"alerts"`
+	Count   uint                 `json:"count"`
+	Options *AlertsSearchOptions `json:"options"`
+}
+
+// GetCallUnitLabels returns the labels of the units which transmitted in the
+// call, as known by its system.
+func GetCallUnitLabels(call *Call, system *System) []string {
+	labels := []string{}
+
+	add := func(f any) {
+		var id uint
+
+		switch v := f.(type) {
+		case float64:
+			id = uint(v)
+		case int:
+			id = uint(v)
+		case uint:
+			id = v
+		default:
+			return
+		}
+
+		if label, ok := system.Units.GetLabel(id); ok {
+			labels = append(labels, label)
+		}
+	}
+
+	switch v := call.Sources.(type) {
+	case []map[string]any:
+		for _, source := range v {
+			add(source["src"])
+		}
+	case []any:
+		for _, f := range v {
+			if source, ok := f.(map[string]any); ok {
+				add(source["src"])
+			}
+		}
+	}
+
+	return labels
+}
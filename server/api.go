@@ -16,12 +16,16 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"path"
 	"strings"
+	"time"
 )
 
 type Api struct {
@@ -53,6 +57,9 @@ func (api *Api) CallUploadHandler(w http.ResponseWriter, r *http.Request) {
 
 		mr := multipart.NewReader(r.Body, params["boundary"])
 
+		parts := []*multipart.Part{}
+		bodies := [][]byte{}
+
 		for {
 			p, err := mr.NextPart()
 			if err == io.EOF {
@@ -72,10 +79,17 @@ func (api *Api) CallUploadHandler(w http.ResponseWriter, r *http.Request) {
 			case "key":
 				key = string(b)
 			default:
-				ParseMultipartContent(call, p, b)
+				parts = append(parts, p)
+				bodies = append(bodies, b)
 			}
 		}
 
+		loc := api.getLocation(key)
+
+		for i, p := range parts {
+			ParseMultipartContent(call, p, bodies[i], loc)
+		}
+
 		if ok, err := call.IsValid(); ok {
 			api.HandleCall(key, call, w)
 		} else {
@@ -88,6 +102,158 @@ func (api *Api) CallUploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CallsExportHandler stitches the calls of a time range into a single audio
+// file. It is available to the administrators, and to the listeners within the
+// scope of their access code when access codes are defined. The export runs in
+// the background, a post returning the id of its job, whose progress is then
+// polled with a get until the export is downloaded.
+func (api *Api) CallsExportHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m := map[string]any{}
+
+		if code := r.URL.Query().Get("code"); len(code) > 0 {
+			m["code"] = code
+		}
+
+		client, ok := api.getClient(r, m)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		job, ok := api.Controller.Exports.Get(r.URL.Query().Get("id"), client)
+		if !ok {
+			api.exitWithError(w, http.StatusNotFound, "Unknown export")
+			return
+		}
+
+		status, export, err := job.Status()
+		if errors.Is(err, ErrCallsExportEmpty) {
+			api.exitWithError(w, http.StatusNotFound, err.Error())
+			return
+		} else if errors.Is(err, ErrCallsExportTooLarge) {
+			api.exitWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		} else if err != nil {
+			api.exitWithError(w, http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		if export == nil {
+			b, err := json.Marshal(status)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write(b)
+			return
+		}
+
+		// the archive is written as long as it takes, past the write timeout
+		// of the server
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.TrimSuffix(export.AudioName, path.Ext(export.AudioName))+".zip"))
+		w.Header().Set("Content-Type", "application/zip")
+
+		if err = export.WriteZip(w); err != nil {
+			api.Controller.Logs.LogEvent(LogLevelError, err.Error())
+		}
+
+	case http.MethodPost:
+		m := map[string]any{}
+
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			api.exitWithError(w, http.StatusBadRequest, "Invalid export request")
+			return
+		}
+
+		client, ok := api.getClient(r, m)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		options := NewCallsExportOptions().FromMap(m)
+		if err := options.IsValid(); err != nil {
+			api.exitWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		job, err := api.Controller.Exports.Start(options, client)
+		if err != nil {
+			api.exitWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		status, _, _ := job.Status()
+
+		b, err := json.Marshal(status)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(b)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Unsupported method\n"))
+	}
+}
+
+// CallsSearchHandler searches the calls with the same options as the call
+// list of the web app.
+func (api *Api) CallsSearchHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		m := map[string]any{}
+
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			api.exitWithError(w, http.StatusBadRequest, "Invalid search request")
+			return
+		}
+
+		client, ok := api.getClient(r, m)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		searchOptions := CallsSearchOptions{searchPatchedTalkgroups: api.Controller.Options.SearchPatchedTalkgroups}
+		if err := searchOptions.fromMap(m); err != nil {
+			api.exitWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		searchResults, err := api.Controller.Calls.Search(&searchOptions, client)
+		if err != nil {
+			api.Controller.Logs.LogEvent(LogLevelError, err.Error())
+			api.exitWithError(w, http.StatusExpectationFailed, "Search failed")
+			return
+		}
+
+		b, err := json.Marshal(searchResults)
+		if err != nil {
+			api.exitWithError(w, http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Unsupported method\n"))
+	}
+}
+
 func (api *Api) HandleCall(key string, call *Call, w http.ResponseWriter) {
 	msg := []byte(fmt.Sprintf("Invalid API key for system %v talkgroup %v.\n", call.System, call.Talkgroup))
 
@@ -110,6 +276,48 @@ func (api *Api) HandleCall(key string, call *Call, w http.ResponseWriter) {
 	w.Write([]byte("Call imported successfully.\n"))
 }
 
+// getClient returns a client for a request which is authorized by an admin
+// token, or by the access code in its body when access is restricted.
+func (api *Api) getClient(r *http.Request, m map[string]any) (*Client, bool) {
+	client := &Client{Controller: api.Controller}
+
+	if !api.Controller.Admin.ValidateToken(api.Controller.Admin.GetAuthorization(r)) && api.Controller.Accesses.IsRestricted() {
+		var code string
+
+		switch v := m["code"].(type) {
+		case string:
+			code = v
+		}
+
+		access, ok := api.Controller.Accesses.GetAccess(code)
+		if !ok {
+			api.Controller.Logs.LogEvent(LogLevelWarn, fmt.Sprintf("invalid access code %s for ip %s", code, GetRemoteAddr(r)))
+			return nil, false
+		}
+
+		if access.HasExpired() {
+			api.Controller.Logs.LogEvent(LogLevelWarn, fmt.Sprintf("expired access for ident %s", access.Ident))
+			return nil, false
+		}
+
+		client.Access = access
+	}
+
+	client.SystemsMap = api.Controller.Systems.GetScopedSystems(client, api.Controller.Groups, api.Controller.Tags, api.Controller.Options.SortTalkgroups)
+	client.GroupsMap = api.Controller.Groups.GetGroupsMap(&client.SystemsMap)
+	client.TagsMap = api.Controller.Tags.GetTagsMap(&client.SystemsMap)
+
+	return client, true
+}
+
+func (api *Api) getLocation(key string) *time.Location {
+	if apikey, ok := api.Controller.Apikeys.GetApikey(key); ok {
+		return apikey.GetLocation(api.Controller.Options)
+	}
+
+	return api.Controller.Options.GetLocation()
+}
+
 func (api *Api) TrunkRecorderCallUploadHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
@@ -161,8 +369,10 @@ func (api *Api) TrunkRecorderCallUploadHandler(w http.ResponseWriter, r *http.Re
 			}
 		}
 
+		loc := api.getLocation(key)
+
 		for p, b := range parts {
-			ParseMultipartContent(call, p, b)
+			ParseMultipartContent(call, p, b, loc)
 		}
 
 		if ok, err := call.IsValid(); ok {
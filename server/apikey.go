@@ -19,8 +19,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -32,6 +32,8 @@ type Apikey struct {
 	Key      string `json:"key"`
 	Order    any    `json:"order"`
 	Systems  any    `json:"systems"`
+	TimeZone any    `json:"timeZone"`
+	location *time.Location
 }
 
 func (apikey *Apikey) FromMap(m map[string]any) *Apikey {
@@ -69,9 +71,26 @@ func (apikey *Apikey) FromMap(m map[string]any) *Apikey {
 		apikey.Systems = v
 	}
 
+	switch v := m["timeZone"].(type) {
+	case string:
+		apikey.TimeZone = v
+	}
+
+	apikey.location, _ = loadLocation(apikey.TimeZone)
+
 	return apikey
 }
 
+// GetLocation returns the time zone of the date times sent without an offset
+// with this API key, falling back to the global option.
+func (apikey *Apikey) GetLocation(options *Options) *time.Location {
+	if apikey.location != nil {
+		return apikey.location
+	}
+
+	return options.GetLocation()
+}
+
 func (apikey *Apikey) HasAccess(call *Call) bool {
 	switch v := apikey.Systems.(type) {
 	case []any:
@@ -154,11 +173,12 @@ func (apikeys *Apikeys) GetApikey(key string) (apikey *Apikey, ok bool) {
 
 func (apikeys *Apikeys) Read(db *Database) error {
 	var (
-		err     error
-		id      sql.NullFloat64
-		order   sql.NullFloat64
-		rows    *sql.Rows
-		systems string
+		err      error
+		id       sql.NullFloat64
+		order    sql.NullFloat64
+		rows     *sql.Rows
+		systems  string
+		timeZone sql.NullString
 	)
 
 	apikeys.mutex.Lock()
@@ -170,18 +190,14 @@ func (apikeys *Apikeys) Read(db *Database) error {
 		return fmt.Errorf("apikeys.read: %v", err)
 	}
 
-	q := "select `_id`, `disabled`, `ident`, `key`, `order`, `systems` from `rdioScannerApiKeys`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id, disabled, ident, key, \"order\", systems from rdioScannerApiKeys"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `disabled`, `ident`, `key`, `order`, `systems`, `timeZone` from `rdioScannerApiKeys`").Query(); err != nil {
 		return formatError(err)
 	}
 
 	for rows.Next() {
 		apikey := &Apikey{}
 
-		if err = rows.Scan(&id, &apikey.Disabled, &apikey.Ident, &apikey.Key, &order, &systems); err != nil {
+		if err = rows.Scan(&id, &apikey.Disabled, &apikey.Ident, &apikey.Key, &order, &systems, &timeZone); err != nil {
 			break
 		}
 
@@ -205,6 +221,11 @@ func (apikeys *Apikeys) Read(db *Database) error {
 			apikey.Systems = []any{}
 		}
 
+		if timeZone.Valid && len(timeZone.String) > 0 {
+			apikey.TimeZone = timeZone.String
+			apikey.location, _ = loadLocation(apikey.TimeZone)
+		}
+
 		apikeys.List = append(apikeys.List, apikey)
 	}
 
@@ -222,7 +243,7 @@ func (apikeys *Apikeys) Write(db *Database) error {
 		count   uint
 		err     error
 		rows    *sql.Rows
-		rowIds  = []uint{}
+		rowIds  = []any{}
 		systems any
 	)
 
@@ -233,11 +254,7 @@ func (apikeys *Apikeys) Write(db *Database) error {
 		return fmt.Errorf("apikeys.write %v", err)
 	}
 
-	q := "select `_id` from `rdioScannerApiKeys`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id from rdioScannerApiKeys"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerApiKeys`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -265,17 +282,8 @@ func (apikeys *Apikeys) Write(db *Database) error {
 	}
 
 	if len(rowIds) > 0 {
-		if b, err := json.Marshal(rowIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerApikeys` where `_id` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerApikeys where _id in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerApikeys` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
@@ -287,37 +295,30 @@ func (apikeys *Apikeys) Write(db *Database) error {
 			systems = apikey.Systems
 		}
 
-		q := "select count(*) from `rdioScannerApiKeys` where `_id` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerApiKeys where _id = $1"
-		}
-		if err = db.Sql.QueryRow(q, apikey.Id).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerApiKeys` where `_id` = ?", apikey.Id).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerApiKeys (disabled, ident, key, \"order\", systems) values ($1, $2, $3, $4, $5)"
-				if _, err = db.Sql.Exec(q, apikey.Disabled, apikey.Ident, apikey.Key, apikey.Order, systems); err != nil {
-					break
-				}
-			} else {
-				q = "insert into `rdioScannerApiKeys` (`_id`, `disabled`, `ident`, `key`, `order`, `systems`) values (?, ?, ?, ?, ?, ?)"
-				if _, err = db.Sql.Exec(q, apikey.Id, apikey.Disabled, apikey.Ident, apikey.Key, apikey.Order, systems); err != nil {
-					break
-				}
+			query := db.NewQuery("insert into `rdioScannerApiKeys` (`disabled`, `ident`, `key`, `order`, `systems`, `timeZone`", apikey.Disabled, apikey.Ident, apikey.Key, apikey.Order, systems, apikey.TimeZone)
+			if apikey.Id != nil {
+				query.Append(", `_id`", apikey.Id)
 			}
-		} else {
-			q := "update `rdioScannerApiKeys` set `_id` = ?, `disabled` = ?, `ident` = ?, `key` = ?, `order` = ?, `systems` = ? where `_id` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerApiKeys set _id = $1, disabled = $2, ident = $3, key = $4, \"order\" = $5, systems = $6 where _id = $7"
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
 			}
-			if _, err = db.Sql.Exec(q, apikey.Id, apikey.Disabled, apikey.Ident, apikey.Key, apikey.Order, systems, apikey.Id); err != nil {
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerApiKeys` set `_id` = ?, `disabled` = ?, `ident` = ?, `key` = ?, `order` = ?, `systems` = ?, `timeZone` = ? where `_id` = ?", apikey.Id, apikey.Disabled, apikey.Ident, apikey.Key, apikey.Order, systems, apikey.TimeZone, apikey.Id).Exec(); err != nil {
 				break
 			}
 		}
 	}
 
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerApiKeys"))
+	}
+
 	if err != nil {
 		return formatError(err)
 	}
@@ -0,0 +1,524 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ARCHIVE_DAY_FORMAT = "2006-01-02"
+	ARCHIVE_MANIFEST   = "manifest.ndjson"
+)
+
+// Archive keeps the calls about to be pruned in daily bundles. A bundle is a
+// folder named after the UTC day of its calls, which holds their audio files
+// and a manifest with the metadata of one call per line. The bundles grow as
+// the calls of their day are pruned, and can be restored into the database.
+type Archive struct {
+	backend AudioBackend
+	mutex   sync.Mutex
+}
+
+// ArchiveEntry is a manifest line. The audio files are given relative to the
+// bundle folder.
+type ArchiveEntry struct {
+	Id                uint            `json:"id"`
+	AudioFile         string          `json:"audioFile,omitempty"`
+	AudioName         string          `json:"audioName,omitempty"`
+	AudioType         string          `json:"audioType,omitempty"`
+	DateTime          time.Time       `json:"dateTime"`
+	Duration          int64           `json:"duration,omitempty"`
+	Fingerprint       []byte          `json:"fingerprint,omitempty"`
+	Frequencies       json.RawMessage `json:"frequencies,omitempty"`
+	Frequency         uint            `json:"frequency,omitempty"`
+	OriginalAudioFile string          `json:"originalAudioFile,omitempty"`
+	OriginalName      string          `json:"originalName,omitempty"`
+	OriginalType      string          `json:"originalType,omitempty"`
+	Patches           json.RawMessage `json:"patches,omitempty"`
+	Source            uint            `json:"source,omitempty"`
+	Sources           json.RawMessage `json:"sources,omitempty"`
+	System            uint            `json:"system"`
+	Talkgroup         uint            `json:"talkgroup"`
+	ToneSets          json.RawMessage `json:"toneSets,omitempty"`
+	Transcript        json.RawMessage `json:"transcript,omitempty"`
+	Waveform          []byte          `json:"waveform,omitempty"`
+}
+
+// NewArchive returns nil when no archive store is configured.
+func NewArchive(config *Config) (*Archive, error) {
+	archive := &Archive{mutex: sync.Mutex{}}
+
+	switch config.ArchiveStore {
+	case "":
+		return nil, nil
+
+	case AUDIO_STORE_FILESYSTEM:
+		archive.backend = &FilesystemArchiveBackend{FilesystemAudioBackend{Dir: config.GetArchiveDirPath()}}
+
+	case AUDIO_STORE_S3:
+		if len(config.ArchiveS3Bucket) == 0 {
+			return nil, errors.New("archive: no s3 bucket configured")
+		}
+
+		orDefault := func(v string, d string) string {
+			if len(v) > 0 {
+				return v
+			}
+			return d
+		}
+
+		archive.backend = &S3AudioBackend{
+			Bucket: config.ArchiveS3Bucket,
+			Client: NewS3Client(
+				orDefault(config.ArchiveS3Endpoint, config.AudioS3Endpoint),
+				orDefault(config.ArchiveS3Region, config.AudioS3Region),
+				orDefault(config.ArchiveS3AccessKey, config.AudioS3AccessKey),
+				orDefault(config.ArchiveS3SecretKey, config.AudioS3SecretKey),
+			),
+		}
+
+	default:
+		return nil, fmt.Errorf("archive: unknown archive store %s", config.ArchiveStore)
+	}
+
+	return archive, nil
+}
+
+// Put adds the matching calls to the bundles of their day. The audio files
+// are written before the manifests, so that a manifest never lists a call
+// whose audio is missing.
+func (archive *Archive) Put(db *Database, where *Query) (uint, error) {
+	var (
+		bundles = map[string][]*ArchiveEntry{}
+		count   uint
+		lastId  uint
+	)
+
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("archive.put: %v", err)
+	}
+
+	for {
+		batch, err := archive.readCalls(db, where, lastId)
+		if err != nil {
+			return 0, formatError(err)
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, call := range batch {
+			day := call.entry.DateTime.UTC().Format(ARCHIVE_DAY_FORMAT)
+
+			if len(call.audio) > 0 {
+				call.entry.AudioFile = fmt.Sprintf("audio/%d%s", call.entry.Id, archiveExt(call.entry.AudioName, call.entry.AudioType))
+				if err = archive.backend.Put(path.Join(day, call.entry.AudioFile), call.audio, call.entry.AudioType); err != nil {
+					return 0, formatError(err)
+				}
+			}
+
+			if len(call.originalAudio) > 0 {
+				call.entry.OriginalAudioFile = fmt.Sprintf("audio/%d-original%s", call.entry.Id, archiveExt(call.entry.OriginalName, call.entry.OriginalType))
+				if err = archive.backend.Put(path.Join(day, call.entry.OriginalAudioFile), call.originalAudio, call.entry.OriginalType); err != nil {
+					return 0, formatError(err)
+				}
+			}
+
+			bundles[day] = append(bundles[day], call.entry)
+			lastId = call.entry.Id
+			count++
+		}
+	}
+
+	for day, entries := range bundles {
+		if err := archive.writeManifest(day, entries); err != nil {
+			return 0, formatError(err)
+		}
+	}
+
+	return count, nil
+}
+
+// Restore imports the calls of the bundle of a day back into the database.
+// The calls keep their ids, and those still in the database are skipped. The
+// restored calls are marked as such, so that they are not pruned again before
+// their retention period has elapsed anew.
+func (archive *Archive) Restore(db *Database, calls *Calls, systems *Systems, day string) (restored uint, skipped uint, err error) {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("archive.restore: %v", err)
+	}
+
+	if _, err = time.Parse(ARCHIVE_DAY_FORMAT, day); err != nil {
+		return 0, 0, formatError(fmt.Errorf("invalid day %s", day))
+	}
+
+	entries, err := archive.readManifest(day)
+	if err != nil {
+		return 0, 0, formatError(err)
+	} else if len(entries) == 0 {
+		return 0, 0, formatError(fmt.Errorf("no bundle for %s", day))
+	}
+
+	restoredAt := time.Now().UTC().Format(db.DateTimeFormat)
+
+	for _, entry := range entries {
+		var count uint
+
+		if err = db.NewQuery("select count(*) from `rdioScannerCalls` where `id` = ?", entry.Id).QueryRow().Scan(&count); err != nil {
+			return restored, skipped, formatError(err)
+		}
+
+		if count > 0 {
+			skipped++
+			continue
+		}
+
+		call, err := archive.toCall(day, entry)
+		if err != nil {
+			return restored, skipped, formatError(err)
+		}
+
+		if _, err = calls.WriteCall(call, db); err != nil {
+			return restored, skipped, formatError(err)
+		}
+
+		if _, err = db.NewQuery("update `rdioScannerCalls` set `restoredAt` = ? where `id` = ?", restoredAt, call.Id).Exec(); err != nil {
+			return restored, skipped, formatError(err)
+		}
+
+		var talkgroup *Talkgroup
+
+		system, ok := systems.GetSystem(call.System)
+		if ok {
+			talkgroup, _ = system.Talkgroups.GetTalkgroup(call.Talkgroup)
+		}
+
+		if err = calls.IndexText(call, system, talkgroup, db); err != nil {
+			return restored, skipped, formatError(err)
+		}
+
+		restored++
+	}
+
+	return restored, skipped, nil
+}
+
+type archiveCall struct {
+	audio         []byte
+	entry         *ArchiveEntry
+	originalAudio []byte
+}
+
+// readCalls returns the next 100 matching calls after lastId, with their
+// audio read from the audio store when it is kept outside of the database.
+func (archive *Archive) readCalls(db *Database, where *Query, lastId uint) ([]*archiveCall, error) {
+	var (
+		batch = []*archiveCall{}
+		err   error
+		refs  = map[*archiveCall][2]string{}
+		rows  *sql.Rows
+	)
+
+	query := db.NewQuery("select `id`, `audio`, `audioName`, `audioRef`, `audioType`, `dateTime`, `duration`, `fingerprint`, `frequencies`, `frequency`, `originalAudio`, `originalAudioName`, `originalAudioRef`, `originalAudioType`, `patches`, `source`, `sources`, `system`, `talkgroup`, `toneSets`, `transcript`, `waveform` from `rdioScannerCalls` where `id` > ? and ", lastId).AppendQuery(where).Append(" order by `id` limit 100")
+	if rows, err = query.Query(); err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var (
+			audioName         sql.NullString
+			audioRef          sql.NullString
+			audioType         sql.NullString
+			dateTime          any
+			duration          sql.NullInt64
+			frequencies       sql.NullString
+			frequency         sql.NullFloat64
+			originalAudioName sql.NullString
+			originalAudioRef  sql.NullString
+			originalAudioType sql.NullString
+			patches           sql.NullString
+			source            sql.NullFloat64
+			sources           sql.NullString
+			toneSets          sql.NullString
+			transcript        sql.NullString
+		)
+
+		call := &archiveCall{entry: &ArchiveEntry{}}
+		entry := call.entry
+
+		if err = rows.Scan(&entry.Id, &call.audio, &audioName, &audioRef, &audioType, &dateTime, &duration, &entry.Fingerprint, &frequencies, &frequency, &call.originalAudio, &originalAudioName, &originalAudioRef, &originalAudioType, &patches, &source, &sources, &entry.System, &entry.Talkgroup, &toneSets, &transcript, &entry.Waveform); err != nil {
+			break
+		}
+
+		if entry.DateTime, err = db.ParseDateTime(dateTime); err != nil {
+			break
+		}
+
+		entry.AudioName = audioName.String
+		entry.AudioType = audioType.String
+		entry.Duration = duration.Int64
+		entry.OriginalName = originalAudioName.String
+		entry.OriginalType = originalAudioType.String
+
+		if frequency.Valid && frequency.Float64 > 0 {
+			entry.Frequency = uint(frequency.Float64)
+		}
+
+		if source.Valid && source.Float64 > 0 {
+			entry.Source = uint(source.Float64)
+		}
+
+		for _, f := range []struct {
+			column sql.NullString
+			raw    *json.RawMessage
+		}{
+			{frequencies, &entry.Frequencies},
+			{patches, &entry.Patches},
+			{sources, &entry.Sources},
+			{toneSets, &entry.ToneSets},
+			{transcript, &entry.Transcript},
+		} {
+			if f.column.Valid && json.Valid([]byte(f.column.String)) {
+				*f.raw = json.RawMessage(f.column.String)
+			}
+		}
+
+		refs[call] = [2]string{audioRef.String, originalAudioRef.String}
+
+		batch = append(batch, call)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, call := range batch {
+		if ref := refs[call][0]; len(ref) > 0 {
+			if call.audio, err = db.AudioStore.Get(ref); err != nil {
+				return nil, err
+			}
+		}
+
+		if ref := refs[call][1]; len(ref) > 0 {
+			if call.originalAudio, err = db.AudioStore.Get(ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return batch, nil
+}
+
+// readManifest returns the entries of the bundle of a day, none when the
+// bundle doesn't exist yet.
+func (archive *Archive) readManifest(day string) ([]*ArchiveEntry, error) {
+	entries := []*ArchiveEntry{}
+
+	b, err := archive.backend.Get(path.Join(day, ARCHIVE_MANIFEST))
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	for decoder.More() {
+		entry := &ArchiveEntry{}
+		if err = decoder.Decode(entry); err != nil {
+			return nil, fmt.Errorf("%s: %v", path.Join(day, ARCHIVE_MANIFEST), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (archive *Archive) toCall(day string, entry *ArchiveEntry) (*Call, error) {
+	var err error
+
+	call := NewCall()
+
+	call.Id = entry.Id
+	call.DateTime = entry.DateTime
+	call.Duration = time.Duration(entry.Duration) * time.Millisecond
+	call.Fingerprint = entry.Fingerprint
+	call.System = entry.System
+	call.Talkgroup = entry.Talkgroup
+	call.Waveform = entry.Waveform
+
+	if len(entry.AudioFile) > 0 {
+		if call.Audio, err = archive.backend.Get(path.Join(day, entry.AudioFile)); err != nil {
+			return nil, err
+		}
+		call.AudioName = entry.AudioName
+		call.AudioType = entry.AudioType
+	}
+
+	if len(entry.OriginalAudioFile) > 0 {
+		if call.OriginalAudio, err = archive.backend.Get(path.Join(day, entry.OriginalAudioFile)); err != nil {
+			return nil, err
+		}
+		call.OriginalName = entry.OriginalName
+		call.OriginalType = entry.OriginalType
+	}
+
+	if entry.Frequency > 0 {
+		call.Frequency = entry.Frequency
+	}
+
+	if entry.Source > 0 {
+		call.Source = entry.Source
+	}
+
+	frequencies := []map[string]any{}
+	patches := []uint{}
+	sources := []map[string]any{}
+	toneSets := []uint{}
+
+	for _, f := range []struct {
+		raw json.RawMessage
+		v   any
+	}{
+		{entry.Frequencies, &frequencies},
+		{entry.Patches, &patches},
+		{entry.Sources, &sources},
+		{entry.ToneSets, &toneSets},
+	} {
+		if len(f.raw) > 0 {
+			if err = json.Unmarshal(f.raw, f.v); err != nil {
+				return nil, fmt.Errorf("call %d: %v", entry.Id, err)
+			}
+		}
+	}
+
+	call.Frequencies = frequencies
+	call.Patches = patches
+	call.Sources = sources
+	call.ToneSets = toneSets
+
+	if len(entry.Transcript) > 0 && string(entry.Transcript) != "null" {
+		call.Transcript = &Transcript{}
+		if err = json.Unmarshal(entry.Transcript, call.Transcript); err != nil {
+			return nil, fmt.Errorf("call %d: %v", entry.Id, err)
+		}
+	}
+
+	return call, nil
+}
+
+// writeManifest merges the entries into the manifest of the bundle of a day,
+// the entries of calls already archived being replaced.
+func (archive *Archive) writeManifest(day string, entries []*ArchiveEntry) error {
+	current, err := archive.readManifest(day)
+	if err != nil {
+		return err
+	}
+
+	ids := map[uint]bool{}
+	for _, entry := range entries {
+		ids[entry.Id] = true
+	}
+
+	for _, entry := range current {
+		if !ids[entry.Id] {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i int, j int) bool {
+		if entries[i].DateTime.Equal(entries[j].DateTime) {
+			return entries[i].Id < entries[j].Id
+		}
+		return entries[i].DateTime.Before(entries[j].DateTime)
+	})
+
+	var b bytes.Buffer
+
+	encoder := json.NewEncoder(&b)
+	for _, entry := range entries {
+		if err = encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return archive.backend.Put(path.Join(day, ARCHIVE_MANIFEST), b.Bytes(), "application/x-ndjson")
+}
+
+func archiveExt(name string, kind string) string {
+	if ext := filepath.Ext(name); len(ext) > 0 {
+		return ext
+	}
+
+	if exts, err := mime.ExtensionsByType(kind); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ".bin"
+}
+
+// FilesystemArchiveBackend overwrites the existing files, unlike the audio
+// store which names its files after their content.
+type FilesystemArchiveBackend struct {
+	FilesystemAudioBackend
+}
+
+func (backend *FilesystemArchiveBackend) Put(key string, data []byte, dataType string) error {
+	p := backend.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
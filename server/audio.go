@@ -0,0 +1,625 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	AudioFormatM4a = "m4a"
+	AudioFormatMp3 = "mp3"
+	AudioFormatOgg = "ogg"
+	AudioFormatWav = "wav"
+)
+
+// ErrAudioUnknownFormat is returned by InspectAudio when the audio is none of
+// the formats it knows about. Such audio is neither accepted nor rejected.
+var ErrAudioUnknownFormat = errors.New("unknown audio format")
+
+// AudioInfo is what can be learned from the headers of an audio file without
+// decoding it. Duration is zero when it can't be determined from the headers.
+type AudioInfo struct {
+	Channels   uint
+	Codec      string
+	Duration   time.Duration
+	Format     string
+	MimeType   string
+	SampleRate uint
+}
+
+// InspectAudio identifies the audio format from its signature and parses its
+// headers. Truncated or corrupt audio of a known format returns an error.
+func InspectAudio(b []byte) (*AudioInfo, error) {
+	switch {
+	case len(b) >= 12 && string(b[0:4]) == "RIFF" && string(b[8:12]) == "WAVE":
+		return inspectWav(b)
+
+	case len(b) >= 8 && string(b[4:8]) == "ftyp":
+		return inspectM4a(b)
+
+	case len(b) >= 4 && string(b[0:4]) == "OggS":
+		return inspectOgg(b)
+
+	// adts aac shares the sync word of mp3 frames but has a zero layer
+	case len(b) >= 3 && string(b[0:3]) == "ID3", len(b) >= 2 && b[0] == 0xff && b[1]&0xe0 == 0xe0 && b[1]&0x06 != 0:
+		return inspectMp3(b)
+	}
+
+	return nil, ErrAudioUnknownFormat
+}
+
+func inspectWav(b []byte) (*AudioInfo, error) {
+	var (
+		byteRate uint32
+		found    bool
+		info     = &AudioInfo{Format: AudioFormatWav, MimeType: "audio/wav"}
+		pos      = 12
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("wav: %v", err)
+	}
+
+	for pos+8 <= len(b) {
+		id := string(b[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(b[pos+4 : pos+8]))
+		pos += 8
+
+		switch id {
+		case "fmt ":
+			if size < 16 || pos+size > len(b) {
+				return nil, formatError(errors.New("truncated fmt chunk"))
+			}
+
+			tag := binary.LittleEndian.Uint16(b[pos : pos+2])
+			if tag == 0xfffe && size >= 26 {
+				tag = binary.LittleEndian.Uint16(b[pos+24 : pos+26])
+			}
+
+			switch tag {
+			case 0x0001:
+				info.Codec = "pcm"
+			case 0x0003:
+				info.Codec = "pcm_float"
+			case 0x0006:
+				info.Codec = "alaw"
+			case 0x0007:
+				info.Codec = "mulaw"
+			case 0x0011:
+				info.Codec = "adpcm_ima"
+			case 0x0055:
+				info.Codec = "mp3"
+			default:
+				info.Codec = fmt.Sprintf("0x%04x", tag)
+			}
+
+			info.Channels = uint(binary.LittleEndian.Uint16(b[pos+2 : pos+4]))
+			info.SampleRate = uint(binary.LittleEndian.Uint32(b[pos+4 : pos+8]))
+			byteRate = binary.LittleEndian.Uint32(b[pos+8 : pos+12])
+
+			found = true
+
+		case "data":
+			if !found {
+				return nil, formatError(errors.New("data chunk before fmt chunk"))
+			}
+
+			// streamed recordings are often left with an unset data size
+			if size == 0 || uint32(size) == 0xffffffff {
+				size = len(b) - pos
+			}
+
+			if pos+size > len(b) {
+				return nil, formatError(fmt.Errorf("truncated data chunk, %d of %d bytes", len(b)-pos, size))
+			}
+
+			if byteRate == 0 {
+				return nil, formatError(errors.New("invalid byte rate"))
+			}
+
+			info.Duration = time.Duration(float64(size) / float64(byteRate) * float64(time.Second))
+
+			return info, nil
+		}
+
+		pos += size + size%2
+	}
+
+	if !found {
+		return nil, formatError(errors.New("no fmt chunk"))
+	}
+
+	return nil, formatError(errors.New("no data chunk"))
+}
+
+var (
+	mp3Bitrates = [2][3][16]uint{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		},
+	}
+
+	mp3SampleRates = [4][3]uint{
+		{11025, 12000, 8000},
+		{0, 0, 0},
+		{22050, 24000, 16000},
+		{44100, 48000, 32000},
+	}
+)
+
+type mp3Frame struct {
+	channels   uint
+	length     int
+	samples    uint
+	sampleRate uint
+}
+
+func parseMp3Frame(b []byte) (*mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return nil, false
+	}
+
+	version := (b[1] >> 3) & 0x03
+	layer := (b[1] >> 1) & 0x03
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 0x03
+	padding := int((b[2] >> 1) & 0x01)
+
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil, false
+	}
+
+	v := 1
+	if version == 3 {
+		v = 0
+	}
+	l := 3 - int(layer)
+
+	frame := &mp3Frame{
+		channels:   2,
+		sampleRate: mp3SampleRates[version][sampleRateIndex],
+	}
+
+	if b[3]>>6 == 3 {
+		frame.channels = 1
+	}
+
+	bitrate := int(mp3Bitrates[v][l][bitrateIndex]) * 1000
+
+	switch {
+	case l == 0:
+		frame.samples = 384
+		frame.length = (12*bitrate/int(frame.sampleRate) + padding) * 4
+	case l == 2 && v == 1:
+		frame.samples = 576
+		frame.length = 72*bitrate/int(frame.sampleRate) + padding
+	default:
+		frame.samples = 1152
+		frame.length = 144*bitrate/int(frame.sampleRate) + padding
+	}
+
+	return frame, frame.length > 4
+}
+
+func inspectMp3(b []byte) (*AudioInfo, error) {
+	var (
+		frames  uint
+		info    = &AudioInfo{Codec: "mp3", Format: AudioFormatMp3, MimeType: "audio/mpeg"}
+		pos     int
+		samples uint
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("mp3: %v", err)
+	}
+
+	if len(b) >= 10 && string(b[0:3]) == "ID3" {
+		size := int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f)
+		pos = 10 + size
+		if b[5]&0x10 != 0 {
+			pos += 10
+		}
+		if pos > len(b) {
+			return nil, formatError(errors.New("truncated id3 tag"))
+		}
+	}
+
+	// skip padding or garbage before the first frame, but require the next
+	// frame to follow so that a stray sync word isn't taken for a frame
+	for ; pos+4 <= len(b); pos++ {
+		if frame, ok := parseMp3Frame(b[pos:]); ok {
+			if pos+frame.length == len(b) {
+				break
+			}
+			if _, ok := parseMp3Frame(b[min(pos+frame.length, len(b)):]); ok {
+				break
+			}
+		}
+	}
+
+	for pos+4 <= len(b) {
+		frame, ok := parseMp3Frame(b[pos:])
+		if !ok {
+			break
+		}
+
+		if pos+frame.length > len(b) {
+			return nil, formatError(fmt.Errorf("truncated frame at offset %d", pos))
+		}
+
+		if frames == 0 {
+			info.Channels = frame.channels
+			info.SampleRate = frame.sampleRate
+		}
+
+		frames++
+		samples += frame.samples
+		pos += frame.length
+	}
+
+	if frames == 0 {
+		return nil, formatError(errors.New("no audio frame"))
+	}
+
+	info.Duration = time.Duration(float64(samples) / float64(info.SampleRate) * float64(time.Second))
+
+	return info, nil
+}
+
+func inspectM4a(b []byte) (*AudioInfo, error) {
+	var (
+		found bool
+		info  = &AudioInfo{Format: AudioFormatM4a, MimeType: "audio/mp4"}
+		walk  func(b []byte) error
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("m4a: %v", err)
+	}
+
+	walk = func(b []byte) error {
+		pos := 0
+
+		for pos+8 <= len(b) {
+			size := int(binary.BigEndian.Uint32(b[pos : pos+4]))
+			kind := string(b[pos+4 : pos+8])
+			header := 8
+
+			switch size {
+			case 0:
+				size = len(b) - pos
+			case 1:
+				if pos+16 > len(b) {
+					return fmt.Errorf("truncated %s box", kind)
+				}
+				// checked before the conversion, which would overflow
+				largesize := binary.BigEndian.Uint64(b[pos+8 : pos+16])
+				if largesize > uint64(len(b)-pos) {
+					return fmt.Errorf("truncated %s box", kind)
+				}
+				size = int(largesize)
+				header = 16
+			}
+
+			if size < header || size > len(b)-pos {
+				return fmt.Errorf("truncated %s box", kind)
+			}
+
+			body := b[pos+header : pos+size]
+
+			switch kind {
+			case "moov", "trak", "mdia", "minf", "stbl":
+				if err := walk(body); err != nil {
+					return err
+				}
+
+			case "mvhd":
+				if len(body) >= 20 && body[0] == 0 {
+					timescale := binary.BigEndian.Uint32(body[12:16])
+					duration := binary.BigEndian.Uint32(body[16:20])
+					if timescale > 0 {
+						info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+					}
+				} else if len(body) >= 32 && body[0] == 1 {
+					timescale := binary.BigEndian.Uint32(body[20:24])
+					duration := binary.BigEndian.Uint64(body[24:32])
+					if timescale > 0 {
+						info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+					}
+				}
+
+			case "stsd":
+				// version, flags and entry count, then the first sample entry
+				if found || len(body) < 8+8+28 {
+					break
+				}
+
+				entry := body[8:]
+
+				switch string(entry[4:8]) {
+				case "mp4a":
+					info.Codec = "aac"
+				case "Opus":
+					info.Codec = "opus"
+				case "alac":
+					info.Codec = "alac"
+				case "fLaC":
+					info.Codec = "flac"
+				case ".mp3":
+					info.Codec = "mp3"
+				default:
+					return nil
+				}
+
+				info.Channels = uint(binary.BigEndian.Uint16(entry[24:26]))
+				info.SampleRate = uint(binary.BigEndian.Uint32(entry[32:36]) >> 16)
+
+				found = true
+			}
+
+			pos += size
+		}
+
+		return nil
+	}
+
+	if err := walk(b); err != nil {
+		return nil, formatError(err)
+	}
+
+	if !found {
+		return nil, formatError(errors.New("no audio track"))
+	}
+
+	return info, nil
+}
+
+var oggCrcTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func oggCrc(page []byte) uint32 {
+	var crc uint32
+
+	for i, c := range page {
+		// the checksum field itself is computed as zeros
+		if i >= 22 && i < 26 {
+			c = 0
+		}
+		crc = crc<<8 ^ oggCrcTable[byte(crc>>24)^c]
+	}
+
+	return crc
+}
+
+func inspectOgg(b []byte) (*AudioInfo, error) {
+	var (
+		granule int64
+		info    = &AudioInfo{Format: AudioFormatOgg, MimeType: "audio/ogg"}
+		pages   uint
+		pos     int
+		preSkip int64
+		serial  uint32
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("ogg: %v", err)
+	}
+
+	for pos < len(b) {
+		if pos+27 > len(b) {
+			return nil, formatError(fmt.Errorf("truncated page at offset %d", pos))
+		}
+
+		if string(b[pos:pos+4]) != "OggS" {
+			return nil, formatError(fmt.Errorf("invalid page at offset %d", pos))
+		}
+
+		segments := int(b[pos+26])
+		if pos+27+segments > len(b) {
+			return nil, formatError(fmt.Errorf("truncated page at offset %d", pos))
+		}
+
+		size := 27 + segments
+		for _, s := range b[pos+27 : pos+27+segments] {
+			size += int(s)
+		}
+
+		if pos+size > len(b) {
+			return nil, formatError(fmt.Errorf("truncated page at offset %d", pos))
+		}
+
+		page := b[pos : pos+size]
+
+		if oggCrc(page) != binary.LittleEndian.Uint32(page[22:26]) {
+			return nil, formatError(fmt.Errorf("checksum mismatch at offset %d", pos))
+		}
+
+		if pages == 0 {
+			serial = binary.LittleEndian.Uint32(page[14:18])
+			packet := page[27+segments:]
+
+			switch {
+			case len(packet) >= 19 && bytes.HasPrefix(packet, []byte("OpusHead")):
+				info.Codec = "opus"
+				info.Channels = uint(packet[9])
+				info.SampleRate = 48000
+				preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+
+			case len(packet) >= 16 && bytes.HasPrefix(packet, []byte("\x01vorbis")):
+				info.Codec = "vorbis"
+				info.Channels = uint(packet[11])
+				info.SampleRate = uint(binary.LittleEndian.Uint32(packet[12:16]))
+			}
+
+		} else if binary.LittleEndian.Uint32(page[14:18]) == serial {
+			if g := int64(binary.LittleEndian.Uint64(page[6:14])); g > 0 {
+				granule = g
+			}
+		}
+
+		pages++
+		pos += size
+	}
+
+	if granule > preSkip && info.SampleRate > 0 {
+		info.Duration = time.Duration(float64(granule-preSkip) / float64(info.SampleRate) * float64(time.Second))
+	}
+
+	return info, nil
+}
+
+// DecodeWav returns the samples of a PCM WAV file mixed down to mono, along
+// with their sample rate.
+func DecodeWav(b []byte) ([]int16, uint, error) {
+	var (
+		bits     uint16
+		channels uint16
+		rate     uint32
+		tag      uint16
+		pos      = 12
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("wav: %v", err)
+	}
+
+	if _, err := inspectWav(b); err != nil {
+		return nil, 0, err
+	}
+
+	for pos+8 <= len(b) {
+		id := string(b[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(b[pos+4 : pos+8]))
+		pos += 8
+
+		switch id {
+		case "fmt ":
+			tag = binary.LittleEndian.Uint16(b[pos : pos+2])
+			if tag == 0xfffe && size >= 26 {
+				tag = binary.LittleEndian.Uint16(b[pos+24 : pos+26])
+			}
+			channels = binary.LittleEndian.Uint16(b[pos+2 : pos+4])
+			rate = binary.LittleEndian.Uint32(b[pos+4 : pos+8])
+			bits = binary.LittleEndian.Uint16(b[pos+14 : pos+16])
+
+		case "data":
+			if tag != 0x0001 || (bits != 8 && bits != 16) || channels == 0 {
+				return nil, 0, formatError(errors.New("unsupported encoding"))
+			}
+
+			if size == 0 || uint32(size) == 0xffffffff {
+				size = len(b) - pos
+			}
+
+			data := b[pos : pos+size]
+			width := int(bits/8) * int(channels)
+			samples := make([]int16, len(data)/width)
+
+			for i := range samples {
+				var sum int
+				for c := 0; c < int(channels); c++ {
+					o := i*width + c*int(bits/8)
+					if bits == 8 {
+						sum += (int(data[o]) - 128) << 8
+					} else {
+						sum += int(int16(binary.LittleEndian.Uint16(data[o : o+2])))
+					}
+				}
+				samples[i] = int16(sum / int(channels))
+			}
+
+			return samples, uint(rate), nil
+		}
+
+		pos += size + size%2
+	}
+
+	return nil, 0, formatError(errors.New("no data chunk"))
+}
+
+// EncodeWav returns the mono samples as a 16 bits PCM WAV file.
+func EncodeWav(samples []int16, sampleRate uint) []byte {
+	size := len(samples) * 2
+
+	b := make([]byte, 44+size)
+	copy(b[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:8], uint32(36+size))
+	copy(b[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:20], 16)
+	binary.LittleEndian.PutUint16(b[20:22], 0x0001)
+	binary.LittleEndian.PutUint16(b[22:24], 1)
+	binary.LittleEndian.PutUint32(b[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(b[28:32], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(b[32:34], 2)
+	binary.LittleEndian.PutUint16(b[34:36], 16)
+	copy(b[36:40], "data")
+	binary.LittleEndian.PutUint32(b[40:44], uint32(size))
+
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(b[44+i*2:], uint16(sample))
+	}
+
+	return b
+}
+
+// resample converts the samples to another sample rate by linear
+// interpolation, which is good enough for analysis but not for listening.
+func resample(samples []int16, from uint, to uint) []int16 {
+	if from == to || from == 0 || to == 0 || len(samples) == 0 {
+		return samples
+	}
+
+	n := int(uint64(len(samples)) * uint64(to) / uint64(from))
+	out := make([]int16, n)
+	ratio := float64(from) / float64(to)
+
+	for i := range out {
+		p := float64(i) * ratio
+		j := int(p)
+		if j+1 >= len(samples) {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		f := p - float64(j)
+		out[i] = int16(float64(samples[j])*(1-f) + float64(samples[j+1])*f)
+	}
+
+	return out
+}
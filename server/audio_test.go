@@ -0,0 +1,356 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func m4aBox(kind string, body ...[]byte) []byte {
+	var b []byte
+
+	for _, p := range body {
+		b = append(b, p...)
+	}
+
+	box := make([]byte, 8, 8+len(b))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(b)))
+	copy(box[4:8], kind)
+
+	return append(box, b...)
+}
+
+func m4aLargeBox(kind string, largesize uint64) []byte {
+	box := make([]byte, 16)
+	binary.BigEndian.PutUint32(box[0:4], 1)
+	copy(box[4:8], kind)
+	binary.BigEndian.PutUint64(box[8:16], largesize)
+
+	return box
+}
+
+func m4aFixture() []byte {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 2500)
+
+	stsd := make([]byte, 8+36)
+	binary.BigEndian.PutUint32(stsd[4:8], 1)
+	binary.BigEndian.PutUint32(stsd[8:12], 36)
+	copy(stsd[12:16], "mp4a")
+	binary.BigEndian.PutUint16(stsd[32:34], 1)
+	binary.BigEndian.PutUint32(stsd[40:44], 16000<<16)
+
+	moov := m4aBox("moov",
+		m4aBox("mvhd", mvhd),
+		m4aBox("trak", m4aBox("mdia", m4aBox("minf", m4aBox("stbl", m4aBox("stsd", stsd))))),
+	)
+
+	return append(m4aBox("ftyp", []byte("M4A \x00\x00\x00\x00")), moov...)
+}
+
+func TestInspectM4a(t *testing.T) {
+	info, err := InspectAudio(m4aFixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Codec != "aac" || info.Channels != 1 || info.SampleRate != 16000 || info.Duration.Milliseconds() != 2500 {
+		t.Errorf("unexpected audio info %+v", info)
+	}
+}
+
+func TestInspectM4aInvalidBoxes(t *testing.T) {
+	ftyp := m4aBox("ftyp")
+
+	tests := map[string][]byte{
+		"truncated file":        m4aFixture()[:60],
+		"truncated box":         append(append([]byte{}, ftyp...), m4aBox("moov", make([]byte, 32))[:20]...),
+		"truncated largesize":   append(append([]byte{}, ftyp...), m4aLargeBox("moov", 0)[:12]...),
+		"oversized box":         append(append([]byte{}, ftyp...), 0x7f, 0xff, 0xff, 0xff, 'm', 'o', 'o', 'v'),
+		"oversized largesize":   append(append([]byte{}, ftyp...), m4aLargeBox("moov", 0x7fffffffffffffff)...),
+		"overflowing largesize": append(append([]byte{}, ftyp...), m4aLargeBox("moov", 0xffffffffffffffff)...),
+		"undersized largesize":  append(append([]byte{}, ftyp...), m4aLargeBox("moov", 8)...),
+		"undersized box":        append(append([]byte{}, ftyp...), 0, 0, 0, 4, 'm', 'o', 'o', 'v'),
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := InspectAudio(b); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func wavFixture() []byte {
+	return EncodeWav(make([]int16, 8000), 8000)
+}
+
+func TestInspectWav(t *testing.T) {
+	streamed := wavFixture()
+	binary.LittleEndian.PutUint32(streamed[40:44], 0xffffffff)
+
+	tests := map[string][]byte{
+		"sized data":    wavFixture(),
+		"streamed data": streamed,
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := InspectAudio(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Codec != "pcm" || info.Channels != 1 || info.SampleRate != 8000 || info.Duration.Milliseconds() != 1000 {
+				t.Errorf("unexpected audio info %+v", info)
+			}
+		})
+	}
+}
+
+func TestInspectWavInvalidHeaders(t *testing.T) {
+	dataFirst := wavFixture()
+	copy(dataFirst[12:16], "data")
+
+	noData := wavFixture()
+	copy(noData[36:40], "junk")
+
+	noFmt := wavFixture()
+	copy(noFmt[12:16], "junk")
+
+	shortFmt := wavFixture()
+	binary.LittleEndian.PutUint32(shortFmt[16:20], 8)
+
+	zeroByteRate := wavFixture()
+	binary.LittleEndian.PutUint32(zeroByteRate[28:32], 0)
+
+	tests := map[string][]byte{
+		"truncated fmt chunk":  wavFixture()[:30],
+		"truncated data chunk": wavFixture()[:1000],
+		"data before fmt":      dataFirst,
+		"no data chunk":        noData,
+		"no fmt chunk":         noFmt,
+		"short fmt chunk":      shortFmt,
+		"zero byte rate":       zeroByteRate,
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := InspectAudio(b); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestDecodeWav(t *testing.T) {
+	samples := []int16{0, 1000, -1000, 32767, -32768}
+
+	decoded, sampleRate, err := DecodeWav(EncodeWav(samples, 16000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sampleRate != 16000 || len(decoded) != len(samples) {
+		t.Fatalf("unexpected %d samples at %d Hz", len(decoded), sampleRate)
+	}
+
+	for i := range samples {
+		if decoded[i] != samples[i] {
+			t.Errorf("sample %d is %d, expected %d", i, decoded[i], samples[i])
+		}
+	}
+}
+
+// mp3Fixture returns silent frames of the given 4 bytes header, their length
+// following from its bitrate and sample rate.
+func mp3Fixture(header []byte, frames int) []byte {
+	frame, ok := parseMp3Frame(header)
+	if !ok {
+		panic("invalid mp3 frame header")
+	}
+
+	var b []byte
+
+	for i := 0; i < frames; i++ {
+		f := make([]byte, frame.length)
+		copy(f, header)
+		b = append(b, f...)
+	}
+
+	return b
+}
+
+func id3Fixture(size int) []byte {
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+
+	return append(tag, make([]byte, size)...)
+}
+
+func TestInspectMp3(t *testing.T) {
+	mpeg1 := []byte{0xff, 0xfb, 0x90, 0x00}
+	mpeg1Mono := []byte{0xff, 0xfb, 0x90, 0xc0}
+	mpeg2 := []byte{0xff, 0xf3, 0x80, 0x00}
+
+	stray := append(id3Fixture(16), 0xff, 0xfb, 0x90, 0x00)
+	stray = append(stray, make([]byte, 10)...)
+	stray = append(stray, mp3Fixture(mpeg1, 2)...)
+
+	tests := map[string]struct {
+		b          []byte
+		channels   uint
+		duration   int64
+		sampleRate uint
+	}{
+		"mpeg1 layer3":        {mp3Fixture(mpeg1, 10), 2, 261, 44100},
+		"mpeg1 layer3 mono":   {mp3Fixture(mpeg1Mono, 10), 1, 261, 44100},
+		"mpeg2 layer3":        {mp3Fixture(mpeg2, 10), 2, 261, 22050},
+		"id3 tag":             {append(id3Fixture(100), mp3Fixture(mpeg1, 10)...), 2, 261, 44100},
+		"padding after tag":   {append(append(id3Fixture(100), make([]byte, 32)...), mp3Fixture(mpeg1, 10)...), 2, 261, 44100},
+		"stray sync word":     {stray, 2, 52, 44100},
+		"trailing junk":       {append(mp3Fixture(mpeg1, 10), make([]byte, 32)...), 2, 261, 44100},
+		"single frame":        {mp3Fixture(mpeg1, 1), 2, 26, 44100},
+		"single frame in tag": {append(id3Fixture(10), mp3Fixture(mpeg1, 1)...), 2, 26, 44100},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := InspectAudio(test.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Codec != "mp3" || info.Channels != test.channels || info.SampleRate != test.sampleRate || info.Duration.Milliseconds() != test.duration {
+				t.Errorf("unexpected audio info %+v", info)
+			}
+		})
+	}
+}
+
+func TestInspectMp3InvalidFrames(t *testing.T) {
+	mpeg1 := []byte{0xff, 0xfb, 0x90, 0x00}
+
+	tests := map[string][]byte{
+		"truncated id3 tag":  id3Fixture(100)[:50],
+		"truncated frame":    mp3Fixture(mpeg1, 3)[:1000],
+		"no frame after tag": append(id3Fixture(10), make([]byte, 1000)...),
+		"lone frame header":  append(id3Fixture(10), mpeg1...),
+		"free bitrate":       append(id3Fixture(10), 0xff, 0xfb, 0x00, 0x00),
+		"bad bitrate":        append(id3Fixture(10), 0xff, 0xfb, 0xf0, 0x00),
+		"reserved version":   append(id3Fixture(10), 0xff, 0xeb, 0x90, 0x00),
+		"reserved rate":      append(id3Fixture(10), 0xff, 0xfb, 0x9c, 0x00),
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := InspectAudio(b); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func oggPage(serial uint32, granule int64, packet []byte) []byte {
+	page := make([]byte, 28, 28+len(packet))
+	copy(page[0:4], "OggS")
+	binary.LittleEndian.PutUint64(page[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:18], serial)
+	page[26] = 1
+	page[27] = byte(len(packet))
+	page = append(page, packet...)
+
+	binary.LittleEndian.PutUint32(page[22:26], oggCrc(page))
+
+	return page
+}
+
+func opusFixture() []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = 1
+	binary.LittleEndian.PutUint16(head[10:12], 312)
+	binary.LittleEndian.PutUint32(head[12:16], 48000)
+
+	b := oggPage(1, 0, head)
+	b = append(b, oggPage(1, 0, []byte("OpusTags"))...)
+	b = append(b, oggPage(1, 24312, make([]byte, 32))...)
+
+	return append(b, oggPage(1, 48312, make([]byte, 32))...)
+}
+
+func TestInspectOgg(t *testing.T) {
+	vorbis := make([]byte, 30)
+	copy(vorbis, "\x01vorbis")
+	vorbis[11] = 2
+	binary.LittleEndian.PutUint32(vorbis[12:16], 16000)
+
+	tests := map[string]struct {
+		b          []byte
+		codec      string
+		channels   uint
+		duration   int64
+		sampleRate uint
+	}{
+		"opus":           {opusFixture(), "opus", 1, 1000, 48000},
+		"opus multiplex": {append(opusFixture(), oggPage(2, 960000, make([]byte, 32))...), "opus", 1, 1000, 48000},
+		"opus head only": {opusFixture()[:47], "opus", 1, 0, 48000},
+		"vorbis":         {append(oggPage(1, 0, vorbis), oggPage(1, 32000, make([]byte, 32))...), "vorbis", 2, 2000, 16000},
+		"unknown codec":  {oggPage(1, 0, []byte("unknown")), "", 0, 0, 0},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := InspectAudio(test.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Codec != test.codec || info.Channels != test.channels || info.SampleRate != test.sampleRate || info.Duration.Milliseconds() != test.duration {
+				t.Errorf("unexpected audio info %+v", info)
+			}
+		})
+	}
+}
+
+func TestInspectOggInvalidPages(t *testing.T) {
+	head := opusFixture()[:47]
+
+	corrupt := opusFixture()
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	invalid := opusFixture()
+	copy(invalid[47:51], "OggX")
+
+	tests := map[string][]byte{
+		"truncated page header":   opusFixture()[:60],
+		"truncated segment table": append(append([]byte{}, head...), oggPage(1, 0, make([]byte, 32))[:27]...),
+		"truncated page body":     opusFixture()[:len(opusFixture())-1],
+		"checksum mismatch":       corrupt,
+		"invalid capture pattern": invalid,
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := InspectAudio(b); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	AUDIO_LOUDNORM_EBU  = "ebu"
+	AUDIO_LOUDNORM_LOUD = "loud"
+	AUDIO_LOUDNORM_NORM = "norm"
+	AUDIO_LOUDNORM_OFF  = "off"
+)
+
+// AudioFilters are the audio settings of a system or a talkgroup applied
+// when converting its calls. Unset values are inherited, from the system for
+// a talkgroup and from the audio conversion options for a system.
+type AudioFilters struct {
+	Gain           any `json:"gain"`
+	Highpass       any `json:"highpass"`
+	Loudnorm       any `json:"loudnorm"`
+	Lowpass        any `json:"lowpass"`
+	NoiseReduction any `json:"noiseReduction"`
+}
+
+func NewAudioFilters() *AudioFilters {
+	return &AudioFilters{}
+}
+
+func (audioFilters *AudioFilters) FromJson(s string) *AudioFilters {
+	m := map[string]any{}
+	if err := json.Unmarshal([]byte(s), &m); err == nil {
+		audioFilters.FromMap(m)
+	}
+
+	return audioFilters
+}
+
+func (audioFilters *AudioFilters) FromMap(m map[string]any) *AudioFilters {
+	switch v := m["gain"].(type) {
+	case float64:
+		if v != 0 {
+			audioFilters.Gain = v
+		}
+	}
+
+	switch v := m["highpass"].(type) {
+	case float64:
+		if v > 0 {
+			audioFilters.Highpass = uint(v)
+		}
+	}
+
+	switch v := m["loudnorm"].(type) {
+	case string:
+		switch v {
+		case AUDIO_LOUDNORM_EBU, AUDIO_LOUDNORM_LOUD, AUDIO_LOUDNORM_NORM, AUDIO_LOUDNORM_OFF:
+			audioFilters.Loudnorm = v
+		}
+	}
+
+	switch v := m["lowpass"].(type) {
+	case float64:
+		if v > 0 {
+			audioFilters.Lowpass = uint(v)
+		}
+	}
+
+	switch v := m["noiseReduction"].(type) {
+	case bool:
+		audioFilters.NoiseReduction = v
+	}
+
+	return audioFilters
+}
+
+// GetFilters returns the ffmpeg filters for the gain, the passbands and the
+// noise reduction, the loudness normalization aside.
+func (audioFilters *AudioFilters) GetFilters() []string {
+	filters := []string{}
+
+	switch v := audioFilters.Highpass.(type) {
+	case uint:
+		filters = append(filters, fmt.Sprintf("highpass=f=%d", v))
+	}
+
+	switch v := audioFilters.Lowpass.(type) {
+	case uint:
+		filters = append(filters, fmt.Sprintf("lowpass=f=%d", v))
+	}
+
+	switch v := audioFilters.NoiseReduction.(type) {
+	case bool:
+		if v {
+			filters = append(filters, "afftdn")
+		}
+	}
+
+	switch v := audioFilters.Gain.(type) {
+	case float64:
+		filters = append(filters, fmt.Sprintf("volume=%gdB", v))
+	}
+
+	return filters
+}
+
+// Merge returns the audio filters with the values set in the given ones
+// taking precedence.
+func (audioFilters *AudioFilters) Merge(other *AudioFilters) *AudioFilters {
+	merged := *audioFilters
+
+	if other == nil {
+		return &merged
+	}
+
+	if other.Gain != nil {
+		merged.Gain = other.Gain
+	}
+
+	if other.Highpass != nil {
+		merged.Highpass = other.Highpass
+	}
+
+	if other.Loudnorm != nil {
+		merged.Loudnorm = other.Loudnorm
+	}
+
+	if other.Lowpass != nil {
+		merged.Lowpass = other.Lowpass
+	}
+
+	if other.NoiseReduction != nil {
+		merged.NoiseReduction = other.NoiseReduction
+	}
+
+	return &merged
+}
+
+// Value returns the audio filters as stored in the database, nil when none is
+// set.
+func (audioFilters *AudioFilters) Value() any {
+	if audioFilters == nil || *audioFilters == (AudioFilters{}) {
+		return nil
+	}
+
+	if b, err := json.Marshal(audioFilters); err == nil {
+		return string(b)
+	}
+
+	return nil
+}
+
+func getLoudnormFilters(loudnorm string) []string {
+	switch loudnorm {
+	case AUDIO_LOUDNORM_EBU:
+		return []string{"apad=whole_dur=3s", "loudnorm=I=-23:TP=-1:LRA=7"}
+	case AUDIO_LOUDNORM_LOUD:
+		return []string{"apad=whole_dur=3s", "loudnorm=I=-16:TP=-1.5:LRA=11"}
+	case AUDIO_LOUDNORM_NORM:
+		return []string{"apad=whole_dur=3s", "loudnorm"}
+	}
+
+	return []string{}
+}
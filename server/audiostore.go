@@ -0,0 +1,213 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	AUDIO_STORE_DATABASE   = "database"
+	AUDIO_STORE_FILESYSTEM = "filesystem"
+	AUDIO_STORE_S3         = "s3"
+)
+
+// AudioBackend keeps audio files outside of the database, by key.
+type AudioBackend interface {
+	Delete(key string) error
+	Get(key string) ([]byte, error)
+	Put(key string, audio []byte, audioType string) error
+}
+
+// AudioStore puts the call audio in the configured backend. The calls keep a
+// reference made of the backend name and of the content hash of the audio,
+// so that identical files are stored once and that audio put in another
+// backend remains readable.
+type AudioStore struct {
+	Type     string
+	backends map[string]AudioBackend
+}
+
+func NewAudioStore(config *Config) (*AudioStore, error) {
+	store := &AudioStore{
+		Type:     config.AudioStore,
+		backends: map[string]AudioBackend{},
+	}
+
+	if len(store.Type) == 0 {
+		store.Type = AUDIO_STORE_DATABASE
+	}
+
+	store.backends[AUDIO_STORE_FILESYSTEM] = &FilesystemAudioBackend{Dir: config.GetAudioDirPath()}
+
+	if len(config.AudioS3Bucket) > 0 {
+		store.backends[AUDIO_STORE_S3] = &S3AudioBackend{
+			Bucket: config.AudioS3Bucket,
+			Client: NewS3Client(config.AudioS3Endpoint, config.AudioS3Region, config.AudioS3AccessKey, config.AudioS3SecretKey),
+		}
+	}
+
+	switch store.Type {
+	case AUDIO_STORE_DATABASE, AUDIO_STORE_FILESYSTEM:
+	case AUDIO_STORE_S3:
+		if store.backends[AUDIO_STORE_S3] == nil {
+			return nil, errors.New("audiostore: no s3 bucket configured")
+		}
+	default:
+		return nil, fmt.Errorf("audiostore: unknown audio store %s", store.Type)
+	}
+
+	return store, nil
+}
+
+func (store *AudioStore) Delete(ref string) error {
+	backend, key, err := store.resolve(ref)
+	if err != nil {
+		return err
+	}
+
+	if err = backend.Delete(key); err != nil {
+		return fmt.Errorf("audiostore.delete: %v", err)
+	}
+
+	return nil
+}
+
+func (store *AudioStore) Get(ref string) ([]byte, error) {
+	backend, key, err := store.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	audio, err := backend.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("audiostore.get: %v", err)
+	}
+
+	return audio, nil
+}
+
+// IsExternal tells whether the audio goes outside of the database.
+func (store *AudioStore) IsExternal() bool {
+	return store.Type != AUDIO_STORE_DATABASE
+}
+
+// Put stores the audio and returns its reference, or nil when the audio
+// belongs in the database.
+func (store *AudioStore) Put(audio []byte, audioType any) (any, error) {
+	if !store.IsExternal() || len(audio) == 0 {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256(audio)
+	hash := hex.EncodeToString(sum[:])
+	key := fmt.Sprintf("%s/%s/%s", hash[0:2], hash[2:4], hash)
+
+	kind, _ := audioType.(string)
+
+	if err := store.backends[store.Type].Put(key, audio, kind); err != nil {
+		return nil, fmt.Errorf("audiostore.put: %v", err)
+	}
+
+	return fmt.Sprintf("%s:%s", store.Type, key), nil
+}
+
+func (store *AudioStore) resolve(ref string) (AudioBackend, string, error) {
+	s := strings.SplitN(ref, ":", 2)
+	if len(s) != 2 {
+		return nil, "", fmt.Errorf("audiostore: invalid reference %s", ref)
+	}
+
+	backend := store.backends[s[0]]
+	if backend == nil {
+		return nil, "", fmt.Errorf("audiostore: no %s backend for %s", s[0], ref)
+	}
+
+	return backend, s[1], nil
+}
+
+type FilesystemAudioBackend struct {
+	Dir string
+}
+
+func (backend *FilesystemAudioBackend) Delete(key string) error {
+	if err := os.Remove(backend.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (backend *FilesystemAudioBackend) Get(key string) ([]byte, error) {
+	return os.ReadFile(backend.path(key))
+}
+
+func (backend *FilesystemAudioBackend) Put(key string, audio []byte, audioType string) error {
+	p := backend.path(key)
+
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(audio); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+func (backend *FilesystemAudioBackend) path(key string) string {
+	return filepath.Join(backend.Dir, filepath.FromSlash(key))
+}
+
+type S3AudioBackend struct {
+	Bucket string
+	Client *S3Client
+}
+
+func (backend *S3AudioBackend) Delete(key string) error {
+	return backend.Client.DeleteObject(backend.Bucket, key)
+}
+
+func (backend *S3AudioBackend) Get(key string) ([]byte, error) {
+	return backend.Client.GetObject(backend.Bucket, key)
+}
+
+func (backend *S3AudioBackend) Put(key string, audio []byte, audioType string) error {
+	return backend.Client.PutObject(backend.Bucket, key, audio, audioType)
+}
@@ -0,0 +1,782 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BACKUP_FILE_PREFIX = "rdio-scanner-"
+	BACKUP_FILE_SUFFIX = ".ndjson.gz"
+	BACKUP_FORMAT      = "rdio-scanner-backup"
+	BACKUP_VERSION     = 1
+
+	DATABASE_COLUMN_BLOB     = "blob"
+	DATABASE_COLUMN_BOOL     = "bool"
+	DATABASE_COLUMN_DATETIME = "datetime"
+	DATABASE_COLUMN_FLOAT    = "float"
+	DATABASE_COLUMN_INTEGER  = "integer"
+	DATABASE_COLUMN_TEXT     = "text"
+
+	DATABASE_TABLE_CALLS  = "calls"
+	DATABASE_TABLE_CONFIG = "config"
+	DATABASE_TABLE_LOGS   = "logs"
+)
+
+// DatabaseTable describes a table independently of the database type, so that
+// its rows can be moved from one type of database to another. The first column
+// is the primary key.
+type DatabaseTable struct {
+	Columns []*DatabaseColumn
+	Kind    string
+	Name    string
+}
+
+type DatabaseColumn struct {
+	Name string
+	Type string
+}
+
+func NewDatabaseTable(name string, kind string, columns ...string) *DatabaseTable {
+	table := &DatabaseTable{Columns: []*DatabaseColumn{}, Kind: kind, Name: name}
+
+	for _, column := range columns {
+		if s := strings.Fields(column); len(s) == 2 {
+			table.Columns = append(table.Columns, &DatabaseColumn{Name: s[0], Type: s[1]})
+		}
+	}
+
+	return table
+}
+
+// databaseTables are the tables holding the data of the server. The migrations
+// table and the full text index, which is rebuilt from the calls, are left out.
+var databaseTables = []*DatabaseTable{
+	NewDatabaseTable("rdioScannerAccesses", DATABASE_TABLE_CONFIG, "_id integer", "code text", "expiration datetime", "ident text", "limit integer", "order integer", "systems text"),
+	NewDatabaseTable("rdioScannerAlertRules", DATABASE_TABLE_CONFIG, "_id integer", "disabled bool", "groups text", "label text", "matchTalkgroup bool", "matchTranscript bool", "matchUnits bool", "order integer", "pattern text", "regex bool", "systems text", "tags text", "webhook text"),
+	NewDatabaseTable("rdioScannerApiKeys", DATABASE_TABLE_CONFIG, "_id integer", "disabled bool", "ident text", "key text", "order integer", "systems text", "timeZone text"),
+	NewDatabaseTable("rdioScannerBucketWatches", DATABASE_TABLE_CONFIG, "_id integer", "accessKey text", "afterIngest text", "bucket text", "disabled bool", "endpoint text", "extension text", "frequency integer", "interval integer", "mask text", "order integer", "prefix text", "region text", "secretKey text", "systemId integer", "talkgroupId integer", "timeZone text", "type text"),
+	NewDatabaseTable("rdioScannerBucketWatchObjects", DATABASE_TABLE_CONFIG, "_id integer", "bucketWatchId integer", "dateTime datetime", "etag text", "objectKey text"),
+	NewDatabaseTable("rdioScannerConfigs", DATABASE_TABLE_CONFIG, "_id integer", "key text", "val text"),
+	NewDatabaseTable("rdioScannerDirWatches", DATABASE_TABLE_CONFIG, "_id integer", "delay integer", "deleteAfter bool", "directory text", "disabled bool", "extension text", "frequency integer", "mask text", "order integer", "systemId integer", "talkgroupId integer", "timeZone text", "type text", "usePolling bool"),
+	NewDatabaseTable("rdioScannerDownstreams", DATABASE_TABLE_CONFIG, "_id integer", "apiKey text", "disabled bool", "order integer", "systems text", "url text"),
+	NewDatabaseTable("rdioScannerGroups", DATABASE_TABLE_CONFIG, "_id integer", "label text"),
+	NewDatabaseTable("rdioScannerProfiles", DATABASE_TABLE_CONFIG, "_id integer", "bitrate integer", "channels integer", "codec text", "container text", "filters text", "label text", "order integer", "sampleRate integer"),
+	NewDatabaseTable("rdioScannerRetentionRules", DATABASE_TABLE_CONFIG, "_id integer", "days integer", "disabled bool", "groupId integer", "keepForever bool", "label text", "order integer", "systemId integer", "tagId integer", "talkgroupId integer"),
+	NewDatabaseTable("rdioScannerSystems", DATABASE_TABLE_CONFIG, "_id integer", "audioFilters text", "autoPopulate bool", "blacklists text", "id integer", "label text", "led text", "minVoiceDuration integer", "order integer", "profileId integer", "trimSilence bool"),
+	NewDatabaseTable("rdioScannerTags", DATABASE_TABLE_CONFIG, "_id integer", "label text"),
+	NewDatabaseTable("rdioScannerTalkgroups", DATABASE_TABLE_CONFIG, "_id integer", "audioFilters text", "frequency integer", "groupId integer", "id integer", "label text", "led text", "name text", "order integer", "profileId integer", "systemId integer", "tagId integer"),
+	NewDatabaseTable("rdioScannerToneSets", DATABASE_TABLE_CONFIG, "_id integer", "aDuration integer", "aTone float", "bDuration integer", "bTone float", "label text", "order integer", "systems text", "tolerance float"),
+	NewDatabaseTable("rdioScannerUnits", DATABASE_TABLE_CONFIG, "_id integer", "id integer", "label text", "order integer", "systemId integer"),
+	NewDatabaseTable("rdioScannerCalls", DATABASE_TABLE_CALLS, "id integer", "audio blob", "audioName text", "audioRef text", "audioType text", "dateTime datetime", "duration integer", "fingerprint blob", "frequencies text", "frequency integer", "originalAudio blob", "originalAudioName text", "originalAudioRef text", "originalAudioType text", "patches text", "restoredAt datetime", "source integer", "sources text", "system integer", "talkgroup integer", "toneSets text", "transcript text", "waveform blob"),
+	NewDatabaseTable("rdioScannerAlerts", DATABASE_TABLE_CALLS, "_id integer", "alertRuleId integer", "callId integer", "dateTime datetime", "field text", "label text", "matched text", "system integer", "talkgroup integer"),
+	NewDatabaseTable("rdioScannerLogs", DATABASE_TABLE_LOGS, "_id integer", "dateTime datetime", "level text", "message text"),
+}
+
+// GetDatabaseTables returns the tables of the configuration, along with the
+// ones of the calls and of the logs when asked for.
+func GetDatabaseTables(calls bool, logs bool) []*DatabaseTable {
+	tables := []*DatabaseTable{}
+
+	for _, table := range databaseTables {
+		switch table.Kind {
+		case DATABASE_TABLE_CALLS:
+			if !calls {
+				continue
+			}
+		case DATABASE_TABLE_LOGS:
+			if !logs {
+				continue
+			}
+		}
+		tables = append(tables, table)
+	}
+
+	return tables
+}
+
+func GetDatabaseTable(name string) *DatabaseTable {
+	for _, table := range databaseTables {
+		if table.Name == name {
+			return table
+		}
+	}
+
+	return nil
+}
+
+func (table *DatabaseTable) GetColumn(name string) *DatabaseColumn {
+	for _, column := range table.Columns {
+		if column.Name == name {
+			return column
+		}
+	}
+
+	return nil
+}
+
+func (table *DatabaseTable) GetColumnNames() []string {
+	names := []string{}
+
+	for _, column := range table.Columns {
+		names = append(names, column.Name)
+	}
+
+	return names
+}
+
+// FromSql converts a value read from any type of database to an int64, a
+// float64, a bool, a string, a []byte, a time.Time or nil.
+func (column *DatabaseColumn) FromSql(db *Database, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	unexpected := fmt.Errorf("column %s: unexpected %T value", column.Name, v)
+
+	text, isText := "", false
+	switch v := v.(type) {
+	case []byte:
+		text, isText = string(v), true
+	case string:
+		text, isText = v, true
+	}
+
+	switch column.Type {
+	case DATABASE_COLUMN_BLOB:
+		switch v := v.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+
+	case DATABASE_COLUMN_BOOL:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		}
+		if isText {
+			return strconv.ParseBool(text)
+		}
+
+	case DATABASE_COLUMN_DATETIME:
+		if t, ok := v.(time.Time); ok {
+			return t.UTC(), nil
+		}
+		if isText {
+			for _, layout := range []string{db.DateTimeFormat, "2006-01-02 15:04:05.999999999 -0700 MST", time.RFC3339Nano, "2006-01-02 15:04:05.999999999"} {
+				if t, err := time.Parse(layout, text); err == nil {
+					return t.UTC(), nil
+				}
+			}
+			return nil, fmt.Errorf("column %s: invalid datetime %s", column.Name, text)
+		}
+
+	case DATABASE_COLUMN_FLOAT:
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+		if isText {
+			return strconv.ParseFloat(text, 64)
+		}
+
+	case DATABASE_COLUMN_INTEGER:
+		switch v := v.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			return int64(math.Round(v)), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		if isText {
+			return strconv.ParseInt(text, 10, 64)
+		}
+
+	case DATABASE_COLUMN_TEXT:
+		if isText {
+			return text, nil
+		}
+		switch v := v.(type) {
+		case int64, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	}
+
+	return nil, unexpected
+}
+
+// FromJson converts a value decoded from json with numbers kept as
+// json.Number to the type of the column.
+func (column *DatabaseColumn) FromJson(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	invalid := fmt.Errorf("column %s: invalid value %v", column.Name, v)
+
+	switch column.Type {
+	case DATABASE_COLUMN_BLOB:
+		if s, ok := v.(string); ok {
+			return base64.StdEncoding.DecodeString(s)
+		}
+
+	case DATABASE_COLUMN_BOOL:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+
+	case DATABASE_COLUMN_DATETIME:
+		if s, ok := v.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+
+	case DATABASE_COLUMN_FLOAT:
+		if n, ok := v.(json.Number); ok {
+			return n.Float64()
+		}
+
+	case DATABASE_COLUMN_INTEGER:
+		if n, ok := v.(json.Number); ok {
+			return n.Int64()
+		}
+
+	case DATABASE_COLUMN_TEXT:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	}
+
+	return nil, invalid
+}
+
+// ReadTable reads the rows of a table within a transaction, the values being
+// converted with FromSql in the order of the columns of the table.
+func (db *Database) ReadTable(tx *sql.Tx, table *DatabaseTable, where *Query, fn func(values []any) error) error {
+	formatError := func(err error) error {
+		return fmt.Errorf("%s: %v", table.Name, err)
+	}
+
+	query := db.NewQuery(fmt.Sprintf("select `%s` from `%s`", strings.Join(table.GetColumnNames(), "`, `"), table.Name))
+	if where != nil {
+		query.Append(" where ").AppendQuery(where)
+	}
+	query.Append(fmt.Sprintf(" order by `%s`", table.Columns[0].Name))
+
+	rows, err := query.QueryTx(tx)
+	if err != nil {
+		return formatError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values := make([]any, len(table.Columns))
+		ptrs := make([]any, len(table.Columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err = rows.Scan(ptrs...); err != nil {
+			return formatError(err)
+		}
+
+		for i, column := range table.Columns {
+			if values[i], err = column.FromSql(db, values[i]); err != nil {
+				return formatError(err)
+			}
+		}
+
+		if err = fn(values); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+// TableWriter inserts rows into a table, several rows per statement. Without
+// a transaction, each statement commits its rows on its own.
+type TableWriter struct {
+	Count   uint
+	columns []string
+	db      *Database
+	rows    [][]any
+	size    int
+	table   *DatabaseTable
+	tx      *sql.Tx
+}
+
+func (db *Database) NewTableWriter(tx *sql.Tx, table *DatabaseTable, columns []string) *TableWriter {
+	return &TableWriter{columns: columns, db: db, rows: [][]any{}, table: table, tx: tx}
+}
+
+func (writer *TableWriter) Add(values []any) error {
+	writer.rows = append(writer.rows, values)
+
+	for _, v := range values {
+		switch v := v.(type) {
+		case []byte:
+			writer.size += len(v)
+		case string:
+			writer.size += len(v)
+		default:
+			writer.size += 8
+		}
+	}
+
+	if len(writer.rows) >= 100 || writer.size >= 4<<20 {
+		return writer.Flush()
+	}
+
+	return nil
+}
+
+func (writer *TableWriter) Flush() error {
+	if len(writer.rows) == 0 {
+		return nil
+	}
+
+	query := writer.db.NewQuery(fmt.Sprintf("insert into `%s` (`%s`) values ", writer.table.Name, strings.Join(writer.columns, "`, `")))
+
+	for i, row := range writer.rows {
+		if i > 0 {
+			query.Append(", ")
+		}
+		query.Append(Placeholders(len(row)), row...)
+	}
+
+	var err error
+
+	if writer.tx != nil {
+		_, err = query.ExecTx(writer.tx)
+	} else {
+		_, err = query.Exec()
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %v", writer.table.Name, err)
+	}
+
+	writer.Count += uint(len(writer.rows))
+	writer.rows = [][]any{}
+	writer.size = 0
+
+	return nil
+}
+
+// ResetSequence makes the next generated id of a table follow the restored
+// rows. Only postgres needs it, its sequences being unaware of the ids given
+// on insert.
+func (db *Database) ResetSequence(tx *sql.Tx, table *DatabaseTable) error {
+	if db.Config.DbType != DbTypePostgresql {
+		return nil
+	}
+
+	key := table.Columns[0].Name
+	query := fmt.Sprintf("select setval(pg_get_serial_sequence('%s', '%s'), coalesce(max(%s), 0) + 1, false) from %s", strings.ToLower(table.Name), strings.ToLower(key), key, table.Name)
+
+	var err error
+
+	if tx != nil {
+		_, err = tx.Exec(query)
+	} else {
+		_, err = db.Sql.Exec(query)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %v", table.Name, err)
+	}
+
+	return nil
+}
+
+// BackupHeader is the first line of a backup. A backup is a gzipped json
+// stream, each table being a line with its name and columns followed by a line
+// per row, and which ends with a line marking it complete.
+type BackupHeader struct {
+	CreatedAt time.Time `json:"createdAt"`
+	DbType    string    `json:"dbType"`
+	Format    string    `json:"format"`
+	Schema    uint64    `json:"schema"`
+	Version   uint      `json:"version"`
+}
+
+type BackupTable struct {
+	Columns  []string `json:"columns,omitempty"`
+	Complete bool     `json:"complete,omitempty"`
+	Table    string   `json:"table,omitempty"`
+}
+
+// Backup writes a snapshot of the tables of the configuration, and optionally
+// of the calls and the logs. The tables are read within a single transaction,
+// so that the snapshot is consistent while the server is running. The audio
+// kept in an external audio store is copied into the backup in place of its
+// reference, so that the backup does not depend on the store.
+func (db *Database) Backup(w io.Writer, calls bool, logs bool) (map[string]uint, error) {
+	var (
+		counts = map[string]uint{}
+		err    error
+		tx     *sql.Tx
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("database.backup: %v", err)
+	}
+
+	status, err := db.GetMigrationsStatus()
+	if err != nil {
+		return nil, formatError(err)
+	} else if !status.IsValid() {
+		return nil, formatError(errors.New("the database schema does not match this version"))
+	}
+
+	if tx, err = db.beginSnapshot(); err != nil {
+		return nil, formatError(err)
+	}
+	defer tx.Rollback()
+
+	gz := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gz)
+
+	header := &BackupHeader{
+		CreatedAt: time.Now().UTC(),
+		DbType:    db.Config.DbType,
+		Format:    BACKUP_FORMAT,
+		Schema:    status.Current,
+		Version:   BACKUP_VERSION,
+	}
+
+	if err = encoder.Encode(header); err != nil {
+		return nil, formatError(err)
+	}
+
+	for _, table := range GetDatabaseTables(calls, logs) {
+		if err = encoder.Encode(&BackupTable{Columns: table.GetColumnNames(), Table: table.Name}); err != nil {
+			return nil, formatError(err)
+		}
+
+		counts[table.Name] = 0
+
+		inline := db.inlineAudio(table)
+
+		err = db.ReadTable(tx, table, nil, func(values []any) error {
+			if err := inline(values); err != nil {
+				return err
+			}
+			counts[table.Name]++
+			return encoder.Encode(values)
+		})
+		if err != nil {
+			return nil, formatError(err)
+		}
+	}
+
+	if err = encoder.Encode(&BackupTable{Complete: true}); err != nil {
+		return nil, formatError(err)
+	}
+
+	if err = gz.Close(); err != nil {
+		return nil, formatError(err)
+	}
+
+	return counts, nil
+}
+
+// Restore replaces the rows of the tables found in a backup, within a single
+// transaction. The database must already be migrated, and a backup made by a
+// more recent schema is refused. The full text index is emptied along with the
+// calls, and rebuilt by the server when it starts.
+func (db *Database) Restore(r io.Reader) (map[string]uint, error) {
+	var (
+		columns  []*DatabaseColumn
+		complete bool
+		counts   = map[string]uint{}
+		err      error
+		header   BackupHeader
+		table    *DatabaseTable
+		tx       *sql.Tx
+		writer   *TableWriter
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("database.restore: %v", err)
+	}
+
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, formatError(err)
+	}
+	defer gz.Close()
+
+	decoder := json.NewDecoder(gz)
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&header); err != nil || header.Format != BACKUP_FORMAT {
+		return nil, formatError(errors.New("not a backup file"))
+	} else if header.Version > BACKUP_VERSION {
+		return nil, formatError(fmt.Errorf("backup format version %d is not supported", header.Version))
+	}
+
+	status, err := db.GetMigrationsStatus()
+	if err != nil {
+		return nil, formatError(err)
+	} else if !status.IsValid() {
+		return nil, formatError(errors.New("the database schema does not match this version"))
+	} else if header.Schema > status.Current {
+		return nil, formatError(fmt.Errorf("backup of schema version %d is newer than the database schema version %d", header.Schema, status.Current))
+	}
+
+	if tx, err = db.Sql.Begin(); err != nil {
+		return nil, formatError(err)
+	}
+	defer tx.Rollback()
+
+	endTable := func() error {
+		if writer == nil {
+			return nil
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		counts[table.Name] = writer.Count
+		return db.ResetSequence(tx, table)
+	}
+
+	for !complete {
+		var line json.RawMessage
+
+		if err = decoder.Decode(&line); err == io.EOF {
+			return nil, formatError(errors.New("incomplete backup file"))
+		} else if err != nil {
+			return nil, formatError(err)
+		}
+
+		if len(line) > 0 && line[0] == '{' {
+			var next BackupTable
+
+			if err = json.Unmarshal(line, &next); err != nil {
+				return nil, formatError(err)
+			}
+
+			if err = endTable(); err != nil {
+				return nil, formatError(err)
+			}
+
+			if next.Complete {
+				complete = true
+				break
+			}
+
+			if table = GetDatabaseTable(next.Table); table == nil {
+				return nil, formatError(fmt.Errorf("unknown table %s", next.Table))
+			}
+
+			// the columns dropped since the backup was made are skipped, and the
+			// ones added since get their default values
+			columns = []*DatabaseColumn{}
+			names := []string{}
+			for _, name := range next.Columns {
+				column := table.GetColumn(name)
+				columns = append(columns, column)
+				if column != nil {
+					names = append(names, column.Name)
+				}
+			}
+
+			if _, err = db.NewQuery(fmt.Sprintf("delete from `%s`", table.Name)).ExecTx(tx); err != nil {
+				return nil, formatError(fmt.Errorf("%s: %v", table.Name, err))
+			}
+
+			if table.Name == "rdioScannerCalls" {
+				if _, err = db.NewQuery("delete from `rdioScannerCallsText`").ExecTx(tx); err != nil {
+					return nil, formatError(err)
+				}
+			}
+
+			writer = db.NewTableWriter(tx, table, names)
+			continue
+		}
+
+		if writer == nil {
+			return nil, formatError(errors.New("row outside of a table"))
+		}
+
+		var values []any
+
+		row := []any{}
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+		if err = d.Decode(&values); err != nil || len(values) != len(columns) {
+			return nil, formatError(fmt.Errorf("%s: invalid row", table.Name))
+		}
+
+		for i, column := range columns {
+			if column == nil {
+				continue
+			}
+			v, err := column.FromJson(values[i])
+			if err != nil {
+				return nil, formatError(fmt.Errorf("%s: %v", table.Name, err))
+			}
+			row = append(row, v)
+		}
+
+		if err = writer.Add(row); err != nil {
+			return nil, formatError(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, formatError(err)
+	}
+
+	return counts, nil
+}
+
+// inlineAudio returns a function which replaces the references of the audio
+// of a row of the calls by the audio itself, read from the audio store.
+func (db *Database) inlineAudio(table *DatabaseTable) func(values []any) error {
+	pairs := [][2]int{}
+
+	if table.Name == "rdioScannerCalls" {
+		names := table.GetColumnNames()
+		index := func(name string) int {
+			for i, n := range names {
+				if n == name {
+					return i
+				}
+			}
+			return -1
+		}
+		pairs = append(pairs, [2]int{index("audio"), index("audioRef")}, [2]int{index("originalAudio"), index("originalAudioRef")})
+	}
+
+	return func(values []any) error {
+		for _, pair := range pairs {
+			ref, ok := values[pair[1]].(string)
+			if !ok || len(ref) == 0 {
+				continue
+			}
+			audio, err := db.AudioStore.Get(ref)
+			if err != nil {
+				return fmt.Errorf("%s: %v", ref, err)
+			}
+			values[pair[0]], values[pair[1]] = audio, nil
+		}
+		return nil
+	}
+}
+
+// beginSnapshot starts a read only transaction which sees the database as it
+// was when it started. A sqlite transaction keeps its snapshot from its first
+// read, and does not hold back the writers as the database is opened with a
+// write ahead log.
+func (db *Database) beginSnapshot() (*sql.Tx, error) {
+	if db.Config.DbType == DbTypeSqlite {
+		return db.Sql.Begin()
+	}
+
+	return db.Sql.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// GetBackupFiles returns the backups of a folder, the most recent first.
+func GetBackupFiles(dir string) ([]string, error) {
+	files := []string{}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return files, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), BACKUP_FILE_PREFIX) && strings.HasSuffix(entry.Name(), BACKUP_FILE_SUFFIX) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	// the file names hold their utc time stamp
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	return files, nil
+}
+
+// WriteBackupFile writes a backup in a folder, under a name made of the
+// current time, and returns its path. The file only gets its name once
+// complete.
+func (db *Database) WriteBackupFile(dir string, calls bool, logs bool) (string, map[string]uint, error) {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return "", nil, err
+	}
+
+	p := filepath.Join(dir, BACKUP_FILE_PREFIX+time.Now().UTC().Format("20060102T150405Z")+BACKUP_FILE_SUFFIX)
+
+	f, err := os.CreateTemp(dir, ".tmp*")
+	if err != nil {
+		return "", nil, err
+	}
+
+	counts, err := db.Backup(f, calls, logs)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return "", nil, err
+	}
+
+	return p, counts, nil
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BestCopies holds the copies of a call received from overlapping recorders
+// until the best copy window closes, so that only the best one is stored.
+type BestCopies struct {
+	controller *Controller
+	holds      []*BestCopyHold
+	mutex      sync.Mutex
+}
+
+type BestCopyHold struct {
+	Calls     []*Call
+	System    *System
+	Talkgroup *Talkgroup
+	releasing bool
+	timer     *time.Timer
+}
+
+func NewBestCopies(controller *Controller) *BestCopies {
+	return &BestCopies{
+		controller: controller,
+		holds:      []*BestCopyHold{},
+		mutex:      sync.Mutex{},
+	}
+}
+
+// Flush stores the best copy of every pending hold right away.
+func (bestCopies *BestCopies) Flush() {
+	bestCopies.mutex.Lock()
+	holds := bestCopies.holds
+	bestCopies.mutex.Unlock()
+
+	for _, hold := range holds {
+		if hold.timer.Stop() {
+			bestCopies.release(hold)
+		}
+	}
+}
+
+// Hold adds the call to the pending hold of another copy of the same call, or
+// opens a new hold for it. It returns false when the call is a duplicate of a
+// call already stored, or of a call being stored from a released hold.
+func (bestCopies *BestCopies) Hold(call *Call, system *System, talkgroup *Talkgroup) bool {
+	controller := bestCopies.controller
+	options := controller.Options
+
+	bestCopies.mutex.Lock()
+	defer bestCopies.mutex.Unlock()
+
+	timeFrame := time.Duration(options.DuplicateDetectionTimeFrame) * time.Millisecond
+
+	for _, hold := range bestCopies.holds {
+		first := hold.Calls[0]
+
+		if first.System != call.System || first.Talkgroup != call.Talkgroup {
+			continue
+		}
+
+		if d := first.DateTime.Sub(call.DateTime); d > timeFrame || d < -timeFrame {
+			continue
+		}
+
+		if call.IsDuplicateOf(first, options) {
+			if hold.releasing {
+				return false
+			}
+			hold.Calls = append(hold.Calls, call)
+			return true
+		}
+	}
+
+	if controller.Calls.CheckDuplicate(call, options, controller.Database) {
+		return false
+	}
+
+	hold := &BestCopyHold{
+		Calls:     []*Call{call},
+		System:    system,
+		Talkgroup: talkgroup,
+	}
+
+	hold.timer = time.AfterFunc(time.Duration(options.BestCopyWindow)*time.Millisecond, func() {
+		bestCopies.release(hold)
+	})
+
+	bestCopies.holds = append(bestCopies.holds, hold)
+
+	return true
+}
+
+// release stores the best copy of the hold. The hold stays registered until
+// the call is written, so that the late copies are rejected instead of being
+// stored while the best one is not yet in the database.
+func (bestCopies *BestCopies) release(hold *BestCopyHold) {
+	controller := bestCopies.controller
+
+	bestCopies.mutex.Lock()
+	hold.releasing = true
+	bestCopies.mutex.Unlock()
+
+	defer func() {
+		bestCopies.mutex.Lock()
+		for i, h := range bestCopies.holds {
+			if h == hold {
+				bestCopies.holds = append(bestCopies.holds[:i], bestCopies.holds[i+1:]...)
+				break
+			}
+		}
+		bestCopies.mutex.Unlock()
+	}()
+
+	best, reason := hold.Best()
+
+	if len(hold.Calls) > 1 {
+		controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("bestcopy: system=%v talkgroup=%v file=%v kept out of %v copies, %v", best.System, best.Talkgroup, best.AudioName, len(hold.Calls), reason))
+
+		for _, call := range hold.Calls {
+			if call != best {
+				controller.logCall(call, LogLevelWarn, "duplicate call rejected")
+			}
+		}
+	}
+
+	controller.storeCall(best, hold.System, hold.Talkgroup)
+}
+
+// Best returns the copy with the fewest decode errors, or else the longest
+// one, along with the reason for the choice.
+func (hold *BestCopyHold) Best() (*Call, string) {
+	best := hold.Calls[0]
+	bestErrors, bestDuration := getCallQuality(best)
+
+	for _, call := range hold.Calls[1:] {
+		errors, duration := getCallQuality(call)
+		if errors < bestErrors || (errors == bestErrors && duration > bestDuration) {
+			best, bestErrors, bestDuration = call, errors, duration
+		}
+	}
+
+	reason := fmt.Sprintf("fewest decode errors (%v)", bestErrors)
+
+	for _, call := range hold.Calls {
+		if call == best {
+			continue
+		}
+
+		if errors, duration := getCallQuality(call); errors == bestErrors {
+			if duration < bestDuration {
+				reason = fmt.Sprintf("longest duration (%v)", bestDuration)
+			} else {
+				reason = "first received"
+				break
+			}
+		}
+	}
+
+	return best, reason
+}
+
+// getCallQuality returns the total of the error and spike counts reported by
+// the recorder, and the audio duration, which is 0 when it cannot be read from
+// the audio.
+func getCallQuality(call *Call) (errors uint, duration time.Duration) {
+	switch v := call.Frequencies.(type) {
+	case []map[string]any:
+		for _, f := range v {
+			if n, ok := f["errorCount"].(uint); ok {
+				errors += n
+			}
+			if n, ok := f["spikeCount"].(uint); ok {
+				errors += n
+			}
+		}
+	}
+
+	if info, err := InspectAudio(call.Audio); err == nil {
+		duration = info.Duration
+	}
+
+	return errors, duration
+}
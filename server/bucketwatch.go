@@ -0,0 +1,707 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BucketwatchAfterIngestDelete = "delete"
+	BucketwatchAfterIngestTag    = "tag"
+)
+
+// Bucketwatch polls a prefix of an S3-compatible bucket and ingests new
+// objects with the same parsers as a Dirwatch of the same type. Ingested
+// objects are recorded in rdioScannerBucketWatchObjects so that they are never
+// imported twice, even when they cannot be deleted or tagged afterward.
+type Bucketwatch struct {
+	Id          any    `json:"_id"`
+	AccessKey   string `json:"accessKey"`
+	AfterIngest any    `json:"afterIngest"`
+	Bucket      string `json:"bucket"`
+	Disabled    bool   `json:"disabled"`
+	Endpoint    string `json:"endpoint"`
+	Extension   any    `json:"extension"`
+	Frequency   any    `json:"frequency"`
+	Interval    any    `json:"interval"`
+	Mask        any    `json:"mask"`
+	Order       any    `json:"order"`
+	Prefix      any    `json:"prefix"`
+	Region      any    `json:"region"`
+	SecretKey   string `json:"secretKey"`
+	SystemId    any    `json:"systemId"`
+	TalkgroupId any    `json:"talkgroupId"`
+	TimeZone    any    `json:"timeZone"`
+	Kind        any    `json:"type"`
+	client      *S3Client
+	controller  *Controller
+	done        chan struct{}
+	failed      map[string]string
+	location    *time.Location
+	mutex       sync.Mutex
+	stop        chan struct{}
+}
+
+func NewBucketwatch() *Bucketwatch {
+	return &Bucketwatch{
+		failed: map[string]string{},
+		mutex:  sync.Mutex{},
+	}
+}
+
+func (bucketwatch *Bucketwatch) FromMap(m map[string]any) *Bucketwatch {
+	switch v := m["_id"].(type) {
+	case float64:
+		bucketwatch.Id = uint(v)
+	}
+
+	switch v := m["accessKey"].(type) {
+	case string:
+		bucketwatch.AccessKey = v
+	}
+
+	switch v := m["afterIngest"].(type) {
+	case string:
+		bucketwatch.AfterIngest = v
+	}
+
+	switch v := m["bucket"].(type) {
+	case string:
+		bucketwatch.Bucket = v
+	}
+
+	switch v := m["disabled"].(type) {
+	case bool:
+		bucketwatch.Disabled = v
+	}
+
+	switch v := m["endpoint"].(type) {
+	case string:
+		bucketwatch.Endpoint = v
+	}
+
+	switch v := m["extension"].(type) {
+	case string:
+		bucketwatch.Extension = v
+	}
+
+	switch v := m["frequency"].(type) {
+	case float64:
+		bucketwatch.Frequency = uint(v)
+	}
+
+	switch v := m["interval"].(type) {
+	case float64:
+		bucketwatch.Interval = uint(v)
+	}
+
+	switch v := m["mask"].(type) {
+	case string:
+		bucketwatch.Mask = v
+	}
+
+	switch v := m["order"].(type) {
+	case float64:
+		bucketwatch.Order = uint(v)
+	}
+
+	switch v := m["prefix"].(type) {
+	case string:
+		bucketwatch.Prefix = v
+	}
+
+	switch v := m["region"].(type) {
+	case string:
+		bucketwatch.Region = v
+	}
+
+	switch v := m["secretKey"].(type) {
+	case string:
+		bucketwatch.SecretKey = v
+	}
+
+	switch v := m["systemId"].(type) {
+	case float64:
+		bucketwatch.SystemId = uint(v)
+	}
+
+	switch v := m["talkgroupId"].(type) {
+	case float64:
+		bucketwatch.TalkgroupId = uint(v)
+	}
+
+	switch v := m["timeZone"].(type) {
+	case string:
+		bucketwatch.TimeZone = v
+	}
+
+	bucketwatch.location, _ = loadLocation(bucketwatch.TimeZone)
+
+	switch v := m["type"].(type) {
+	case string:
+		bucketwatch.Kind = v
+	}
+
+	return bucketwatch
+}
+
+func (bucketwatch *Bucketwatch) Poll() error {
+	var (
+		dirwatch = bucketwatch.dirwatch()
+		prefix   string
+	)
+
+	switch v := bucketwatch.Prefix.(type) {
+	case string:
+		prefix = v
+	}
+
+	objects, err := bucketwatch.client.ListObjects(bucketwatch.Bucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]S3Object{}
+	for _, object := range objects {
+		keys[object.Key] = object
+	}
+
+	// the failed objects no longer listed are forgotten
+	for key := range bucketwatch.failed {
+		if _, ok := keys[key]; !ok {
+			delete(bucketwatch.failed, key)
+		}
+	}
+
+	ingested, err := bucketwatch.ingested()
+	if err != nil {
+		return err
+	}
+
+	audioExt := dirwatch.audioExtension()
+
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+
+		related := []S3Object{object}
+
+		switch dirwatch.Kind {
+		case DirwatchTypeTrunkRecorder:
+			if !strings.EqualFold(path.Ext(object.Key), ".json") {
+				continue
+			}
+			audio, ok := keys[strings.TrimSuffix(object.Key, path.Ext(object.Key))+audioExt]
+			if !ok {
+				continue
+			}
+			related = append(related, audio)
+		default:
+			if !strings.EqualFold(path.Ext(object.Key), audioExt) {
+				continue
+			}
+		}
+
+		if etag, ok := ingested[object.Key]; ok && etag == object.ETag {
+			if bucketwatch.AfterIngest != BucketwatchAfterIngestTag {
+				if err := bucketwatch.afterIngest(related); err != nil {
+					bucketwatch.logError(err, object.Key)
+				}
+			}
+			continue
+		}
+
+		if err := bucketwatch.ingest(dirwatch, related); err != nil {
+			bucketwatch.logError(err, object.Key)
+		}
+	}
+
+	return nil
+}
+
+func (bucketwatch *Bucketwatch) Start(controller *Controller) error {
+	var interval time.Duration
+
+	if bucketwatch.Disabled {
+		return nil
+	}
+
+	if bucketwatch.stop != nil {
+		return errors.New("bucketwatch.start: already started")
+	}
+
+	if len(bucketwatch.Bucket) == 0 || len(bucketwatch.Endpoint) == 0 {
+		return errors.New("bucketwatch.start: no bucket or endpoint")
+	}
+
+	switch v := bucketwatch.Interval.(type) {
+	case uint:
+		interval = time.Duration(math.Max(float64(v), 10)) * time.Second
+	default:
+		interval = time.Duration(defaults.bucketwatch.interval) * time.Second
+	}
+
+	region := ""
+	switch v := bucketwatch.Region.(type) {
+	case string:
+		region = v
+	}
+
+	bucketwatch.controller = controller
+	bucketwatch.client = NewS3Client(bucketwatch.Endpoint, region, bucketwatch.AccessKey, bucketwatch.SecretKey)
+	bucketwatch.done = make(chan struct{})
+	bucketwatch.stop = make(chan struct{})
+
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+
+		defer func() {
+			switch v := recover().(type) {
+			case error:
+				controller.Logs.LogEvent(LogLevelError, v.Error())
+			}
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			bucketwatch.mutex.Lock()
+			if err := bucketwatch.Poll(); err != nil {
+				controller.Logs.LogEvent(LogLevelError, fmt.Sprintf("bucketwatch.poll: %s, %s", err.Error(), bucketwatch.Bucket))
+			}
+			bucketwatch.mutex.Unlock()
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(bucketwatch.stop, bucketwatch.done)
+
+	return nil
+}
+
+// Stop stops the polling and waits for a poll in progress to end, so that no
+// object is ingested once it returns.
+func (bucketwatch *Bucketwatch) Stop() {
+	if bucketwatch.stop != nil {
+		close(bucketwatch.stop)
+		<-bucketwatch.done
+		bucketwatch.done = nil
+		bucketwatch.stop = nil
+	}
+}
+
+func (bucketwatch *Bucketwatch) afterIngest(objects []S3Object) error {
+	switch bucketwatch.AfterIngest {
+	case BucketwatchAfterIngestTag:
+		for _, object := range objects {
+			if err := bucketwatch.client.PutObjectTagging(bucketwatch.Bucket, object.Key, map[string]string{"rdio-scanner": "ingested"}); err != nil {
+				return err
+			}
+		}
+
+	default:
+		for _, object := range objects {
+			if err := bucketwatch.client.DeleteObject(bucketwatch.Bucket, object.Key); err != nil {
+				return err
+			}
+		}
+
+		return bucketwatch.forget(objects[0])
+	}
+
+	return nil
+}
+
+func (bucketwatch *Bucketwatch) dirwatch() *Dirwatch {
+	dirwatch := NewDirwatch()
+
+	dirwatch.controller = bucketwatch.controller
+	dirwatch.Extension = bucketwatch.Extension
+	dirwatch.Frequency = bucketwatch.Frequency
+	dirwatch.Kind = bucketwatch.Kind
+	dirwatch.Mask = bucketwatch.Mask
+	dirwatch.SystemId = bucketwatch.SystemId
+	dirwatch.TalkgroupId = bucketwatch.TalkgroupId
+	dirwatch.TimeZone = bucketwatch.TimeZone
+	dirwatch.location = bucketwatch.location
+
+	return dirwatch
+}
+
+func (bucketwatch *Bucketwatch) forget(object S3Object) error {
+	db := bucketwatch.controller.Database
+
+	if _, err := db.NewQuery("delete from `rdioScannerBucketWatchObjects` where `bucketWatchId` = ? and `objectKey` = ?", bucketwatch.Id, object.Key).Exec(); err != nil {
+		return fmt.Errorf("bucketwatch.forget: %v", err)
+	}
+
+	return nil
+}
+
+func (bucketwatch *Bucketwatch) ingest(dirwatch *Dirwatch, objects []S3Object) error {
+	if etag, ok := bucketwatch.failed[objects[0].Key]; ok && etag == objects[0].ETag {
+		return nil
+	}
+
+	tmp, err := os.MkdirTemp("", "rdio-scanner-bucketwatch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	files := []string{}
+
+	for _, object := range objects {
+		b, err := bucketwatch.client.GetObject(bucketwatch.Bucket, object.Key)
+		if err != nil {
+			return err
+		}
+
+		fp := filepath.Join(tmp, filepath.FromSlash(path.Clean("/"+object.Key)))
+
+		if err = os.MkdirAll(filepath.Dir(fp), 0770); err != nil {
+			return err
+		}
+
+		if err = os.WriteFile(fp, b, 0660); err != nil {
+			return err
+		}
+
+		files = append(files, fp)
+	}
+
+	call, _, err := dirwatch.Parse(files[0])
+	if err != nil || call == nil {
+		bucketwatch.failed[objects[0].Key] = objects[0].ETag
+		if err == nil {
+			err = errors.New("no call found")
+		}
+		return err
+	}
+
+	if err = bucketwatch.remember(objects[0]); err != nil {
+		return err
+	}
+
+	bucketwatch.controller.Ingest <- call
+
+	return bucketwatch.afterIngest(objects)
+}
+
+func (bucketwatch *Bucketwatch) ingested() (map[string]string, error) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	etags := map[string]string{}
+
+	formatError := func(err error) error {
+		return fmt.Errorf("bucketwatch.ingested: %v", err)
+	}
+
+	db := bucketwatch.controller.Database
+
+	if rows, err = db.NewQuery("select `objectKey`, `etag` from `rdioScannerBucketWatchObjects` where `bucketWatchId` = ?", bucketwatch.Id).Query(); err != nil {
+		return nil, formatError(err)
+	}
+
+	for rows.Next() {
+		var key, etag string
+		if err = rows.Scan(&key, &etag); err != nil {
+			break
+		}
+		etags[key] = etag
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	return etags, nil
+}
+
+func (bucketwatch *Bucketwatch) logError(err error, key string) {
+	bucketwatch.controller.Logs.LogEvent(LogLevelWarn, fmt.Sprintf("bucketwatch.ingest: %s, %s/%s", err.Error(), bucketwatch.Bucket, key))
+}
+
+func (bucketwatch *Bucketwatch) remember(object S3Object) error {
+	db := bucketwatch.controller.Database
+
+	if err := bucketwatch.forget(object); err != nil {
+		return err
+	}
+
+	if _, err := db.NewQuery("insert into `rdioScannerBucketWatchObjects` (`bucketWatchId`, `dateTime`, `etag`, `objectKey`) values (?, ?, ?, ?)", bucketwatch.Id, time.Now().UTC(), object.ETag, object.Key).Exec(); err != nil {
+		return fmt.Errorf("bucketwatch.remember: %v", err)
+	}
+
+	return nil
+}
+
+type Bucketwatches struct {
+	List  []*Bucketwatch
+	mutex sync.Mutex
+}
+
+func NewBucketwatches() *Bucketwatches {
+	return &Bucketwatches{
+		List:  []*Bucketwatch{},
+		mutex: sync.Mutex{},
+	}
+}
+
+func (bucketwatches *Bucketwatches) FromMap(f []any) *Bucketwatches {
+	bucketwatches.mutex.Lock()
+	defer bucketwatches.mutex.Unlock()
+
+	bucketwatches.Stop()
+
+	bucketwatches.List = []*Bucketwatch{}
+
+	for _, f := range f {
+		switch v := f.(type) {
+		case map[string]any:
+			bucketwatch := NewBucketwatch().FromMap(v)
+			bucketwatches.List = append(bucketwatches.List, bucketwatch)
+		}
+	}
+
+	return bucketwatches
+}
+
+func (bucketwatches *Bucketwatches) Read(db *Database) error {
+	var (
+		afterIngest sql.NullString
+		err         error
+		extension   sql.NullString
+		frequency   sql.NullFloat64
+		id          sql.NullFloat64
+		interval    sql.NullFloat64
+		kind        sql.NullString
+		mask        sql.NullString
+		order       sql.NullFloat64
+		prefix      sql.NullString
+		region      sql.NullString
+		rows        *sql.Rows
+		systemId    sql.NullFloat64
+		talkgroupId sql.NullFloat64
+		timeZone    sql.NullString
+	)
+
+	bucketwatches.mutex.Lock()
+	defer bucketwatches.mutex.Unlock()
+
+	bucketwatches.Stop()
+
+	bucketwatches.List = []*Bucketwatch{}
+
+	formatError := func(err error) error {
+		return fmt.Errorf("bucketwatches.read: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id`, `accessKey`, `afterIngest`, `bucket`, `disabled`, `endpoint`, `extension`, `frequency`, `interval`, `mask`, `order`, `prefix`, `region`, `secretKey`, `systemId`, `talkgroupId`, `timeZone`, `type` from `rdioScannerBucketWatches`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		bucketwatch := NewBucketwatch()
+
+		if err = rows.Scan(&id, &bucketwatch.AccessKey, &afterIngest, &bucketwatch.Bucket, &bucketwatch.Disabled, &bucketwatch.Endpoint, &extension, &frequency, &interval, &mask, &order, &prefix, &region, &bucketwatch.SecretKey, &systemId, &talkgroupId, &timeZone, &kind); err != nil {
+			break
+		}
+
+		if id.Valid && id.Float64 > 0 {
+			bucketwatch.Id = uint(id.Float64)
+		}
+
+		if afterIngest.Valid && len(afterIngest.String) > 0 {
+			bucketwatch.AfterIngest = afterIngest.String
+		} else {
+			bucketwatch.AfterIngest = defaults.bucketwatch.afterIngest
+		}
+
+		if extension.Valid && len(extension.String) > 0 {
+			bucketwatch.Extension = extension.String
+		}
+
+		if frequency.Valid && frequency.Float64 > 0 {
+			bucketwatch.Frequency = uint(frequency.Float64)
+		}
+
+		if interval.Valid && interval.Float64 > 0 {
+			bucketwatch.Interval = uint(interval.Float64)
+		}
+
+		if mask.Valid && len(mask.String) > 0 {
+			bucketwatch.Mask = mask.String
+		}
+
+		if order.Valid && order.Float64 > 0 {
+			bucketwatch.Order = uint(order.Float64)
+		}
+
+		if prefix.Valid && len(prefix.String) > 0 {
+			bucketwatch.Prefix = prefix.String
+		}
+
+		if region.Valid && len(region.String) > 0 {
+			bucketwatch.Region = region.String
+		}
+
+		if systemId.Valid && systemId.Float64 > 0 {
+			bucketwatch.SystemId = uint(systemId.Float64)
+		}
+
+		if talkgroupId.Valid && talkgroupId.Float64 > 0 {
+			bucketwatch.TalkgroupId = uint(talkgroupId.Float64)
+		}
+
+		if timeZone.Valid && len(timeZone.String) > 0 {
+			bucketwatch.TimeZone = timeZone.String
+			bucketwatch.location, _ = loadLocation(bucketwatch.TimeZone)
+		}
+
+		if kind.Valid && len(kind.String) > 0 {
+			bucketwatch.Kind = kind.String
+		}
+
+		bucketwatches.List = append(bucketwatches.List, bucketwatch)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+func (bucketwatches *Bucketwatches) Start(controller *Controller) {
+	for i := range bucketwatches.List {
+		if err := bucketwatches.List[i].Start(controller); err != nil {
+			controller.Logs.LogEvent(LogLevelError, fmt.Sprintf("bucketwatches.start: %s", err.Error()))
+		}
+	}
+}
+
+func (bucketwatches *Bucketwatches) Stop() {
+	for i := range bucketwatches.List {
+		bucketwatches.List[i].Stop()
+	}
+	bucketwatches.List = []*Bucketwatch{}
+}
+
+func (bucketwatches *Bucketwatches) Write(db *Database) error {
+	var (
+		count  uint
+		err    error
+		rows   *sql.Rows
+		rowIds = []any{}
+	)
+
+	bucketwatches.mutex.Lock()
+	defer bucketwatches.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("bucketwatches.write: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerBucketWatches`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		var rowId uint
+		if err = rows.Scan(&rowId); err != nil {
+			break
+		}
+		remove := true
+		for _, bucketwatch := range bucketwatches.List {
+			if bucketwatch.Id == nil || bucketwatch.Id == rowId {
+				remove = false
+				break
+			}
+		}
+		if remove {
+			rowIds = append(rowIds, rowId)
+		}
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	if len(rowIds) > 0 {
+		if _, err = db.NewQuery("delete from `rdioScannerBucketWatches` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
+		}
+		if _, err = db.NewQuery("delete from `rdioScannerBucketWatchObjects` where `bucketWatchId` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
+		}
+	}
+
+	for _, bucketwatch := range bucketwatches.List {
+		if err = db.NewQuery("select count(*) from `rdioScannerBucketWatches` where `_id` = ?", bucketwatch.Id).QueryRow().Scan(&count); err != nil {
+			break
+		}
+
+		if count == 0 {
+			query := db.NewQuery("insert into `rdioScannerBucketWatches` (`accessKey`, `afterIngest`, `bucket`, `disabled`, `endpoint`, `extension`, `frequency`, `interval`, `mask`, `order`, `prefix`, `region`, `secretKey`, `systemId`, `talkgroupId`, `timeZone`, `type`", bucketwatch.AccessKey, bucketwatch.AfterIngest, bucketwatch.Bucket, bucketwatch.Disabled, bucketwatch.Endpoint, bucketwatch.Extension, bucketwatch.Frequency, bucketwatch.Interval, bucketwatch.Mask, bucketwatch.Order, bucketwatch.Prefix, bucketwatch.Region, bucketwatch.SecretKey, bucketwatch.SystemId, bucketwatch.TalkgroupId, bucketwatch.TimeZone, bucketwatch.Kind)
+			if bucketwatch.Id != nil {
+				query.Append(", `_id`", bucketwatch.Id)
+			}
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
+			}
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerBucketWatches` set `_id` = ?, `accessKey` = ?, `afterIngest` = ?, `bucket` = ?, `disabled` = ?, `endpoint` = ?, `extension` = ?, `frequency` = ?, `interval` = ?, `mask` = ?, `order` = ?, `prefix` = ?, `region` = ?, `secretKey` = ?, `systemId` = ?, `talkgroupId` = ?, `timeZone` = ?, `type` = ? where `_id` = ?", bucketwatch.Id, bucketwatch.AccessKey, bucketwatch.AfterIngest, bucketwatch.Bucket, bucketwatch.Disabled, bucketwatch.Endpoint, bucketwatch.Extension, bucketwatch.Frequency, bucketwatch.Interval, bucketwatch.Mask, bucketwatch.Order, bucketwatch.Prefix, bucketwatch.Region, bucketwatch.SecretKey, bucketwatch.SystemId, bucketwatch.TalkgroupId, bucketwatch.TimeZone, bucketwatch.Kind, bucketwatch.Id).Exec(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerBucketWatches"))
+	}
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
@@ -17,33 +17,44 @@ package main
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 )
 
 type Call struct {
-	Id             any       `json:"id"`
-	Audio          []byte    `json:"audio"`
-	AudioName      any       `json:"audioName"`
-	AudioType      any       `json:"audioType"`
-	DateTime       time.Time `json:"dateTime"`
-	Frequencies    any       `json:"frequencies"`
-	Frequency      any       `json:"frequency"`
-	Patches        any       `json:"patches"`
-	Source         any       `json:"source"`
-	Sources        any       `json:"sources"`
-	System         uint      `json:"system"`
-	Talkgroup      uint      `json:"talkgroup"`
+	Id             any           `json:"id"`
+	Audio          []byte        `json:"audio"`
+	AudioName      any           `json:"audioName"`
+	AudioType      any           `json:"audioType"`
+	DateTime       time.Time     `json:"dateTime"`
+	Duration       time.Duration `json:"-"`
+	Fingerprint    Fingerprint   `json:"-"`
+	Frequencies    any           `json:"frequencies"`
+	Frequency      any           `json:"frequency"`
+	OriginalAudio  []byte        `json:"-"`
+	OriginalName   any           `json:"-"`
+	OriginalType   any           `json:"-"`
+	Patches        any           `json:"patches"`
+	Source         any           `json:"source"`
+	Sources        any           `json:"sources"`
+	System         uint          `json:"system"`
+	Talkgroup      uint          `json:"talkgroup"`
+	ToneSets       any           `json:"toneSets"`
+	Transcript     *Transcript   `json:"transcript"`
+	Waveform       Waveform      `json:"waveform"`
 	systemLabel    any
 	talkgroupGroup any
 	talkgroupLabel any
 	talkgroupName  any
 	talkgroupTag   any
+	tones          []string
 	units          any
 }
 
@@ -52,15 +63,30 @@ func NewCall() *Call {
 		Frequencies: []map[string]any{},
 		Patches:     []uint{},
 		Sources:     []map[string]any{},
+		ToneSets:    []uint{},
 	}
 }
 
+// IsValid also fills the audio type from the audio headers when the recorder
+// didn't provide one.
 func (call *Call) IsValid() (ok bool, err error) {
 	ok = true
 
 	if len(call.Audio) <= 44 {
 		ok = false
 		err = errors.New("no audio")
+	} else if info, e := InspectAudio(call.Audio); e == nil {
+		switch v := call.AudioType.(type) {
+		case string:
+			if len(v) == 0 {
+				call.AudioType = info.MimeType
+			}
+		case nil:
+			call.AudioType = info.MimeType
+		}
+	} else if e != ErrAudioUnknownFormat {
+		ok = false
+		err = fmt.Errorf("invalid audio: %v", e)
 	}
 
 	if call.DateTime.Unix() == 0 {
@@ -81,6 +107,34 @@ func (call *Call) IsValid() (ok bool, err error) {
 	return ok, err
 }
 
+// IsDuplicateOf compares the call with another one of the same talkgroup and
+// time frame, according to the duplicate detection options.
+func (call *Call) IsDuplicateOf(other *Call, options *Options) bool {
+	if options.DuplicateDetectionMatchFrequency {
+		if a, ok := call.Frequency.(uint); ok {
+			if b, ok := other.Frequency.(uint); ok && a != b {
+				return false
+			}
+		}
+	}
+
+	if options.DuplicateDetectionMatchSource {
+		if a, ok := call.Source.(uint); ok {
+			if b, ok := other.Source.(uint); ok && a != b {
+				return false
+			}
+		}
+	}
+
+	// calls stored before fingerprinting was enabled can only be compared on
+	// their time stamps
+	if options.DuplicateDetectionMode != DUPLICATE_DETECTION_MODE_FINGERPRINT || len(call.Fingerprint) == 0 || len(other.Fingerprint) == 0 {
+		return true
+	}
+
+	return call.Fingerprint.Similarity(other.Fingerprint) >= FINGERPRINT_THRESHOLD
+}
+
 func (call *Call) MarshalJSON() ([]byte, error) {
 	audio := fmt.Sprintf("%v", call.Audio)
 	audio = strings.ReplaceAll(audio, " ", ",")
@@ -101,6 +155,9 @@ func (call *Call) MarshalJSON() ([]byte, error) {
 		"sources":     call.Sources,
 		"system":      call.System,
 		"talkgroup":   call.Talkgroup,
+		"toneSets":    call.ToneSets,
+		"transcript":  call.Transcript,
+		"waveform":    call.Waveform,
 	})
 }
 
@@ -113,39 +170,92 @@ func (call *Call) ToJson() (string, error) {
 }
 
 type Calls struct {
-	mutex sync.Mutex
+	mutex   sync.Mutex
+	pending map[*Call]bool
 }
 
 func NewCalls() *Calls {
 	return &Calls{
-		mutex: sync.Mutex{},
+		mutex:   sync.Mutex{},
+		pending: map[*Call]bool{},
 	}
 }
 
-func (calls *Calls) CheckDuplicate(call *Call, msTimeFrame uint, db *Database) bool {
-	var count uint
+// CheckDuplicate tells whether a call of the same talkgroup already exists, or
+// is still being stored, within the time frame. In fingerprint mode, it must
+// also sound the same, and it can be required to share the same source unit and
+// frequency.
+func (calls *Calls) CheckDuplicate(call *Call, options *Options, db *Database) bool {
+	var (
+		err         error
+		fingerprint []byte
+		frequency   sql.NullFloat64
+		rows        *sql.Rows
+		source      sql.NullFloat64
+	)
 
 	calls.mutex.Lock()
 	defer calls.mutex.Unlock()
 
-	d := time.Duration(msTimeFrame) * time.Millisecond
+	d := time.Duration(options.DuplicateDetectionTimeFrame) * time.Millisecond
 	from := call.DateTime.Add(-d)
 	to := call.DateTime.Add(d)
 
-	query := fmt.Sprintf("select count(*) from `rdioScannerCalls` where (`dateTime` between '%v' and '%v') and `system` = %v and `talkgroup` = %v", from, to, call.System, call.Talkgroup)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select count(*) from rdioScannerCalls where (dateTime between '%v' and '%v') and system = %v and talkgroup = %v", from, to, call.System, call.Talkgroup)
+	for other := range calls.pending {
+		if other.System != call.System || other.Talkgroup != call.Talkgroup || other.DateTime.Before(from) || other.DateTime.After(to) {
+			continue
+		}
+		if call.IsDuplicateOf(other, options) {
+			return true
+		}
 	}
-	if err := db.Sql.QueryRow(query).Scan(&count); err != nil {
+
+	query := db.NewQuery("select `fingerprint`, `frequency`, `source` from `rdioScannerCalls` where (`dateTime` between ? and ?) and `system` = ? and `talkgroup` = ?", from, to, call.System, call.Talkgroup)
+	if rows, err = query.Query(); err != nil {
 		return false
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&fingerprint, &frequency, &source); err != nil {
+			return false
+		}
+
+		other := &Call{Fingerprint: fingerprint}
+
+		if frequency.Valid {
+			other.Frequency = uint(frequency.Float64)
+		}
+
+		if source.Valid {
+			other.Source = uint(source.Float64)
+		}
+
+		if call.IsDuplicateOf(other, options) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetPending marks the call as being stored, or as done, so that its
+// duplicates are detected before it is written.
+func (calls *Calls) SetPending(call *Call, pending bool) {
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
 
-	return count > 0
+	if pending {
+		calls.pending[call] = true
+	} else {
+		delete(calls.pending, call)
+	}
 }
 
 func (calls *Calls) GetCall(id uint, db *Database) (*Call, error) {
 	var (
 		audioName   sql.NullString
+		audioRef    sql.NullString
 		audioType   sql.NullString
 		dateTime    any
 		frequency   sql.NullFloat64
@@ -154,6 +264,9 @@ func (calls *Calls) GetCall(id uint, db *Database) (*Call, error) {
 		patches     string
 		sources     string
 		t           time.Time
+		toneSets    sql.NullString
+		transcript  sql.NullString
+		waveform    []byte
 	)
 
 	calls.mutex.Lock()
@@ -161,11 +274,8 @@ func (calls *Calls) GetCall(id uint, db *Database) (*Call, error) {
 
 	call := Call{Id: id}
 
-	query := fmt.Sprintf("select `audio`, `audioName`, `audioType`, `DateTime`, `frequencies`, `frequency`, `patches`, `source`, `sources`, `system`, `talkgroup` from `rdioScannerCalls` where `id` = %v", id)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select audio, audioName, audioType, DateTime, frequencies, frequency, patches, source, sources, system, talkgroup from rdioScannerCalls where id = %v", id)
-	}
-	err := db.Sql.QueryRow(query).Scan(&call.Audio, &audioName, &audioType, &dateTime, &frequencies, &frequency, &patches, &source, &sources, &call.System, &call.Talkgroup)
+	query := db.NewQuery("select `audio`, `audioName`, `audioRef`, `audioType`, `DateTime`, `frequencies`, `frequency`, `patches`, `source`, `sources`, `system`, `talkgroup`, `toneSets`, `transcript`, `waveform` from `rdioScannerCalls` where `id` = ?", id)
+	err := query.QueryRow().Scan(&call.Audio, &audioName, &audioRef, &audioType, &dateTime, &frequencies, &frequency, &patches, &source, &sources, &call.System, &call.Talkgroup, &toneSets, &transcript, &waveform)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("getcall: %v, %v", err, query)
 	}
@@ -174,6 +284,12 @@ func (calls *Calls) GetCall(id uint, db *Database) (*Call, error) {
 		call.AudioName = audioName.String
 	}
 
+	if audioRef.Valid && len(audioRef.String) > 0 {
+		if call.Audio, err = db.AudioStore.Get(audioRef.String); err != nil {
+			return nil, fmt.Errorf("getcall: %v", err)
+		}
+	}
+
 	if audioType.Valid {
 		call.AudioType = audioType.String
 	}
@@ -210,23 +326,268 @@ func (calls *Calls) GetCall(id uint, db *Database) (*Call, error) {
 		}
 	}
 
+	if toneSets.Valid && len(toneSets.String) > 0 {
+		if err = json.Unmarshal([]byte(toneSets.String), &call.ToneSets); err != nil {
+			call.ToneSets = []any{}
+		}
+	}
+
+	if transcript.Valid && len(transcript.String) > 0 {
+		call.Transcript = &Transcript{}
+		if err = json.Unmarshal([]byte(transcript.String), call.Transcript); err != nil {
+			call.Transcript = nil
+		}
+	}
+
+	if len(waveform) > 0 {
+		call.Waveform = waveform
+	}
+
 	return &call, nil
 }
 
-func (calls *Calls) Prune(db *Database, pruneDays uint) error {
+func (calls *Calls) GetOriginalAudio(id uint, db *Database) (audio []byte, audioName string, audioType string, err error) {
+	var (
+		name sql.NullString
+		kind sql.NullString
+		ref  sql.NullString
+	)
+
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	query := db.NewQuery("select `originalAudio`, `originalAudioName`, `originalAudioRef`, `originalAudioType` from `rdioScannerCalls` where `id` = ?", id)
+	if err = query.QueryRow().Scan(&audio, &name, &ref, &kind); err != nil {
+		return nil, "", "", fmt.Errorf("calls.getoriginalaudio: %v", err)
+	}
+
+	if ref.Valid && len(ref.String) > 0 {
+		if audio, err = db.AudioStore.Get(ref.String); err != nil {
+			return nil, "", "", fmt.Errorf("calls.getoriginalaudio: %v", err)
+		}
+	}
+
+	return audio, name.String, kind.String, nil
+}
+
+// GetOriginalIds returns the ids of the calls which have their original audio
+// kept, optionally restricted to a time frame and to some systems.
+func (calls *Calls) GetOriginalIds(from time.Time, to time.Time, systems []uint, db *Database) ([]uint, error) {
+	var (
+		err  error
+		ids  = []uint{}
+		rows *sql.Rows
+	)
+
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("calls.getoriginalids: %v", err)
+	}
+
+	query := db.NewQuery("select `id` from `rdioScannerCalls` where (`originalAudio` is not null or `originalAudioRef` is not null)")
+
+	if !from.IsZero() {
+		query.Append(" and `dateTime` >= ?", from.Format(db.DateTimeFormat))
+	}
+
+	if !to.IsZero() {
+		query.Append(" and `dateTime` <= ?", to.Format(db.DateTimeFormat))
+	}
+
+	if len(systems) > 0 {
+		args := []any{}
+		for _, system := range systems {
+			args = append(args, system)
+		}
+		query.Append(" and `system` in "+Placeholders(len(args)), args...)
+	}
+
+	query.Append(" order by `id`")
+
+	if rows, err = query.Query(); err != nil {
+		return nil, formatError(err)
+	}
+
+	for rows.Next() {
+		var id uint
+		if err = rows.Scan(&id); err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	return ids, nil
+}
+
+// CountMigrateAudio returns the number of calls whose audio is to be moved by
+// MigrateAudio.
+func (calls *Calls) CountMigrateAudio(db *Database) (uint, error) {
+	var count uint
+
+	if err := db.NewQuery("select count(*) from `rdioScannerCalls` where ").AppendQuery(calls.getMigrateAudioWhere(db)).QueryRow().Scan(&count); err != nil {
+		return 0, fmt.Errorf("calls.countmigrateaudio: %v", err)
+	}
+
+	return count, nil
+}
+
+// MigrateAudio moves the audio of all the calls to the configured audio
+// store, or back into the database when no external store is configured.
+// The progress function, when given, is called with the count of calls moved
+// after each call.
+func (calls *Calls) MigrateAudio(db *Database, progress func(count uint)) (uint, error) {
+	var (
+		count  uint
+		lastId uint
+		where  = calls.getMigrateAudioWhere(db)
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("calls.migrateaudio: %v", err)
+	}
+
+	for {
+		ids := []uint{}
+
+		query := db.NewQuery("select `id` from `rdioScannerCalls` where `id` > ? and ", lastId).AppendQuery(where).Append(" order by `id` limit 100")
+		rows, err := query.Query()
+		if err != nil {
+			return count, formatError(err)
+		}
+
+		for rows.Next() {
+			var id uint
+			if err = rows.Scan(&id); err != nil {
+				break
+			}
+			ids = append(ids, id)
+		}
+
+		rows.Close()
+
+		if err != nil {
+			return count, formatError(err)
+		}
+
+		if len(ids) == 0 {
+			break
+		}
+
+		for _, id := range ids {
+			if err = calls.migrateCallAudio(id, db); err != nil {
+				return count, formatError(err)
+			}
+			count++
+			lastId = id
+			if progress != nil {
+				progress(count)
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// getMigrateAudioWhere matches the calls whose audio is not in the configured
+// audio store.
+func (calls *Calls) getMigrateAudioWhere(db *Database) *Query {
+	if db.AudioStore.IsExternal() {
+		prefix := db.AudioStore.Type + ":%"
+		return db.NewQuery("(`audioRef` is null or `audioRef` not like ? or `originalAudio` is not null or (`originalAudioRef` is not null and `originalAudioRef` not like ?))", prefix, prefix)
+	}
+
+	return db.NewQuery("(`audioRef` is not null or `originalAudioRef` is not null)")
+}
+
+// Prune deletes the calls matching the condition, along with their audio and
+// text index entries, and returns how many were deleted. When an archive is
+// configured, the calls are archived first and kept if that fails. The calls
+// are pruned by batches of ids, each batch being archived without holding the
+// calls, whose writes would otherwise wait for the archive store.
+func (calls *Calls) Prune(db *Database, where *Query) (uint, error) {
+	const batchSize = 1000
+
+	var (
+		count  uint
+		lastId uint
+	)
+
+	for {
+		var maxId sql.NullFloat64
+
+		query := db.NewQuery("select max(`id`) from (select `id` from `rdioScannerCalls` where `id` > ? and ", lastId).AppendQuery(where).Append(" order by `id` limit ?) as `batch`", batchSize)
+		if err := query.QueryRow().Scan(&maxId); err != nil {
+			return count, err
+		}
+
+		if !maxId.Valid {
+			break
+		}
+
+		batch := db.NewQuery("`id` > ? and `id` <= ? and ", lastId, uint(maxId.Float64)).AppendQuery(where)
+
+		if db.Archive != nil {
+			if _, err := db.Archive.Put(db, batch); err != nil {
+				return count, err
+			}
+		}
+
+		n, err := calls.pruneBatch(db, batch, lastId, uint(maxId.Float64))
+		count += n
+		if err != nil {
+			return count, err
+		}
+
+		lastId = uint(maxId.Float64)
+	}
+
+	return count, nil
+}
+
+// pruneBatch deletes the calls of a batch of ids, from and excluding fromId
+// to and including toId.
+func (calls *Calls) pruneBatch(db *Database, where *Query, fromId uint, toId uint) (uint, error) {
+	var count int64
+
 	calls.mutex.Lock()
 	defer calls.mutex.Unlock()
 
-	date := time.Now().Add(-24 * time.Hour * time.Duration(pruneDays)).Format(db.DateTimeFormat)
-	q := "delete from `rdioScannerCalls` where `dateTime` < ?"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "delete from rdioScannerCalls where dateTime < $1"
+	refs, err := calls.getAudioRefs(db, where)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.NewQuery("delete from `rdioScannerCalls` where ").AppendQuery(where).Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	if count, err = res.RowsAffected(); err != nil {
+		return 0, err
 	}
-	_, err := db.Sql.Exec(q, date)
 
-	return err
+	query := db.NewQuery("delete from `rdioScannerCallsText` where `callId` > ? and `callId` <= ? and `callId` not in (select `id` from `rdioScannerCalls` where `id` > ? and `id` <= ?)", fromId, toId, fromId, toId)
+	if _, err = query.Exec(); err != nil {
+		return uint(count), err
+	}
+
+	return uint(count), calls.releaseAudio(db, refs)
 }
 
+// Search lists the calls matching the search options. The pages are chained
+// with the next and prev cursors, which hold the date and id of the last and
+// first calls of a page. The count, dateStart and dateStop totals are costly
+// on large tables and are left out of the pages reached with a cursor, unless
+// asked for. The calls matching a text are ranked by relevance instead, and
+// are paged by offset.
 func (calls *Calls) Search(searchOptions *CallsSearchOptions, client *Client) (*CallsSearchResults, error) {
 	const (
 		ascOrder  = "asc"
@@ -234,16 +595,16 @@ func (calls *Calls) Search(searchOptions *CallsSearchOptions, client *Client) (*
 	)
 
 	var (
+		count    uint
 		dateTime any
 		err      error
 		id       sql.NullFloat64
 		limit    uint
 		offset   uint
 		order    string
-		query    string
+		query    *Query
 		rows     *sql.Rows
 		t        time.Time
-		where    string = "true"
 	)
 
 	calls.mutex.Lock()
@@ -260,130 +621,39 @@ func (calls *Calls) Search(searchOptions *CallsSearchOptions, client *Client) (*
 		Results: []CallsSearchResult{},
 	}
 
-	if client.Access != nil {
-		switch v := client.Access.Systems.(type) {
-		case []any:
-			a := []string{}
-			for _, scope := range v {
-				var c string
-				switch v := scope.(type) {
-				case map[string]any:
-					switch v["talkgroups"].(type) {
-					case []any:
-						b := strings.ReplaceAll(fmt.Sprintf("%v", v["talkgroups"]), " ", ", ")
-						b = strings.ReplaceAll(b, "[", "(")
-						b = strings.ReplaceAll(b, "]", ")")
-						c = fmt.Sprintf("(`system` = %v and `talkgroup` in %v)", v["id"], b)
-						if db.Config.DbType == DbTypePostgresql {
-							c = fmt.Sprintf("(system = %v and talkgroup in %v)", v["id"], b)
-						}
-					case string:
-						if v["talkgroups"] == "*" {
-							c = fmt.Sprintf("`system` = %v", v["id"])
-							if db.Config.DbType == DbTypePostgresql {
-								c = fmt.Sprintf("system = %v", v["id"])
-							}
-						}
-					}
-				}
-				if len(c) > 0 {
-					a = append(a, c)
-				}
-			}
-			where = fmt.Sprintf("(%s)", strings.Join(a, " or "))
-		}
+	cursor, _ := searchOptions.Cursor.(*CallsSearchCursor)
+
+	totals := cursor == nil
+	switch v := searchOptions.Totals.(type) {
+	case bool:
+		totals = v
 	}
 
-	switch v := searchOptions.System.(type) {
-	case uint:
-		a := []string{
-			fmt.Sprintf("`system` = %v", v),
-		}
-		if db.Config.DbType == DbTypePostgresql {
-			a = []string{
-				fmt.Sprintf("system = %v", v),
-			}
-		}
-		switch v := searchOptions.Talkgroup.(type) {
-		case uint:
-			if searchOptions.searchPatchedTalkgroups {
-				if db.Config.DbType == DbTypePostgresql {
-					a = append(a, fmt.Sprintf("talkgroup = %v or patches = '%v' or patches like '[%v,%%' or patches like '%%,%v,%%' or patches like '%%,%v]'", v, v, v, v, v))
-				} else {
-					a = append(a, fmt.Sprintf("`talkgroup` = %v or patches = '%v' or patches like '[%v,%%' or patches like '%%,%v,%%' or patches like '%%,%v]'", v, v, v, v, v))
-				}
-			} else {
-				if db.Config.DbType == DbTypePostgresql {
-					a = append(a, fmt.Sprintf("talkgroup = %v", v))
-				} else {
-					a = append(a, fmt.Sprintf("`talkgroup` = %v", v))
-				}
+	where := calls.getSearchWhere(searchOptions, client)
+	textWhere := calls.getSearchTextWhere(searchOptions, client)
 
-			}
+	if totals {
+		query = db.NewQuery("select `dateTime` from `rdioScannerCalls` where ").AppendQuery(where).AppendQuery(textWhere).Append(" order by `dateTime` asc limit 1")
+		if err = query.QueryRow().Scan(&dateTime); err != nil && err != sql.ErrNoRows {
+			return nil, formatError(fmt.Errorf("%v, %v", err, query))
 		}
-		where += fmt.Sprintf(" and (%s)", strings.Join(a, " and "))
-	}
 
-	switch v := searchOptions.Group.(type) {
-	case string:
-		a := []string{}
-		for id, m := range client.GroupsMap[v] {
-			b := strings.ReplaceAll(fmt.Sprintf("%v", m), " ", ", ")
-			b = strings.ReplaceAll(b, "[", "(")
-			b = strings.ReplaceAll(b, "]", ")")
-			if db.Config.DbType == DbTypePostgresql {
-				a = append(a, fmt.Sprintf("(system = %v and talkgroup in %v)", id, b))
-			} else {
-				a = append(a, fmt.Sprintf("(`system` = %v and `talkgroup` in %v)", id, b))
-			}
-		}
-		if len(a) > 0 {
-			where += fmt.Sprintf(" and (%s)", strings.Join(a, " or "))
+		if t, err = db.ParseDateTime(dateTime); err == nil {
+			searchResults.DateStart = t
+		} else {
+			searchResults.DateStart = time.Time{}
 		}
-	}
 
-	switch v := searchOptions.Tag.(type) {
-	case string:
-		a := []string{}
-		for id, m := range client.TagsMap[v] {
-			b := strings.ReplaceAll(fmt.Sprintf("%v", m), " ", ", ")
-			b = strings.ReplaceAll(b, "[", "(")
-			b = strings.ReplaceAll(b, "]", ")")
-			if db.Config.DbType == DbTypePostgresql {
-				a = append(a, fmt.Sprintf("(system = %v and talkgroup in %v)", id, b))
-			} else {
-				a = append(a, fmt.Sprintf("(`system` = %v and `talkgroup` in %v)", id, b))
-			}
+		query = db.NewQuery("select `dateTime` from `rdioScannerCalls` where ").AppendQuery(where).AppendQuery(textWhere).Append(" order by `dateTime` desc limit 1")
+		if err = query.QueryRow().Scan(&dateTime); err != nil && err != sql.ErrNoRows {
+			return nil, formatError(fmt.Errorf("%v, %v", err, query))
 		}
-		if len(a) > 0 {
-			where += fmt.Sprintf(" and (%s)", strings.Join(a, " or "))
-		}
-	}
-
-	query = fmt.Sprintf("select `dateTime` from `rdioScannerCalls` where %v order by `dateTime` asc", where)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select dateTime from rdioScannerCalls where %v order by dateTime asc", where)
-	}
-	if err = db.Sql.QueryRow(query).Scan(&dateTime); err != nil && err != sql.ErrNoRows {
-		return nil, formatError(fmt.Errorf("%v, %v", err, query))
-	}
-
-	if t, err = db.ParseDateTime(dateTime); err == nil {
-		searchResults.DateStart = t
-	}
-
-	query = fmt.Sprintf("select `dateTime` from `rdioScannerCalls` where %v order by `dateTime` desc", where)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select dateTime from rdioScannerCalls where %v order by dateTime desc", where)
-	}
-	if err = db.Sql.QueryRow(query).Scan(&dateTime); err != nil && err != sql.ErrNoRows {
-		return nil, formatError(fmt.Errorf("%v, %v", err, query))
-	}
 
-	if t, err = db.ParseDateTime(dateTime); err == nil {
-		searchResults.DateStop = t
-	} else {
-		searchResults.DateStop = time.Now()
+		if t, err = db.ParseDateTime(dateTime); err == nil {
+			searchResults.DateStop = t
+		} else {
+			searchResults.DateStop = time.Now()
+		}
 	}
 
 	switch v := searchOptions.Sort.(type) {
@@ -414,11 +684,7 @@ func (calls *Calls) Search(searchOptions *CallsSearchOptions, client *Client) (*
 			stop = time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), 0, 0, time.UTC)
 		}
 
-		if db.Config.DbType == DbTypePostgresql {
-			where += fmt.Sprintf(" and (dateTime between '%v' and '%v')", start.Format(df), stop.Format(df))
-		} else {
-			where += fmt.Sprintf(" and (`dateTime` between '%v' and '%v')", start.Format(df), stop.Format(df))
-		}
+		where.Append(" and (`dateTime` between ? and ?)", start.Format(df), stop.Format(df))
 	}
 
 	switch v := searchOptions.Limit.(type) {
@@ -433,28 +699,59 @@ func (calls *Calls) Search(searchOptions *CallsSearchOptions, client *Client) (*
 		offset = v
 	}
 
-	query = fmt.Sprintf("select count(*) from `rdioScannerCalls` where %v", where)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select count(*) from rdioScannerCalls where %v", where)
+	if totals {
+		query = db.NewQuery("select count(*) from `rdioScannerCalls` where ").AppendQuery(where).AppendQuery(textWhere)
+		if err = query.QueryRow().Scan(&count); err != nil && err != sql.ErrNoRows {
+			return nil, formatError(fmt.Errorf("%v, %v", err, query))
+		}
+		searchResults.Count = count
 	}
-	if err = db.Sql.QueryRow(query).Scan(&searchResults.Count); err != nil && err != sql.ErrNoRows {
-		return nil, formatError(fmt.Errorf("%v, %v", err, query))
+
+	terms := []string{}
+	switch v := searchOptions.Text.(type) {
+	case string:
+		terms = GetTextTerms(v)
 	}
 
-	query = fmt.Sprintf("select `id`, `DateTime`, `system`, `talkgroup` from `rdioScannerCalls` where %v order by `dateTime` %v limit %v offset %v", where, order, limit, offset)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select id, dateTime, system, talkgroup from rdioScannerCalls where %v order by dateTime %v limit %v offset %v", where, order, limit, offset)
+	// a page is read backward from a prev cursor, then put back in order
+	backward := len(terms) == 0 && cursor != nil && cursor.Backward
+
+	// one more call than the limit tells if there is a page after
+	if len(terms) > 0 {
+		query = db.NewQuery("select `id`, `dateTime`, `system`, `talkgroup`, `waveform`, `matches`.`score` from `rdioScannerCalls` inner join (").AppendQuery(db.TextIndex.Match(db, terms)).Append(") as `matches` on `matches`.`callId` = `rdioScannerCalls`.`id` where ").AppendQuery(where).Append(fmt.Sprintf(" order by `matches`.`score` desc, `dateTime` %s limit ? offset ?", order), limit+1, offset)
+
+	} else {
+		direction, operator := ascOrder, ">"
+		if (order == descOrder) != backward {
+			direction, operator = descOrder, "<"
+		}
+
+		query = db.NewQuery("select `id`, `dateTime`, `system`, `talkgroup`, `waveform`, 0 from `rdioScannerCalls` where ").AppendQuery(where)
+		if cursor != nil {
+			query.Append(fmt.Sprintf(" and (`dateTime` %s ? or (`dateTime` = ? and `id` %s ?))", operator, operator), cursor.DateTime, cursor.DateTime, cursor.Id)
+		}
+		query.Append(fmt.Sprintf(" order by `dateTime` %s, `id` %s limit ?", direction, direction), limit+1)
+		if cursor == nil {
+			query.Append(" offset ?", offset)
+		}
 	}
-	if rows, err = db.Sql.Query(query); err != nil && err != sql.ErrNoRows {
+
+	if rows, err = query.Query(); err != nil && err != sql.ErrNoRows {
 		return nil, formatError(fmt.Errorf("%v, %v", err, query))
 	}
 
 	for rows.Next() {
+		var waveform []byte
+
 		searchResult := CallsSearchResult{}
-		if err = rows.Scan(&id, &dateTime, &searchResult.System, &searchResult.Talkgroup); err != nil {
+		if err = rows.Scan(&id, &dateTime, &searchResult.System, &searchResult.Talkgroup, &waveform, &searchResult.Score); err != nil {
 			break
 		}
 
+		if len(waveform) > 0 {
+			searchResult.Waveform = waveform
+		}
+
 		if id.Valid && id.Float64 > 0 {
 			searchResult.Id = uint(id.Float64)
 		}
@@ -475,18 +772,46 @@ func (calls *Calls) Search(searchOptions *CallsSearchOptions, client *Client) (*
 		return nil, formatError(err)
 	}
 
-	return searchResults, err
+	more := uint(len(searchResults.Results)) > limit
+	if more {
+		searchResults.Results = searchResults.Results[:limit]
+	}
+
+	if backward {
+		slices.Reverse(searchResults.Results)
+	}
+
+	if n := len(searchResults.Results); n > 0 && len(terms) == 0 {
+		first := searchResults.Results[0]
+		last := searchResults.Results[n-1]
+
+		if more || backward {
+			searchResults.Next = (&CallsSearchCursor{DateTime: last.DateTime, Id: last.Id}).String()
+		}
+
+		if (backward && more) || (!backward && (cursor != nil || offset > 0)) {
+			searchResults.Prev = (&CallsSearchCursor{Backward: true, DateTime: first.DateTime, Id: first.Id}).String()
+		}
+	}
+
+	return searchResults, nil
 }
 
 func (calls *Calls) WriteCall(call *Call, db *Database) (uint, error) {
 	var (
-		b           []byte
-		err         error
-		frequencies string
-		id          int64
-		patches     string
-		res         sql.Result
-		sources     string
+		audio            = call.Audio
+		audioRef         any
+		b                []byte
+		duration         any
+		err              error
+		frequencies      string
+		id               uint
+		originalAudio    = call.OriginalAudio
+		originalAudioRef any
+		patches          string
+		sources          string
+		toneSets         string
+		transcript       any
 	)
 
 	calls.mutex.Lock()
@@ -523,50 +848,544 @@ func (calls *Calls) WriteCall(call *Call, db *Database) (uint, error) {
 		}
 	}
 
-	if db.Config.DbType == DbTypePostgresql {
-		if call.Id != nil {
-			if _, err = db.Sql.Exec("insert into rdioScannerCalls (id, audio, audioName, audioType, dateTime, frequencies, frequency, patches, source, sources, system, talkgroup) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)", call.Id, call.Audio, call.AudioName, call.AudioType, call.DateTime, frequencies, call.Frequency, patches, call.Source, sources, call.System, call.Talkgroup); err != nil {
-				return 0, formatError(err)
-			}
-			callInt, ok := call.Id.(int)
-			if ok {
-				return uint(callInt), nil
-			}
-			return 0, formatError(err)
+	switch v := call.ToneSets.(type) {
+	case []uint:
+		if b, err = json.Marshal(v); err == nil {
+			toneSets = string(b)
 		} else {
-			var uid int
-			err = db.Sql.QueryRow("insert into rdioScannerCalls (audio, audioName, audioType, dateTime, frequencies, frequency, patches, source, sources, system, talkgroup) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id", call.Audio, call.AudioName, call.AudioType, call.DateTime, frequencies, call.Frequency, patches, call.Source, sources, call.System, call.Talkgroup).Scan(&uid)
-			if err != nil {
-				return 0, formatError(err)
-			}
-			return uint(uid), nil
-		}
-	} else {
-		if res, err = db.Sql.Exec("insert into `rdioScannerCalls` (`id`, `audio`, `audioName`, `audioType`, `dateTime`, `frequencies`, `frequency`, `patches`, `source`, `sources`, `system`, `talkgroup`) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", call.Id, call.Audio, call.AudioName, call.AudioType, call.DateTime, frequencies, call.Frequency, patches, call.Source, sources, call.System, call.Talkgroup); err != nil {
 			return 0, formatError(err)
 		}
+	}
 
-		if id, err = res.LastInsertId(); err == nil {
-			return uint(id), nil
+	if call.Transcript != nil {
+		if b, err = json.Marshal(call.Transcript); err == nil {
+			transcript = string(b)
 		} else {
 			return 0, formatError(err)
 		}
 	}
+
+	if call.Duration > 0 {
+		duration = call.Duration.Milliseconds()
+	}
+
+	if audioRef, err = db.AudioStore.Put(call.Audio, call.AudioType); err != nil {
+		return 0, formatError(err)
+	} else if audioRef != nil {
+		audio = []byte{}
+	}
+
+	if originalAudioRef, err = db.AudioStore.Put(call.OriginalAudio, call.OriginalType); err != nil {
+		return 0, formatError(err)
+	} else if originalAudioRef != nil {
+		originalAudio = nil
+	}
+
+	query := db.NewQuery("insert into `rdioScannerCalls` (`audio`, `audioName`, `audioRef`, `audioType`, `dateTime`, `duration`, `fingerprint`, `frequencies`, `frequency`, `originalAudio`, `originalAudioName`, `originalAudioRef`, `originalAudioType`, `patches`, `source`, `sources`, `system`, `talkgroup`, `toneSets`, `transcript`, `waveform`")
+	args := []any{audio, call.AudioName, audioRef, call.AudioType, call.DateTime, duration, []byte(call.Fingerprint), frequencies, call.Frequency, originalAudio, call.OriginalName, originalAudioRef, call.OriginalType, patches, call.Source, sources, call.System, call.Talkgroup, toneSets, transcript, []byte(call.Waveform)}
+
+	if call.Id != nil {
+		query.Append(", `id`")
+		args = append(args, call.Id)
+	}
+
+	query.Append(") values "+Placeholders(len(args)), args...)
+
+	if id, err = query.ExecInsert("id"); err != nil {
+		return 0, formatError(err)
+	}
+
+	return id, nil
+}
+
+func (calls *Calls) UpdateAudio(call *Call, db *Database) error {
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("calls.updateaudio: %v", err)
+	}
+
+	refs, err := calls.getAudioRefs(db, db.NewQuery("`id` = ?", call.Id))
+	if err != nil {
+		return formatError(err)
+	}
+
+	var duration any
+
+	if call.Duration > 0 {
+		duration = call.Duration.Milliseconds()
+	}
+
+	audio := call.Audio
+
+	audioRef, err := db.AudioStore.Put(call.Audio, call.AudioType)
+	if err != nil {
+		return formatError(err)
+	} else if audioRef != nil {
+		audio = []byte{}
+	}
+
+	query := db.NewQuery("update `rdioScannerCalls` set `audio` = ?, `audioName` = ?, `audioRef` = ?, `audioType` = ?, `duration` = ?, `waveform` = ? where `id` = ?", audio, call.AudioName, audioRef, call.AudioType, duration, []byte(call.Waveform), call.Id)
+	if _, err := query.Exec(); err != nil {
+		return formatError(err)
+	}
+
+	if err = calls.releaseAudio(db, refs); err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+func (calls *Calls) UpdateTranscript(call *Call, db *Database) error {
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	b, err := json.Marshal(call.Transcript)
+	if err != nil {
+		return fmt.Errorf("calls.updatetranscript: %v", err)
+	}
+
+	query := db.NewQuery("update `rdioScannerCalls` set `transcript` = ? where `id` = ?", string(b), call.Id)
+	if _, err := query.Exec(); err != nil {
+		return fmt.Errorf("calls.updatetranscript: %v", err)
+	}
+
+	return nil
+}
+
+// getAudioRefs returns the references to the external audio of the matching
+// calls.
+func (calls *Calls) getAudioRefs(db *Database, where *Query) ([]string, error) {
+	var (
+		err  error
+		refs = []string{}
+		rows *sql.Rows
+		seen = map[string]bool{}
+	)
+
+	query := db.NewQuery("select `audioRef`, `originalAudioRef` from `rdioScannerCalls` where (`audioRef` is not null or `originalAudioRef` is not null) and ").AppendQuery(where)
+	if rows, err = query.Query(); err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var audioRef, originalAudioRef sql.NullString
+
+		if err = rows.Scan(&audioRef, &originalAudioRef); err != nil {
+			break
+		}
+
+		for _, ref := range []sql.NullString{audioRef, originalAudioRef} {
+			if ref.Valid && len(ref.String) > 0 && !seen[ref.String] {
+				seen[ref.String] = true
+				refs = append(refs, ref.String)
+			}
+		}
+	}
+
+	rows.Close()
+
+	return refs, err
+}
+
+// getSearchTextWhere returns the condition on the text of the search options
+// to be appended to the search where, which is left out when the calls are
+// joined to the ranked matches instead.
+func (calls *Calls) getSearchTextWhere(searchOptions *CallsSearchOptions, client *Client) *Query {
+	db := client.Controller.Database
+
+	where := db.NewQuery("")
+
+	switch v := searchOptions.Text.(type) {
+	case string:
+		if terms := GetTextTerms(v); len(terms) > 0 {
+			where.Append(" and `id` in (select `callId` from (").AppendQuery(db.TextIndex.Match(db, terms)).Append(") as `matches`)")
+		}
+	}
+
+	return where
+}
+
+// getSearchWhere returns the sql condition matching the calls of the search
+// options which are within the access scope of the client, except for the
+// text, whose condition is returned by getSearchTextWhere.
+func (calls *Calls) getSearchWhere(searchOptions *CallsSearchOptions, client *Client) *Query {
+	db := client.Controller.Database
+
+	where := db.NewQuery("true")
+
+	// the scopes come from the access codes and the groups and tags maps as
+	// decoded json, which is why the ids are converted to integers.
+	scopeQuery := func(system any, talkgroups any) *Query {
+		systemId, ok := toSqlId(system)
+		if !ok {
+			return nil
+		}
+
+		switch v := talkgroups.(type) {
+		case []any, []uint:
+			args := []any{}
+			switch v := v.(type) {
+			case []any:
+				for _, f := range v {
+					if id, ok := toSqlId(f); ok {
+						args = append(args, id)
+					}
+				}
+			case []uint:
+				for _, id := range v {
+					args = append(args, id)
+				}
+			}
+			if len(args) == 0 {
+				return nil
+			}
+			return db.NewQuery("(`system` = ? and `talkgroup` in "+Placeholders(len(args))+")", append([]any{systemId}, args...)...)
+
+		case string:
+			if v == "*" {
+				return db.NewQuery("`system` = ?", systemId)
+			}
+		}
+
+		return nil
+	}
+
+	scopesQuery := func(scopes []*Query) *Query {
+		if len(scopes) == 0 {
+			return db.NewQuery("false")
+		}
+		return db.NewQuery("(").AppendQuery(db.JoinQueries(scopes, " or ")).Append(")")
+	}
+
+	// systemsScopes returns the scopes of a list of systems in the format of
+	// the access codes.
+	systemsScopes := func(systems []any) []*Query {
+		scopes := []*Query{}
+		for _, scope := range systems {
+			switch v := scope.(type) {
+			case map[string]any:
+				if q := scopeQuery(v["id"], v["talkgroups"]); q != nil {
+					scopes = append(scopes, q)
+				}
+			}
+		}
+		return scopes
+	}
+
+	// unitsQuery matches the calls whose source, or any of the sources, is
+	// one of the units. The sources are stored as json with sorted keys.
+	unitsQuery := func(units []uint) *Query {
+		args := make([]any, len(units))
+		for i, unit := range units {
+			args[i] = unit
+		}
+		q := db.NewQuery("(`source` in "+Placeholders(len(args)), args...)
+		for _, unit := range units {
+			q.Append(" or `sources` like ? or `sources` like ?", fmt.Sprintf("%%\"src\":%d,%%", unit), fmt.Sprintf("%%\"src\":%d}%%", unit))
+		}
+		return q.Append(")")
+	}
+
+	if client.Access != nil {
+		switch v := client.Access.Systems.(type) {
+		case []any:
+			where = scopesQuery(systemsScopes(v))
+		}
+	}
+
+	switch v := searchOptions.DateFrom.(type) {
+	case time.Time:
+		where.Append(" and `dateTime` >= ?", v.Format(db.DateTimeFormat))
+	}
+
+	switch v := searchOptions.DateTo.(type) {
+	case time.Time:
+		where.Append(" and `dateTime` <= ?", v.Format(db.DateTimeFormat))
+	}
+
+	switch v := searchOptions.System.(type) {
+	case uint:
+		where.Append(" and (`system` = ?", v)
+		switch v := searchOptions.Talkgroup.(type) {
+		case uint:
+			if searchOptions.searchPatchedTalkgroups {
+				where.Append(" and (`talkgroup` = ? or `patches` = ? or `patches` like ? or `patches` like ? or `patches` like ?)", v, fmt.Sprintf("%v", v), fmt.Sprintf("[%v,%%", v), fmt.Sprintf("%%,%v,%%", v), fmt.Sprintf("%%,%v]", v))
+			} else {
+				where.Append(" and `talkgroup` = ?", v)
+			}
+		}
+		where.Append(")")
+	}
+
+	switch v := searchOptions.Systems.(type) {
+	case []any:
+		where.Append(" and ").AppendQuery(scopesQuery(systemsScopes(v)))
+	}
+
+	switch v := searchOptions.ExcludeSystems.(type) {
+	case []any:
+		if scopes := systemsScopes(v); len(scopes) > 0 {
+			where.Append(" and not ").AppendQuery(scopesQuery(scopes))
+		}
+	}
+
+	switch v := searchOptions.Units.(type) {
+	case []uint:
+		if len(v) > 0 {
+			where.Append(" and ").AppendQuery(unitsQuery(v))
+		}
+	}
+
+	// a call without a source is not excluded by the units
+	switch v := searchOptions.ExcludeUnits.(type) {
+	case []uint:
+		if len(v) > 0 {
+			where.Append(" and not coalesce(").AppendQuery(unitsQuery(v)).Append(", false)")
+		}
+	}
+
+	switch v := searchOptions.Frequency.(type) {
+	case uint:
+		where.Append(" and `frequency` = ?", v)
+	}
+
+	switch v := searchOptions.MinFrequency.(type) {
+	case uint:
+		where.Append(" and `frequency` >= ?", v)
+	}
+
+	switch v := searchOptions.MaxFrequency.(type) {
+	case uint:
+		where.Append(" and `frequency` <= ?", v)
+	}
+
+	// the duration is in milliseconds, and unknown for the calls stored before
+	// it was recorded, which the duration filters leave out
+	switch v := searchOptions.MinDuration.(type) {
+	case float64:
+		where.Append(" and `duration` >= ?", int64(v*1000))
+	}
+
+	switch v := searchOptions.MaxDuration.(type) {
+	case float64:
+		where.Append(" and `duration` <= ?", int64(v*1000))
+	}
+
+	switch v := searchOptions.ToneSet.(type) {
+	case uint:
+		where.Append(" and (`toneSets` = ? or `toneSets` like ? or `toneSets` like ? or `toneSets` like ?)", fmt.Sprintf("[%v]", v), fmt.Sprintf("[%v,%%", v), fmt.Sprintf("%%,%v,%%", v), fmt.Sprintf("%%,%v]", v))
+	}
+
+	switch v := searchOptions.Group.(type) {
+	case string:
+		if m, ok := client.GroupsMap[v]; ok {
+			scopes := []*Query{}
+			for id, talkgroups := range m {
+				if q := scopeQuery(id, talkgroups); q != nil {
+					scopes = append(scopes, q)
+				}
+			}
+			where.Append(" and ").AppendQuery(scopesQuery(scopes))
+		}
+	}
+
+	switch v := searchOptions.Tag.(type) {
+	case string:
+		if m, ok := client.TagsMap[v]; ok {
+			scopes := []*Query{}
+			for id, talkgroups := range m {
+				if q := scopeQuery(id, talkgroups); q != nil {
+					scopes = append(scopes, q)
+				}
+			}
+			where.Append(" and ").AppendQuery(scopesQuery(scopes))
+		}
+	}
+
+	return where
 }
 
+func (calls *Calls) migrateCallAudio(id uint, db *Database) error {
+	var (
+		audio            []byte
+		audioRef         sql.NullString
+		audioType        sql.NullString
+		newAudioRef      any
+		newOriginalRef   any
+		originalAudio    []byte
+		originalAudioRef sql.NullString
+		originalType     sql.NullString
+		refs             = []string{}
+	)
+
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	query := db.NewQuery("select `audio`, `audioRef`, `audioType`, `originalAudio`, `originalAudioRef`, `originalAudioType` from `rdioScannerCalls` where `id` = ?", id)
+	err := query.QueryRow().Scan(&audio, &audioRef, &audioType, &originalAudio, &originalAudioRef, &originalType)
+	if err != nil {
+		return err
+	}
+
+	if audioRef.Valid && len(audioRef.String) > 0 {
+		if audio, err = db.AudioStore.Get(audioRef.String); err != nil {
+			return err
+		}
+		refs = append(refs, audioRef.String)
+	}
+
+	if originalAudioRef.Valid && len(originalAudioRef.String) > 0 {
+		if originalAudio, err = db.AudioStore.Get(originalAudioRef.String); err != nil {
+			return err
+		}
+		refs = append(refs, originalAudioRef.String)
+	}
+
+	if newAudioRef, err = db.AudioStore.Put(audio, audioType.String); err != nil {
+		return err
+	} else if newAudioRef != nil {
+		audio = []byte{}
+	}
+
+	if newOriginalRef, err = db.AudioStore.Put(originalAudio, originalType.String); err != nil {
+		return err
+	} else if newOriginalRef != nil {
+		originalAudio = nil
+	}
+
+	query = db.NewQuery("update `rdioScannerCalls` set `audio` = ?, `audioRef` = ?, `originalAudio` = ?, `originalAudioRef` = ? where `id` = ?", audio, newAudioRef, originalAudio, newOriginalRef, id)
+	if _, err = query.Exec(); err != nil {
+		return err
+	}
+
+	return calls.releaseAudio(db, refs)
+}
+
+// releaseAudio deletes the external audio no call refers to anymore.
+func (calls *Calls) releaseAudio(db *Database, refs []string) error {
+	var errs []error
+
+	for _, ref := range refs {
+		var count uint
+
+		query := db.NewQuery("select count(*) from `rdioScannerCalls` where `audioRef` = ? or `originalAudioRef` = ?", ref, ref)
+		if err := query.QueryRow().Scan(&count); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if count == 0 {
+			if err := db.AudioStore.Delete(ref); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CallsSearchCursor is the position of a call in the search results, from
+// which the next or the previous page is read.
+type CallsSearchCursor struct {
+	Backward bool
+	DateTime time.Time
+	Id       uint
+}
+
+// ParseCallsSearchCursor decodes a cursor made by CallsSearchCursor.String.
+func ParseCallsSearchCursor(s string) (*CallsSearchCursor, error) {
+	var (
+		direction string
+		nanos     int64
+	)
+
+	cursor := &CallsSearchCursor{}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		_, err = fmt.Sscanf(string(b), "%1s%d.%d", &direction, &nanos, &cursor.Id)
+	}
+	if err != nil || (direction != "n" && direction != "p") {
+		return nil, fmt.Errorf("invalid search cursor %q", s)
+	}
+
+	cursor.Backward = direction == "p"
+	cursor.DateTime = time.Unix(0, nanos).UTC()
+
+	return cursor, nil
+}
+
+func (cursor *CallsSearchCursor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cursor.String())
+}
+
+func (cursor *CallsSearchCursor) String() string {
+	direction := "n"
+	if cursor.Backward {
+		direction = "p"
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s%d.%d", direction, cursor.DateTime.UnixNano(), cursor.Id)))
+}
+
+// CallsSearchOptions are the filters of a call search. The systems and
+// excludeSystems lists are in the same format as the systems of an access
+// code, and the durations are in seconds.
 type CallsSearchOptions struct {
+	Cursor                  any `json:"cursor,omitempty"`
 	Date                    any `json:"date,omitempty"`
+	DateFrom                any `json:"from,omitempty"`
+	DateTo                  any `json:"to,omitempty"`
+	ExcludeSystems          any `json:"excludeSystems,omitempty"`
+	ExcludeUnits            any `json:"excludeUnits,omitempty"`
+	Frequency               any `json:"frequency,omitempty"`
 	Group                   any `json:"group,omitempty"`
 	Limit                   any `json:"limit,omitempty"`
+	MaxDuration             any `json:"maxDuration,omitempty"`
+	MaxFrequency            any `json:"maxFrequency,omitempty"`
+	MinDuration             any `json:"minDuration,omitempty"`
+	MinFrequency            any `json:"minFrequency,omitempty"`
 	Offset                  any `json:"offset,omitempty"`
 	Sort                    any `json:"sort,omitempty"`
 	System                  any `json:"system,omitempty"`
+	Systems                 any `json:"systems,omitempty"`
 	Tag                     any `json:"tag,omitempty"`
 	Talkgroup               any `json:"talkgroup,omitempty"`
+	Text                    any `json:"text,omitempty"`
+	ToneSet                 any `json:"toneSet,omitempty"`
+	Totals                  any `json:"totals,omitempty"`
+	Units                   any `json:"units,omitempty"`
 	searchPatchedTalkgroups bool
 }
 
 func (searchOptions *CallsSearchOptions) fromMap(m map[string]any) error {
+	uints := func(f any) []uint {
+		ids := []uint{}
+		switch v := f.(type) {
+		case []any:
+			for _, f := range v {
+				if id, ok := toSqlId(f); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+		return ids
+	}
+
+	switch v := m["cursor"].(type) {
+	case string:
+		if len(v) > 0 {
+			cursor, err := ParseCallsSearchCursor(v)
+			if err != nil {
+				return err
+			}
+			searchOptions.Cursor = cursor
+		}
+	}
+
 	switch v := m["date"].(type) {
 	case string:
 		if t, err := time.Parse(time.RFC3339, v); err == nil {
@@ -574,6 +1393,29 @@ func (searchOptions *CallsSearchOptions) fromMap(m map[string]any) error {
 		}
 	}
 
+	switch v := m["excludeSystems"].(type) {
+	case []any:
+		if len(v) > 0 {
+			searchOptions.ExcludeSystems = v
+		}
+	}
+
+	if ids := uints(m["excludeUnits"]); len(ids) > 0 {
+		searchOptions.ExcludeUnits = ids
+	}
+
+	switch v := m["frequency"].(type) {
+	case float64:
+		searchOptions.Frequency = uint(v)
+	}
+
+	switch v := m["from"].(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			searchOptions.DateFrom = t.UTC()
+		}
+	}
+
 	switch v := m["group"].(type) {
 	case string:
 		searchOptions.Group = v
@@ -584,6 +1426,26 @@ func (searchOptions *CallsSearchOptions) fromMap(m map[string]any) error {
 		searchOptions.Limit = uint(v)
 	}
 
+	switch v := m["maxDuration"].(type) {
+	case float64:
+		searchOptions.MaxDuration = v
+	}
+
+	switch v := m["maxFrequency"].(type) {
+	case float64:
+		searchOptions.MaxFrequency = uint(v)
+	}
+
+	switch v := m["minDuration"].(type) {
+	case float64:
+		searchOptions.MinDuration = v
+	}
+
+	switch v := m["minFrequency"].(type) {
+	case float64:
+		searchOptions.MinFrequency = uint(v)
+	}
+
 	switch v := m["offset"].(type) {
 	case float64:
 		searchOptions.Offset = uint(v)
@@ -599,6 +1461,13 @@ func (searchOptions *CallsSearchOptions) fromMap(m map[string]any) error {
 		searchOptions.System = uint(v)
 	}
 
+	switch v := m["systems"].(type) {
+	case []any:
+		if len(v) > 0 {
+			searchOptions.Systems = v
+		}
+	}
+
 	switch v := m["tag"].(type) {
 	case string:
 		searchOptions.Tag = v
@@ -609,20 +1478,52 @@ func (searchOptions *CallsSearchOptions) fromMap(m map[string]any) error {
 		searchOptions.Talkgroup = uint(v)
 	}
 
+	switch v := m["text"].(type) {
+	case string:
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			searchOptions.Text = v
+		}
+	}
+
+	switch v := m["to"].(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			searchOptions.DateTo = t.UTC()
+		}
+	}
+
+	switch v := m["toneSet"].(type) {
+	case float64:
+		searchOptions.ToneSet = uint(v)
+	}
+
+	switch v := m["totals"].(type) {
+	case bool:
+		searchOptions.Totals = v
+	}
+
+	if ids := uints(m["units"]); len(ids) > 0 {
+		searchOptions.Units = ids
+	}
+
 	return nil
 }
 
 type CallsSearchResult struct {
 	Id        uint      `json:"id"`
 	DateTime  time.Time `json:"dateTime"`
+	Score     float64   `json:"score,omitempty"`
 	System    uint      `json:"system"`
 	Talkgroup uint      `json:"talkgroup"`
+	Waveform  Waveform  `json:"waveform"`
 }
 
 type CallsSearchResults struct {
-	Count     uint                `json:"count"`
-	DateStart time.Time           `json:"dateStart"`
-	DateStop  time.Time           `json:"dateStop"`
+	Count     any                 `json:"count,omitempty"`
+	DateStart any                 `json:"dateStart,omitempty"`
+	DateStop  any                 `json:"dateStop,omitempty"`
+	Next      string              `json:"next,omitempty"`
 	Options   *CallsSearchOptions `json:"options"`
+	Prev      string              `json:"prev,omitempty"`
 	Results   []CallsSearchResult `json:"results"`
 }
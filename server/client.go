@@ -28,6 +28,7 @@ import (
 
 type Client struct {
 	Access     *Access
+	AlertRules []uint
 	AuthCount  int
 	Controller *Controller
 	Conn       *websocket.Conn
@@ -172,12 +173,13 @@ func (client *Client) GetRemoteAddr() string {
 	return GetRemoteAddr(client.request)
 }
 
-func (client *Client) SendConfig(groups *Groups, options *Options, systems *Systems, tags *Tags) {
+func (client *Client) SendConfig(groups *Groups, options *Options, systems *Systems, tags *Tags, toneSets *ToneSets, alertRules *AlertRules) {
 	client.SystemsMap = systems.GetScopedSystems(client, groups, tags, options.SortTalkgroups)
 	client.GroupsMap = groups.GetGroupsMap(&client.SystemsMap)
 	client.TagsMap = tags.GetTagsMap(&client.SystemsMap)
 
 	var payload = map[string]any{
+		"alertRules":         alertRules.GetAlertRulesList(),
 		"branding":           options.Branding,
 		"dimmerDelay":        options.DimmerDelay,
 		"groups":             client.GroupsMap,
@@ -188,6 +190,7 @@ func (client *Client) SendConfig(groups *Groups, options *Options, systems *Syst
 		"tags":               client.TagsMap,
 		"tagsToggle":         options.TagsToggle,
 		"time12hFormat":      options.Time12hFormat,
+		"toneSets":           toneSets.GetToneSetsList(),
 	}
 
 	if len(options.AfsSystems) > 0 {
@@ -239,6 +242,30 @@ func (clients *Clients) Count() int {
 	return len(clients.Map)
 }
 
+// EmitAlert sends an alert to the clients subscribed to its rule, provided
+// they have access to the call.
+func (clients *Clients) EmitAlert(call *Call, alert *Alert, restricted bool) {
+	payload := map[string]any{
+		"alert":     alert,
+		"call":      call.Id,
+		"dateTime":  call.DateTime.Format(time.RFC3339),
+		"system":    call.System,
+		"talkgroup": call.Talkgroup,
+	}
+
+	for c := range clients.Map {
+		if restricted && !c.Access.HasAccess(call) {
+			continue
+		}
+		for _, id := range c.AlertRules {
+			if id == alert.AlertRule {
+				c.Send <- &Message{Command: MessageCommandAlert, Payload: payload}
+				break
+			}
+		}
+	}
+}
+
 func (clients *Clients) EmitCall(call *Call, restricted bool) {
 	for c := range clients.Map {
 		if (!restricted || c.Access.HasAccess(call)) && c.Livefeed.IsEnabled(call) {
@@ -247,14 +274,14 @@ func (clients *Clients) EmitCall(call *Call, restricted bool) {
 	}
 }
 
-func (clients *Clients) EmitConfig(groups *Groups, options *Options, systems *Systems, tags *Tags, restricted bool) {
+func (clients *Clients) EmitConfig(groups *Groups, options *Options, systems *Systems, tags *Tags, toneSets *ToneSets, alertRules *AlertRules, restricted bool) {
 	count := len(clients.Map)
 
 	for c := range clients.Map {
 		if restricted {
 			c.Send <- &Message{Command: MessageCommandPin}
 		} else {
-			c.SendConfig(groups, options, systems, tags)
+			c.SendConfig(groups, options, systems, tags, toneSets, alertRules)
 		}
 
 		if options.ShowListenersCount {
@@ -263,6 +290,44 @@ func (clients *Clients) EmitConfig(groups *Groups, options *Options, systems *Sy
 	}
 }
 
+// EmitTones notifies the clients with access to the call of the tone sets
+// detected in it, whether or not they listen to its talkgroup.
+func (clients *Clients) EmitTones(call *Call, toneSets []*ToneSet, restricted bool) {
+	list := []map[string]any{}
+	for _, toneSet := range toneSets {
+		list = append(list, map[string]any{"id": toneSet.Id, "label": toneSet.Label})
+	}
+
+	payload := map[string]any{
+		"call":      call.Id,
+		"dateTime":  call.DateTime.Format(time.RFC3339),
+		"system":    call.System,
+		"talkgroup": call.Talkgroup,
+		"toneSets":  list,
+	}
+
+	for c := range clients.Map {
+		if !restricted || c.Access.HasAccess(call) {
+			c.Send <- &Message{Command: MessageCommandTone, Payload: payload}
+		}
+	}
+}
+
+// EmitTranscript sends the transcript of a call to the clients which received
+// it live.
+func (clients *Clients) EmitTranscript(call *Call, restricted bool) {
+	payload := map[string]any{
+		"call":       call.Id,
+		"transcript": call.Transcript,
+	}
+
+	for c := range clients.Map {
+		if (!restricted || c.Access.HasAccess(call)) && c.Livefeed.IsEnabled(call) {
+			c.Send <- &Message{Command: MessageCommandTranscript, Payload: payload}
+		}
+	}
+}
+
 func (clients *Clients) EmitListenersCount() {
 	count := len(clients.Map)
 
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -32,25 +33,42 @@ import (
 )
 
 const (
-	COMMAND_ARG            = "cmd"
-	COMMAND_ARG_CODE       = "+code"
-	COMMAND_ARG_EXPIRATION = "+expiration"
-	COMMAND_ARG_IDENT      = "+ident"
-	COMMAND_ARG_IN         = "+in"
-	COMMAND_ARG_LIMIT      = "+limit"
-	COMMAND_ARG_OUT        = "+out"
-	COMMAND_ARG_PASSWORD   = "+password"
-	COMMAND_ARG_SYSTEMS    = "+systems"
-	COMMAND_ARG_TOKEN      = "+token"
-	COMMAND_ARG_URL        = "+url"
-	COMMAND_ADMIN_PASSWORD = "admin-password"
-	COMMAND_CONFIG_GET     = "config-get"
-	COMMAND_CONFIG_SET     = "config-set"
-	COMMAND_HELP           = "help"
-	COMMAND_LOGIN          = "login"
-	COMMAND_LOGOUT         = "logout"
-	COMMAND_USER_ADD       = "user-add"
-	COMMAND_USER_REMOVE    = "user-remove"
+	COMMAND_ARG             = "cmd"
+	COMMAND_ARG_CALLS       = "+calls"
+	COMMAND_ARG_CODE        = "+code"
+	COMMAND_ARG_DAY         = "+day"
+	COMMAND_ARG_EXPIRATION  = "+expiration"
+	COMMAND_ARG_FROM        = "+from"
+	COMMAND_ARG_ID          = "+id"
+	COMMAND_ARG_IDENT       = "+ident"
+	COMMAND_ARG_IN          = "+in"
+	COMMAND_ARG_LIMIT       = "+limit"
+	COMMAND_ARG_LOGS        = "+logs"
+	COMMAND_ARG_OUT         = "+out"
+	COMMAND_ARG_PASSWORD    = "+password"
+	COMMAND_ARG_PROFILE     = "+profile"
+	COMMAND_ARG_SYSTEMS     = "+systems"
+	COMMAND_ARG_TARGET      = "+target"
+	COMMAND_ARG_TO          = "+to"
+	COMMAND_ARG_TOKEN       = "+token"
+	COMMAND_ARG_URL         = "+url"
+	COMMAND_ADMIN_PASSWORD  = "admin-password"
+	COMMAND_ARCHIVE_RESTORE = "archive-restore"
+	COMMAND_AUDIO_MIGRATE   = "audio-migrate"
+	COMMAND_BACKUP          = "backup"
+	COMMAND_CALL_ORIGINAL   = "call-original"
+	COMMAND_CALL_TRANSCODE  = "call-transcode"
+	COMMAND_CONFIG_GET      = "config-get"
+	COMMAND_CONFIG_SET      = "config-set"
+	COMMAND_DB_COPY         = "db-copy"
+	COMMAND_DB_MIGRATE      = "db-migrate"
+	COMMAND_DB_STATUS       = "db-status"
+	COMMAND_HELP            = "help"
+	COMMAND_LOGIN           = "login"
+	COMMAND_LOGOUT          = "logout"
+	COMMAND_RESTORE         = "restore"
+	COMMAND_USER_ADD        = "user-add"
+	COMMAND_USER_REMOVE     = "user-remove"
 
 	COMMAND_DEF_PASSWORD = "rdio-scanner"
 	COMMAND_DEF_URL      = "http://localhost:3000/"
@@ -58,21 +76,30 @@ const (
 
 type Command struct {
 	app        string
+	calls      bool
 	code       string
 	command    string
+	config     *Config
+	day        string
 	expiration string
+	from       string
+	id         string
 	ident      string
 	in         string
 	limit      string
+	logs       bool
 	out        string
 	password   string
+	profile    string
 	systems    string
+	target     string
+	to         string
 	token      string
 	tokenFile  string
 	url        string
 }
 
-func NewCommand(baseDir string) *Command {
+func NewCommand(config *Config) *Command {
 	app, _ := os.Executable()
 	pass := os.Getenv("RDIO_ADMIN_PASSWORD")
 
@@ -83,8 +110,9 @@ func NewCommand(baseDir string) *Command {
 	return &Command{
 		app:       filepath.Base(app),
 		command:   COMMAND_HELP,
+		config:    config,
 		password:  pass,
-		tokenFile: baseDir + filepath.Base(app) + ".token",
+		tokenFile: config.BaseDir + filepath.Base(app) + ".token",
 		url:       COMMAND_DEF_URL,
 	}
 }
@@ -104,12 +132,24 @@ func (command *Command) Do(action string) {
 
 	for i < len(os.Args) {
 		switch os.Args[i] {
+		case COMMAND_ARG_CALLS:
+			command.calls = true
+
 		case COMMAND_ARG_CODE:
 			command.code = readVal()
 
+		case COMMAND_ARG_DAY:
+			command.day = readVal()
+
 		case COMMAND_ARG_EXPIRATION:
 			command.expiration = readVal()
 
+		case COMMAND_ARG_FROM:
+			command.from = readVal()
+
+		case COMMAND_ARG_ID:
+			command.id = readVal()
+
 		case COMMAND_ARG_IDENT:
 			command.ident = readVal()
 
@@ -119,18 +159,27 @@ func (command *Command) Do(action string) {
 		case COMMAND_ARG_LIMIT:
 			command.limit = readVal()
 
+		case COMMAND_ARG_LOGS:
+			command.logs = true
+
 		case COMMAND_ARG_OUT:
 			command.out = readVal()
-			if !strings.HasSuffix(strings.ToLower(command.out), ".json") {
-				command.out = command.out + ".json"
-			}
 
 		case COMMAND_ARG_PASSWORD:
 			command.password = readVal()
 
+		case COMMAND_ARG_PROFILE:
+			command.profile = readVal()
+
 		case COMMAND_ARG_SYSTEMS:
 			command.systems = readVal()
 
+		case COMMAND_ARG_TARGET:
+			command.target = readVal()
+
+		case COMMAND_ARG_TO:
+			command.to = readVal()
+
 		case COMMAND_ARG_TOKEN:
 			command.tokenFile = readVal()
 
@@ -154,12 +203,36 @@ func (command *Command) Do(action string) {
 	}
 
 	switch action {
+	case COMMAND_ARCHIVE_RESTORE:
+		command.archiveRestore()
+
+	case COMMAND_AUDIO_MIGRATE:
+		command.audioMigrate()
+
+	case COMMAND_BACKUP:
+		command.backup()
+
+	case COMMAND_CALL_ORIGINAL:
+		command.callOriginal()
+
+	case COMMAND_CALL_TRANSCODE:
+		command.callTranscode()
+
 	case COMMAND_CONFIG_GET:
 		command.configGet()
 
 	case COMMAND_CONFIG_SET:
 		command.configSet()
 
+	case COMMAND_DB_COPY:
+		command.dbCopy()
+
+	case COMMAND_DB_MIGRATE:
+		command.dbMigrate()
+
+	case COMMAND_DB_STATUS:
+		command.dbStatus()
+
 	case COMMAND_LOGIN:
 		command.login()
 
@@ -169,6 +242,9 @@ func (command *Command) Do(action string) {
 	case COMMAND_ADMIN_PASSWORD:
 		command.adminPassword()
 
+	case COMMAND_RESTORE:
+		command.restore()
+
 	case COMMAND_USER_ADD:
 		command.userAdd()
 
@@ -195,10 +271,38 @@ func (command *Command) printUsage() {
 	fmt.Printf("\nAvailable Commands:\n\n")
 	fmt.Printf("  %-11s – Change administrator password.\n\n", COMMAND_ADMIN_PASSWORD)
 	fmt.Printf("    %-11s %s%s -%s %s %s <password>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_ADMIN_PASSWORD, COMMAND_ARG_PASSWORD)
+	fmt.Printf("  %-11s – Restore the archived calls of a day, the ones still in the database being skipped. The restored calls are kept for the retention period from the time they are restored.\n\n", COMMAND_ARCHIVE_RESTORE)
+	fmt.Printf("    %-11s %s%s -%s %s %s <YYYY-MM-DD>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_ARCHIVE_RESTORE, COMMAND_ARG_DAY)
+	fmt.Printf("  %-11s – Move the audio of all calls to the configured audio store, in the background.\n\n", COMMAND_AUDIO_MIGRATE)
+	fmt.Printf("    %-11s %s%s -%s %s\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_AUDIO_MIGRATE)
+	fmt.Printf("  %-11s – Write a snapshot of the configuration, the server may be running.\n\n", COMMAND_BACKUP)
+	fmt.Printf("    %-11s %s%s -%s %s\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_BACKUP)
+	fmt.Printf("    %-11s Optional:\n\n", "")
+	fmt.Printf("      %-11s %-11s <file>                – Backup file instead of a new one in the backup folder.\n", "", COMMAND_ARG_OUT)
+	fmt.Printf("      %-11s %-11s                       – Include the calls and their alerts.\n", "", COMMAND_ARG_CALLS)
+	fmt.Printf("      %-11s %-11s                       – Include the logs.\n\n", "", COMMAND_ARG_LOGS)
+	fmt.Printf("  %-11s – Download the original audio of a call.\n\n", COMMAND_CALL_ORIGINAL)
+	fmt.Printf("    %-11s %s%s -%s %s %s <call id> %s <file>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_CALL_ORIGINAL, COMMAND_ARG_ID, COMMAND_ARG_OUT)
+	fmt.Printf("  %-11s – Transcode calls again from their original audio, in the background.\n\n", COMMAND_CALL_TRANSCODE)
+	fmt.Printf("    %-11s %s%s -%s %s\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_CALL_TRANSCODE)
+	fmt.Printf("    %-11s Optional:\n\n", "")
+	fmt.Printf("      %-11s %-11s <RFC3339 format>      – Calls from this date.\n", "", COMMAND_ARG_FROM)
+	fmt.Printf("      %-11s %-11s <RFC3339 format>      – Calls up to this date.\n", "", COMMAND_ARG_TO)
+	fmt.Printf("      %-11s %-11s <label>               – Encoding profile instead of the assigned one.\n", "", COMMAND_ARG_PROFILE)
+	fmt.Printf("      %-11s %-11s <sysid1[,sysid2,...]> – Calls of specific systems.\n\n", "", COMMAND_ARG_SYSTEMS)
 	fmt.Printf("  %-11s – Retrieve server's configuration.\n\n", COMMAND_CONFIG_GET)
 	fmt.Printf("    %-11s %s%s -%s %s %s <file.json>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_CONFIG_GET, COMMAND_ARG_OUT)
 	fmt.Printf("  %-11s – Set server's configuration.\n\n", COMMAND_CONFIG_SET)
 	fmt.Printf("    %-11s %s%s -%s %s %s <file.json>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_CONFIG_SET, COMMAND_ARG_IN)
+	fmt.Printf("  %-11s – Copy all the data to an empty database, the server being stopped. Run it again to resume an interrupted copy.\n\n", COMMAND_DB_COPY)
+	fmt.Printf("    %-11s %s%s -%s %s %s sqlite://<file>\n", "", prompt, command.app, COMMAND_ARG, COMMAND_DB_COPY, COMMAND_ARG_TARGET)
+	fmt.Printf("    %-11s %s%s -%s %s %s <mysql|mariadb|postgresql>://<user>:<password>@<host>:<port>/<name>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_DB_COPY, COMMAND_ARG_TARGET)
+	fmt.Printf("  %-11s – Apply the pending database migrations, the server being stopped.\n\n", COMMAND_DB_MIGRATE)
+	fmt.Printf("    %-11s %s%s -%s %s\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_DB_MIGRATE)
+	fmt.Printf("    %-11s Optional:\n\n", "")
+	fmt.Printf("      %-11s %-11s                       – List the pending migrations without applying them.\n\n", "", "--dry-run")
+	fmt.Printf("  %-11s – Verify the database schema against this version.\n\n", COMMAND_DB_STATUS)
+	fmt.Printf("    %-11s %s%s -%s %s\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_DB_STATUS)
 	fmt.Printf("  %-11s – Login to server.\n\n", COMMAND_LOGIN)
 	if runtime.GOOS != "windows" {
 		fmt.Printf("    %-11s $ RDIO_ADMIN_PASSWORD=<password> ./%s -%s %s\n", "", command.app, COMMAND_ARG, COMMAND_LOGIN)
@@ -206,6 +310,8 @@ func (command *Command) printUsage() {
 	fmt.Printf("    %-11s %s%s -%s %s %s <password>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_LOGIN, COMMAND_ARG_PASSWORD)
 	fmt.Printf("  %-11s – Logout from server.\n\n", COMMAND_LOGOUT)
 	fmt.Printf("    %-11s %s%s -%s %s\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_LOGOUT)
+	fmt.Printf("  %-11s – Replace the tables found in a backup, the server being stopped.\n\n", COMMAND_RESTORE)
+	fmt.Printf("    %-11s %s%s -%s %s %s <file>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_RESTORE, COMMAND_ARG_IN)
 	fmt.Printf("  %-11s – Add a user access.\n\n", COMMAND_USER_ADD)
 	fmt.Printf("    %-11s %s%s -%s %s %s <ident> %s <code>\n\n", "", prompt, command.app, COMMAND_ARG, COMMAND_USER_ADD, COMMAND_ARG_IDENT, COMMAND_ARG_CODE)
 	fmt.Printf("    %-11s Optional:\n\n", "")
@@ -237,11 +343,183 @@ func (command *Command) adminPassword() {
 	}
 }
 
+func (command *Command) archiveRestore() {
+	if command.day == "" {
+		command.exitWithError(fmt.Sprintf("Missing %s <YYYY-MM-DD> arguments.", COMMAND_ARG_DAY))
+	}
+
+	db := OpenDatabase(command.config)
+	defer db.Sql.Close()
+
+	if db.Archive == nil {
+		command.exitWithError("No archive store configured.")
+	}
+
+	systems := NewSystems()
+	if err := systems.Read(db); err != nil {
+		command.exitWithError(err)
+	}
+
+	restored, skipped, err := db.Archive.Restore(db, NewCalls(), systems, command.day)
+	if err != nil {
+		command.exitWithError(err)
+	}
+
+	fmt.Printf("%d calls restored from the archive of %s, %d already in the database.\n", restored, command.day, skipped)
+}
+
+func (command *Command) audioMigrate() {
+	if res, err := command.submit(http.MethodPost, "/api/admin/audio-migrate", nil, true); err == nil {
+		if res.StatusCode == http.StatusAccepted {
+			if data, err := command.readBody(res.Body); err == nil {
+				switch v := data.(type) {
+				case map[string]any:
+					fmt.Printf("%v calls are being moved to the %v audio store, the progress is in the server logs.\n", v["count"], v["store"])
+				default:
+					command.exitWithError(errors.New("invalid response"))
+				}
+			} else {
+				command.exitWithError(err)
+			}
+		} else if res.StatusCode == http.StatusConflict {
+			command.exitWithError("The audio is already being migrated.")
+		} else {
+			command.exitWithError(errors.New(res.Status))
+		}
+	} else {
+		command.exitWithError(err)
+	}
+}
+
+func (command *Command) backup() {
+	var (
+		counts map[string]uint
+		err    error
+		out    = command.out
+	)
+
+	db := OpenDatabase(command.config)
+	defer db.Sql.Close()
+
+	if out == "" {
+		out, counts, err = db.WriteBackupFile(command.config.GetBackupDirPath(), command.calls, command.logs)
+
+	} else if f, e := os.Create(out); e == nil {
+		if counts, err = db.Backup(f, command.calls, command.logs); err == nil {
+			err = f.Close()
+		} else {
+			f.Close()
+			os.Remove(out)
+		}
+
+	} else {
+		err = e
+	}
+
+	if err != nil {
+		command.exitWithError(err)
+	}
+
+	fmt.Printf("%s saved to %s.\n", command.countRows(counts), out)
+}
+
+func (command *Command) callOriginal() {
+	if command.id == "" {
+		command.exitWithError(fmt.Sprintf("Missing %s <call id> arguments.", COMMAND_ARG_ID))
+	}
+	if command.out == "" {
+		command.exitWithError(fmt.Sprintf("Missing %s <file> arguments.", COMMAND_ARG_OUT))
+	}
+
+	if res, err := command.submit(http.MethodGet, fmt.Sprintf("/api/admin/call-original?id=%s", url.QueryEscape(command.id)), nil, true); err == nil {
+		if res.StatusCode == http.StatusOK {
+			if b, err := io.ReadAll(res.Body); err == nil {
+				if err := os.WriteFile(command.out, b, 0644); err == nil {
+					fmt.Printf("Original audio of call %s saved to %s.\n", command.id, command.out)
+				} else {
+					command.exitWithError(err)
+				}
+			} else {
+				command.exitWithError(err)
+			}
+		} else {
+			command.exitWithError(errors.New(res.Status))
+		}
+	} else {
+		command.exitWithError(err)
+	}
+}
+
+func (command *Command) callTranscode() {
+	m := map[string]any{}
+
+	if command.from != "" {
+		if t, err := time.Parse(time.RFC3339, command.from); err == nil {
+			m["from"] = t.Format(time.RFC3339)
+		} else {
+			command.exitWithError(fmt.Sprintf("Invalid date format for %s", COMMAND_ARG_FROM))
+		}
+	}
+
+	if command.to != "" {
+		if t, err := time.Parse(time.RFC3339, command.to); err == nil {
+			m["to"] = t.Format(time.RFC3339)
+		} else {
+			command.exitWithError(fmt.Sprintf("Invalid date format for %s", COMMAND_ARG_TO))
+		}
+	}
+
+	if command.profile != "" {
+		m["profile"] = command.profile
+	}
+
+	if command.systems != "" {
+		s := []int{}
+		for _, v := range strings.Split(command.systems, ",") {
+			if i, err := strconv.Atoi(v); err == nil {
+				s = append(s, i)
+			} else {
+				command.exitWithError(fmt.Sprintf("The value '%s' is invalid for %s", v, COMMAND_ARG_SYSTEMS))
+			}
+		}
+		m["systems"] = s
+	}
+
+	if body, err := command.writeBody(m); err == nil {
+		if res, err := command.submit(http.MethodPost, "/api/admin/call-transcode", body, true); err == nil {
+			if res.StatusCode == http.StatusAccepted {
+				if data, err := command.readBody(res.Body); err == nil {
+					switch v := data.(type) {
+					case map[string]any:
+						fmt.Printf("%v calls are being transcoded, the progress is in the server logs.\n", v["count"])
+					default:
+						command.exitWithError(errors.New("invalid response"))
+					}
+				} else {
+					command.exitWithError(err)
+				}
+			} else if res.StatusCode == http.StatusConflict {
+				command.exitWithError("Calls are already being transcoded.")
+			} else {
+				command.exitWithError(errors.New(res.Status))
+			}
+		} else {
+			command.exitWithError(err)
+		}
+	} else {
+		command.exitWithError(err)
+	}
+}
+
 func (command *Command) configGet() {
 	if command.out == "" {
 		command.exitWithError(fmt.Sprintf("Missing %s <file.json> arguments.", COMMAND_ARG_OUT))
 	}
 
+	if !strings.HasSuffix(strings.ToLower(command.out), ".json") {
+		command.out = command.out + ".json"
+	}
+
 	if res, err := command.submit(http.MethodGet, "/api/admin/config", nil, true); err == nil {
 		if res.StatusCode == http.StatusOK {
 			if data, err := command.readBody(res.Body); err == nil {
@@ -299,6 +577,126 @@ func (command *Command) configSet() {
 	}
 }
 
+func (command *Command) dbCopy() {
+	if command.target == "" {
+		command.exitWithError(fmt.Sprintf("Missing %s <url> arguments.", COMMAND_ARG_TARGET))
+	}
+
+	config, err := ParseDatabaseUrl(command.config, command.target)
+	if err != nil {
+		command.exitWithError(fmt.Sprintf("Invalid database url for %s: %v", COMMAND_ARG_TARGET, err))
+	}
+
+	db := OpenDatabase(command.config)
+	defer db.Sql.Close()
+
+	target := OpenDatabase(config)
+	defer target.Sql.Close()
+
+	if err = target.migrate(); err != nil {
+		command.exitWithError(err)
+	}
+
+	copies, err := db.CopyTo(target, func(tableCopy *DatabaseCopy, done bool) {
+		fmt.Printf("\r  %-30s %d rows copied", tableCopy.Table.Name, tableCopy.Copied)
+		if done {
+			fmt.Printf(", %d of %d rows in the target\n", tableCopy.Target, tableCopy.Source)
+		}
+	})
+	if err != nil {
+		fmt.Println()
+		command.exitWithError(err)
+	}
+
+	invalid := 0
+	for _, tableCopy := range copies {
+		if !tableCopy.IsValid() {
+			invalid++
+		}
+	}
+
+	if invalid > 0 {
+		command.exitWithError(fmt.Sprintf("The row counts of %d tables don't match.", invalid))
+	}
+
+	fmt.Printf("%d tables copied to the %s database. The search index is rebuilt when the server starts on it.\n", len(copies), config.DbType)
+}
+
+func (command *Command) dbMigrate() {
+	db := OpenDatabase(command.config)
+	defer db.Sql.Close()
+
+	status, err := db.GetMigrationsStatus()
+	if err != nil {
+		command.exitWithError(err)
+	}
+
+	if status.IsNewer() {
+		command.exitWithError(fmt.Sprintf("Database schema version %d is newer than version %d supported by this version.", status.Current, status.Latest))
+	}
+
+	pending := status.GetPending()
+
+	if len(pending) == 0 {
+		fmt.Println("No pending database migration.")
+		return
+	}
+
+	if command.config.dryRun {
+		for _, migration := range pending {
+			fmt.Printf("-- %s\n", migration.Name)
+			for _, query := range migration.Queries {
+				fmt.Printf("%s;\n", query)
+			}
+			if migration.Data != nil {
+				fmt.Println("-- followed by the queries moving the existing rows")
+			}
+			fmt.Println()
+		}
+
+		fmt.Printf("%d pending database migrations, none applied.\n", len(pending))
+		return
+	}
+
+	if err := db.migrate(); err != nil {
+		command.exitWithError(err)
+	}
+
+	fmt.Printf("%d database migrations applied.\n", len(pending))
+}
+
+func (command *Command) dbStatus() {
+	db := OpenDatabase(command.config)
+	defer db.Sql.Close()
+
+	status, err := db.GetMigrationsStatus()
+	if err != nil {
+		command.exitWithError(err)
+	}
+
+	fmt.Printf("Database schema version %d, this version expects %d.\n\n", status.Current, status.Latest)
+
+	fmt.Printf("  %-14s  %-8s  %-20s  %s\n", "VERSION", "STATUS", "APPLIED AT", "NAME")
+	for _, entry := range status.List {
+		appliedAt := "-"
+		switch v := entry.AppliedAt.(type) {
+		case time.Time:
+			appliedAt = v.Format(time.RFC3339)
+		}
+
+		fmt.Printf("  %-14d  %-8s  %-20s  %s\n", entry.Version, entry.Status, appliedAt, entry.Name)
+	}
+	fmt.Println()
+
+	if status.IsNewer() {
+		command.exitWithError("The database was migrated by a more recent version.")
+	} else if !status.IsValid() {
+		command.exitWithError("The database schema does not match this version.")
+	}
+
+	fmt.Println("The database schema is up to date.")
+}
+
 func (command *Command) login() {
 	if body, err := command.writeBody(map[string]any{"password": command.password}); err == nil {
 		if res, err := command.submit(http.MethodPost, "/api/admin/login", body, false); err == nil {
@@ -352,6 +750,32 @@ func (command *Command) logout() {
 	}
 }
 
+func (command *Command) restore() {
+	if command.in == "" {
+		command.exitWithError(fmt.Sprintf("Missing %s <file> arguments.", COMMAND_ARG_IN))
+	}
+
+	f, err := os.Open(command.in)
+	if err != nil {
+		command.exitWithError(err)
+	}
+	defer f.Close()
+
+	db := OpenDatabase(command.config)
+	defer db.Sql.Close()
+
+	if err = db.migrate(); err != nil {
+		command.exitWithError(err)
+	}
+
+	counts, err := db.Restore(f)
+	if err != nil {
+		command.exitWithError(err)
+	}
+
+	fmt.Printf("%s restored from %s.\n", command.countRows(counts), command.in)
+}
+
 func (command *Command) userAdd() {
 	if command.ident == "" {
 		command.exitWithError(fmt.Sprintf("Missing %s <ident> arguments.", COMMAND_ARG_IDENT))
@@ -432,6 +856,16 @@ func (command *Command) userRemove() {
 	}
 }
 
+func (c *Command) countRows(counts map[string]uint) string {
+	var rows uint
+
+	for _, count := range counts {
+		rows += count
+	}
+
+	return fmt.Sprintf("%d rows of %d tables", rows, len(counts))
+}
+
 func (c *Command) readBody(body io.ReadCloser) (data any, err error) {
 	err = json.NewDecoder(body).Decode(&data)
 	return data, err
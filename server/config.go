@@ -53,20 +53,36 @@ const (
 )
 
 type Config struct {
-	BaseDir          string
-	ConfigFile       string
-	DbType           string
-	DbFile           string
-	DbHost           string
-	DbPort           uint
-	DbName           string
-	DBSSLMode        sslMode
-	DbUsername       string
-	DbPassword       string
-	MetricsPort      uint
-	Listen           string
-	daemon           *Daemon
-	newAdminPassword string
+	ArchiveDir         string
+	ArchiveS3AccessKey string
+	ArchiveS3Bucket    string
+	ArchiveS3Endpoint  string
+	ArchiveS3Region    string
+	ArchiveS3SecretKey string
+	ArchiveStore       string
+	AudioDir           string
+	AudioS3AccessKey   string
+	AudioS3Bucket      string
+	AudioS3Endpoint    string
+	AudioS3Region      string
+	AudioS3SecretKey   string
+	AudioStore         string
+	BackupDir          string
+	BaseDir            string
+	ConfigFile         string
+	DbType             string
+	DbFile             string
+	DbHost             string
+	DbPort             uint
+	DbName             string
+	DBSSLMode          sslMode
+	DbUsername         string
+	DbPassword         string
+	MetricsPort        uint
+	Listen             string
+	daemon             *Daemon
+	dryRun             bool
+	newAdminPassword   string
 }
 
 func NewConfig() *Config {
@@ -77,7 +93,7 @@ func NewConfig() *Config {
 		config        = &Config{}
 		configSave    = flag.Bool("config_save", false, fmt.Sprintf("save configuration to %s", defaultConfigFile))
 		serviceAction = flag.String("service", "", "service command, one of start, stop, restart, install, uninstall")
-		version       = flag.Bool("version", false, "show application version")
+		showVersion   = flag.Bool("version", false, "show application version")
 	)
 
 	defaultDbType := os.Getenv("DB_TYPE")
@@ -103,9 +119,12 @@ func NewConfig() *Config {
 	}
 
 	const (
-		defaultAdminUrl = "/admin"
-		defaultDbFile   = "rdio-scanner.db"
-		defaultListen   = ":3000"
+		defaultAdminUrl   = "/admin"
+		defaultArchiveDir = "archive"
+		defaultAudioDir   = "audio"
+		defaultBackupDir  = "backups"
+		defaultDbFile     = "rdio-scanner.db"
+		defaultListen     = ":3000"
 	)
 
 	if exe, err := os.Executable(); err == nil {
@@ -122,6 +141,21 @@ func NewConfig() *Config {
 		}
 	}
 
+	flag.StringVar(&config.ArchiveDir, "archive_dir", defaultArchiveDir, "directory of the filesystem call archive")
+	flag.StringVar(&config.ArchiveS3AccessKey, "archive_s3_access_key", "", "access key of the s3 call archive, default to the audio store one")
+	flag.StringVar(&config.ArchiveS3Bucket, "archive_s3_bucket", "", "bucket of the s3 call archive")
+	flag.StringVar(&config.ArchiveS3Endpoint, "archive_s3_endpoint", "", "endpoint of the s3 call archive, default to the audio store one")
+	flag.StringVar(&config.ArchiveS3Region, "archive_s3_region", "", "region of the s3 call archive, default to the audio store one")
+	flag.StringVar(&config.ArchiveS3SecretKey, "archive_s3_secret_key", "", "secret key of the s3 call archive, default to the audio store one")
+	flag.StringVar(&config.ArchiveStore, "archive_store", "", fmt.Sprintf("where pruned calls are archived, one of %s or %s, none by default", AUDIO_STORE_FILESYSTEM, AUDIO_STORE_S3))
+	flag.StringVar(&config.AudioDir, "audio_dir", defaultAudioDir, "directory of the filesystem audio store")
+	flag.StringVar(&config.AudioS3AccessKey, "audio_s3_access_key", "", "access key of the s3 audio store")
+	flag.StringVar(&config.AudioS3Bucket, "audio_s3_bucket", "", "bucket of the s3 audio store")
+	flag.StringVar(&config.AudioS3Endpoint, "audio_s3_endpoint", "", "endpoint of the s3 audio store")
+	flag.StringVar(&config.AudioS3Region, "audio_s3_region", "", "region of the s3 audio store")
+	flag.StringVar(&config.AudioS3SecretKey, "audio_s3_secret_key", "", "secret key of the s3 audio store")
+	flag.StringVar(&config.AudioStore, "audio_store", AUDIO_STORE_DATABASE, fmt.Sprintf("where call audio is stored, one of %s, %s, or %s", AUDIO_STORE_DATABASE, AUDIO_STORE_FILESYSTEM, AUDIO_STORE_S3))
+	flag.StringVar(&config.BackupDir, "backup_dir", defaultBackupDir, "directory of the scheduled database backups")
 	flag.StringVar(&config.BaseDir, "base_dir", config.BaseDir, "base directory where all data will be written")
 	flag.StringVar(&config.DbFile, "db_file", defaultDbFile, "sqlite database file")
 	flag.StringVar(&config.DbHost, "db_host", defaultDbHost, "database host ip or hostname")
@@ -135,8 +169,25 @@ func NewConfig() *Config {
 	flag.StringVar(&config.ConfigFile, "config", defaultConfigFile, "server config file")
 	flag.StringVar(&config.Listen, "listen", defaultListen, "listening address")
 	flag.StringVar(&config.newAdminPassword, "admin_password", "", "change admin password")
+	flag.BoolVar(&config.dryRun, "dry-run", false, fmt.Sprintf("with -%s %s, show the pending migrations without applying them", COMMAND_ARG, COMMAND_DB_MIGRATE))
 	flag.Parse()
 
+	if v := os.Getenv("ARCHIVE_S3_ACCESS_KEY"); v != "" {
+		config.ArchiveS3AccessKey = v
+	}
+
+	if v := os.Getenv("ARCHIVE_S3_SECRET_KEY"); v != "" {
+		config.ArchiveS3SecretKey = v
+	}
+
+	if v := os.Getenv("AUDIO_S3_ACCESS_KEY"); v != "" {
+		config.AudioS3AccessKey = v
+	}
+
+	if v := os.Getenv("AUDIO_S3_SECRET_KEY"); v != "" {
+		config.AudioS3SecretKey = v
+	}
+
 	dbUsernameEnv := os.Getenv("DB_USER")
 	if dbUsernameEnv != "" {
 		config.DbUsername = dbUsernameEnv
@@ -181,12 +232,72 @@ func NewConfig() *Config {
 			os.Exit(-1)
 		}
 
-	case *version:
-		fmt.Printf("Version %s Commit %s", version, commit)
+	case *showVersion:
+		fmt.Printf("Version %s Commit %s\n", version, commit)
 		os.Exit(0)
 
 	default:
 		if cfg, err := ini.Load(config.GetConfigFilePath()); err == nil {
+			if v := cfg.Section("").Key("archive_dir").String(); len(v) > 0 {
+				config.ArchiveDir = v
+			}
+
+			if v := cfg.Section("").Key("archive_s3_access_key").String(); len(v) > 0 {
+				config.ArchiveS3AccessKey = v
+			}
+
+			if v := cfg.Section("").Key("archive_s3_bucket").String(); len(v) > 0 {
+				config.ArchiveS3Bucket = v
+			}
+
+			if v := cfg.Section("").Key("archive_s3_endpoint").String(); len(v) > 0 {
+				config.ArchiveS3Endpoint = v
+			}
+
+			if v := cfg.Section("").Key("archive_s3_region").String(); len(v) > 0 {
+				config.ArchiveS3Region = v
+			}
+
+			if v := cfg.Section("").Key("archive_s3_secret_key").String(); len(v) > 0 {
+				config.ArchiveS3SecretKey = v
+			}
+
+			if v := cfg.Section("").Key("archive_store").String(); len(v) > 0 {
+				config.ArchiveStore = v
+			}
+
+			if v := cfg.Section("").Key("audio_dir").String(); len(v) > 0 {
+				config.AudioDir = v
+			}
+
+			if v := cfg.Section("").Key("audio_s3_access_key").String(); len(v) > 0 {
+				config.AudioS3AccessKey = v
+			}
+
+			if v := cfg.Section("").Key("audio_s3_bucket").String(); len(v) > 0 {
+				config.AudioS3Bucket = v
+			}
+
+			if v := cfg.Section("").Key("audio_s3_endpoint").String(); len(v) > 0 {
+				config.AudioS3Endpoint = v
+			}
+
+			if v := cfg.Section("").Key("audio_s3_region").String(); len(v) > 0 {
+				config.AudioS3Region = v
+			}
+
+			if v := cfg.Section("").Key("audio_s3_secret_key").String(); len(v) > 0 {
+				config.AudioS3SecretKey = v
+			}
+
+			if v := cfg.Section("").Key("audio_store").String(); len(v) > 0 {
+				config.AudioStore = v
+			}
+
+			if v := cfg.Section("").Key("backup_dir").String(); len(v) > 0 {
+				config.BackupDir = v
+			}
+
 			if v := cfg.Section("").Key("db_file").String(); len(v) > 0 {
 				config.DbFile = v
 			}
@@ -231,7 +342,7 @@ func NewConfig() *Config {
 	}
 
 	if *command != "" {
-		NewCommand(config.BaseDir).Do(*command)
+		NewCommand(config).Do(*command)
 	}
 
 	if *serviceAction != "" {
@@ -241,6 +352,18 @@ func NewConfig() *Config {
 	return config
 }
 
+func (config *Config) GetArchiveDirPath() string {
+	return config.GetPath(config.ArchiveDir)
+}
+
+func (config *Config) GetAudioDirPath() string {
+	return config.GetPath(config.AudioDir)
+}
+
+func (config *Config) GetBackupDirPath() string {
+	return config.GetPath(config.BackupDir)
+}
+
 func (config *Config) GetConfigFilePath() string {
 	return config.GetPath(config.ConfigFile)
 }
@@ -268,6 +391,66 @@ func (config *Config) isBaseDirWritable() bool {
 func (config *Config) saveConfig() error {
 	ini := []string{}
 
+	if config.ArchiveStore != "" {
+		ini = append(ini, fmt.Sprintf("archive_store = %s", config.ArchiveStore))
+	}
+
+	if config.ArchiveStore == AUDIO_STORE_FILESYSTEM && config.ArchiveDir != "" {
+		ini = append(ini, fmt.Sprintf("archive_dir = %s", config.ArchiveDir))
+	}
+
+	if config.ArchiveS3Bucket != "" {
+		ini = append(ini, fmt.Sprintf("archive_s3_bucket = %s", config.ArchiveS3Bucket))
+
+		if config.ArchiveS3Endpoint != "" {
+			ini = append(ini, fmt.Sprintf("archive_s3_endpoint = %s", config.ArchiveS3Endpoint))
+		}
+
+		if config.ArchiveS3Region != "" {
+			ini = append(ini, fmt.Sprintf("archive_s3_region = %s", config.ArchiveS3Region))
+		}
+
+		if config.ArchiveS3AccessKey != "" {
+			ini = append(ini, fmt.Sprintf("archive_s3_access_key = %s", config.ArchiveS3AccessKey))
+		}
+
+		if config.ArchiveS3SecretKey != "" {
+			ini = append(ini, fmt.Sprintf("archive_s3_secret_key = %s", config.ArchiveS3SecretKey))
+		}
+	}
+
+	if config.AudioStore != "" && config.AudioStore != AUDIO_STORE_DATABASE {
+		ini = append(ini, fmt.Sprintf("audio_store = %s", config.AudioStore))
+	}
+
+	if config.AudioStore == AUDIO_STORE_FILESYSTEM && config.AudioDir != "" {
+		ini = append(ini, fmt.Sprintf("audio_dir = %s", config.AudioDir))
+	}
+
+	if config.AudioS3Bucket != "" {
+		ini = append(ini, fmt.Sprintf("audio_s3_bucket = %s", config.AudioS3Bucket))
+
+		if config.AudioS3Endpoint != "" {
+			ini = append(ini, fmt.Sprintf("audio_s3_endpoint = %s", config.AudioS3Endpoint))
+		}
+
+		if config.AudioS3Region != "" {
+			ini = append(ini, fmt.Sprintf("audio_s3_region = %s", config.AudioS3Region))
+		}
+
+		if config.AudioS3AccessKey != "" {
+			ini = append(ini, fmt.Sprintf("audio_s3_access_key = %s", config.AudioS3AccessKey))
+		}
+
+		if config.AudioS3SecretKey != "" {
+			ini = append(ini, fmt.Sprintf("audio_s3_secret_key = %s", config.AudioS3SecretKey))
+		}
+	}
+
+	if config.BackupDir != "" {
+		ini = append(ini, fmt.Sprintf("backup_dir = %s", config.BackupDir))
+	}
+
 	if config.DbType == DbTypeSqlite {
 		if config.DbFile != "" {
 			ini = append(ini, fmt.Sprintf("db_file = %s", config.DbFile))
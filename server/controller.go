@@ -23,57 +23,94 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// ErrAudioMigrateRunning is returned when the audio of the calls is to be
+// moved while it is still being moved.
+var ErrAudioMigrateRunning = errors.New("the audio is already being migrated")
+
+// ErrReindexRunning is returned when the calls are to be reindexed while they
+// are still being reindexed.
+var ErrReindexRunning = errors.New("calls are already being reindexed")
+
+// ErrTranscodeRunning is returned when calls are to be transcoded while the
+// previous ones are still being transcoded.
+var ErrTranscodeRunning = errors.New("calls are already being transcoded")
+
 type Controller struct {
-	Admin       *Admin
-	Api         *Api
-	Calls       *Calls
-	Config      *Config
-	Database    *Database
-	Accesses    *Accesses
-	Apikeys     *Apikeys
-	Dirwatches  *Dirwatches
-	Downstreams *Downstreams
-	FFMpeg      *FFMpeg
-	Groups      *Groups
-	Logs        *Logs
-	Options     *Options
-	Scheduler   *Scheduler
-	Systems     *Systems
-	Tags        *Tags
-	Clients     *Clients
-	Register    chan *Client
-	Unregister  chan *Client
-	Ingest      chan *Call
-	running     bool
+	Admin          *Admin
+	AlertRules     *AlertRules
+	Alerts         *Alerts
+	Api            *Api
+	Calls          *Calls
+	Config         *Config
+	Database       *Database
+	Accesses       *Accesses
+	Apikeys        *Apikeys
+	BestCopies     *BestCopies
+	Bucketwatches  *Bucketwatches
+	Dirwatches     *Dirwatches
+	Downstreams    *Downstreams
+	Exports        *CallsExports
+	FFMpeg         *FFMpeg
+	Groups         *Groups
+	Logs           *Logs
+	Options        *Options
+	Profiles       *Profiles
+	RetentionRules *RetentionRules
+	Scheduler      *Scheduler
+	Systems        *Systems
+	Tags           *Tags
+	ToneSets       *ToneSets
+	Transcriptions *Transcriptions
+	Clients        *Clients
+	Register       chan *Client
+	Unregister     chan *Client
+	Ingest         chan *Call
+	populateMutex  sync.RWMutex
+	jobsMutex      sync.Mutex
+	migrating      bool
+	reindexing     bool
+	running        bool
+	transcoding    bool
 }
 
 func NewController(config *Config) *Controller {
 	controller := &Controller{
-		Config:      config,
-		Accesses:    NewAccesses(),
-		Apikeys:     NewApikeys(),
-		Calls:       NewCalls(),
-		Dirwatches:  NewDirwatches(),
-		Downstreams: NewDownstreams(),
-		FFMpeg:      NewFFMpeg(),
-		Groups:      NewGroups(),
-		Logs:        NewLogs(),
-		Options:     NewOptions(),
-		Systems:     NewSystems(),
-		Tags:        NewTags(),
-		Clients:     NewClients(),
-		Register:    make(chan *Client, 8192),
-		Unregister:  make(chan *Client, 8192),
-		Ingest:      make(chan *Call, 8192),
+		Config:         config,
+		Accesses:       NewAccesses(),
+		AlertRules:     NewAlertRules(),
+		Apikeys:        NewApikeys(),
+		Bucketwatches:  NewBucketwatches(),
+		Calls:          NewCalls(),
+		Dirwatches:     NewDirwatches(),
+		Downstreams:    NewDownstreams(),
+		FFMpeg:         NewFFMpeg(),
+		Groups:         NewGroups(),
+		Logs:           NewLogs(),
+		Options:        NewOptions(),
+		Profiles:       NewProfiles(),
+		RetentionRules: NewRetentionRules(),
+		Systems:        NewSystems(),
+		Tags:           NewTags(),
+		ToneSets:       NewToneSets(),
+		Clients:        NewClients(),
+		Register:       make(chan *Client, 8192),
+		Unregister:     make(chan *Client, 8192),
+		Ingest:         make(chan *Call, 8192),
 	}
 
 	controller.Admin = NewAdmin(controller)
+	controller.Alerts = NewAlerts(controller)
 	controller.Api = NewApi(controller)
+	controller.BestCopies = NewBestCopies(controller)
 	controller.Database = NewDatabase(config)
+	controller.Exports = NewCallsExports(controller)
 	controller.Scheduler = NewScheduler(controller)
+	controller.Transcriptions = NewTranscriptions(controller)
 
 	controller.Logs.setDaemon(config.daemon)
 	controller.Logs.setDatabase(controller.Database)
@@ -81,23 +118,30 @@ func NewController(config *Config) *Controller {
 	return controller
 }
 
+// EmitCall sends the call to the clients right away. When it has to be
+// transcribed, the downstreams get it along with its transcript afterward.
 func (controller *Controller) EmitCall(call *Call) {
-	go controller.Downstreams.Send(controller, call)
+	if call.Transcript != nil || !controller.Transcriptions.Enqueue(call) {
+		go controller.Downstreams.Send(controller, call)
+	}
 	go controller.Clients.EmitCall(call, controller.Accesses.IsRestricted())
 }
 
 func (controller *Controller) EmitConfig() {
-	go controller.Clients.EmitConfig(controller.Groups, controller.Options, controller.Systems, controller.Tags, controller.Accesses.IsRestricted())
+	go controller.Clients.EmitConfig(controller.Groups, controller.Options, controller.Systems, controller.Tags, controller.ToneSets, controller.AlertRules, controller.Accesses.IsRestricted())
 	go controller.Admin.BroadcastConfig()
 }
 
+func (controller *Controller) EmitTones(call *Call, toneSets []*ToneSet) {
+	go controller.Clients.EmitTones(call, toneSets, controller.Accesses.IsRestricted())
+}
+
 func (controller *Controller) IngestCall(call *Call) {
 	var (
 		err        error
 		group      *Group
 		groupId    uint
 		groupLabel string
-		id         uint
 		ok         bool
 		populated  bool
 		system     *System
@@ -107,23 +151,37 @@ func (controller *Controller) IngestCall(call *Call) {
 		talkgroup  *Talkgroup
 	)
 
-	logCall := func(call *Call, level string, message string) {
-		controller.Logs.LogEvent(level, fmt.Sprintf("newcall: system=%v talkgroup=%v file=%v %v", call.System, call.Talkgroup, call.AudioName, message))
-	}
-
 	logError := func(err error) {
 		controller.Logs.LogEvent(LogLevelError, fmt.Sprintf("controller.ingestcall: %v", err.Error()))
 	}
 
+	// the systems and talkgroups are only changed while no call is being
+	// stored, as the best copies are stored from other goroutines
+	locked := false
+	lock := func() {
+		if !locked {
+			controller.populateMutex.Lock()
+			locked = true
+		}
+	}
+	unlock := func() {
+		if locked {
+			controller.populateMutex.Unlock()
+			locked = false
+		}
+	}
+	defer unlock()
+
 	if system, ok = controller.Systems.GetSystem(call.System); ok {
 		if system.Blacklists.IsBlacklisted(call.Talkgroup) {
-			logCall(call, LogLevelInfo, "blacklisted")
+			controller.logCall(call, LogLevelInfo, "blacklisted")
 			return
 		}
 		talkgroup, _ = system.Talkgroups.GetTalkgroup(call.Talkgroup)
 	}
 
 	if controller.Options.AutoPopulate && system == nil {
+		lock()
 		populated = true
 
 		system = NewSystem()
@@ -141,6 +199,7 @@ func (controller *Controller) IngestCall(call *Call) {
 
 	if controller.Options.AutoPopulate || (system != nil && system.AutoPopulate) {
 		if system != nil && talkgroup == nil {
+			lock()
 			populated = true
 
 			switch v := call.talkgroupGroup.(type) {
@@ -228,6 +287,7 @@ func (controller *Controller) IngestCall(call *Call) {
 		switch v := call.talkgroupLabel.(type) {
 		case string:
 			if talkgroup.Label != v {
+				lock()
 				populated = true
 				talkgroup.Label = v
 			}
@@ -236,11 +296,13 @@ func (controller *Controller) IngestCall(call *Call) {
 		switch v := call.talkgroupName.(type) {
 		case string:
 			if talkgroup.Name != v {
+				lock()
 				populated = true
 				talkgroup.Name = v
 			}
 		default:
 			if len(talkgroup.Name) == 0 {
+				lock()
 				populated = true
 				talkgroup.Name = talkgroup.Label
 			}
@@ -268,47 +330,42 @@ func (controller *Controller) IngestCall(call *Call) {
 		controller.EmitConfig()
 	}
 
+	unlock()
+
 	if system == nil || talkgroup == nil {
-		logCall(call, LogLevelWarn, "no matching system/talkgroup")
+		controller.logCall(call, LogLevelWarn, "no matching system/talkgroup")
 		return
 	}
 
 	if !controller.Options.DisableDuplicateDetection {
-		if controller.Calls.CheckDuplicate(call, controller.Options.DuplicateDetectionTimeFrame, controller.Database) {
-			logCall(call, LogLevelWarn, "duplicate call rejected")
-			return
+		if controller.Options.DuplicateDetectionMode == DUPLICATE_DETECTION_MODE_FINGERPRINT {
+			if samples, err := controller.FFMpeg.Decode(call.Audio, FINGERPRINT_SAMPLE_RATE); err == nil {
+				call.Fingerprint = NewFingerprint(samples)
+			}
 		}
-	}
-
-	if err := controller.FFMpeg.Convert(call, controller.Systems, controller.Tags, controller.Options.AudioConversion, controller.Options.AudioBitrate); err != nil {
-		controller.Logs.LogEvent(LogLevelWarn, err.Error())
-	}
-
-	if id, err = controller.Calls.WriteCall(call, controller.Database); err == nil {
-		call.Id = id
-		call.systemLabel = system.Label
-		call.talkgroupLabel = talkgroup.Label
-		call.talkgroupName = talkgroup.Name
 
-		if group == nil {
-			if group, ok = controller.Groups.GetGroup(talkgroup.GroupId); ok {
-				call.talkgroupGroup = group.Label
+		if controller.Options.BestCopyWindow > 0 {
+			if !controller.BestCopies.Hold(call, system, talkgroup) {
+				controller.logCall(call, LogLevelWarn, "duplicate call rejected")
 			}
+			return
 		}
 
-		if tag == nil {
-			if tag, ok = controller.Tags.GetTag(talkgroup.TagId); ok {
-				call.talkgroupTag = tag.Label
-			}
+		if controller.Calls.CheckDuplicate(call, controller.Options, controller.Database) {
+			controller.logCall(call, LogLevelWarn, "duplicate call rejected")
+			return
 		}
+	}
 
-		logCall(call, LogLevelInfo, "success")
+	// the calls are stored concurrently to keep the ffmpeg workers busy, the
+	// ones still being stored counting for the duplicate detection
+	controller.Calls.SetPending(call, true)
 
-		controller.EmitCall(call)
+	controller.FFMpeg.Go(func() {
+		defer controller.Calls.SetPending(call, false)
 
-	} else {
-		logError(err)
-	}
+		controller.storeCall(call, system, talkgroup)
+	})
 }
 
 func (controller *Controller) LogClientsCount() {
@@ -322,13 +379,16 @@ func (controller *Controller) ProcessMessage(client *Client, message *Message) e
 	} else if controller.Accesses.IsRestricted() && client.Access.Systems == nil && message.Command != MessageCommandPin {
 		client.Send <- &Message{Command: MessageCommandPin}
 
+	} else if message.Command == MessageCommandAlert {
+		controller.ProcessMessageCommandAlert(client, message)
+
 	} else if message.Command == MessageCommandCall {
 		if err := controller.ProcessMessageCommandCall(client, message); err != nil {
 			return err
 		}
 
 	} else if message.Command == MessageCommandConfig {
-		client.SendConfig(controller.Groups, controller.Options, controller.Systems, controller.Tags)
+		client.SendConfig(controller.Groups, controller.Options, controller.Systems, controller.Tags, controller.ToneSets, controller.AlertRules)
 
 	} else if message.Command == MessageCommandListCall {
 		if err := controller.ProcessMessageCommandListCall(client, message); err != nil {
@@ -347,6 +407,20 @@ func (controller *Controller) ProcessMessage(client *Client, message *Message) e
 	return nil
 }
 
+func (controller *Controller) ProcessMessageCommandAlert(client *Client, message *Message) {
+	client.AlertRules = []uint{}
+
+	switch v := message.Payload.(type) {
+	case []any:
+		for _, f := range v {
+			switch id := f.(type) {
+			case float64:
+				client.AlertRules = append(client.AlertRules, uint(id))
+			}
+		}
+	}
+}
+
 func (controller *Controller) ProcessMessageCommandCall(client *Client, message *Message) error {
 	var (
 		call *Call
@@ -381,7 +455,9 @@ func (controller *Controller) ProcessMessageCommandListCall(client *Client, mess
 	switch v := message.Payload.(type) {
 	case map[string]any:
 		searchOptions := CallsSearchOptions{searchPatchedTalkgroups: controller.Options.SearchPatchedTalkgroups}
-		searchOptions.fromMap(v)
+		if err := searchOptions.fromMap(v); err != nil {
+			return fmt.Errorf("controller.processmessage.commandlistcall: %v", err)
+		}
 		if searchResults, err := controller.Calls.Search(&searchOptions, client); err == nil {
 			client.Send <- &Message{Command: MessageCommandListCall, Payload: searchResults}
 		} else {
@@ -446,7 +522,7 @@ func (controller *Controller) ProcessMessageCommandPin(client *Client, message *
 
 		client.AuthCount = 0
 
-		client.SendConfig(controller.Groups, controller.Options, controller.Systems, controller.Tags)
+		client.SendConfig(controller.Groups, controller.Options, controller.Systems, controller.Tags, controller.ToneSets, controller.AlertRules)
 	}
 
 	return nil
@@ -480,9 +556,15 @@ func (controller *Controller) Start() error {
 	if err = controller.Accesses.Read(controller.Database); err != nil {
 		return err
 	}
+	if err = controller.AlertRules.Read(controller.Database); err != nil {
+		return err
+	}
 	if err = controller.Apikeys.Read(controller.Database); err != nil {
 		return err
 	}
+	if err = controller.Bucketwatches.Read(controller.Database); err != nil {
+		return err
+	}
 	if err = controller.Dirwatches.Read(controller.Database); err != nil {
 		return err
 	}
@@ -495,12 +577,22 @@ func (controller *Controller) Start() error {
 	if err = controller.Options.Read(controller.Database); err != nil {
 		return err
 	}
+	controller.FFMpeg.SetLimits(controller.Options.FFMpegWorkers, time.Duration(controller.Options.FFMpegTimeout)*time.Second)
+	if err = controller.Profiles.Read(controller.Database); err != nil {
+		return err
+	}
+	if err = controller.RetentionRules.Read(controller.Database); err != nil {
+		return err
+	}
 	if err = controller.Systems.Read(controller.Database); err != nil {
 		return err
 	}
 	if err = controller.Tags.Read(controller.Database); err != nil {
 		return err
 	}
+	if err = controller.ToneSets.Read(controller.Database); err != nil {
+		return err
+	}
 
 	if err = controller.Admin.Start(); err != nil {
 		return err
@@ -509,6 +601,18 @@ func (controller *Controller) Start() error {
 		return err
 	}
 
+	controller.Transcriptions.Start()
+
+	go func() {
+		count, err := controller.Calls.Reindex(controller, false, nil)
+		if err != nil {
+			controller.Logs.LogEvent(LogLevelError, err.Error())
+		}
+		if count > 0 {
+			controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("%d calls added to the search index", count))
+		}
+	}()
+
 	go func() {
 		c := make(chan os.Signal, 8)
 		signal.Notify(c, os.Interrupt)
@@ -569,13 +673,19 @@ func (controller *Controller) Start() error {
 		}
 	}()
 
+	controller.Bucketwatches.Start(controller)
 	controller.Dirwatches.Start(controller)
 
 	return nil
 }
 
 func (controller *Controller) Terminate() {
+	controller.Bucketwatches.Stop()
 	controller.Dirwatches.Stop()
+	controller.BestCopies.Flush()
+	controller.FFMpeg.Stop()
+	controller.FFMpeg.Wait()
+	controller.Exports.Remove()
 
 	if err := controller.Database.Sql.Close(); err != nil {
 		log.Println(err)
@@ -585,3 +695,313 @@ func (controller *Controller) Terminate() {
 
 	os.Exit(0)
 }
+
+// TranscodeCalls starts encoding again the kept original audio of the
+// matching calls in the background, with the given profile or else with the
+// profile assigned to each call. It returns the number of matching calls, the
+// progress being logged as the calls are transcoded.
+func (controller *Controller) TranscodeCalls(from time.Time, to time.Time, systems []uint, profile *Profile) (uint, error) {
+	formatError := func(err error) error {
+		return fmt.Errorf("controller.transcodecalls: %w", err)
+	}
+
+	if !controller.FFMpeg.available {
+		return 0, formatError(errors.New("ffmpeg is not available"))
+	}
+
+	controller.jobsMutex.Lock()
+	defer controller.jobsMutex.Unlock()
+
+	if controller.transcoding {
+		return 0, formatError(ErrTranscodeRunning)
+	}
+
+	ids, err := controller.Calls.GetOriginalIds(from, to, systems, controller.Database)
+	if err != nil {
+		return 0, formatError(err)
+	}
+
+	controller.transcoding = true
+
+	go func() {
+		defer func() {
+			controller.jobsMutex.Lock()
+			controller.transcoding = false
+			controller.jobsMutex.Unlock()
+		}()
+
+		controller.transcodeCalls(ids, profile)
+	}()
+
+	return uint(len(ids)), nil
+}
+
+// transcodeCalls transcodes the calls one at a time, so as to leave the ffmpeg
+// workers to the incoming calls. A call which fails to transcode is logged and
+// left with its current audio.
+func (controller *Controller) transcodeCalls(ids []uint, profile *Profile) {
+	const progressInterval = 100
+
+	var count, failed, skipped uint
+
+	logError := func(id uint, err error) {
+		failed++
+		controller.Logs.LogEvent(LogLevelError, fmt.Sprintf("controller.transcodecalls: call %d, %v", id, err))
+	}
+
+	mode := controller.Options.AudioConversion
+	if mode == AUDIO_CONVERSION_DISABLED {
+		mode = AUDIO_CONVERSION_ENABLED
+	}
+
+	controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("call transcoding, %d calls to transcode from their original audio", len(ids)))
+
+	for i, id := range ids {
+		if i > 0 && i%progressInterval == 0 {
+			controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("call transcoding, %d of %d calls done", i, len(ids)))
+		}
+
+		call, err := controller.Calls.GetCall(id, controller.Database)
+		if err != nil {
+			logError(id, err)
+			continue
+		}
+
+		audio, audioName, audioType, err := controller.Calls.GetOriginalAudio(id, controller.Database)
+		if err != nil {
+			logError(id, err)
+			continue
+		}
+
+		call.Audio = audio
+		call.AudioName = audioName
+		call.AudioType = audioType
+
+		if profile == nil {
+			err = controller.FFMpeg.Convert(call, controller.Systems, controller.Tags, controller.Profiles, mode, controller.Options.AudioBitrate)
+		} else {
+			err = controller.FFMpeg.ConvertWithProfile(call, controller.Systems, controller.Tags, profile, mode)
+		}
+		if err == ErrNoVoice {
+			skipped++
+			controller.Logs.LogEvent(LogLevelWarn, fmt.Sprintf("controller.transcodecalls: call %d, %v, audio left as is", id, err))
+			continue
+		} else if err != nil {
+			logError(id, err)
+			continue
+		}
+
+		call.Duration = 0
+		call.Waveform = nil
+
+		if samples, err := controller.FFMpeg.Decode(call.Audio, WAVEFORM_SAMPLE_RATE); err == nil {
+			call.Duration = time.Duration(len(samples)) * time.Second / WAVEFORM_SAMPLE_RATE
+			call.Waveform = NewWaveform(samples)
+		}
+
+		if err = controller.Calls.UpdateAudio(call, controller.Database); err != nil {
+			logError(id, err)
+			continue
+		}
+
+		count++
+	}
+
+	controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("call transcoding, %d of %d calls transcoded from their original audio, %d without voice, %d failed", count, len(ids), skipped, failed))
+}
+
+// MigrateAudio starts moving the audio of the calls to the configured audio
+// store in the background. It returns the number of calls to move, the
+// progress being logged as the calls are moved.
+func (controller *Controller) MigrateAudio() (uint, error) {
+	const progressInterval = 1000
+
+	formatError := func(err error) error {
+		return fmt.Errorf("controller.migrateaudio: %w", err)
+	}
+
+	controller.jobsMutex.Lock()
+	defer controller.jobsMutex.Unlock()
+
+	if controller.migrating {
+		return 0, formatError(ErrAudioMigrateRunning)
+	}
+
+	total, err := controller.Calls.CountMigrateAudio(controller.Database)
+	if err != nil {
+		return 0, formatError(err)
+	}
+
+	controller.migrating = true
+
+	go func() {
+		defer func() {
+			controller.jobsMutex.Lock()
+			controller.migrating = false
+			controller.jobsMutex.Unlock()
+		}()
+
+		store := controller.Database.AudioStore.Type
+
+		controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("audio migration, %d calls to move to the %s audio store", total, store))
+
+		count, err := controller.Calls.MigrateAudio(controller.Database, func(count uint) {
+			if count%progressInterval == 0 {
+				controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("audio migration, %d of %d calls done", count, total))
+			}
+		})
+		if err != nil {
+			controller.Logs.LogEvent(LogLevelError, err.Error())
+		}
+
+		controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("audio migration, %d of %d calls moved to the %s audio store", count, total, store))
+	}()
+
+	return total, nil
+}
+
+// ReindexCalls starts putting all the calls in the full text index again in
+// the background. It returns the number of calls to index, the progress being
+// logged as the calls are indexed.
+func (controller *Controller) ReindexCalls() (uint, error) {
+	const progressInterval = 1000
+
+	var total uint
+
+	formatError := func(err error) error {
+		return fmt.Errorf("controller.reindexcalls: %w", err)
+	}
+
+	controller.jobsMutex.Lock()
+	defer controller.jobsMutex.Unlock()
+
+	if controller.reindexing {
+		return 0, formatError(ErrReindexRunning)
+	}
+
+	if err := controller.Database.NewQuery("select count(*) from `rdioScannerCalls`").QueryRow().Scan(&total); err != nil {
+		return 0, formatError(err)
+	}
+
+	controller.reindexing = true
+
+	go func() {
+		defer func() {
+			controller.jobsMutex.Lock()
+			controller.reindexing = false
+			controller.jobsMutex.Unlock()
+		}()
+
+		controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("call reindexing, %d calls to index for search", total))
+
+		count, err := controller.Calls.Reindex(controller, true, func(count uint) {
+			if count%progressInterval == 0 {
+				controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("call reindexing, %d of %d calls done", count, total))
+			}
+		})
+		if err != nil {
+			controller.Logs.LogEvent(LogLevelError, err.Error())
+		}
+
+		controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("call reindexing, %d of %d calls indexed for search", count, total))
+	}()
+
+	return total, nil
+}
+
+func (controller *Controller) logCall(call *Call, level string, message string) {
+	controller.Logs.LogEvent(level, fmt.Sprintf("newcall: system=%v talkgroup=%v file=%v %v", call.System, call.Talkgroup, call.AudioName, message))
+}
+
+// storeCall converts, writes and emits a call which made it through all the
+// ingest checks.
+func (controller *Controller) storeCall(call *Call, system *System, talkgroup *Talkgroup) {
+	controller.populateMutex.RLock()
+	defer controller.populateMutex.RUnlock()
+
+	// tones are looked for in the audio as received, as the conversion and
+	// the audio filters may well attenuate them
+	audio := call.Audio
+
+	if controller.Options.KeepOriginalAudio {
+		call.OriginalAudio = call.Audio
+		call.OriginalName = call.AudioName
+		call.OriginalType = call.AudioType
+	}
+
+	if err := controller.FFMpeg.Convert(call, controller.Systems, controller.Tags, controller.Profiles, controller.Options.AudioConversion, controller.Options.AudioBitrate); err == ErrNoVoice {
+		controller.logCall(call, LogLevelInfo, "no voice")
+		return
+	} else if err == ErrFFMpegUnavailable {
+		controller.Logs.LogEvent(LogLevelWarn, err.Error())
+	} else if err != nil {
+		if controller.Options.AudioConversionFailure == AUDIO_CONVERSION_FAILURE_REJECT {
+			metricsConversionFailures.WithLabelValues("rejected").Inc()
+			controller.logCall(call, LogLevelError, fmt.Sprintf("rejected, %v", err))
+			return
+		}
+		metricsConversionFailures.WithLabelValues("original").Inc()
+		controller.logCall(call, LogLevelWarn, fmt.Sprintf("original audio stored, %v", err))
+	}
+
+	toneSets := []*ToneSet{}
+
+	if samples, err := controller.FFMpeg.Decode(call.Audio, WAVEFORM_SAMPLE_RATE); err == nil {
+		call.Duration = time.Duration(len(samples)) * time.Second / WAVEFORM_SAMPLE_RATE
+		call.Waveform = NewWaveform(samples)
+	}
+
+	if controller.ToneSets.HasAccess(call) {
+		if samples, err := controller.FFMpeg.Decode(audio, WAVEFORM_SAMPLE_RATE); err == nil {
+			toneSets = controller.ToneSets.Detect(call, samples, WAVEFORM_SAMPLE_RATE)
+		} else {
+			controller.logCall(call, LogLevelWarn, fmt.Sprintf("no tone detection, %v", err))
+		}
+	}
+
+	ids := []uint{}
+	call.tones = []string{}
+	for _, toneSet := range toneSets {
+		if id, ok := toneSet.Id.(uint); ok {
+			ids = append(ids, id)
+		}
+		call.tones = append(call.tones, toneSet.Label)
+	}
+	call.ToneSets = ids
+
+	if id, err := controller.Calls.WriteCall(call, controller.Database); err == nil {
+		call.Id = id
+		call.systemLabel = system.Label
+		call.talkgroupLabel = talkgroup.Label
+		call.talkgroupName = talkgroup.Name
+
+		if group, ok := controller.Groups.GetGroup(talkgroup.GroupId); ok {
+			call.talkgroupGroup = group.Label
+		}
+
+		if tag, ok := controller.Tags.GetTag(talkgroup.TagId); ok {
+			call.talkgroupTag = tag.Label
+		}
+
+		if err := controller.Calls.IndexText(call, system, talkgroup, controller.Database); err != nil {
+			controller.Logs.LogEvent(LogLevelError, fmt.Sprintf("controller.ingestcall: %v", err))
+		}
+
+		controller.logCall(call, LogLevelInfo, "success")
+
+		controller.EmitCall(call)
+
+		if len(toneSets) > 0 {
+			controller.logCall(call, LogLevelInfo, fmt.Sprintf("tones detected: %v", strings.Join(call.tones, ", ")))
+			controller.EmitTones(call, toneSets)
+		}
+
+		go controller.Alerts.Check(call, map[string][]string{
+			AlertFieldTalkgroup: {talkgroup.Label, talkgroup.Name},
+			AlertFieldUnit:      GetCallUnitLabels(call, system),
+		})
+
+	} else {
+		controller.Logs.LogEvent(LogLevelError, fmt.Sprintf("controller.ingestcall: %v", err.Error()))
+	}
+}
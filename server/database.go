@@ -29,12 +29,30 @@ import (
 )
 
 type Database struct {
+	Archive        *Archive
+	AudioStore     *AudioStore
 	Config         *Config
 	DateTimeFormat string
 	Sql            *sql.DB
+	TextIndex      CallsTextIndex
 }
 
 func NewDatabase(config *Config) *Database {
+	database := OpenDatabase(config)
+
+	if err := database.migrate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := database.seed(); err != nil {
+		log.Fatal(err)
+	}
+
+	return database
+}
+
+// OpenDatabase connects to the database without migrating its schema.
+func OpenDatabase(config *Config) *Database {
 	var err error
 
 	database := &Database{Config: config}
@@ -43,7 +61,9 @@ func NewDatabase(config *Config) *Database {
 	case DbTypeSqlite:
 		database.DateTimeFormat = "2006-01-02 15:04:05.000 -07:00"
 
-		dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout%%3d10000", config.GetDbFilePath())
+		// the write ahead log lets the calls be written while a backup reads
+		// the database
+		dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout%%3d10000&_pragma=journal_mode%%3dwal", config.GetDbFilePath())
 
 		if database.Sql, err = sql.Open("sqlite", dsn); err != nil {
 			log.Fatal(err)
@@ -72,18 +92,20 @@ func NewDatabase(config *Config) *Database {
 		log.Fatalf("unknown database type %s\n", config.DbType)
 	}
 
-	database.Sql.SetConnMaxLifetime(time.Minute)
-	database.Sql.SetMaxIdleConns(25)
-	database.Sql.SetMaxOpenConns(25)
-
-	if err = database.migrate(); err != nil {
+	if database.Archive, err = NewArchive(config); err != nil {
 		log.Fatal(err)
 	}
 
-	if err = database.seed(); err != nil {
+	if database.AudioStore, err = NewAudioStore(config); err != nil {
 		log.Fatal(err)
 	}
 
+	database.TextIndex = NewCallsTextIndex(config.DbType)
+
+	database.Sql.SetConnMaxLifetime(time.Minute)
+	database.Sql.SetMaxIdleConns(25)
+	database.Sql.SetMaxOpenConns(25)
+
 	return database
 }
 
@@ -100,94 +122,115 @@ func (db *Database) ParseDateTime(f any) (time.Time, error) {
 	}
 }
 
-func (db *Database) migrate() error {
+func (db *Database) applyMigration(migration *Migration, verbose bool) error {
 	var (
-		err     error
-		verbose bool
+		data  []string
+		err   error
+		query string
+		tx    *sql.Tx
 	)
 
-	verbose, err = db.prepareMigration()
-
-	if err == nil {
-		err = db.migration20191028144433(verbose)
-	}
-	if err == nil {
-		err = db.migration20191029092201(verbose)
-	}
-	if err == nil {
-		err = db.migration20191126135515(verbose)
-	}
-	if err == nil {
-		err = db.migration20191220093214(verbose)
+	formatError := func(err error, query string) error {
+		return fmt.Errorf("%s while doing %s", err.Error(), query)
 	}
-	if err == nil {
-		err = db.migration20200123094105(verbose)
+
+	if verbose {
+		log.Printf("running database migration %s", migration.Name)
 	}
-	if err == nil {
-		err = db.migration20200428132918(verbose)
+
+	if migration.Data != nil {
+		if data, err = migration.Data(); err != nil {
+			return fmt.Errorf("%s while preparing %s", err.Error(), migration.Name)
+		}
 	}
-	if err == nil {
-		err = db.migration20210115105958(verbose)
+
+	if tx, err = db.Sql.Begin(); err != nil {
+		return err
 	}
-	if err == nil {
-		err = db.migration20210830092027(verbose)
+
+	queries := append(append([]string{}, migration.Queries...), data...)
+
+	for _, query = range queries {
+		if _, err = tx.Exec(query); err != nil {
+			tx.Rollback()
+			return formatError(err, query)
+		}
 	}
-	if err == nil {
-		err = db.migration20211202094819(verbose)
+
+	meta := db.NewQuery("insert into `rdioScannerMeta` (`name`, `appliedAt`, `checksum`) values (?, ?, ?)", migration.Name, time.Now().UTC().Format(db.DateTimeFormat), migration.GetChecksum())
+	if _, err = meta.ExecTx(tx); err != nil {
+		tx.Rollback()
+		return formatError(err, meta.String())
 	}
-	if err == nil {
-		err = db.migration20220101070000(verbose)
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	return err
+	return nil
 }
 
-func (db *Database) migrateWithSchema(name string, schemas []string, verbose bool) error {
-	var (
-		count int = 0
-		err   error
-		query string
-		tx    *sql.Tx
-	)
-
-	formatError := func(err error, query string) error {
-		return fmt.Errorf("%s while doing %s", err.Error(), query)
+func (db *Database) getMigrations() []*Migration {
+	return []*Migration{
+		db.migration20191028144433(),
+		db.migration20191029092201(),
+		db.migration20191126135515(),
+		db.migration20191220093214(),
+		db.migration20200123094105(),
+		db.migration20200428132918(),
+		db.migration20210115105958(),
+		db.migration20210830092027(),
+		db.migration20211202094819(),
+		db.migration20220101070000(),
+		db.migration20261018090000(),
+		db.migration20261018100000(),
+		db.migration20261018110000(),
+		db.migration20261018120000(),
+		db.migration20261018130000(),
+		db.migration20261018140000(),
+		db.migration20261018150000(),
+		db.migration20261018160000(),
+		db.migration20261018170000(),
+		db.migration20261018180000(),
+		db.migration20261018190000(),
+		db.migration20261018200000(),
+		db.migration20261018210000(),
+		db.migration20261018220000(),
+		db.migration20261018230000(),
+		db.migration20261019000000(),
 	}
+}
 
-	if db.Config.DbType != DbTypePostgresql {
-		query = fmt.Sprintf("select count(*) from `rdioScannerMeta` where `name` = '%s'", name)
-	} else {
-		query = fmt.Sprintf("select count(*) from rdioScannerMeta where name = '%s'", name)
+func (db *Database) migrate() error {
+	verbose, err := db.prepareMigration()
+	if err != nil {
+		return err
 	}
-	if err = db.Sql.QueryRow(query).Scan(&count); err != nil {
-		return formatError(err, query)
+
+	status, err := db.GetMigrationsStatus()
+	if err != nil {
+		return err
 	}
 
-	if count == 0 {
-		if verbose {
-			log.Printf("running database migration %s", name)
-		}
+	if status.IsNewer() {
+		return fmt.Errorf("database schema version %d is newer than version %d supported by this version of rdio scanner", status.Current, status.Latest)
+	}
 
-		if tx, err = db.Sql.Begin(); err == nil {
-			for _, query = range schemas {
-				if _, err = tx.Exec(query); err != nil {
-					tx.Rollback()
-					return formatError(err, query)
+	for _, entry := range status.List {
+		switch entry.Status {
+		case MIGRATION_STATUS_APPLIED:
+			if len(entry.Checksum) == 0 {
+				if err = db.recordMigration(entry.migration); err != nil {
+					return err
 				}
 			}
 
-			if db.Config.DbType != DbTypePostgresql {
-				query = fmt.Sprintf("insert into `rdioScannerMeta` (`name`) values ('%s')", name)
-			} else {
-				query = fmt.Sprintf("insert into rdioScannerMeta (name) values ('%s')", name)
-			}
-			if _, err = tx.Exec(query); err != nil {
-				tx.Rollback()
-				return formatError(err, query)
-			}
+		case MIGRATION_STATUS_MODIFIED:
+			log.Printf("database migration %s was modified since it was applied", entry.Name)
 
-			if err = tx.Commit(); err != nil {
-				tx.Rollback()
+		case MIGRATION_STATUS_PENDING:
+			if err = db.applyMigration(entry.migration, verbose); err != nil {
 				return err
 			}
 		}
@@ -196,7 +239,7 @@ func (db *Database) migrateWithSchema(name string, schemas []string, verbose boo
 	return nil
 }
 
-func (db *Database) migration20191028144433(verbose bool) error {
+func (db *Database) migration20191028144433() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -214,10 +257,10 @@ func (db *Database) migration20191028144433(verbose bool) error {
 			"create unique index `rdio_scanner_systems_system` on `rdioScannerSystems` (`system`)",
 		}
 	}
-	return db.migrateWithSchema("20191028144433-create-rdio-scanner-system", queries, verbose)
+	return NewMigration("20191028144433-create-rdio-scanner-system", queries)
 }
 
-func (db *Database) migration20191029092201(verbose bool) error {
+func (db *Database) migration20191029092201() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -241,10 +284,10 @@ func (db *Database) migration20191029092201(verbose bool) error {
 			"create index `rdio_scanner_calls_talkgroup` on `rdioScannerCalls` (`talkgroup`)",
 		}
 	}
-	return db.migrateWithSchema("20191029092201-create-rdio-scanner-call", queries, verbose)
+	return NewMigration("20191029092201-create-rdio-scanner-call", queries)
 }
 
-func (db *Database) migration20191126135515(verbose bool) error {
+func (db *Database) migration20191126135515() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -262,10 +305,10 @@ func (db *Database) migration20191126135515(verbose bool) error {
 			"drop index `rdio_scanner_calls_talkgroup` on `rdioScannerCalls`",
 		}
 	}
-	return db.migrateWithSchema("20191126135515-optimize-rdio-scanner-calls", queries, verbose)
+	return NewMigration("20191126135515-optimize-rdio-scanner-calls", queries)
 }
 
-func (db *Database) migration20191220093214(verbose bool) error {
+func (db *Database) migration20191220093214() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -286,10 +329,10 @@ func (db *Database) migration20191220093214(verbose bool) error {
 			"alter table `rdioScannerSystems` add column `aliases` json not null",
 		}
 	}
-	return db.migrateWithSchema("20191220093214-new-v3-tables", queries, verbose)
+	return NewMigration("20191220093214-new-v3-tables", queries)
 }
 
-func (db *Database) migration20200123094105(verbose bool) error {
+func (db *Database) migration20200123094105() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -307,10 +350,10 @@ func (db *Database) migration20200123094105(verbose bool) error {
 			"create index `rdio_scanner_calls_system_talkgroup` on `rdioScannerCalls` (`system`, `talkgroup`)",
 		}
 	}
-	return db.migrateWithSchema("20200123094105-optimize-rdio-scanner-calls", queries, verbose)
+	return NewMigration("20200123094105-optimize-rdio-scanner-calls", queries)
 }
 
-func (db *Database) migration20200428132918(verbose bool) error {
+func (db *Database) migration20200428132918() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -340,10 +383,10 @@ func (db *Database) migration20200428132918(verbose bool) error {
 			"create index `rdio_scanner_calls_date_time_system_talkgroup` on `rdioScannerCalls` (`dateTime`, `system`, `talkgroup`)",
 		}
 	}
-	return db.migrateWithSchema("20200428132918-new-v4-tables", queries, verbose)
+	return NewMigration("20200428132918-new-v4-tables", queries)
 }
 
-func (db *Database) migration20210115105958(verbose bool) error {
+func (db *Database) migration20210115105958() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -403,10 +446,10 @@ func (db *Database) migration20210115105958(verbose bool) error {
 			"create table `rdioScannerTags` (`_id` integer primary key auto_increment, `label` varchar(255) not null)",
 		}
 	}
-	return db.migrateWithSchema("20210115105958-new-v5.1-tables", queries, verbose)
+	return NewMigration("20210115105958-new-v5.1-tables", queries)
 }
 
-func (db *Database) migration20210830092027(verbose bool) error {
+func (db *Database) migration20210830092027() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -434,10 +477,10 @@ func (db *Database) migration20210830092027(verbose bool) error {
 			"create index `rdio_scanner_calls_date_time_system_talkgroup` on `rdioScannerCalls` (`dateTime`, `system`, `talkgroup`)",
 		}
 	}
-	return db.migrateWithSchema("20210830092027-v6.0-rename-index", queries, verbose)
+	return NewMigration("20210830092027-v6.0-rename-index", queries)
 }
 
-func (db *Database) migration20211202094819(verbose bool) error {
+func (db *Database) migration20211202094819() *Migration {
 	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
@@ -461,24 +504,11 @@ func (db *Database) migration20211202094819(verbose bool) error {
 			"drop table `rdioScannerDownstreams2`",
 		}
 	}
-	return db.migrateWithSchema("20211202094819-v6.0.2-alter-table", queries, verbose)
+	return NewMigration("20211202094819-v6.0.2-alter-table", queries)
 }
 
-func (db *Database) migration20220101070000(verbose bool) error {
-	var (
-		err        error
-		frequency  any
-		id         uint
-		label      string
-		led        any
-		name       string
-		queries    []string
-		rows       *sql.Rows
-		stra       string
-		strb       string
-		talkgroups []*Talkgroup
-		units      []*Unit
-	)
+func (db *Database) migration20220101070000() *Migration {
+	var queries []string
 	if db.Config.DbType == DbTypeSqlite {
 		queries = []string{
 			"create table `rdioScannerCalls2` (`id` integer primary key autoincrement, `audio` longblob not null, `audioName` varchar(255), `audioType` varchar(255), `dateTime` datetime not null, `frequencies` text not null, `frequency` integer, `patches` text not null, `source` integer, `sources` text not null, `system` integer not null, `talkgroup` integer not null)",
@@ -516,100 +546,415 @@ func (db *Database) migration20220101070000(verbose bool) error {
 			"create unique index `rdio_scanner_units_system_id_id` on `rdioScannerUnits` (`systemId`, `id`)",
 		}
 	}
-	q := "select `id`, `talkgroups`, `units` from `rdioScannerSystems`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select id, talkgroups, units from rdioScannerSystems"
-	}
-	if rows, err = db.Sql.Query(q); err == nil {
-		for rows.Next() {
-			if err = rows.Scan(&id, &stra, &strb); err != nil {
-				break
-			}
-			if err = json.Unmarshal([]byte(stra), &talkgroups); err != nil {
-				break
-			}
-			if err = json.Unmarshal([]byte(strb), &units); err != nil {
-				break
-			}
-			for i, tg := range talkgroups {
-				switch v := tg.Frequency.(type) {
-				case uint:
-					frequency = v
-				default:
-					frequency = "null"
+	migration := NewMigration("20220101070000-v6.1.0", queries)
+
+	// the talkgroups and units are moved out of the json columns of the
+	// systems, which are read before the schema queries drop them.
+	migration.Data = func() ([]string, error) {
+		var (
+			data       = []string{}
+			err        error
+			frequency  any
+			id         uint
+			label      string
+			led        any
+			name       string
+			rows       *sql.Rows
+			stra       string
+			strb       string
+			talkgroups []*Talkgroup
+			units      []*Unit
+		)
+
+		if rows, err = db.NewQuery("select `id`, `talkgroups`, `units` from `rdioScannerSystems`").Query(); err == nil {
+			for rows.Next() {
+				if err = rows.Scan(&id, &stra, &strb); err != nil {
+					break
 				}
-				label = strings.ReplaceAll(tg.Label, "'", "''")
-				switch v := tg.Led.(type) {
-				case string:
-					led = fmt.Sprintf("'%v'", strings.ReplaceAll(v, "'", "''"))
-				default:
-					led = "null"
+				if err = json.Unmarshal([]byte(stra), &talkgroups); err != nil {
+					break
 				}
-				name = strings.ReplaceAll(tg.Name, "'", "''")
-				tg.Order = uint(i + 1)
-				if db.Config.DbType != DbTypePostgresql {
-					queries = append(queries, fmt.Sprintf("insert into `rdioScannerTalkgroups` (`frequency`, `groupId`, `id`, `label`, `led`, `name`, `order`, `systemId`, `tagId`) values (%v, %v, %v, '%v', %v, '%v', %v, %v, %v)", frequency, tg.GroupId, tg.Id, label, led, name, tg.Order, id, tg.TagId))
-				} else {
-					queries = append(queries, fmt.Sprintf("insert into rdioScannerTalkgroups (frequency, groupId, id, label, led, name, \"order\", systemId, tagId) values (%v, %v, %v, '%v', %v, '%v', %v, %v, %v)", frequency, tg.GroupId, tg.Id, label, led, name, tg.Order, id, tg.TagId))
+				if err = json.Unmarshal([]byte(strb), &units); err != nil {
+					break
 				}
-			}
-			for i, unit := range units {
-				label = strings.ReplaceAll(unit.Label, "'", "''")
-				unit.Order = uint(i + 1)
-				if db.Config.DbType != DbTypePostgresql {
-					queries = append(queries, fmt.Sprintf("insert into `rdioScannerUnits` (`id`, `label`, `order`, `systemId`) values (%v, '%v', %v, %v)", unit.Id, label, unit.Order, id))
-				} else {
-					queries = append(queries, fmt.Sprintf("insert into rdioScannerUnits (id, label, \"order\", systemId) values (%v, '%v', %v, %v)", unit.Id, label, unit.Order, id))
+				for i, tg := range talkgroups {
+					switch v := tg.Frequency.(type) {
+					case uint:
+						frequency = v
+					default:
+						frequency = "null"
+					}
+					label = strings.ReplaceAll(tg.Label, "'", "''")
+					switch v := tg.Led.(type) {
+					case string:
+						led = fmt.Sprintf("'%v'", strings.ReplaceAll(v, "'", "''"))
+					default:
+						led = "null"
+					}
+					name = strings.ReplaceAll(tg.Name, "'", "''")
+					tg.Order = uint(i + 1)
+					if db.Config.DbType != DbTypePostgresql {
+						data = append(data, fmt.Sprintf("insert into `rdioScannerTalkgroups` (`frequency`, `groupId`, `id`, `label`, `led`, `name`, `order`, `systemId`, `tagId`) values (%v, %v, %v, '%v', %v, '%v', %v, %v, %v)", frequency, tg.GroupId, tg.Id, label, led, name, tg.Order, id, tg.TagId))
+					} else {
+						data = append(data, fmt.Sprintf("insert into rdioScannerTalkgroups (frequency, groupId, id, label, led, name, \"order\", systemId, tagId) values (%v, %v, %v, '%v', %v, '%v', %v, %v, %v)", frequency, tg.GroupId, tg.Id, label, led, name, tg.Order, id, tg.TagId))
+					}
 				}
+				for i, unit := range units {
+					label = strings.ReplaceAll(unit.Label, "'", "''")
+					unit.Order = uint(i + 1)
+					if db.Config.DbType != DbTypePostgresql {
+						data = append(data, fmt.Sprintf("insert into `rdioScannerUnits` (`id`, `label`, `order`, `systemId`) values (%v, '%v', %v, %v)", unit.Id, label, unit.Order, id))
+					} else {
+						data = append(data, fmt.Sprintf("insert into rdioScannerUnits (id, label, \"order\", systemId) values (%v, '%v', %v, %v)", unit.Id, label, unit.Order, id))
+					}
+				}
+			}
+			rows.Close()
+			if err != nil {
+				return nil, err
 			}
 		}
-		rows.Close()
-		if err != nil {
-			return err
+
+		return data, nil
+	}
+
+	return migration
+}
+
+func (db *Database) migration20261018090000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypeSqlite {
+		queries = []string{
+			"create table `rdioScannerBucketWatches` (`_id` integer primary key autoincrement, `accessKey` varchar(255) not null, `afterIngest` varchar(255), `bucket` varchar(255) not null, `disabled` tinyint(1) default 0, `endpoint` varchar(255) not null, `extension` varchar(255), `frequency` integer, `interval` integer, `mask` varchar(255), `order` integer, `prefix` varchar(255), `region` varchar(255), `secretKey` varchar(255) not null, `systemId` integer, `talkgroupId` integer, `type` varchar(255))",
+			"create table `rdioScannerBucketWatchObjects` (`_id` integer primary key autoincrement, `bucketWatchId` integer not null, `dateTime` datetime not null, `etag` varchar(255) not null, `objectKey` varchar(512) not null)",
+			"create unique index `rdio_scanner_bucket_watch_objects_bucket_watch_id_object_key` on `rdioScannerBucketWatchObjects` (`bucketWatchId`, `objectKey`)",
+		}
+	} else if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"create table rdioScannerBucketWatches (_id serial primary key, accessKey varchar(255) not null, afterIngest varchar(255), bucket varchar(255) not null, disabled boolean default false, endpoint varchar(255) not null, extension varchar(255), frequency integer, \"interval\" integer, mask varchar(255), \"order\" integer, prefix varchar(255), region varchar(255), secretKey varchar(255) not null, systemId integer, talkgroupId integer, type varchar(255))",
+			"create table rdioScannerBucketWatchObjects (_id serial primary key, bucketWatchId integer not null, dateTime timestamp not null, etag varchar(255) not null, objectKey varchar(512) not null)",
+			"create unique index rdio_scanner_bucket_watch_objects_bucket_watch_id_object_key on rdioScannerBucketWatchObjects (bucketWatchId, objectKey)",
+		}
+	} else {
+		queries = []string{
+			"create table `rdioScannerBucketWatches` (`_id` integer primary key auto_increment, `accessKey` varchar(255) not null, `afterIngest` varchar(255), `bucket` varchar(255) not null, `disabled` tinyint(1) default 0, `endpoint` varchar(255) not null, `extension` varchar(255), `frequency` integer, `interval` integer, `mask` varchar(255), `order` integer, `prefix` varchar(255), `region` varchar(255), `secretKey` varchar(255) not null, `systemId` integer, `talkgroupId` integer, `type` varchar(255))",
+			"create table `rdioScannerBucketWatchObjects` (`_id` integer primary key auto_increment, `bucketWatchId` integer not null, `dateTime` datetime not null, `etag` varchar(255) not null, `objectKey` varchar(512) not null)",
+			"create unique index `rdio_scanner_bucket_watch_objects_bucket_watch_id_object_key` on `rdioScannerBucketWatchObjects` (`bucketWatchId`, `objectKey`)",
+		}
+	}
+	return NewMigration("20261018090000-bucket-watches", queries)
+}
+
+func (db *Database) migration20261018100000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"alter table rdioScannerApiKeys add column timeZone varchar(255)",
+			"alter table rdioScannerBucketWatches add column timeZone varchar(255)",
+			"alter table rdioScannerDirWatches add column timeZone varchar(255)",
+		}
+	} else {
+		queries = []string{
+			"alter table `rdioScannerApiKeys` add column `timeZone` varchar(255)",
+			"alter table `rdioScannerBucketWatches` add column `timeZone` varchar(255)",
+			"alter table `rdioScannerDirWatches` add column `timeZone` varchar(255)",
+		}
+	}
+	return NewMigration("20261018100000-time-zones", queries)
+}
+
+func (db *Database) migration20261018110000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypeSqlite {
+		queries = []string{
+			"create table `rdioScannerProfiles` (`_id` integer primary key autoincrement, `bitrate` integer, `channels` integer, `codec` varchar(255) not null, `container` varchar(255), `filters` text, `label` varchar(255) not null, `order` integer, `sampleRate` integer)",
+			"alter table `rdioScannerSystems` add column `profileId` integer",
+			"alter table `rdioScannerTalkgroups` add column `profileId` integer",
+		}
+	} else if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"create table rdioScannerProfiles (_id serial primary key, bitrate integer, channels integer, codec varchar(255) not null, container varchar(255), filters text, label varchar(255) not null, \"order\" integer, sampleRate integer)",
+			"alter table rdioScannerSystems add column profileId integer",
+			"alter table rdioScannerTalkgroups add column profileId integer",
+		}
+	} else {
+		queries = []string{
+			"create table `rdioScannerProfiles` (`_id` integer primary key auto_increment, `bitrate` integer, `channels` integer, `codec` varchar(255) not null, `container` varchar(255), `filters` text, `label` varchar(255) not null, `order` integer, `sampleRate` integer)",
+			"alter table `rdioScannerSystems` add column `profileId` integer",
+			"alter table `rdioScannerTalkgroups` add column `profileId` integer",
+		}
+	}
+	return NewMigration("20261018110000-profiles", queries)
+}
+
+func (db *Database) migration20261018120000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypeSqlite {
+		queries = []string{
+			"alter table `rdioScannerCalls` add column `originalAudio` longblob",
+			"alter table `rdioScannerCalls` add column `originalAudioName` varchar(255)",
+			"alter table `rdioScannerCalls` add column `originalAudioType` varchar(255)",
+		}
+	} else if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"alter table rdioScannerCalls add column originalAudio bytea",
+			"alter table rdioScannerCalls add column originalAudioName varchar(255)",
+			"alter table rdioScannerCalls add column originalAudioType varchar(255)",
+		}
+	} else {
+		queries = []string{
+			"alter table `rdioScannerCalls` add column `originalAudio` longblob",
+			"alter table `rdioScannerCalls` add column `originalAudioName` varchar(255)",
+			"alter table `rdioScannerCalls` add column `originalAudioType` varchar(255)",
+		}
+	}
+	return NewMigration("20261018120000-original-audio", queries)
+}
+
+func (db *Database) migration20261018130000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"alter table rdioScannerSystems add column minVoiceDuration integer",
+			"alter table rdioScannerSystems add column trimSilence boolean default false",
+		}
+	} else {
+		queries = []string{
+			"alter table `rdioScannerSystems` add column `minVoiceDuration` integer",
+			"alter table `rdioScannerSystems` add column `trimSilence` tinyint(1) default 0",
+		}
+	}
+	return NewMigration("20261018130000-silence-trim", queries)
+}
+
+func (db *Database) migration20261018140000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{"alter table rdioScannerCalls add column fingerprint bytea"}
+	} else {
+		queries = []string{"alter table `rdioScannerCalls` add column `fingerprint` blob"}
+	}
+	return NewMigration("20261018140000-fingerprint", queries)
+}
+
+func (db *Database) migration20261018150000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{"alter table rdioScannerCalls add column waveform bytea"}
+	} else {
+		queries = []string{"alter table `rdioScannerCalls` add column `waveform` blob"}
+	}
+	return NewMigration("20261018150000-waveform", queries)
+}
+
+func (db *Database) migration20261018160000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypeSqlite {
+		queries = []string{
+			"create table `rdioScannerToneSets` (`_id` integer primary key autoincrement, `aDuration` integer not null, `aTone` float not null, `bDuration` integer, `bTone` float, `label` varchar(255) not null, `order` integer, `systems` text not null, `tolerance` float)",
+			"alter table `rdioScannerCalls` add column `toneSets` text",
+		}
+	} else if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"create table rdioScannerToneSets (_id serial primary key, aDuration integer not null, aTone float not null, bDuration integer, bTone float, label varchar(255) not null, \"order\" integer, systems text not null, tolerance float)",
+			"alter table rdioScannerCalls add column toneSets text",
+		}
+	} else {
+		queries = []string{
+			"create table `rdioScannerToneSets` (`_id` integer primary key auto_increment, `aDuration` integer not null, `aTone` float not null, `bDuration` integer, `bTone` float, `label` varchar(255) not null, `order` integer, `systems` text not null, `tolerance` float)",
+			"alter table `rdioScannerCalls` add column `toneSets` text",
+		}
+	}
+	return NewMigration("20261018160000-tone-sets", queries)
+}
+
+func (db *Database) migration20261018170000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{"alter table rdioScannerCalls add column transcript text"}
+	} else {
+		queries = []string{"alter table `rdioScannerCalls` add column `transcript` text"}
+	}
+	return NewMigration("20261018170000-transcript", queries)
+}
+
+func (db *Database) migration20261018180000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypeSqlite {
+		queries = []string{
+			"create table `rdioScannerAlertRules` (`_id` integer primary key autoincrement, `disabled` boolean not null default false, `groups` text not null, `label` varchar(255) not null, `matchTalkgroup` boolean not null default false, `matchTranscript` boolean not null default false, `matchUnits` boolean not null default false, `order` integer, `pattern` text not null, `regex` boolean not null default false, `systems` text not null, `tags` text not null, `webhook` text)",
+			"create table `rdioScannerAlerts` (`_id` integer primary key autoincrement, `alertRuleId` integer, `callId` integer not null, `dateTime` datetime not null, `field` varchar(16) not null, `label` varchar(255) not null, `matched` text not null, `system` integer not null, `talkgroup` integer not null)",
+			"create index `rdioScannerAlerts_idx` on `rdioScannerAlerts` (`alertRuleId`,`dateTime`)",
+		}
+	} else if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"create table rdioScannerAlertRules (_id serial primary key, disabled boolean not null default false, groups text not null, label varchar(255) not null, matchTalkgroup boolean not null default false, matchTranscript boolean not null default false, matchUnits boolean not null default false, \"order\" integer, pattern text not null, regex boolean not null default false, systems text not null, tags text not null, webhook text)",
+			"create table rdioScannerAlerts (_id serial primary key, alertRuleId integer, callId integer not null, dateTime timestamp not null, field varchar(16) not null, label varchar(255) not null, matched text not null, system integer not null, talkgroup integer not null)",
+			"create index rdioScannerAlerts_idx on rdioScannerAlerts (alertRuleId, dateTime)",
+		}
+	} else {
+		queries = []string{
+			"create table `rdioScannerAlertRules` (`_id` integer primary key auto_increment, `disabled` boolean not null default false, `groups` text not null, `label` varchar(255) not null, `matchTalkgroup` boolean not null default false, `matchTranscript` boolean not null default false, `matchUnits` boolean not null default false, `order` integer, `pattern` text not null, `regex` boolean not null default false, `systems` text not null, `tags` text not null, `webhook` text)",
+			"create table `rdioScannerAlerts` (`_id` integer primary key auto_increment, `alertRuleId` integer, `callId` integer not null, `dateTime` datetime not null, `field` varchar(16) not null, `label` varchar(255) not null, `matched` text not null, `system` integer not null, `talkgroup` integer not null)",
+			"create index `rdioScannerAlerts_idx` on `rdioScannerAlerts` (`alertRuleId`,`dateTime`)",
+		}
+	}
+	return NewMigration("20261018180000-alerts", queries)
+}
+
+func (db *Database) migration20261018190000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"alter table rdioScannerSystems add column audioFilters text",
+			"alter table rdioScannerTalkgroups add column audioFilters text",
+		}
+	} else {
+		queries = []string{
+			"alter table `rdioScannerSystems` add column `audioFilters` text",
+			"alter table `rdioScannerTalkgroups` add column `audioFilters` text",
+		}
+	}
+	return NewMigration("20261018190000-audio-filters", queries)
+}
+
+func (db *Database) migration20261018200000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"alter table rdioScannerCalls add column audioRef varchar(255)",
+			"alter table rdioScannerCalls add column originalAudioRef varchar(255)",
+			"create index rdio_scanner_calls_audio_ref on rdioScannerCalls (audioRef)",
+			"create index rdio_scanner_calls_original_audio_ref on rdioScannerCalls (originalAudioRef)",
+		}
+	} else {
+		queries = []string{
+			"alter table `rdioScannerCalls` add column `audioRef` varchar(255)",
+			"alter table `rdioScannerCalls` add column `originalAudioRef` varchar(255)",
+			"create index `rdio_scanner_calls_audio_ref` on `rdioScannerCalls` (`audioRef`)",
+			"create index `rdio_scanner_calls_original_audio_ref` on `rdioScannerCalls` (`originalAudioRef`)",
+		}
+	}
+	return NewMigration("20261018200000-audio-store", queries)
+}
+
+func (db *Database) migration20261018210000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypeSqlite {
+		queries = []string{
+			"create virtual table `rdioScannerCallsText` using fts5(`callId` unindexed, `body`, tokenize = 'unicode61 remove_diacritics 2')",
+		}
+	} else if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"create table rdioScannerCallsText (callId integer not null primary key, body text not null, vector tsvector generated always as (to_tsvector('simple', body)) stored)",
+			"create index rdio_scanner_calls_text_vector on rdioScannerCallsText using gin (vector)",
+		}
+	} else {
+		queries = []string{
+			"create table `rdioScannerCallsText` (`callId` integer not null primary key, `body` text not null, fulltext index `rdio_scanner_calls_text_body` (`body`))",
+		}
+	}
+	return NewMigration("20261018210000-calls-text", queries)
+}
+
+func (db *Database) migration20261018220000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"alter table rdioScannerCalls add column duration integer",
+			"create index rdio_scanner_calls_frequency on rdioScannerCalls (frequency)",
+		}
+	} else {
+		queries = []string{
+			"alter table `rdioScannerCalls` add column `duration` integer",
+			"create index `rdio_scanner_calls_frequency` on `rdioScannerCalls` (`frequency`)",
+		}
+	}
+	return NewMigration("20261018220000-call-search-filters", queries)
+}
+
+func (db *Database) migration20261018230000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypeSqlite {
+		queries = []string{
+			"create table `rdioScannerRetentionRules` (`_id` integer primary key autoincrement, `days` integer not null default 0, `disabled` boolean not null default false, `groupId` integer, `keepForever` boolean not null default false, `label` varchar(255) not null, `order` integer, `systemId` integer, `tagId` integer, `talkgroupId` integer)",
+		}
+	} else if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"create table rdioScannerRetentionRules (_id serial primary key, days integer not null default 0, disabled boolean not null default false, groupId integer, keepForever boolean not null default false, label varchar(255) not null, \"order\" integer, systemId integer, tagId integer, talkgroupId integer)",
+		}
+	} else {
+		queries = []string{
+			"create table `rdioScannerRetentionRules` (`_id` integer primary key auto_increment, `days` integer not null default 0, `disabled` boolean not null default false, `groupId` integer, `keepForever` boolean not null default false, `label` varchar(255) not null, `order` integer, `systemId` integer, `tagId` integer, `talkgroupId` integer)",
 		}
 	}
-	return db.migrateWithSchema("20220101070000-v6.1.0", queries, verbose)
+	return NewMigration("20261018230000-retention-rules", queries)
+}
+
+func (db *Database) migration20261019000000() *Migration {
+	var queries []string
+	if db.Config.DbType == DbTypePostgresql {
+		queries = []string{
+			"alter table rdioScannerCalls add column restoredAt timestamp",
+		}
+	} else {
+		queries = []string{
+			"alter table `rdioScannerCalls` add column `restoredAt` datetime",
+		}
+	}
+	return NewMigration("20261019000000-call-restored-at", queries)
 }
 
 func (db *Database) prepareMigration() (bool, error) {
 	var (
 		err     error
 		verbose bool = true
-		query   string
 	)
 
-	if db.Config.DbType != DbTypePostgresql {
-		query = "select count(*) as count from `rdioScannerMeta`"
-		if _, err = db.Sql.Exec(query); err != nil {
-			query = "select count(*) as count from `SequelizeMeta`"
-			if _, err = db.Sql.Exec(query); err == nil {
-				log.Println("Preparing for database migration")
-				query = "alter table `SequelizeMeta` rename to `rdioScannerMeta`"
-				_, err = db.Sql.Exec(query)
-			} else {
-				verbose = false
-				query = "create table `rdioScannerMeta` (name varchar(255) not null unique primary key)"
-				_, err = db.Sql.Exec(query)
-			}
+	// only the column types differ between the databases
+	dateTimeType := "datetime"
+	if db.Config.DbType == DbTypePostgresql {
+		dateTimeType = "timestamp"
+	}
+
+	if _, err = db.NewQuery("select count(*) as count from `rdioScannerMeta`").Exec(); err != nil {
+		if _, err = db.NewQuery("select count(*) as count from `SequelizeMeta`").Exec(); err == nil {
+			log.Println("Preparing for database migration")
+			_, err = db.NewQuery("alter table `SequelizeMeta` rename to `rdioScannerMeta`").Exec()
+		} else {
+			verbose = false
+			_, err = db.NewQuery("create table `rdioScannerMeta` (`name` varchar(255) not null unique primary key, `appliedAt` " + dateTimeType + ", `checksum` varchar(64))").Exec()
 		}
-	} else {
-		query = "select count(*) as count from rdioScannerMeta"
-		if _, err = db.Sql.Exec(query); err != nil {
-			query = "select count(*) as count from SequelizeMeta"
-			if _, err = db.Sql.Exec(query); err == nil {
-				log.Println("Preparing for database migration")
-				query = "alter table SequelizeMeta rename to rdioScannerMeta"
-				_, err = db.Sql.Exec(query)
-			} else {
-				verbose = false
-				query = "create table rdioScannerMeta (name varchar(255) not null unique primary key)"
-				_, err = db.Sql.Exec(query)
+	}
+
+	// the meta table of older versions lacks the checksums of the migrations
+	if err == nil {
+		if _, err = db.NewQuery("select `checksum` from `rdioScannerMeta` limit 1").Exec(); err != nil {
+			for _, query := range []*Query{
+				db.NewQuery("alter table `rdioScannerMeta` add column `appliedAt` " + dateTimeType),
+				db.NewQuery("alter table `rdioScannerMeta` add column `checksum` varchar(64)"),
+			} {
+				if _, err = query.Exec(); err != nil {
+					break
+				}
 			}
 		}
 	}
+
 	return verbose, err
 }
 
+// recordMigration stores the checksum of a migration applied by a version
+// which did not record them.
+func (db *Database) recordMigration(migration *Migration) error {
+	query := db.NewQuery("update `rdioScannerMeta` set `checksum` = ? where `name` = ?", migration.GetChecksum(), migration.Name)
+	if _, err := query.Exec(); err != nil {
+		return fmt.Errorf("%s while doing %s", err.Error(), query)
+	}
+
+	return nil
+}
+
 func (db *Database) seed() error {
 	if err := db.seedGroups(); err != nil {
 		return err
@@ -629,26 +974,14 @@ func (db *Database) seedGroups() error {
 		return fmt.Errorf("database.seedgroups: %s", err.Error())
 	}
 
-	if db.Config.DbType != DbTypePostgresql {
-		if err := db.Sql.QueryRow("select count(*) from `rdioScannerGroups`").Scan(&count); err != nil {
-			return formatError(err)
-		}
-	} else {
-		if err := db.Sql.QueryRow("select count(*) from rdioScannerGroups").Scan(&count); err != nil {
-			return formatError(err)
-		}
+	if err := db.NewQuery("select count(*) from `rdioScannerGroups`").QueryRow().Scan(&count); err != nil {
+		return formatError(err)
 	}
 
 	if count == 0 {
 		if tx, err := db.Sql.Begin(); err == nil {
 			for _, group := range defaults.groups {
-				query := ""
-				if db.Config.DbType != DbTypePostgresql {
-					query = "insert into `rdioScannerGroups` (`label`) values (?)"
-				} else {
-					query = "insert into rdioScannerGroups (label) values ($1)"
-				}
-				if _, err := tx.Exec(query, group); err != nil {
+				if _, err := db.NewQuery("insert into `rdioScannerGroups` (`label`) values (?)", group).ExecTx(tx); err != nil {
 					tx.Rollback()
 					return formatError(err)
 				}
@@ -673,26 +1006,14 @@ func (db *Database) seedTags() error {
 		return fmt.Errorf("database.seedtags: %s", err.Error())
 	}
 
-	if db.Config.DbType != DbTypePostgresql {
-		if err := db.Sql.QueryRow("select count(*) from `rdioScannerTags`").Scan(&count); err != nil {
-			return formatError(err)
-		}
-	} else {
-		if err := db.Sql.QueryRow("select count(*) from rdioScannerTags").Scan(&count); err != nil {
-			return formatError(err)
-		}
+	if err := db.NewQuery("select count(*) from `rdioScannerTags`").QueryRow().Scan(&count); err != nil {
+		return formatError(err)
 	}
 
 	if count == 0 {
 		if tx, err := db.Sql.Begin(); err == nil {
 			for _, group := range defaults.tags {
-				query := ""
-				if db.Config.DbType != DbTypePostgresql {
-					query = "insert into `rdioScannerTags` (`label`) values (?)"
-				} else {
-					query = "insert into rdioScannerTags (label) values ($1)"
-				}
-				if _, err := tx.Exec(query, group); err != nil {
+				if _, err := db.NewQuery("insert into `rdioScannerTags` (`label`) values (?)", group).ExecTx(tx); err != nil {
 					tx.Rollback()
 					return formatError(err)
 				}
@@ -0,0 +1,250 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// databaseCopyMarker is the table which the target holds while a copy is in
+// progress. Only then are the rows found in the target known to come from an
+// interrupted copy, the copy having started on an empty target.
+const databaseCopyMarker = "rdioScannerCopyInProgress"
+
+// DatabaseCopy is the outcome of the copy of a table. The rows already in the
+// target from an interrupted copy are not copied again.
+type DatabaseCopy struct {
+	Copied uint
+	Source uint
+	Table  *DatabaseTable
+	Target uint
+}
+
+func (tableCopy *DatabaseCopy) IsValid() bool {
+	return tableCopy.Source == tableCopy.Target
+}
+
+// ParseDatabaseUrl returns the configuration of the database of an url, one of
+// sqlite://<file>, mysql://, mariadb:// or postgresql://<user>:<password>@<host>:<port>/<name>.
+// A relative sqlite file is within the base folder.
+func ParseDatabaseUrl(base *Config, s string) (*Config, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{BaseDir: base.BaseDir, DBSSLMode: SSLModeDisable}
+
+	switch strings.ToLower(u.Scheme) {
+	case "sqlite", "sqlite3":
+		config.DbType = DbTypeSqlite
+		config.DbFile = u.Host + u.Path
+		if len(config.DbFile) == 0 {
+			return nil, errors.New("no sqlite database file")
+		}
+		return config, nil
+
+	case "mariadb":
+		config.DbType = DbTypeMariadb
+		config.DbPort = 3306
+
+	case "mysql":
+		config.DbType = DbTypeMysql
+		config.DbPort = 3306
+
+	case "postgres", "postgresql":
+		config.DbType = DbTypePostgresql
+		config.DbPort = 5432
+
+	default:
+		return nil, fmt.Errorf("unknown database type %s", u.Scheme)
+	}
+
+	config.DbHost = u.Hostname()
+	config.DbName = strings.TrimPrefix(u.Path, "/")
+
+	if len(config.DbHost) == 0 || len(config.DbName) == 0 {
+		return nil, errors.New("no database host or name")
+	}
+
+	if p := u.Port(); len(p) > 0 {
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %s", p)
+		}
+		config.DbPort = uint(port)
+	}
+
+	if u.User != nil {
+		config.DbUsername = u.User.Username()
+		config.DbPassword, _ = u.User.Password()
+	}
+
+	if v := u.Query().Get("sslmode"); len(v) > 0 {
+		config.DBSSLMode = sslMode(v)
+	}
+
+	return config, nil
+}
+
+// CopyTo copies the rows of all the tables to another database, which must be
+// migrated to the same schema and empty. The rows are read from a snapshot of
+// the source and written in batches which commit on their own, so that an
+// interrupted copy resumes after the last row of each table found in the
+// target. The full text index is left out, the server rebuilds it when it
+// starts.
+func (db *Database) CopyTo(target *Database, progress func(tableCopy *DatabaseCopy, done bool)) ([]*DatabaseCopy, error) {
+	var (
+		copies = []*DatabaseCopy{}
+		err    error
+		tx     *sql.Tx
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("database.copyto: %v", err)
+	}
+
+	for _, d := range []*Database{db, target} {
+		status, err := d.GetMigrationsStatus()
+		if err != nil {
+			return nil, formatError(err)
+		} else if !status.IsValid() {
+			return nil, formatError(fmt.Errorf("the %s database schema does not match this version", d.Config.DbType))
+		}
+	}
+
+	if resuming, err := target.hasCopyMarker(); err != nil {
+		return nil, formatError(err)
+
+	} else if !resuming {
+		for _, table := range GetDatabaseTables(true, true) {
+			var count uint
+
+			if err = target.NewQuery(fmt.Sprintf("select count(*) from `%s`", table.Name)).QueryRow().Scan(&count); err != nil {
+				return nil, formatError(err)
+			} else if count > 0 {
+				return nil, formatError(fmt.Errorf("the %s table of the target database is not empty", table.Name))
+			}
+		}
+
+		if _, err = target.NewQuery(fmt.Sprintf("create table `%s` (`startedAt` varchar(255) not null)", databaseCopyMarker)).Exec(); err != nil {
+			return nil, formatError(err)
+		}
+	}
+
+	if tx, err = db.beginSnapshot(); err != nil {
+		return nil, formatError(err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range GetDatabaseTables(true, true) {
+		var lastKey sql.NullInt64
+
+		tableCopy := &DatabaseCopy{Table: table}
+		copies = append(copies, tableCopy)
+
+		key := table.Columns[0].Name
+
+		if err = db.NewQuery(fmt.Sprintf("select count(*) from `%s`", table.Name)).QueryRowTx(tx).Scan(&tableCopy.Source); err != nil {
+			return nil, formatError(err)
+		}
+
+		if err = target.NewQuery(fmt.Sprintf("select max(`%s`) from `%s`", key, table.Name)).QueryRow().Scan(&lastKey); err != nil {
+			return nil, formatError(err)
+		}
+
+		var where *Query
+		if lastKey.Valid {
+			where = db.NewQuery(fmt.Sprintf("`%s` > ?", key), lastKey.Int64)
+		}
+
+		writer := target.NewTableWriter(nil, table, table.GetColumnNames())
+
+		flushed := uint(0)
+		err = db.ReadTable(tx, table, where, func(values []any) error {
+			if err := writer.Add(values); err != nil {
+				return err
+			}
+			if writer.Count > flushed && progress != nil {
+				flushed = writer.Count
+				tableCopy.Copied = writer.Count
+				progress(tableCopy, false)
+			}
+			return nil
+		})
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err == nil {
+			err = target.ResetSequence(nil, table)
+		}
+		if err != nil {
+			return nil, formatError(err)
+		}
+
+		tableCopy.Copied = writer.Count
+
+		if err = target.NewQuery(fmt.Sprintf("select count(*) from `%s`", table.Name)).QueryRow().Scan(&tableCopy.Target); err != nil {
+			return nil, formatError(err)
+		}
+
+		if progress != nil {
+			progress(tableCopy, true)
+		}
+	}
+
+	// a copy which doesn't match the source can still be resumed
+	for _, tableCopy := range copies {
+		if !tableCopy.IsValid() {
+			return copies, nil
+		}
+	}
+
+	if _, err = target.NewQuery(fmt.Sprintf("drop table `%s`", databaseCopyMarker)).Exec(); err != nil {
+		return nil, formatError(err)
+	}
+
+	return copies, nil
+}
+
+// hasCopyMarker tells whether the database holds the marker of a copy in
+// progress.
+func (db *Database) hasCopyMarker() (bool, error) {
+	var (
+		count uint
+		query *Query
+	)
+
+	switch db.Config.DbType {
+	case DbTypeSqlite:
+		query = db.NewQuery("select count(*) from sqlite_master where type = 'table' and name = ?", databaseCopyMarker)
+	case DbTypePostgresql:
+		query = db.NewQuery("select count(*) from information_schema.tables where table_schema = current_schema() and table_name = ?", databaseCopyMarker)
+	default:
+		query = db.NewQuery("select count(*) from information_schema.tables where table_schema = database() and table_name = ?", databaseCopyMarker)
+	}
+
+	if err := query.QueryRow().Scan(&count); err != nil {
+		return false, fmt.Errorf("database.hascopymarker: %v", err)
+	}
+
+	return count > 0, nil
+}
@@ -15,11 +15,14 @@
 
 package main
 
+import "runtime"
+
 type Defaults struct {
 	adminPassword           string
 	adminPasswordNeedChange bool
 	access                  DefaultAccess
 	apikey                  DefaultApikey
+	bucketwatch             DefaultBucketwatch
 	dirwatch                DefaultDirwatch
 	downstream              DefaultDownstream
 	groups                  []string
@@ -39,6 +42,11 @@ type DefaultApikey struct {
 	systems string
 }
 
+type DefaultBucketwatch struct {
+	afterIngest string
+	interval    uint
+}
+
 type DefaultDirwatch struct {
 	deleteAfter bool
 	disabled    bool
@@ -50,22 +58,40 @@ type DefaultDownstream struct {
 }
 
 type DefaultOptions struct {
-	autoPopulate                bool
-	audioConversion             uint
-	audioBitrate                uint
-	dimmerDelay                 uint
-	disableDuplicateDetection   bool
-	duplicateDetectionTimeFrame uint
-	keypadBeeps                 string
-	maxClients                  uint
-	playbackGoesLive            bool
-	pruneCallDays               uint
-	pruneLogDays                uint
-	searchPatchedTalkgroups     bool
-	showListenersCount          bool
-	sortTalkgroups              bool
-	tagsToggle                  bool
-	time12hFormat               bool
+	autoPopulate                     bool
+	audioConversion                  uint
+	audioBitrate                     uint
+	audioConversionFailure           uint
+	backupCalls                      bool
+	backupInterval                   uint
+	backupKeep                       uint
+	backupLogs                       bool
+	bestCopyWindow                   uint
+	dimmerDelay                      uint
+	disableDuplicateDetection        bool
+	duplicateDetectionMatchFrequency bool
+	duplicateDetectionMatchSource    bool
+	duplicateDetectionMode           uint
+	duplicateDetectionTimeFrame      uint
+	ffmpegTimeout                    uint
+	ffmpegWorkers                    uint
+	keepOriginalAudio                bool
+	keypadBeeps                      string
+	maxClients                       uint
+	playbackGoesLive                 bool
+	pruneCallDays                    uint
+	pruneLogDays                     uint
+	searchPatchedTalkgroups          bool
+	showListenersCount               bool
+	sortTalkgroups                   bool
+	tagsToggle                       bool
+	time12hFormat                    bool
+	timeZone                         string
+	transcriptionApiKey              string
+	transcriptionBackend             string
+	transcriptionLanguage            string
+	transcriptionModel               string
+	transcriptionUrl                 string
 }
 
 var defaults Defaults = Defaults{
@@ -79,6 +105,10 @@ var defaults Defaults = Defaults{
 		ident:   "Unknown",
 		systems: "*",
 	},
+	bucketwatch: DefaultBucketwatch{
+		afterIngest: BucketwatchAfterIngestDelete,
+		interval:    60,
+	},
 	dirwatch: DefaultDirwatch{
 		deleteAfter: true,
 		disabled:    false,
@@ -97,22 +127,40 @@ var defaults Defaults = Defaults{
 	},
 	keypadBeeps: "uniden",
 	options: DefaultOptions{
-		audioConversion:             AUDIO_CONVERSION_ENABLED,
-		audioBitrate:                24,
-		autoPopulate:                true,
-		dimmerDelay:                 5000,
-		disableDuplicateDetection:   false,
-		duplicateDetectionTimeFrame: 500,
-		keypadBeeps:                 "uniden",
-		maxClients:                  200,
-		playbackGoesLive:            false,
-		pruneCallDays:               7,
-		pruneLogDays:                7,
-		searchPatchedTalkgroups:     false,
-		showListenersCount:          false,
-		sortTalkgroups:              false,
-		tagsToggle:                  false,
-		time12hFormat:               false,
+		audioConversion:                  AUDIO_CONVERSION_ENABLED,
+		audioBitrate:                     24,
+		audioConversionFailure:           AUDIO_CONVERSION_FAILURE_KEEP_ORIGINAL,
+		autoPopulate:                     true,
+		backupCalls:                      false,
+		backupInterval:                   0,
+		backupKeep:                       7,
+		backupLogs:                       false,
+		bestCopyWindow:                   0,
+		dimmerDelay:                      5000,
+		disableDuplicateDetection:        false,
+		duplicateDetectionMatchFrequency: false,
+		duplicateDetectionMatchSource:    false,
+		duplicateDetectionMode:           DUPLICATE_DETECTION_MODE_TIME,
+		duplicateDetectionTimeFrame:      500,
+		ffmpegTimeout:                    60,
+		ffmpegWorkers:                    uint(runtime.NumCPU()),
+		keepOriginalAudio:                false,
+		keypadBeeps:                      "uniden",
+		maxClients:                       200,
+		playbackGoesLive:                 false,
+		pruneCallDays:                    7,
+		pruneLogDays:                     7,
+		searchPatchedTalkgroups:          false,
+		showListenersCount:               false,
+		sortTalkgroups:                   false,
+		tagsToggle:                       false,
+		time12hFormat:                    false,
+		timeZone:                         "",
+		transcriptionApiKey:              "",
+		transcriptionBackend:             "",
+		transcriptionLanguage:            "",
+		transcriptionModel:               "whisper-1",
+		transcriptionUrl:                 "",
 	},
 	systems: []System{},
 	tags: []string{
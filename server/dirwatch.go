@@ -17,7 +17,6 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -55,10 +54,12 @@ type Dirwatch struct {
 	Order       any    `json:"order"`
 	SystemId    any    `json:"systemId"`
 	TalkgroupId any    `json:"talkgroupId"`
+	TimeZone    any    `json:"timeZone"`
 	Kind        any    `json:"type"`
 	UsePolling  bool   `json:"usePolling"`
 	controller  *Controller
 	dirs        map[string]bool
+	location    *time.Location
 	mutex       sync.Mutex
 	timers      map[string]*time.Timer
 	watcher     *fsnotify.Watcher
@@ -128,6 +129,13 @@ func (dirwatch *Dirwatch) FromMap(m map[string]any) *Dirwatch {
 		dirwatch.TalkgroupId = uint(v)
 	}
 
+	switch v := m["timeZone"].(type) {
+	case string:
+		dirwatch.TimeZone = v
+	}
+
+	dirwatch.location, _ = loadLocation(dirwatch.TimeZone)
+
 	switch v := m["type"].(type) {
 	case string:
 		dirwatch.Kind = v
@@ -141,102 +149,119 @@ func (dirwatch *Dirwatch) FromMap(m map[string]any) *Dirwatch {
 	return dirwatch
 }
 
+// GetLocation returns the time zone of the recorder time stamps, falling back
+// to the global option.
+func (dirwatch *Dirwatch) GetLocation() *time.Location {
+	if dirwatch.location != nil {
+		return dirwatch.location
+	}
+
+	return dirwatch.controller.Options.GetLocation()
+}
+
 func (dirwatch *Dirwatch) Ingest(p string) {
-	var err error
+	call, files, err := dirwatch.Parse(p)
+
+	if err == nil && call != nil {
+		dirwatch.controller.Ingest <- call
+
+		if dirwatch.DeleteAfter {
+			for _, f := range files {
+				if err = os.Remove(f); err != nil {
+					break
+				}
+			}
+		}
+	}
 
+	if err != nil {
+		dirwatch.controller.Logs.LogEvent(LogLevelWarn, fmt.Sprintf("dirwatch.ingest: %s, %s", err.Error(), p))
+	}
+}
+
+// Parse builds a call from the file at p according to the dirwatch type. It
+// returns a nil call when the file is not one the dirwatch should ingest, and
+// the list of files the call was built from.
+func (dirwatch *Dirwatch) Parse(p string) (*Call, []string, error) {
 	switch dirwatch.Kind {
 	case DirwatchTypeDSDPlus:
-		err = dirwatch.ingestDSDPlus(p)
+		return dirwatch.parseDSDPlus(p)
 	case DirwatchTypeTrunkRecorder:
-		err = dirwatch.ingestTrunkRecorder(p)
+		return dirwatch.parseTrunkRecorder(p)
 	case DirwatchTypeSdrTrunk:
-		err = dirwatch.ingestSdrTrunk(p)
+		return dirwatch.parseSdrTrunk(p)
 	default:
-		err = dirwatch.ingestDefault(p)
-	}
-
-	if err != nil {
-		dirwatch.controller.Logs.LogEvent(LogLevelWarn, fmt.Sprintf("dirwatch.ingest: %s, %s", err.Error(), p))
+		return dirwatch.parseDefault(p)
 	}
 }
 
-func (dirwatch *Dirwatch) ingestDefault(p string) error {
-	var (
-		err error
-		ext string
-	)
+func (dirwatch *Dirwatch) audioExtension() string {
+	if dirwatch.Kind == DirwatchTypeSdrTrunk {
+		return ".mp3"
+	}
 
 	switch v := dirwatch.Extension.(type) {
 	case string:
 		if len(v) > 0 {
-			ext = fmt.Sprintf(".%s", v)
-		} else {
-			ext = ".wav"
+			return fmt.Sprintf(".%s", v)
 		}
-	default:
-		ext = ".wav"
 	}
 
-	if strings.EqualFold(path.Ext(p), ext) {
-		call := NewCall()
+	if dirwatch.Kind == DirwatchTypeDSDPlus {
+		return ".mp3"
+	}
 
-		call.AudioName = filepath.Base(p)
-		call.AudioType = mime.TypeByExtension(path.Ext(p))
-		call.Frequency = dirwatch.Frequency
-		call.DateTime = time.Now().UTC()
+	return ".wav"
+}
 
-		if call.Audio, err = os.ReadFile(p); err != nil {
-			return err
-		}
+func (dirwatch *Dirwatch) parseDefault(p string) (*Call, []string, error) {
+	var (
+		err error
+		ext = dirwatch.audioExtension()
+	)
 
-		dirwatch.parseMask(call)
+	if !strings.EqualFold(path.Ext(p), ext) {
+		return nil, nil, nil
+	}
 
-		switch v := dirwatch.SystemId.(type) {
-		case uint:
-			call.System = v
-		}
+	call := NewCall()
 
-		switch v := dirwatch.TalkgroupId.(type) {
-		case uint:
-			call.Talkgroup = v
-		}
+	call.AudioName = filepath.Base(p)
+	call.AudioType = mime.TypeByExtension(path.Ext(p))
+	call.Frequency = dirwatch.Frequency
+	call.DateTime = time.Now().UTC()
 
-		if ok, err := call.IsValid(); ok {
-			dirwatch.controller.Ingest <- call
+	if call.Audio, err = os.ReadFile(p); err != nil {
+		return nil, nil, err
+	}
 
-			if dirwatch.DeleteAfter {
-				if err = os.Remove(p); err != nil {
-					return err
-				}
-			}
+	dirwatch.parseMask(call)
 
-		} else {
-			return err
-		}
+	switch v := dirwatch.SystemId.(type) {
+	case uint:
+		call.System = v
+	}
+
+	switch v := dirwatch.TalkgroupId.(type) {
+	case uint:
+		call.Talkgroup = v
 	}
 
-	return err
+	if ok, err := call.IsValid(); !ok {
+		return nil, nil, err
+	}
+
+	return call, []string{p}, nil
 }
 
-func (dirwatch *Dirwatch) ingestDSDPlus(p string) error {
+func (dirwatch *Dirwatch) parseDSDPlus(p string) (*Call, []string, error) {
 	var (
 		err error
-		ext string
+		ext = dirwatch.audioExtension()
 	)
 
-	switch v := dirwatch.Extension.(type) {
-	case string:
-		if len(v) > 0 {
-			ext = fmt.Sprintf(".%s", v)
-		} else {
-			ext = ".mp3"
-		}
-	default:
-		ext = ".mp3"
-	}
-
 	if !strings.EqualFold(path.Ext(p), ext) {
-		return nil
+		return nil, nil, nil
 	}
 
 	call := NewCall()
@@ -256,34 +281,25 @@ func (dirwatch *Dirwatch) ingestDSDPlus(p string) error {
 	}
 
 	if call.Audio, err = os.ReadFile(p); err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	if err = ParseDSDPlusMeta(call, p); err != nil {
-		return err
+	if err = ParseDSDPlusMeta(call, p, dirwatch.GetLocation()); err != nil {
+		return nil, nil, err
 	}
 
-	if ok, err := call.IsValid(); ok {
-		dirwatch.controller.Ingest <- call
-
-		if dirwatch.DeleteAfter {
-			if err = os.Remove(p); err != nil {
-				return err
-			}
-		}
-
-	} else {
-		return err
+	if ok, err := call.IsValid(); !ok {
+		return nil, nil, err
 	}
 
-	return nil
+	return call, []string{p}, nil
 }
 
-func (dirwatch *Dirwatch) ingestSdrTrunk(p string) error {
+func (dirwatch *Dirwatch) parseSdrTrunk(p string) (*Call, []string, error) {
 	var err error
 
-	if !strings.EqualFold(path.Ext(p), ".mp3") {
-		return nil
+	if !strings.EqualFold(path.Ext(p), dirwatch.audioExtension()) {
+		return nil, nil, nil
 	}
 
 	call := NewCall()
@@ -293,49 +309,29 @@ func (dirwatch *Dirwatch) ingestSdrTrunk(p string) error {
 	call.Frequency = dirwatch.Frequency
 
 	if call.Audio, err = os.ReadFile(p); err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	if err = ParseSdrTrunkMeta(call, dirwatch.controller); err != nil {
-		return err
+	if err = ParseSdrTrunkMeta(call, dirwatch.controller, dirwatch.GetLocation()); err != nil {
+		return nil, nil, err
 	}
 
-	if ok, err := call.IsValid(); ok {
-		dirwatch.controller.Ingest <- call
-
-		if dirwatch.DeleteAfter {
-			if err = os.Remove(p); err != nil {
-				return err
-			}
-		}
-
-	} else {
-		return err
+	if ok, err := call.IsValid(); !ok {
+		return nil, nil, err
 	}
 
-	return nil
+	return call, []string{p}, nil
 }
 
-func (dirwatch *Dirwatch) ingestTrunkRecorder(p string) error {
+func (dirwatch *Dirwatch) parseTrunkRecorder(p string) (*Call, []string, error) {
 	var (
 		b   []byte
 		err error
-		ext string
+		ext = dirwatch.audioExtension()
 	)
 
 	if !strings.EqualFold(path.Ext(p), ".json") {
-		return nil
-	}
-
-	switch v := dirwatch.Extension.(type) {
-	case string:
-		if len(v) > 0 {
-			ext = fmt.Sprintf(".%s", v)
-		} else {
-			ext = ".wav"
-		}
-	default:
-		ext = ".wav"
+		return nil, nil, nil
 	}
 
 	base := strings.TrimSuffix(p, ".json")
@@ -354,34 +350,22 @@ func (dirwatch *Dirwatch) ingestTrunkRecorder(p string) error {
 	}
 
 	if call.Audio, err = os.ReadFile(audioName); err != nil {
-		return nil
+		return nil, nil, nil
 	}
 
 	if b, err = os.ReadFile(p); err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if err = ParseTrunkRecorderMeta(call, b); err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	if ok, err := call.IsValid(); ok {
-		dirwatch.controller.Ingest <- call
-
-	} else {
-		return err
+	if ok, err := call.IsValid(); !ok {
+		return nil, nil, err
 	}
 
-	if dirwatch.DeleteAfter {
-		if err = os.Remove(p); err != nil {
-			return err
-		}
-		if err = os.Remove(audioName); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return call, []string{p, audioName}, nil
 }
 
 func (dirwatch *Dirwatch) parseMask(call *Call) {
@@ -451,7 +435,7 @@ func (dirwatch *Dirwatch) parseMask(call *Call) {
 		switch vTime := metaval["time"].(type) {
 		case string:
 			vTime = regexp.MustCompile(`(\d{2})[^\d]*(\d{2})[^\d]*(\d{2})`).ReplaceAllString(vTime, "$1:$2:$3")
-			if dateTime, err := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprintf("%vT%v", vDate, vTime), time.Now().Location()); err == nil {
+			if dateTime, err := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprintf("%vT%v", vDate, vTime), dirwatch.GetLocation()); err == nil {
 				call.DateTime = dateTime.UTC()
 			}
 		default:
@@ -786,6 +770,7 @@ func (dirwatches *Dirwatches) Read(db *Database) error {
 		rows        *sql.Rows
 		systemId    sql.NullFloat64
 		talkgroupId sql.NullFloat64
+		timeZone    sql.NullString
 	)
 
 	dirwatches.mutex.Lock()
@@ -799,18 +784,14 @@ func (dirwatches *Dirwatches) Read(db *Database) error {
 		return fmt.Errorf("dirwatches.read: %v", err)
 	}
 
-	q := "select `_id`, `delay`, `deleteAfter`, `directory`, `disabled`, `extension`, `frequency`, `mask`, `order`, `systemId`, `talkgroupId`, `type`, `usePolling` from `rdioScannerDirWatches`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id, delay, deleteAfter, directory, disabled, extension, frequency, mask, \"order\", systemId, talkgroupId, type, usePolling from rdioScannerDirWatches"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `delay`, `deleteAfter`, `directory`, `disabled`, `extension`, `frequency`, `mask`, `order`, `systemId`, `talkgroupId`, `timeZone`, `type`, `usePolling` from `rdioScannerDirWatches`").Query(); err != nil {
 		return formatError(err)
 	}
 
 	for rows.Next() {
 		dirwatch := NewDirwatch()
 
-		if err = rows.Scan(&id, &delay, &dirwatch.DeleteAfter, &dirwatch.Directory, &dirwatch.Disabled, &extension, &frequency, &mask, &order, &systemId, &talkgroupId, &kind, &dirwatch.UsePolling); err != nil {
+		if err = rows.Scan(&id, &delay, &dirwatch.DeleteAfter, &dirwatch.Directory, &dirwatch.Disabled, &extension, &frequency, &mask, &order, &systemId, &talkgroupId, &timeZone, &kind, &dirwatch.UsePolling); err != nil {
 			break
 		}
 
@@ -846,6 +827,11 @@ func (dirwatches *Dirwatches) Read(db *Database) error {
 			dirwatch.TalkgroupId = uint(talkgroupId.Float64)
 		}
 
+		if timeZone.Valid && len(timeZone.String) > 0 {
+			dirwatch.TimeZone = timeZone.String
+			dirwatch.location, _ = loadLocation(dirwatch.TimeZone)
+		}
+
 		if kind.Valid && len(kind.String) > 0 {
 			dirwatch.Kind = kind.String
 		}
@@ -882,7 +868,7 @@ func (dirwatches *Dirwatches) Write(db *Database) error {
 		count  uint
 		err    error
 		rows   *sql.Rows
-		rowIds = []uint{}
+		rowIds = []any{}
 	)
 
 	dirwatches.mutex.Lock()
@@ -892,11 +878,7 @@ func (dirwatches *Dirwatches) Write(db *Database) error {
 		return fmt.Errorf("dirwatches.write: %v", err)
 	}
 
-	q := "select `_id` from `rdioScannerDirWatches`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id from rdioScannerDirWatches"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerDirWatches`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -924,52 +906,36 @@ func (dirwatches *Dirwatches) Write(db *Database) error {
 	}
 
 	if len(rowIds) > 0 {
-		if b, err := json.Marshal(rowIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerDirwatches` where `_id` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerDirwatches where _id in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerDirwatches` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
 	for _, dirwatch := range dirwatches.List {
-		q := "select count(*) from `rdioScannerDirWatches` where `_id` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerDirWatches where _id = $1"
-		}
-		if err = db.Sql.QueryRow(q, dirwatch.Id).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerDirWatches` where `_id` = ?", dirwatch.Id).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerDirWatches (delay, deleteAfter, directory, disabled, extension, frequency, mask, \"order\", systemId, talkgroupId, type, usePolling) values ($1, $2, $3, $4, $5, $6, $7, $8, $9 , $10, $11, $12)"
-				if _, err = db.Sql.Exec(q, dirwatch.Delay, dirwatch.DeleteAfter, dirwatch.Directory, dirwatch.Disabled, dirwatch.Extension, dirwatch.Frequency, dirwatch.Mask, dirwatch.Order, dirwatch.SystemId, dirwatch.TalkgroupId, dirwatch.Kind, dirwatch.UsePolling); err != nil {
-					break
-				}
-			} else {
-				q = "insert into `rdioScannerDirWatches` (`_id`, `delay`, `deleteAfter`, `directory`, `disabled`, `extension`, `frequency`, `mask`, `order`, `systemId`, `talkgroupId`, `type`, `usePolling`) values (?, ?, ?, ?, ?, ?, ?, ?, ? ,? ,? ,? ,?)"
-				if _, err = db.Sql.Exec(q, dirwatch.Id, dirwatch.Delay, dirwatch.DeleteAfter, dirwatch.Directory, dirwatch.Disabled, dirwatch.Extension, dirwatch.Frequency, dirwatch.Mask, dirwatch.Order, dirwatch.SystemId, dirwatch.TalkgroupId, dirwatch.Kind, dirwatch.UsePolling); err != nil {
-					break
-				}
+			query := db.NewQuery("insert into `rdioScannerDirWatches` (`delay`, `deleteAfter`, `directory`, `disabled`, `extension`, `frequency`, `mask`, `order`, `systemId`, `talkgroupId`, `timeZone`, `type`, `usePolling`", dirwatch.Delay, dirwatch.DeleteAfter, dirwatch.Directory, dirwatch.Disabled, dirwatch.Extension, dirwatch.Frequency, dirwatch.Mask, dirwatch.Order, dirwatch.SystemId, dirwatch.TalkgroupId, dirwatch.TimeZone, dirwatch.Kind, dirwatch.UsePolling)
+			if dirwatch.Id != nil {
+				query.Append(", `_id`", dirwatch.Id)
 			}
-		} else {
-			q := "update `rdioScannerDirWatches` set `_id` = ?, `delay` = ?, `deleteAfter` = ?, `directory` = ?, `disabled` = ?, `extension` = ?, `frequency` = ?, `mask` = ?, `order` = ?, `systemId` = ?, `talkgroupId` = ?, `type` = ?, `usePolling` = ? where `_id` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerDirWatches set _id = $1, delay = $2, deleteAfter = $3, directory = $4, disabled = $5, extension = $6, frequency = $7, mask = $8, \"order\" = $9, systemId = $10, talkgroupId = $11, type = $12, usePolling = $13 where _id = $14"
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
 			}
-			if _, err = db.Sql.Exec(q, dirwatch.Id, dirwatch.Delay, dirwatch.DeleteAfter, dirwatch.Directory, dirwatch.Disabled, dirwatch.Extension, dirwatch.Frequency, dirwatch.Mask, dirwatch.Order, dirwatch.SystemId, dirwatch.TalkgroupId, dirwatch.Kind, dirwatch.UsePolling, dirwatch.Id); err != nil {
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerDirWatches` set `_id` = ?, `delay` = ?, `deleteAfter` = ?, `directory` = ?, `disabled` = ?, `extension` = ?, `frequency` = ?, `mask` = ?, `order` = ?, `systemId` = ?, `talkgroupId` = ?, `timeZone` = ?, `type` = ?, `usePolling` = ? where `_id` = ?", dirwatch.Id, dirwatch.Delay, dirwatch.DeleteAfter, dirwatch.Directory, dirwatch.Disabled, dirwatch.Extension, dirwatch.Frequency, dirwatch.Mask, dirwatch.Order, dirwatch.SystemId, dirwatch.TalkgroupId, dirwatch.TimeZone, dirwatch.Kind, dirwatch.UsePolling, dirwatch.Id).Exec(); err != nil {
 				break
 			}
 		}
 	}
 
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerDirWatches"))
+	}
+
 	if err != nil {
 		return formatError(err)
 	}
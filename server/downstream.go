@@ -24,7 +24,6 @@ import (
 	"net/http"
 	"net/url"
 	"path"
-	"strings"
 	"sync"
 	"time"
 
@@ -326,6 +325,34 @@ func (downstream *Downstream) Send(call *Call) error {
 		}
 	}
 
+	if len(call.tones) > 0 {
+		if w, err := mw.CreateFormField("tones"); err == nil {
+			if b, err := json.Marshal(call.tones); err == nil {
+				if _, err = w.Write(b); err != nil {
+					return formatError(err)
+				}
+			} else {
+				return formatError(err)
+			}
+		} else {
+			return formatError(err)
+		}
+	}
+
+	if call.Transcript != nil {
+		if w, err := mw.CreateFormField("transcript"); err == nil {
+			if b, err := json.Marshal(call.Transcript); err == nil {
+				if _, err = w.Write(b); err != nil {
+					return formatError(err)
+				}
+			} else {
+				return formatError(err)
+			}
+		} else {
+			return formatError(err)
+		}
+	}
+
 	if err := mw.Close(); err != nil {
 		return formatError(err)
 	}
@@ -399,11 +426,7 @@ func (downstreams *Downstreams) Read(db *Database) error {
 		return fmt.Errorf("downstreams.read: %v", err)
 	}
 
-	q := "select `_id`, `apiKey`, `disabled`, `order`, `systems`, `url` from `rdioScannerDownstreams`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id, apiKey, disabled, \"order\", systems, url from rdioScannerDownstreams"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `apiKey`, `disabled`, `order`, `systems`, `url` from `rdioScannerDownstreams`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -467,7 +490,7 @@ func (downstreams *Downstreams) Write(db *Database) error {
 		count   uint
 		err     error
 		rows    *sql.Rows
-		rowIds  = []uint{}
+		rowIds  = []any{}
 		systems any
 	)
 
@@ -478,11 +501,7 @@ func (downstreams *Downstreams) Write(db *Database) error {
 		return fmt.Errorf("downstreams.write: %v", err)
 	}
 
-	q := "select `_id` from `rdioScannerDownstreams`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id from rdioScannerDownstreams"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerDownstreams`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -510,17 +529,8 @@ func (downstreams *Downstreams) Write(db *Database) error {
 	}
 
 	if len(rowIds) > 0 {
-		if b, err := json.Marshal(rowIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerDownstreams` where `_id` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerDownstreams where _id in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerDownstreams` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
@@ -532,38 +542,31 @@ func (downstreams *Downstreams) Write(db *Database) error {
 			systems = downstream.Systems
 		}
 
-		q := "select count(*) from `rdioScannerDownstreams` where `_id` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerDownstreams where _id = $1"
-		}
-		if err = db.Sql.QueryRow(q, downstream.Id).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerDownstreams` where `_id` = ?", downstream.Id).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerDownstreams (apiKey, disabled, \"order\", systems, url) values ($1, $2, $3, $4, $5)"
-				if _, err = db.Sql.Exec(q, downstream.Apikey, downstream.Disabled, downstream.Order, systems, downstream.Url); err != nil {
-					break
-				}
-			} else {
-				q = "insert into `rdioScannerDownstreams` (`_id`, `apiKey`, `disabled`, `order`, `systems`, `url`) values (?, ?, ?, ?, ?, ?)"
-				if _, err = db.Sql.Exec(q, downstream.Id, downstream.Apikey, downstream.Disabled, downstream.Order, systems, downstream.Url); err != nil {
-					break
-				}
+			query := db.NewQuery("insert into `rdioScannerDownstreams` (`apiKey`, `disabled`, `order`, `systems`, `url`", downstream.Apikey, downstream.Disabled, downstream.Order, systems, downstream.Url)
+			if downstream.Id != nil {
+				query.Append(", `_id`", downstream.Id)
+			}
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
 			}
 
 		} else {
-			q := "update `rdioScannerDownstreams` set `_id` = ?, `apiKey` = ?, `disabled` = ?, `order` = ?, `systems` = ?, `url` = ? where `_id` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerDownstreams set _id = $1, apiKey = $2, disabled = $3, \"order\" = $4, systems = $5, url = $6 where _id = $7"
-			}
-			if _, err = db.Sql.Exec(q, downstream.Id, downstream.Apikey, downstream.Disabled, downstream.Order, systems, downstream.Url, downstream.Id); err != nil {
+			if _, err = db.NewQuery("update `rdioScannerDownstreams` set `_id` = ?, `apiKey` = ?, `disabled` = ?, `order` = ?, `systems` = ?, `url` = ? where `_id` = ?", downstream.Id, downstream.Apikey, downstream.Disabled, downstream.Order, systems, downstream.Url, downstream.Id).Exec(); err != nil {
 				break
 			}
 		}
 	}
 
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerDownstreams"))
+	}
+
 	if err != nil {
 		return formatError(err)
 	}
@@ -0,0 +1,641 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CALLS_EXPORT_FORMAT_AAC  = "aac"
+	CALLS_EXPORT_FORMAT_MP3  = "mp3"
+	CALLS_EXPORT_FORMAT_OPUS = "opus"
+	CALLS_EXPORT_FORMAT_WAV  = "wav"
+
+	// the calls are stitched into a temporary wav file as they are decoded, a
+	// day of audio being about 1.4 GB of samples
+	callsExportMaxDuration = 24 * time.Hour
+	callsExportSampleRate  = 8000
+
+	// the exports are kept for download for a while once done
+	callsExportExpiration = time.Hour
+)
+
+var (
+	// ErrCallsExportEmpty is returned when no call matches the export options.
+	ErrCallsExportEmpty = errors.New("no calls to export")
+
+	// ErrCallsExportTooLarge is returned when the matching calls exceed the
+	// maximum duration of an export.
+	ErrCallsExportTooLarge = fmt.Errorf("export exceeds %v of audio", callsExportMaxDuration)
+)
+
+// CallsExport is the stitched audio of the calls of a time range along with
+// the position of each call within it. The audio is kept in a temporary file
+// until the export is removed.
+type CallsExport struct {
+	AudioFile string               `json:"-"`
+	AudioName string               `json:"audioName"`
+	AudioType string               `json:"audioType"`
+	Chapters  []CallsExportChapter `json:"chapters"`
+	From      time.Time            `json:"from"`
+	To        time.Time            `json:"to"`
+}
+
+type CallsExportChapter struct {
+	Call      uint          `json:"call"`
+	DateTime  time.Time     `json:"dateTime"`
+	Duration  time.Duration `json:"-"`
+	Start     time.Duration `json:"-"`
+	System    string        `json:"system"`
+	Talkgroup string        `json:"talkgroup"`
+}
+
+func (chapter CallsExportChapter) MarshalJSON() ([]byte, error) {
+	type Alias CallsExportChapter
+
+	return json.Marshal(&struct {
+		Alias
+		Duration float64 `json:"duration"`
+		Start    float64 `json:"start"`
+	}{
+		Alias:    Alias(chapter),
+		Duration: chapter.Duration.Seconds(),
+		Start:    chapter.Start.Seconds(),
+	})
+}
+
+// GetCueSheet returns the chapters as a cue sheet referencing the audio file.
+func (export *CallsExport) GetCueSheet() string {
+	const cueSheetMaxFrames = (99*60+59)*75 + 74
+
+	quote := func(s string) string {
+		return fmt.Sprintf("\"%s\"", strings.ReplaceAll(s, "\"", "'"))
+	}
+
+	// only WAVE and MP3 are in the cue sheet specification, the other types
+	// are named after the format of the audio file
+	var fileType string
+
+	switch export.AudioType {
+	case "audio/aac":
+		fileType = "AAC"
+	case "audio/mp4":
+		fileType = "MP4"
+	case "audio/mpeg":
+		fileType = "MP3"
+	case "application/ogg":
+		fileType = "OPUS"
+	default:
+		fileType = "WAVE"
+	}
+
+	lines := []string{
+		fmt.Sprintf("REM DATE %s", export.From.Format(time.RFC3339)),
+		fmt.Sprintf("TITLE %s", quote(fmt.Sprintf("%s - %s", export.From.Format(time.RFC3339), export.To.Format(time.RFC3339)))),
+		fmt.Sprintf("FILE %s %s", quote(export.AudioName), fileType),
+	}
+
+	for i, chapter := range export.Chapters {
+		// cue sheets count in frames of 1/75 second, up to 99:59:74
+		frames := int64(chapter.Start.Seconds() * 75)
+		if frames > cueSheetMaxFrames {
+			frames = cueSheetMaxFrames
+		}
+
+		lines = append(lines,
+			fmt.Sprintf("  TRACK %02d AUDIO", i+1),
+			fmt.Sprintf("    TITLE %s", quote(chapter.Talkgroup)),
+			fmt.Sprintf("    PERFORMER %s", quote(chapter.System)),
+			fmt.Sprintf("    REM CALL %d", chapter.Call),
+			fmt.Sprintf("    REM DATE %s", chapter.DateTime.Format(time.RFC3339)),
+			fmt.Sprintf("    INDEX 01 %02d:%02d:%02d", frames/75/60, frames/75%60, frames%75),
+		)
+	}
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// WriteZip writes the audio file, its cue sheet and its chapters as json to
+// a zip archive.
+func (export *CallsExport) WriteZip(w io.Writer) error {
+	var (
+		base = strings.TrimSuffix(export.AudioName, path.Ext(export.AudioName))
+		err  error
+		f    io.Writer
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("callsexport.writezip: %v", err)
+	}
+
+	chapters, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return formatError(err)
+	}
+
+	z := zip.NewWriter(w)
+
+	audio, err := os.Open(export.AudioFile)
+	if err != nil {
+		return formatError(err)
+	}
+	defer audio.Close()
+
+	// the audio is copied from its file as it may well be larger than memory
+	files := []struct {
+		name   string
+		method uint16
+		data   io.Reader
+	}{
+		{export.AudioName, zip.Store, audio},
+		{base + ".cue", zip.Deflate, strings.NewReader(export.GetCueSheet())},
+		{base + ".json", zip.Deflate, strings.NewReader(string(chapters))},
+	}
+
+	for _, file := range files {
+		if f, err = z.CreateHeader(&zip.FileHeader{Name: file.name, Method: file.method, Modified: time.Now()}); err != nil {
+			return formatError(err)
+		}
+
+		if _, err = io.Copy(f, file.data); err != nil {
+			return formatError(err)
+		}
+	}
+
+	if err = z.Close(); err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+// CallsExportOptions are the search options of the calls to export along with
+// the time range and the layout of the stitched audio.
+type CallsExportOptions struct {
+	CallsSearchOptions
+	Format     string
+	From       time.Time
+	Gap        time.Duration
+	Timestamps bool
+	To         time.Time
+}
+
+func NewCallsExportOptions() *CallsExportOptions {
+	return &CallsExportOptions{Format: CALLS_EXPORT_FORMAT_WAV}
+}
+
+func (options *CallsExportOptions) FromMap(m map[string]any) *CallsExportOptions {
+	options.CallsSearchOptions.fromMap(m)
+
+	switch v := m["format"].(type) {
+	case string:
+		options.Format = v
+	}
+
+	switch v := m["from"].(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			options.From = t.UTC()
+		}
+	}
+
+	switch v := m["gap"].(type) {
+	case float64:
+		if v > 0 {
+			options.Gap = time.Duration(v * float64(time.Second))
+		}
+	}
+
+	switch v := m["timestamps"].(type) {
+	case bool:
+		options.Timestamps = v
+	}
+
+	switch v := m["to"].(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			options.To = t.UTC()
+		}
+	}
+
+	return options
+}
+
+// GetProfile returns the encoding profile of the export format, or nil when
+// the audio is to be left as PCM WAV.
+func (options *CallsExportOptions) GetProfile() (*Profile, error) {
+	switch options.Format {
+	case CALLS_EXPORT_FORMAT_AAC:
+		return &Profile{Codec: ProfileCodecAac, Container: ProfileContainerM4a}, nil
+	case CALLS_EXPORT_FORMAT_MP3:
+		return &Profile{Codec: ProfileCodecMp3}, nil
+	case CALLS_EXPORT_FORMAT_OPUS:
+		return &Profile{Codec: ProfileCodecOpus}, nil
+	case CALLS_EXPORT_FORMAT_WAV:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %s", options.Format)
+	}
+}
+
+func (options *CallsExportOptions) IsValid() error {
+	if options.From.IsZero() || options.To.IsZero() {
+		return errors.New("from and to are required")
+	}
+
+	if !options.To.After(options.From) {
+		return errors.New("to must be after from")
+	}
+
+	if _, err := options.GetProfile(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Remove deletes the audio file of the export.
+func (export *CallsExport) Remove() {
+	if len(export.AudioFile) > 0 {
+		os.Remove(export.AudioFile)
+	}
+}
+
+// Export stitches the audio of the calls matching the export options, within
+// the access scope of the client, in chronological order. The progress is
+// called after each call with the number of calls done out of the total.
+func (calls *Calls) Export(options *CallsExportOptions, client *Client, progress func(count int, total int)) (*CallsExport, error) {
+	var (
+		controller = client.Controller
+		err        error
+		samples    int
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("calls.export: %w", err)
+	}
+
+	if err = options.IsValid(); err != nil {
+		return nil, formatError(err)
+	}
+
+	profile, _ := options.GetProfile()
+
+	ids, err := calls.getExportIds(options, client)
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	if len(ids) == 0 {
+		return nil, formatError(ErrCallsExportEmpty)
+	}
+
+	export := &CallsExport{
+		AudioName: fmt.Sprintf("calls-%s-%s.wav", options.From.Format("20060102150405"), options.To.Format("20060102150405")),
+		AudioType: "audio/wav",
+		Chapters:  []CallsExportChapter{},
+		From:      options.From,
+		To:        options.To,
+	}
+
+	wav, err := os.CreateTemp("", "rdio-scanner-export-*.wav")
+	if err != nil {
+		return nil, formatError(err)
+	}
+	defer func() {
+		wav.Close()
+		if export.AudioFile != wav.Name() {
+			os.Remove(wav.Name())
+		}
+	}()
+
+	// the sizes of the wav header are written once all the samples are
+	w := bufio.NewWriter(wav)
+	if _, err = w.Write(EncodeWav(nil, callsExportSampleRate)); err != nil {
+		return nil, formatError(err)
+	}
+
+	write := func(s []int16) error {
+		samples += len(s)
+		return binary.Write(w, binary.LittleEndian, s)
+	}
+
+	duration := func(n int) time.Duration {
+		return time.Duration(n) * time.Second / callsExportSampleRate
+	}
+
+	for i, id := range ids {
+		if progress != nil && i > 0 {
+			progress(i, len(ids))
+		}
+
+		call, err := calls.GetCall(id, controller.Database)
+		if err != nil {
+			return nil, formatError(err)
+		}
+
+		if client.Access != nil && !client.Access.HasAccess(call) {
+			continue
+		}
+
+		// spares decoding calls which would not fit anyway
+		if duration(samples)+call.Duration > callsExportMaxDuration {
+			return nil, formatError(ErrCallsExportTooLarge)
+		}
+
+		audio, err := controller.FFMpeg.Decode(call.Audio, callsExportSampleRate)
+		if err != nil {
+			return nil, formatError(fmt.Errorf("call %d: %w", id, err))
+		}
+
+		chapter := CallsExportChapter{
+			Call:      id,
+			DateTime:  call.DateTime,
+			System:    fmt.Sprintf("%d", call.System),
+			Talkgroup: fmt.Sprintf("%d", call.Talkgroup),
+		}
+
+		if system, ok := controller.Systems.GetSystem(call.System); ok {
+			chapter.System = system.Label
+
+			if talkgroup, ok := system.Talkgroups.GetTalkgroup(call.Talkgroup); ok {
+				chapter.Talkgroup = talkgroup.Label
+			}
+		}
+
+		if len(export.Chapters) > 0 && options.Gap > 0 {
+			if err = write(make([]int16, int(options.Gap.Seconds()*callsExportSampleRate))); err != nil {
+				return nil, formatError(err)
+			}
+		}
+
+		if options.Timestamps {
+			t := call.DateTime.In(controller.Options.GetLocation())
+
+			speech, err := controller.FFMpeg.Speak(fmt.Sprintf("%s %d %02d %02d", chapter.Talkgroup, t.Hour(), t.Minute(), t.Second()), callsExportSampleRate)
+			if err != nil {
+				return nil, formatError(err)
+			}
+
+			if err = write(append(speech, make([]int16, callsExportSampleRate/4)...)); err != nil {
+				return nil, formatError(err)
+			}
+		}
+
+		chapter.Start = duration(samples)
+		chapter.Duration = duration(len(audio))
+
+		if err = write(audio); err != nil {
+			return nil, formatError(err)
+		}
+
+		if duration(samples) > callsExportMaxDuration {
+			return nil, formatError(ErrCallsExportTooLarge)
+		}
+
+		export.Chapters = append(export.Chapters, chapter)
+	}
+
+	if len(export.Chapters) == 0 {
+		return nil, formatError(ErrCallsExportEmpty)
+	}
+
+	if err = w.Flush(); err != nil {
+		return nil, formatError(err)
+	}
+
+	header := EncodeWav(nil, callsExportSampleRate)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(36+samples*2))
+	binary.LittleEndian.PutUint32(header[40:44], uint32(samples*2))
+
+	if _, err = wav.WriteAt(header, 0); err != nil {
+		return nil, formatError(err)
+	}
+
+	if err = wav.Close(); err != nil {
+		return nil, formatError(err)
+	}
+
+	if profile == nil {
+		export.AudioFile = wav.Name()
+
+	} else {
+		audioName := strings.TrimSuffix(wav.Name(), ".wav") + ".out"
+
+		audioType, ext, err := controller.FFMpeg.EncodeFile(wav.Name(), audioName, profile)
+		if err != nil {
+			os.Remove(audioName)
+			return nil, formatError(err)
+		}
+
+		export.AudioFile = audioName
+		export.AudioName = strings.TrimSuffix(export.AudioName, ".wav") + ext
+		export.AudioType = audioType
+	}
+
+	if progress != nil {
+		progress(len(ids), len(ids))
+	}
+
+	return export, nil
+}
+
+func (calls *Calls) getExportIds(options *CallsExportOptions, client *Client) ([]uint, error) {
+	var (
+		db   = client.Controller.Database
+		err  error
+		ids  = []uint{}
+		rows *sql.Rows
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("calls.getexportids: %v", err)
+	}
+
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	// the from and to of the export are also those of the search options
+	query := db.NewQuery("select `id` from `rdioScannerCalls` where ").
+		AppendQuery(calls.getSearchWhere(&options.CallsSearchOptions, client)).
+		AppendQuery(calls.getSearchTextWhere(&options.CallsSearchOptions, client)).
+		Append(" order by `dateTime` asc, `id` asc")
+	if rows, err = query.Query(); err != nil {
+		return nil, formatError(err)
+	}
+
+	for rows.Next() {
+		var id uint
+		if err = rows.Scan(&id); err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	return ids, nil
+}
+
+// CallsExportJob is an export running in the background, whose result is kept
+// for download until it expires.
+type CallsExportJob struct {
+	Id     string
+	access *Access
+	count  int
+	done   bool
+	err    error
+	export *CallsExport
+	mutex  sync.Mutex
+	total  int
+}
+
+// Status returns the progress of the job, along with its export and its error
+// once done.
+func (job *CallsExportJob) Status() (map[string]any, *CallsExport, error) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	status := map[string]any{
+		"count": job.count,
+		"done":  job.done,
+		"id":    job.Id,
+		"total": job.total,
+	}
+
+	if job.err != nil {
+		status["error"] = job.err.Error()
+	}
+
+	return status, job.export, job.err
+}
+
+// CallsExports runs the exports as background jobs, as an export decodes and
+// encodes every call of a time range, which outlasts an http request.
+type CallsExports struct {
+	controller *Controller
+	jobs       map[string]*CallsExportJob
+	mutex      sync.Mutex
+}
+
+func NewCallsExports(controller *Controller) *CallsExports {
+	return &CallsExports{
+		controller: controller,
+		jobs:       map[string]*CallsExportJob{},
+		mutex:      sync.Mutex{},
+	}
+}
+
+// Get returns the job when it was started by the same access as the client,
+// the administrators having access to all the jobs.
+func (exports *CallsExports) Get(id string, client *Client) (*CallsExportJob, bool) {
+	exports.mutex.Lock()
+	defer exports.mutex.Unlock()
+
+	job, ok := exports.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	if client.Access != nil && (job.access == nil || job.access.Code != client.Access.Code) {
+		return nil, false
+	}
+
+	return job, true
+}
+
+// Remove deletes the audio files of the exports done, the running ones
+// failing as ffmpeg is stopped.
+func (exports *CallsExports) Remove() {
+	exports.mutex.Lock()
+	defer exports.mutex.Unlock()
+
+	for _, job := range exports.jobs {
+		if _, export, _ := job.Status(); export != nil {
+			export.Remove()
+		}
+	}
+}
+
+// Start starts the export of the calls matching the options, and returns its
+// job right away.
+func (exports *CallsExports) Start(options *CallsExportOptions, client *Client) (*CallsExportJob, error) {
+	if err := options.IsValid(); err != nil {
+		return nil, fmt.Errorf("callsexports.start: %w", err)
+	}
+
+	job := &CallsExportJob{
+		Id:     uuid.New().String(),
+		access: client.Access,
+	}
+
+	exports.mutex.Lock()
+	exports.jobs[job.Id] = job
+	exports.mutex.Unlock()
+
+	go func() {
+		logs := exports.controller.Logs
+
+		export, err := exports.controller.Calls.Export(options, client, func(count int, total int) {
+			job.mutex.Lock()
+			job.count, job.total = count, total
+			job.mutex.Unlock()
+		})
+
+		job.mutex.Lock()
+		job.done = true
+		job.err = err
+		job.export = export
+		job.mutex.Unlock()
+
+		if err == nil {
+			logs.LogEvent(LogLevelInfo, fmt.Sprintf("calls export %s done, %d calls in %s", job.Id, len(export.Chapters), export.AudioName))
+		} else {
+			logs.LogEvent(LogLevelWarn, fmt.Sprintf("calls export %s failed, %v", job.Id, err))
+		}
+
+		time.AfterFunc(callsExportExpiration, func() {
+			exports.mutex.Lock()
+			delete(exports.jobs, job.Id)
+			exports.mutex.Unlock()
+
+			if export != nil {
+				export.Remove()
+			}
+		})
+	}()
+
+	return job, nil
+}
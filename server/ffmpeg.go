@@ -17,6 +17,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -24,16 +26,61 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	// ErrFFMpegStopped is returned by the jobs submitted or still waiting for
+	// a worker once the pool has been stopped.
+	ErrFFMpegStopped = errors.New("ffmpeg is stopped")
+
+	// ErrFFMpegTimeout is returned when a job ran longer than the timeout and
+	// its ffmpeg process was killed.
+	ErrFFMpegTimeout = errors.New("ffmpeg timed out")
+
+	// ErrFFMpegNoSpeech is returned by the speech synthesis when ffmpeg was
+	// built without the flite filter.
+	ErrFFMpegNoSpeech = errors.New("ffmpeg is not built with flite, no speech synthesis available")
+
+	// ErrFFMpegUnavailable is returned once by the conversion when ffmpeg is
+	// not installed.
+	ErrFFMpegUnavailable = errors.New("ffmpeg is not available, no audio conversion will be performed")
+
+	// ErrNoVoice is returned by the conversion when the voiced content of a
+	// call is shorter than the minimum voice duration of its system.
+	ErrNoVoice = errors.New("no voice")
+)
+
+const ffmpegSilenceFilter = "silenceremove=start_periods=1:start_duration=0.1:start_threshold=-50dB"
+
+// FFMpeg runs the ffmpeg processes through a bounded pool of workers, each job
+// being killed when it runs longer than the timeout.
 type FFMpeg struct {
 	available bool
+	cancel    context.CancelFunc
+	cond      *sync.Cond
+	ctx       context.Context
+	flite     bool
+	idle      *sync.Cond
+	mutex     sync.Mutex
+	running   uint
+	tasks     uint
+	timeout   time.Duration
 	version43 bool
 	warned    bool
+	workers   uint
 }
 
 func NewFFMpeg() *FFMpeg {
-	ffmpeg := &FFMpeg{}
+	ffmpeg := &FFMpeg{
+		timeout: time.Duration(defaults.options.ffmpegTimeout) * time.Second,
+		workers: defaults.options.ffmpegWorkers,
+	}
+
+	ffmpeg.cond = sync.NewCond(&ffmpeg.mutex)
+	ffmpeg.idle = sync.NewCond(&ffmpeg.mutex)
+	ffmpeg.ctx, ffmpeg.cancel = context.WithCancel(context.Background())
 
 	stdout := bytes.NewBuffer([]byte(nil))
 
@@ -56,15 +103,38 @@ func NewFFMpeg() *FFMpeg {
 				}
 			}
 		}
+
+		stdout.Reset()
+
+		cmd = exec.Command("ffmpeg", "-hide_banner", "-filters")
+		cmd.Stdout = stdout
+
+		if err := cmd.Run(); err == nil {
+			ffmpeg.flite = regexp.MustCompile(`(?m)^\s*\S*\s+flite\s`).Match(stdout.Bytes())
+		}
 	}
 
 	return ffmpeg
 }
 
-func (ffmpeg *FFMpeg) Convert(call *Call, systems *Systems, tags *Tags, mode uint, bitrateKhz uint) error {
+// Convert encodes the call audio with the profile of its talkgroup or system,
+// or with the global audio bitrate to Opus when none is assigned.
+func (ffmpeg *FFMpeg) Convert(call *Call, systems *Systems, tags *Tags, profiles *Profiles, mode uint, bitrateKhz uint) error {
+	profile, ok := profiles.GetCallProfile(call, systems)
+	if !ok {
+		profile = &Profile{Bitrate: bitrateKhz, Codec: ProfileCodecOpus}
+	}
+
+	return ffmpeg.ConvertWithProfile(call, systems, tags, profile, mode)
+}
+
+// ConvertWithProfile encodes the call audio with the given profile.
+func (ffmpeg *FFMpeg) ConvertWithProfile(call *Call, systems *Systems, tags *Tags, profile *Profile, mode uint) error {
 	var (
-		args = []string{"-i", "-"}
-		err  error
+		args    = []string{"-i", "-"}
+		err     error
+		filters = []string{}
+		trim    bool
 	)
 
 	if mode == AUDIO_CONVERSION_DISABLED {
@@ -72,10 +142,14 @@ func (ffmpeg *FFMpeg) Convert(call *Call, systems *Systems, tags *Tags, mode uin
 	}
 
 	if !ffmpeg.available {
+		// the conversions run concurrently
+		ffmpeg.mutex.Lock()
+		defer ffmpeg.mutex.Unlock()
+
 		if !ffmpeg.warned {
 			ffmpeg.warned = true
 
-			return errors.New("ffmpeg is not available, no audio conversion will be performed")
+			return ErrFFMpegUnavailable
 		}
 		return nil
 	}
@@ -94,39 +168,296 @@ func (ffmpeg *FFMpeg) Convert(call *Call, systems *Systems, tags *Tags, mode uin
 		}
 	}
 
+	audioFilters := NewAudioFilters()
+
+	if system, ok := systems.GetSystem(call.System); ok {
+		audioFilters = audioFilters.Merge(system.AudioFilters)
+
+		if talkgroup, ok := system.Talkgroups.GetTalkgroup(call.Talkgroup); ok {
+			audioFilters = audioFilters.Merge(talkgroup.AudioFilters)
+		}
+
+		switch v := system.MinVoiceDuration.(type) {
+		case uint:
+			if v > 0 {
+				if d, err := ffmpeg.VoiceDuration(call.Audio); err == nil && d < time.Duration(v)*time.Millisecond {
+					return ErrNoVoice
+				}
+			}
+		}
+
+		trim = system.TrimSilence
+	}
+
+	filters = append(filters, audioFilters.GetFilters()...)
+
 	if ffmpeg.version43 {
-		if mode == AUDIO_CONVERSION_ENABLED_NORM {
-			args = append(args, "-af", "apad=whole_dur=3s,loudnorm")
-		} else if mode == AUDIO_CONVERSION_ENABLED_LOUD_NORM {
-			args = append(args, "-af", "apad=whole_dur=3s,loudnorm=I=-16:TP=-1.5:LRA=11")
+		switch v := audioFilters.Loudnorm.(type) {
+		case string:
+			filters = append(filters, getLoudnormFilters(v)...)
+		default:
+			if mode == AUDIO_CONVERSION_ENABLED_NORM {
+				filters = append(filters, getLoudnormFilters(AUDIO_LOUDNORM_NORM)...)
+			} else if mode == AUDIO_CONVERSION_ENABLED_LOUD_NORM {
+				filters = append(filters, getLoudnormFilters(AUDIO_LOUDNORM_LOUD)...)
+			}
 		}
 	}
 
-	bitrateStr := fmt.Sprintf("%dk", bitrateKhz)
+	// trimmed after the padding of the loudness normalization, which would
+	// otherwise pad the trimmed call back to its minimum duration
+	if trim {
+		filters = append(filters, ffmpegSilenceFilter, "areverse", ffmpegSilenceFilter, "areverse")
+	}
 
-	args = append(args, "-c:a", "libopus", "-vbr", "on", "-compression_level", "10", "-b:a", bitrateStr, "-f", "opus", "-")
+	switch v := profile.Filters.(type) {
+	case string:
+		if len(v) > 0 {
+			filters = append(filters, v)
+		}
+	}
 
-	cmd := exec.Command("ffmpeg", args...)
-	cmd.Stdin = bytes.NewReader(call.Audio)
+	if len(filters) > 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
 
-	stdout := bytes.NewBuffer([]byte(nil))
-	cmd.Stdout = stdout
+	encoderArgs, audioType, ext := profile.GetEncoderArgs()
 
-	stderr := bytes.NewBuffer([]byte(nil))
-	cmd.Stderr = stderr
+	args = append(args, encoderArgs...)
+	args = append(args, "-")
 
-	if err = cmd.Run(); err == nil {
-		call.Audio = stdout.Bytes()
-		call.AudioType = "application/ogg"
+	stdout, stderr, err := ffmpeg.run(args, call.Audio)
+	if err == nil {
+		call.Audio = stdout
+		call.AudioType = audioType
 
 		switch v := call.AudioName.(type) {
 		case string:
-			call.AudioName = fmt.Sprintf("%v.opus", strings.TrimSuffix(v, path.Ext((v))))
+			call.AudioName = fmt.Sprintf("%v%v", strings.TrimSuffix(v, path.Ext((v))), ext)
 		}
 
+	} else if lines := strings.Split(strings.TrimSpace(string(stderr)), "\n"); len(lines[0]) > 0 {
+		return fmt.Errorf("ffmpeg.convert: %w, %v", err, lines[len(lines)-1])
 	} else {
-		fmt.Println(stderr.String())
+		return fmt.Errorf("ffmpeg.convert: %w", err)
 	}
 
 	return nil
 }
+
+// Decode returns the audio as mono samples at the given sample rate. Without
+// ffmpeg, only PCM WAV audio can be decoded.
+func (ffmpeg *FFMpeg) Decode(audio []byte, sampleRate uint) ([]int16, error) {
+	if !ffmpeg.available {
+		samples, rate, err := DecodeWav(audio)
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg.decode: %v", err)
+		}
+		return resample(samples, rate, sampleRate), nil
+	}
+
+	b, _, err := ffmpeg.run([]string{"-i", "-", "-ac", "1", "-ar", fmt.Sprintf("%d", sampleRate), "-f", "s16le", "-"}, audio)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg.decode: %w", err)
+	}
+
+	samples := make([]int16, len(b)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(b[i*2 : i*2+2]))
+	}
+
+	return samples, nil
+}
+
+// EncodeFile encodes an audio file to another file with the given profile, and
+// returns the mime type and file extension of the encoded audio. Unlike the
+// other jobs, it is not killed after the timeout, as it lasts as long as the
+// audio is long.
+func (ffmpeg *FFMpeg) EncodeFile(input string, output string, profile *Profile) (string, string, error) {
+	if !ffmpeg.available {
+		return "", "", fmt.Errorf("ffmpeg.encodefile: %w", ErrFFMpegUnavailable)
+	}
+
+	encoderArgs, audioType, ext := profile.GetEncoderArgs()
+
+	args := []string{"-y", "-i", input}
+	args = append(args, encoderArgs...)
+	args = append(args, output)
+
+	_, stderr, err := ffmpeg.runJob(args, nil, false)
+	if err != nil {
+		if lines := strings.Split(strings.TrimSpace(string(stderr)), "\n"); len(lines[0]) > 0 {
+			return "", "", fmt.Errorf("ffmpeg.encodefile: %w, %v", err, lines[len(lines)-1])
+		}
+		return "", "", fmt.Errorf("ffmpeg.encodefile: %w", err)
+	}
+
+	return audioType, ext, nil
+}
+
+// VoiceDuration returns the duration of the audio once all its silences have
+// been removed, counted from the decoded samples.
+func (ffmpeg *FFMpeg) VoiceDuration(audio []byte) (time.Duration, error) {
+	args := []string{"-i", "-", "-af", "silenceremove=start_periods=1:start_threshold=-50dB:stop_periods=-1:stop_duration=0.3:stop_threshold=-50dB", "-ac", "1", "-ar", fmt.Sprintf("%d", WAVEFORM_SAMPLE_RATE), "-f", "s16le", "-"}
+
+	stdout, _, err := ffmpeg.run(args, audio)
+	if err != nil {
+		return 0, fmt.Errorf("ffmpeg.voiceduration: %w", err)
+	}
+
+	return time.Duration(len(stdout)/2) * time.Second / WAVEFORM_SAMPLE_RATE, nil
+}
+
+// Speak synthesizes the text as mono samples at the given sample rate with
+// the flite filter of ffmpeg.
+func (ffmpeg *FFMpeg) Speak(text string, sampleRate uint) ([]int16, error) {
+	if !ffmpeg.available || !ffmpeg.flite {
+		return nil, fmt.Errorf("ffmpeg.speak: %w", ErrFFMpegNoSpeech)
+	}
+
+	text = regexp.MustCompile(`[^0-9A-Za-z ]+`).ReplaceAllString(text, " ")
+
+	b, _, err := ffmpeg.run([]string{"-f", "lavfi", "-i", fmt.Sprintf("flite=text='%s'", text), "-ac", "1", "-ar", fmt.Sprintf("%d", sampleRate), "-f", "s16le", "-"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg.speak: %w", err)
+	}
+
+	samples := make([]int16, len(b)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(b[i*2 : i*2+2]))
+	}
+
+	return samples, nil
+}
+
+// SetLimits changes the number of ffmpeg processes allowed to run at once, and
+// the time after which a job is killed. A timeout of 0 disables it.
+func (ffmpeg *FFMpeg) SetLimits(workers uint, timeout time.Duration) {
+	if workers == 0 {
+		workers = 1
+	}
+
+	ffmpeg.mutex.Lock()
+	ffmpeg.workers = workers
+	ffmpeg.timeout = timeout
+	ffmpeg.mutex.Unlock()
+
+	ffmpeg.cond.Broadcast()
+	ffmpeg.idle.Broadcast()
+}
+
+// Go runs the task in a goroutine once fewer tasks than workers are running,
+// so that the tasks keep all the workers busy without piling up.
+func (ffmpeg *FFMpeg) Go(task func()) {
+	ffmpeg.mutex.Lock()
+	for ffmpeg.tasks >= ffmpeg.workers {
+		ffmpeg.idle.Wait()
+	}
+	ffmpeg.tasks++
+	ffmpeg.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			ffmpeg.mutex.Lock()
+			ffmpeg.tasks--
+			ffmpeg.mutex.Unlock()
+
+			ffmpeg.idle.Broadcast()
+		}()
+
+		task()
+	}()
+}
+
+// Stop kills the running ffmpeg processes and fails the waiting jobs.
+func (ffmpeg *FFMpeg) Stop() {
+	ffmpeg.cancel()
+	ffmpeg.cond.Broadcast()
+}
+
+// Wait returns once all the tasks started with Go are done.
+func (ffmpeg *FFMpeg) Wait() {
+	ffmpeg.mutex.Lock()
+	for ffmpeg.tasks > 0 {
+		ffmpeg.idle.Wait()
+	}
+	ffmpeg.mutex.Unlock()
+}
+
+func (ffmpeg *FFMpeg) run(args []string, stdin []byte) ([]byte, []byte, error) {
+	return ffmpeg.runJob(args, stdin, true)
+}
+
+// runJob runs ffmpeg once a worker is free, killing it after the timeout when
+// the job is timed.
+func (ffmpeg *FFMpeg) runJob(args []string, stdin []byte, timed bool) ([]byte, []byte, error) {
+	ffmpeg.mutex.Lock()
+
+	metricsFFMpegWaiting.Inc()
+	for ffmpeg.running >= ffmpeg.workers && ffmpeg.ctx.Err() == nil {
+		ffmpeg.cond.Wait()
+	}
+	metricsFFMpegWaiting.Dec()
+
+	if ffmpeg.ctx.Err() != nil {
+		ffmpeg.mutex.Unlock()
+		metricsFFMpegJobs.WithLabelValues("stopped").Inc()
+		return nil, nil, ErrFFMpegStopped
+	}
+
+	ffmpeg.running++
+	timeout := ffmpeg.timeout
+	if !timed {
+		timeout = 0
+	}
+
+	ffmpeg.mutex.Unlock()
+
+	metricsFFMpegRunning.Inc()
+
+	defer func() {
+		metricsFFMpegRunning.Dec()
+
+		ffmpeg.mutex.Lock()
+		ffmpeg.running--
+		ffmpeg.mutex.Unlock()
+
+		ffmpeg.cond.Signal()
+	}()
+
+	ctx := ffmpeg.ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.WaitDelay = time.Second
+
+	stdout := bytes.NewBuffer([]byte(nil))
+	cmd.Stdout = stdout
+
+	stderr := bytes.NewBuffer([]byte(nil))
+	cmd.Stderr = stderr
+
+	started := time.Now()
+	err := cmd.Run()
+	metricsFFMpegDuration.Observe(time.Since(started).Seconds())
+
+	switch {
+	case err == nil:
+		metricsFFMpegJobs.WithLabelValues("success").Inc()
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		metricsFFMpegJobs.WithLabelValues("timeout").Inc()
+		err = ErrFFMpegTimeout
+	case ffmpeg.ctx.Err() != nil:
+		metricsFFMpegJobs.WithLabelValues("stopped").Inc()
+		err = ErrFFMpegStopped
+	default:
+		metricsFFMpegJobs.WithLabelValues("failure").Inc()
+	}
+
+	return stdout.Bytes(), stderr.Bytes(), err
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import "math/bits"
+
+const (
+	FINGERPRINT_SAMPLE_RATE = 8000
+	FINGERPRINT_THRESHOLD   = 0.8
+
+	// 32ms frames, compared with up to one second of drift
+	fingerprintFrameSize = 256
+	fingerprintMaxShift  = 32
+)
+
+// Fingerprint is a compact acoustic signature of a call. Each 32ms frame is
+// reduced to two bits telling whether its energy and its zero crossing rate
+// went up from the previous frame, so that the same transmission received by
+// different recorders gives nearly the same bits regardless of level or codec.
+type Fingerprint []byte
+
+func NewFingerprint(samples []int16) Fingerprint {
+	var (
+		crossings = []int{}
+		energies  = []float64{}
+	)
+
+	for pos := 0; pos+fingerprintFrameSize <= len(samples); pos += fingerprintFrameSize {
+		var (
+			crossing int
+			energy   float64
+		)
+
+		frame := samples[pos : pos+fingerprintFrameSize]
+		for i, sample := range frame {
+			energy += float64(sample) * float64(sample)
+			if i > 0 && (sample >= 0) != (frame[i-1] >= 0) {
+				crossing++
+			}
+		}
+
+		crossings = append(crossings, crossing)
+		energies = append(energies, energy)
+	}
+
+	if len(energies) < 2 {
+		return nil
+	}
+
+	fingerprint := make(Fingerprint, (len(energies)-1+3)/4)
+
+	for i := 1; i < len(energies); i++ {
+		var pair byte
+
+		if energies[i] > energies[i-1] {
+			pair |= 1
+		}
+
+		if crossings[i] > crossings[i-1] {
+			pair |= 2
+		}
+
+		fingerprint[(i-1)/4] |= pair << (((i - 1) % 4) * 2)
+	}
+
+	return fingerprint
+}
+
+func (fingerprint Fingerprint) frame(i int) byte {
+	return (fingerprint[i/4] >> ((i % 4) * 2)) & 3
+}
+
+// Similarity returns the ratio of matching bits between two fingerprints at
+// their best alignment, from 0.5 for unrelated audio to 1 for the same audio.
+func (fingerprint Fingerprint) Similarity(other Fingerprint) float64 {
+	var best float64
+
+	na, nb := len(fingerprint)*4, len(other)*4
+
+	overlap := min(na, nb) / 2
+	if overlap < 8 {
+		return 0
+	}
+
+	for shift := -fingerprintMaxShift; shift <= fingerprintMaxShift; shift++ {
+		var matches, total int
+
+		for i := max(0, -shift); i < na && i+shift < nb; i++ {
+			matches += 2 - bits.OnesCount8(fingerprint.frame(i)^other.frame(i+shift))
+			total += 2
+		}
+
+		if total/2 < overlap {
+			continue
+		}
+
+		if ratio := float64(matches) / float64(total); ratio > best {
+			best = ratio
+		}
+	}
+
+	return best
+}
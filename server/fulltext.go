@@ -0,0 +1,255 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// callsTextMaxTerms is the number of search terms above which the extra terms
+// are ignored.
+const callsTextMaxTerms = 16
+
+// CallsTextIndex is the full text index of the calls. Each call is indexed
+// with the labels of its system, talkgroup and units, and with its
+// transcript, in the `rdioScannerCallsText` table which each database type
+// builds and queries on its own.
+type CallsTextIndex interface {
+	// Match returns a query selecting the `callId` and the `score` of the
+	// calls matching all the terms, the best matches having the highest
+	// scores.
+	Match(db *Database, terms []string) *Query
+
+	// Put indexes the text of a call, replacing what was indexed before.
+	Put(db *Database, id uint, text string) error
+}
+
+func NewCallsTextIndex(dbType string) CallsTextIndex {
+	switch dbType {
+	case DbTypePostgresql:
+		return &PostgresCallsTextIndex{}
+	case DbTypeMariadb, DbTypeMysql:
+		return &MysqlCallsTextIndex{}
+	default:
+		return &SqliteCallsTextIndex{}
+	}
+}
+
+// MysqlCallsTextIndex uses a FULLTEXT index in boolean mode.
+type MysqlCallsTextIndex struct{}
+
+func (index *MysqlCallsTextIndex) Match(db *Database, terms []string) *Query {
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = fmt.Sprintf("+%s*", term)
+	}
+	against := strings.Join(words, " ")
+
+	return db.NewQuery("select `callId`, match(`body`) against (? in boolean mode) as `score` from `rdioScannerCallsText` where match(`body`) against (? in boolean mode)", against, against)
+}
+
+func (index *MysqlCallsTextIndex) Put(db *Database, id uint, text string) error {
+	_, err := db.NewQuery("insert into `rdioScannerCallsText` (`callId`, `body`) values (?, ?) on duplicate key update `body` = values(`body`)", id, text).Exec()
+	return err
+}
+
+// PostgresCallsTextIndex uses a tsvector column computed from the text.
+type PostgresCallsTextIndex struct{}
+
+func (index *PostgresCallsTextIndex) Match(db *Database, terms []string) *Query {
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = term + ":*"
+	}
+	tsquery := strings.Join(words, " & ")
+
+	return db.NewQuery("select `callId`, ts_rank(`vector`, to_tsquery('simple', ?)) as `score` from `rdioScannerCallsText` where `vector` @@ to_tsquery('simple', ?)", tsquery, tsquery)
+}
+
+func (index *PostgresCallsTextIndex) Put(db *Database, id uint, text string) error {
+	_, err := db.NewQuery("insert into `rdioScannerCallsText` (`callId`, `body`) values (?, ?) on conflict (`callId`) do update set `body` = excluded.`body`", id, text).Exec()
+	return err
+}
+
+// SqliteCallsTextIndex uses a FTS5 virtual table whose rowid is the call id.
+type SqliteCallsTextIndex struct{}
+
+func (index *SqliteCallsTextIndex) Match(db *Database, terms []string) *Query {
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = fmt.Sprintf("\"%s\"*", term)
+	}
+
+	return db.NewQuery("select `callId`, -`rank` as `score` from `rdioScannerCallsText` where `rdioScannerCallsText` match ?", strings.Join(words, " "))
+}
+
+func (index *SqliteCallsTextIndex) Put(db *Database, id uint, text string) error {
+	_, err := db.NewQuery("insert or replace into `rdioScannerCallsText` (`rowid`, `callId`, `body`) values (?, ?, ?)", id, id, text).Exec()
+	return err
+}
+
+// GetCallText returns the text under which a call is indexed.
+func GetCallText(call *Call, system *System, talkgroup *Talkgroup) string {
+	texts := []string{}
+
+	if system != nil {
+		texts = append(texts, system.Label)
+	}
+
+	if talkgroup != nil {
+		texts = append(texts, talkgroup.Label, talkgroup.Name)
+	}
+
+	if system != nil {
+		texts = append(texts, GetCallUnitLabels(call, system)...)
+	}
+
+	if call.Transcript != nil {
+		texts = append(texts, call.Transcript.Text)
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// GetTextTerms splits a search text into lower case words. Anything but
+// letters and digits separates the words, so that the terms never carry the
+// operators of the full text query syntaxes.
+func GetTextTerms(text string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	if len(terms) > callsTextMaxTerms {
+		terms = terms[:callsTextMaxTerms]
+	}
+
+	return terms
+}
+
+// IndexText puts the call in the full text index.
+func (calls *Calls) IndexText(call *Call, system *System, talkgroup *Talkgroup, db *Database) error {
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	id, ok := toSqlId(call.Id)
+	if !ok {
+		return fmt.Errorf("calls.indextext: invalid call id %v", call.Id)
+	}
+
+	if err := db.TextIndex.Put(db, id, GetCallText(call, system, talkgroup)); err != nil {
+		return fmt.Errorf("calls.indextext: %v", err)
+	}
+
+	return nil
+}
+
+// Reindex puts the stored calls in the full text index with the current
+// labels of their systems, talkgroups and units. Unless all is set, only the
+// calls missing from the index are indexed. The progress function, when given,
+// is called with the count of calls indexed after each call.
+func (calls *Calls) Reindex(controller *Controller, all bool, progress func(count uint)) (uint, error) {
+	var (
+		count  uint
+		db     = controller.Database
+		lastId uint
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("calls.reindex: %v", err)
+	}
+
+	for {
+		batch := []*Call{}
+
+		query := db.NewQuery("select `id`, `sources`, `system`, `talkgroup`, `transcript` from `rdioScannerCalls` where `id` > ?", lastId)
+		if !all {
+			query.Append(" and `id` not in (select `callId` from `rdioScannerCallsText`)")
+		}
+		query.Append(" order by `id` limit 100")
+
+		rows, err := query.Query()
+		if err != nil {
+			return count, formatError(err)
+		}
+
+		for rows.Next() {
+			var (
+				id         uint
+				sources    sql.NullString
+				transcript sql.NullString
+			)
+
+			call := &Call{}
+
+			if err = rows.Scan(&id, &sources, &call.System, &call.Talkgroup, &transcript); err != nil {
+				break
+			}
+
+			call.Id = id
+
+			if sources.Valid && len(sources.String) > 0 {
+				var f any
+				if err := json.Unmarshal([]byte(sources.String), &f); err == nil {
+					call.Sources = f
+				}
+			}
+
+			if transcript.Valid && len(transcript.String) > 0 {
+				t := &Transcript{}
+				if err := json.Unmarshal([]byte(transcript.String), t); err == nil {
+					call.Transcript = t
+				}
+			}
+
+			batch = append(batch, call)
+		}
+
+		rows.Close()
+
+		if err != nil {
+			return count, formatError(err)
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, call := range batch {
+			var talkgroup *Talkgroup
+
+			system, ok := controller.Systems.GetSystem(call.System)
+			if ok {
+				talkgroup, _ = system.Talkgroups.GetTalkgroup(call.Talkgroup)
+			}
+
+			if err := calls.IndexText(call, system, talkgroup, db); err != nil {
+				return count, formatError(err)
+			}
+
+			count++
+			lastId = call.Id.(uint)
+			if progress != nil {
+				progress(count)
+			}
+		}
+	}
+
+	return count, nil
+}
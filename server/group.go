@@ -17,9 +17,7 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 )
 
@@ -178,11 +176,7 @@ func (groups *Groups) Read(db *Database) error {
 		return fmt.Errorf("groups.read: %v", err)
 	}
 
-	q := "select `_id`, `label` from `rdioScannerGroups`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id, label from rdioScannerGroups"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `label` from `rdioScannerGroups`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -218,7 +212,7 @@ func (groups *Groups) Write(db *Database) error {
 		count  uint
 		err    error
 		rows   *sql.Rows
-		rowIds = []uint{}
+		rowIds = []any{}
 	)
 
 	groups.mutex.Lock()
@@ -228,11 +222,7 @@ func (groups *Groups) Write(db *Database) error {
 		return fmt.Errorf("groups.write %v", err)
 	}
 
-	q := "select `_id` from `rdioScannerGroups`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id from rdioScannerGroups"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerGroups`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -260,53 +250,37 @@ func (groups *Groups) Write(db *Database) error {
 	}
 
 	if len(rowIds) > 0 {
-		if b, err := json.Marshal(rowIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerGroups` where `_id` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerGroups where _id in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerGroups` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
 	for _, group := range groups.List {
-		q := "select count(*) from `rdioScannerGroups` where `_id` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerGroups where _id = $1"
-		}
-		if err = db.Sql.QueryRow(q, group.Id).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerGroups` where `_id` = ?", group.Id).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerGroups (label) values ($1)"
-				if _, err = db.Sql.Exec(q, group.Label); err != nil {
-					break
-				}
-			} else {
-				q := "insert into `rdioScannerGroups` (`_id`, `label`) values (?, ?)"
-				if _, err = db.Sql.Exec(q, group.Id, group.Label); err != nil {
-					break
-				}
+			query := db.NewQuery("insert into `rdioScannerGroups` (`label`", group.Label)
+			if group.Id != nil {
+				query.Append(", `_id`", group.Id)
+			}
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
 			}
 
 		} else {
-			q := "update `rdioScannerGroups` set `_id` = ?, `label` = ? where `_id` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerGroups set _id = $1, label = $2 where _id = $3"
-			}
-			if _, err = db.Sql.Exec(q, group.Id, group.Label, group.Id); err != nil {
+			if _, err = db.NewQuery("update `rdioScannerGroups` set `_id` = ?, `label` = ? where `_id` = ?", group.Id, group.Label, group.Id).Exec(); err != nil {
 				break
 			}
 		}
 	}
 
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerGroups"))
+	}
+
 	if err != nil {
 		return formatError(err)
 	}
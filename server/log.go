@@ -74,11 +74,8 @@ func (logs *Logs) LogEvent(level string, message string) error {
 			Message:  message,
 		}
 
-		q := "insert into `rdioScannerLogs` (`dateTime`, `level`, `message`) values (?, ?, ?)"
-		if logs.database.Config.DbType == DbTypePostgresql {
-			q = "insert into rdioScannerLogs (dateTime, level, message) values ($1, $2, $3)"
-		}
-		if _, err := logs.database.Sql.Exec(q, l.DateTime, l.Level, l.Message); err != nil {
+		query := logs.database.NewQuery("insert into `rdioScannerLogs` (`dateTime`, `level`, `message`) values (?, ?, ?)", l.DateTime, l.Level, l.Message)
+		if _, err := query.Exec(); err != nil {
 			return fmt.Errorf("logs.logevent: %v", err)
 		}
 	}
@@ -91,11 +88,7 @@ func (logs *Logs) Prune(db *Database, pruneDays uint) error {
 	defer logs.mutex.Unlock()
 
 	date := time.Now().Add(-24 * time.Hour * time.Duration(pruneDays)).Format(db.DateTimeFormat)
-	q := "delete from `rdioScannerLogs` where `dateTime` < ?"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "delete from rdioScannerLogs where dateTime < $1"
-	}
-	_, err := db.Sql.Exec(q, date)
+	_, err := db.NewQuery("delete from `rdioScannerLogs` where `dateTime` < ?", date).Exec()
 
 	return err
 }
@@ -113,9 +106,9 @@ func (logs *Logs) Search(searchOptions *LogsSearchOptions, db *Database) (*LogsS
 		limit    uint
 		offset   uint
 		order    string
-		query    string
+		query    *Query
 		rows     *sql.Rows
-		where    string = "true"
+		where    = db.NewQuery("true")
 	)
 
 	logs.mutex.Lock()
@@ -132,11 +125,7 @@ func (logs *Logs) Search(searchOptions *LogsSearchOptions, db *Database) (*LogsS
 
 	switch v := searchOptions.Level.(type) {
 	case string:
-		if db.Config.DbType == DbTypePostgresql {
-			where += fmt.Sprintf(" and level = '%v'", v)
-		} else {
-			where += fmt.Sprintf(" and `level` = '%v'", v)
-		}
+		where.Append(" and `level` = ?", v)
 	}
 
 	switch v := searchOptions.Sort.(type) {
@@ -167,11 +156,7 @@ func (logs *Logs) Search(searchOptions *LogsSearchOptions, db *Database) (*LogsS
 			stop = start.Add(time.Hour*24 - time.Millisecond - time.Duration(v.Hour())).Add(time.Minute * time.Duration(-v.Minute()))
 		}
 
-		if db.Config.DbType == DbTypePostgresql {
-			where += fmt.Sprintf(" and (dateTime between '%v' and '%v')", start.Format(df), stop.Format(df))
-		} else {
-			where += fmt.Sprintf(" and (`dateTime` between '%v' and '%v')", start.Format(df), stop.Format(df))
-		}
+		where.Append(" and (`dateTime` between ? and ?)", start.Format(df), stop.Format(df))
 	}
 
 	switch v := searchOptions.Limit.(type) {
@@ -186,11 +171,8 @@ func (logs *Logs) Search(searchOptions *LogsSearchOptions, db *Database) (*LogsS
 		offset = v
 	}
 
-	query = fmt.Sprintf("select `dateTime` from `rdioScannerLogs` where %v order by `dateTime` asc", where)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select dateTime from rdioScannerLogs where %v order by dateTime asc", where)
-	}
-	if err = db.Sql.QueryRow(query).Scan(&dateTime); err != nil && err != sql.ErrNoRows {
+	query = db.NewQuery("select `dateTime` from `rdioScannerLogs` where ").AppendQuery(where).Append(" order by `dateTime` asc limit 1")
+	if err = query.QueryRow().Scan(&dateTime); err != nil && err != sql.ErrNoRows {
 		return nil, formatError(fmt.Errorf("%v, %v", err, query))
 	}
 
@@ -198,11 +180,8 @@ func (logs *Logs) Search(searchOptions *LogsSearchOptions, db *Database) (*LogsS
 		logResults.DateStart = t
 	}
 
-	query = fmt.Sprintf("select `dateTime` from `rdioScannerLogs` where %v order by `dateTime` asc", where)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select dateTime from rdioScannerLogs where %v order by dateTime asc", where)
-	}
-	if err = db.Sql.QueryRow(query).Scan(&dateTime); err != nil && err != sql.ErrNoRows {
+	query = db.NewQuery("select `dateTime` from `rdioScannerLogs` where ").AppendQuery(where).Append(" order by `dateTime` desc limit 1")
+	if err = query.QueryRow().Scan(&dateTime); err != nil && err != sql.ErrNoRows {
 		return nil, formatError(fmt.Errorf("%v, %v", err, query))
 	}
 
@@ -210,19 +189,13 @@ func (logs *Logs) Search(searchOptions *LogsSearchOptions, db *Database) (*LogsS
 		logResults.DateStop = t
 	}
 
-	query = fmt.Sprintf("select count(*) from `rdioScannerLogs` where %v", where)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select count(*) from rdioScannerLogs where %v", where)
-	}
-	if err = db.Sql.QueryRow(query).Scan(&logResults.Count); err != nil && err != sql.ErrNoRows {
+	query = db.NewQuery("select count(*) from `rdioScannerLogs` where ").AppendQuery(where)
+	if err = query.QueryRow().Scan(&logResults.Count); err != nil && err != sql.ErrNoRows {
 		return nil, formatError(fmt.Errorf("%v, %v", err, query))
 	}
 
-	query = fmt.Sprintf("select `_id`, `DateTime`, `level`, `message` from `rdioScannerLogs` where %v order by `dateTime` %v limit %v offset %v", where, order, limit, offset)
-	if db.Config.DbType == DbTypePostgresql {
-		query = fmt.Sprintf("select _id, dateTime, level, message from rdioScannerLogs where %v order by dateTime %v limit %v offset %v", where, order, limit, offset)
-	}
-	if rows, err = db.Sql.Query(query); err != nil && err != sql.ErrNoRows {
+	query = db.NewQuery("select `_id`, `dateTime`, `level`, `message` from `rdioScannerLogs` where ").AppendQuery(where).Append(fmt.Sprintf(" order by `dateTime` %s limit ? offset ?", order), limit, offset)
+	if rows, err = query.Query(); err != nil && err != sql.ErrNoRows {
 		return nil, formatError(fmt.Errorf("%v, %v", err, query))
 	}
 
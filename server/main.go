@@ -91,6 +91,16 @@ func main() {
 		addr = defaultAddr
 	}
 
+	http.HandleFunc("/api/admin/alerts", controller.Admin.AlertsHandler)
+
+	http.HandleFunc("/api/admin/audio-migrate", controller.Admin.AudioMigrateHandler)
+
+	http.HandleFunc("/api/admin/call-original", controller.Admin.CallOriginalHandler)
+
+	http.HandleFunc("/api/admin/call-transcode", controller.Admin.CallTranscodeHandler)
+
+	http.HandleFunc("/api/admin/calls-reindex", controller.Admin.CallsReindexHandler)
+
 	http.HandleFunc("/api/admin/config", controller.Admin.ConfigHandler)
 
 	http.HandleFunc("/api/admin/login", controller.Admin.LoginHandler)
@@ -107,6 +117,10 @@ func main() {
 
 	http.HandleFunc("/api/call-upload", controller.Api.CallUploadHandler)
 
+	http.HandleFunc("/api/calls-export", controller.Api.CallsExportHandler)
+
+	http.HandleFunc("/api/calls-search", controller.Api.CallsSearchHandler)
+
 	http.HandleFunc("/api/trunk-recorder-call-upload", controller.Api.TrunkRecorderCallUploadHandler)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
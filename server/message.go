@@ -20,6 +20,7 @@ import (
 )
 
 const (
+	MessageCommandAlert          = "ALT"
 	MessageCommandCall           = "CAL"
 	MessageCommandConfig         = "CFG"
 	MessageCommandExpired        = "XPR"
@@ -31,6 +32,8 @@ const (
 	MessageCommandPin            = "PIN"
 	MessageCommandPushId         = "PID"
 	MessageCommandServer         = "SRV"
+	MessageCommandTone           = "TON"
+	MessageCommandTranscript     = "TRN"
 	MessageCommandVersion        = "VER"
 )
 
@@ -4,9 +4,35 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+var (
+	metricsFFMpegDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "rdio_scanner_ffmpeg_job_duration_seconds",
+		Help:    "Duration of the ffmpeg jobs.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+	metricsFFMpegJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rdio_scanner_ffmpeg_jobs_total",
+		Help: "Number of ffmpeg jobs by result (success, failure, timeout or stopped).",
+	}, []string{"result"})
+	metricsFFMpegRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rdio_scanner_ffmpeg_jobs_running",
+		Help: "Number of ffmpeg processes currently running.",
+	})
+	metricsFFMpegWaiting = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rdio_scanner_ffmpeg_jobs_waiting",
+		Help: "Number of ffmpeg jobs waiting for a worker.",
+	})
+	metricsConversionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rdio_scanner_audio_conversion_failures_total",
+		Help: "Number of calls whose audio conversion failed, by action taken (original or rejected).",
+	}, []string{"action"})
+)
+
 func CreateMetricsServer(config *Config) {
 	port := config.MetricsPort
 	if port != 0 {
@@ -0,0 +1,221 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIGRATION_STATUS_APPLIED  = "applied"
+	MIGRATION_STATUS_MODIFIED = "modified"
+	MIGRATION_STATUS_PENDING  = "pending"
+	MIGRATION_STATUS_UNKNOWN  = "unknown"
+)
+
+// Migration is a numbered change of the database schema. Its checksum covers
+// its schema queries, so that an applied migration which was modified since is
+// reported. The data queries, which depend on the existing rows, are not part
+// of it.
+type Migration struct {
+	Data    func() ([]string, error)
+	Name    string
+	Queries []string
+	Version uint64
+}
+
+func NewMigration(name string, queries []string) *Migration {
+	migration := &Migration{Name: name, Queries: queries}
+
+	if version, err := strconv.ParseUint(strings.SplitN(name, "-", 2)[0], 10, 64); err == nil {
+		migration.Version = version
+	}
+
+	return migration
+}
+
+func (migration *Migration) GetChecksum() string {
+	h := sha256.New()
+
+	for _, query := range migration.Queries {
+		h.Write([]byte(query))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type MigrationStatus struct {
+	AppliedAt any    `json:"appliedAt"`
+	Checksum  string `json:"checksum"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Version   uint64 `json:"version"`
+	migration *Migration
+}
+
+// MigrationsStatus compares the migrations applied to the database with the
+// ones known to this version. The current version is the one of the latest
+// migration applied, and the latest version the one of the latest migration
+// known.
+type MigrationsStatus struct {
+	Current uint64             `json:"current"`
+	Latest  uint64             `json:"latest"`
+	List    []*MigrationStatus `json:"list"`
+}
+
+func (status *MigrationsStatus) GetPending() []*Migration {
+	migrations := []*Migration{}
+
+	for _, entry := range status.List {
+		if entry.Status == MIGRATION_STATUS_PENDING {
+			migrations = append(migrations, entry.migration)
+		}
+	}
+
+	return migrations
+}
+
+// IsNewer tells if the database was migrated by a more recent version.
+func (status *MigrationsStatus) IsNewer() bool {
+	return status.Current > status.Latest
+}
+
+// IsValid tells if the database schema is the one expected by this version.
+// Unknown migrations older than the latest one are leftovers of previous
+// versions and are ignored.
+func (status *MigrationsStatus) IsValid() bool {
+	if status.IsNewer() {
+		return false
+	}
+
+	for _, entry := range status.List {
+		if entry.Status == MIGRATION_STATUS_MODIFIED || entry.Status == MIGRATION_STATUS_PENDING {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetMigrationsStatus reads the applied migrations without altering the
+// database, so that it can be checked by a version about to replace the one
+// running.
+func (db *Database) GetMigrationsStatus() (*MigrationsStatus, error) {
+	var (
+		applied = map[string]*MigrationStatus{}
+		err     error
+		names   = []string{}
+		rows    *sql.Rows
+	)
+
+	status := &MigrationsStatus{List: []*MigrationStatus{}}
+
+	queries := []*Query{
+		db.NewQuery("select `name`, `checksum`, `appliedAt` from `rdioScannerMeta`"),
+		db.NewQuery("select `name`, null, null from `rdioScannerMeta`"),
+		db.NewQuery("select `name`, null, null from `SequelizeMeta`"),
+	}
+
+	for _, query := range queries {
+		if rows, err = query.Query(); err == nil {
+			break
+		}
+	}
+
+	if err == nil {
+		for rows.Next() {
+			var (
+				appliedAt any
+				checksum  sql.NullString
+			)
+
+			entry := &MigrationStatus{Status: MIGRATION_STATUS_UNKNOWN}
+
+			if err = rows.Scan(&entry.Name, &checksum, &appliedAt); err != nil {
+				break
+			}
+
+			if checksum.Valid {
+				entry.Checksum = checksum.String
+			}
+
+			if t, err := db.ParseDateTime(appliedAt); err == nil {
+				entry.AppliedAt = t
+			}
+
+			entry.Version = NewMigration(entry.Name, nil).Version
+
+			applied[entry.Name] = entry
+			names = append(names, entry.Name)
+		}
+
+		rows.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, migration := range db.getMigrations() {
+		entry := applied[migration.Name]
+
+		if entry == nil {
+			entry = &MigrationStatus{Name: migration.Name, Status: MIGRATION_STATUS_PENDING, Version: migration.Version}
+
+		} else if len(entry.Checksum) > 0 && entry.Checksum != migration.GetChecksum() {
+			entry.Status = MIGRATION_STATUS_MODIFIED
+			delete(applied, migration.Name)
+
+		} else {
+			entry.Status = MIGRATION_STATUS_APPLIED
+			delete(applied, migration.Name)
+		}
+
+		entry.migration = migration
+
+		if migration.Version > status.Latest {
+			status.Latest = migration.Version
+		}
+
+		if entry.Status != MIGRATION_STATUS_PENDING && entry.Version > status.Current {
+			status.Current = entry.Version
+		}
+
+		status.List = append(status.List, entry)
+	}
+
+	for _, name := range names {
+		if entry, ok := applied[name]; ok {
+			if entry.Version > status.Current {
+				status.Current = entry.Version
+			}
+
+			status.List = append(status.List, entry)
+		}
+	}
+
+	sort.SliceStable(status.List, func(i int, j int) bool {
+		return status.List[i].Version < status.List[j].Version
+	})
+
+	return status, nil
+}
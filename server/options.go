@@ -20,33 +20,54 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
+	_ "time/tzdata"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Options struct {
-	AfsSystems                  string `json:"afsSystems"`
-	AudioConversion             uint   `json:"audioConversion"`
-	AudioBitrate                uint   `json:"audioBitrate"`
-	AutoPopulate                bool   `json:"autoPopulate"`
-	Branding                    string `json:"branding"`
-	DimmerDelay                 uint   `json:"dimmerDelay"`
-	DisableDuplicateDetection   bool   `json:"disableDuplicateDetection"`
-	DuplicateDetectionTimeFrame uint   `json:"duplicateDetectionTimeFrame"`
-	KeypadBeeps                 string `json:"keypadBeeps"`
-	MaxClients                  uint   `json:"maxClients"`
-	PlaybackGoesLive            bool   `json:"playbackGoesLive"`
-	PruneCallDays               uint   `json:"pruneCallDays"`
-	PruneLogDays                uint   `json:"pruneLogDays"`
-	SearchPatchedTalkgroups     bool   `json:"searchPatchedTalkgroups"`
-	ShowListenersCount          bool   `json:"showListenersCount"`
-	SortTalkgroups              bool   `json:"sortTalkgroups"`
-	TagsToggle                  bool   `json:"tagsToggle"`
-	Time12hFormat               bool   `json:"time12hFormat"`
-	adminPassword               string
-	adminPasswordNeedChange     bool
-	mutex                       sync.Mutex
-	secret                      string
+	AfsSystems                       string `json:"afsSystems"`
+	AudioConversion                  uint   `json:"audioConversion"`
+	AudioBitrate                     uint   `json:"audioBitrate"`
+	AudioConversionFailure           uint   `json:"audioConversionFailure"`
+	AutoPopulate                     bool   `json:"autoPopulate"`
+	BackupCalls                      bool   `json:"backupCalls"`
+	BackupInterval                   uint   `json:"backupInterval"`
+	BackupKeep                       uint   `json:"backupKeep"`
+	BackupLogs                       bool   `json:"backupLogs"`
+	BestCopyWindow                   uint   `json:"bestCopyWindow"`
+	Branding                         string `json:"branding"`
+	DimmerDelay                      uint   `json:"dimmerDelay"`
+	DisableDuplicateDetection        bool   `json:"disableDuplicateDetection"`
+	DuplicateDetectionMatchFrequency bool   `json:"duplicateDetectionMatchFrequency"`
+	DuplicateDetectionMatchSource    bool   `json:"duplicateDetectionMatchSource"`
+	DuplicateDetectionMode           uint   `json:"duplicateDetectionMode"`
+	DuplicateDetectionTimeFrame      uint   `json:"duplicateDetectionTimeFrame"`
+	FFMpegTimeout                    uint   `json:"ffmpegTimeout"`
+	FFMpegWorkers                    uint   `json:"ffmpegWorkers"`
+	KeepOriginalAudio                bool   `json:"keepOriginalAudio"`
+	KeypadBeeps                      string `json:"keypadBeeps"`
+	MaxClients                       uint   `json:"maxClients"`
+	PlaybackGoesLive                 bool   `json:"playbackGoesLive"`
+	PruneCallDays                    uint   `json:"pruneCallDays"`
+	PruneLogDays                     uint   `json:"pruneLogDays"`
+	SearchPatchedTalkgroups          bool   `json:"searchPatchedTalkgroups"`
+	ShowListenersCount               bool   `json:"showListenersCount"`
+	SortTalkgroups                   bool   `json:"sortTalkgroups"`
+	TagsToggle                       bool   `json:"tagsToggle"`
+	Time12hFormat                    bool   `json:"time12hFormat"`
+	TimeZone                         string `json:"timeZone"`
+	TranscriptionApiKey              string `json:"transcriptionApiKey"`
+	TranscriptionBackend             string `json:"transcriptionBackend"`
+	TranscriptionLanguage            string `json:"transcriptionLanguage"`
+	TranscriptionModel               string `json:"transcriptionModel"`
+	TranscriptionUrl                 string `json:"transcriptionUrl"`
+	adminPassword                    string
+	adminPasswordNeedChange          bool
+	location                         *time.Location
+	mutex                            sync.Mutex
+	secret                           string
 }
 
 const (
@@ -54,6 +75,12 @@ const (
 	AUDIO_CONVERSION_ENABLED           = 1
 	AUDIO_CONVERSION_ENABLED_NORM      = 2
 	AUDIO_CONVERSION_ENABLED_LOUD_NORM = 3
+
+	AUDIO_CONVERSION_FAILURE_KEEP_ORIGINAL = 0
+	AUDIO_CONVERSION_FAILURE_REJECT        = 1
+
+	DUPLICATE_DETECTION_MODE_TIME        = 0
+	DUPLICATE_DETECTION_MODE_FINGERPRINT = 1
 )
 
 func NewOptions() *Options {
@@ -93,6 +120,13 @@ func (options *Options) FromMap(m map[string]any) *Options {
 		options.AudioBitrate = 6
 	}
 
+	switch v := m["audioConversionFailure"].(type) {
+	case float64:
+		options.AudioConversionFailure = uint(v)
+	default:
+		options.AudioConversionFailure = defaults.options.audioConversionFailure
+	}
+
 	switch v := m["autoPopulate"].(type) {
 	case bool:
 		options.AutoPopulate = v
@@ -100,6 +134,41 @@ func (options *Options) FromMap(m map[string]any) *Options {
 		options.AutoPopulate = defaults.options.autoPopulate
 	}
 
+	switch v := m["backupCalls"].(type) {
+	case bool:
+		options.BackupCalls = v
+	default:
+		options.BackupCalls = defaults.options.backupCalls
+	}
+
+	switch v := m["backupInterval"].(type) {
+	case float64:
+		options.BackupInterval = uint(v)
+	default:
+		options.BackupInterval = defaults.options.backupInterval
+	}
+
+	switch v := m["backupKeep"].(type) {
+	case float64:
+		options.BackupKeep = uint(v)
+	default:
+		options.BackupKeep = defaults.options.backupKeep
+	}
+
+	switch v := m["backupLogs"].(type) {
+	case bool:
+		options.BackupLogs = v
+	default:
+		options.BackupLogs = defaults.options.backupLogs
+	}
+
+	switch v := m["bestCopyWindow"].(type) {
+	case float64:
+		options.BestCopyWindow = uint(v)
+	default:
+		options.BestCopyWindow = defaults.options.bestCopyWindow
+	}
+
 	switch v := m["branding"].(type) {
 	case string:
 		options.Branding = v
@@ -128,6 +197,27 @@ func (options *Options) FromMap(m map[string]any) *Options {
 		options.DisableDuplicateDetection = defaults.options.disableDuplicateDetection
 	}
 
+	switch v := m["duplicateDetectionMatchFrequency"].(type) {
+	case bool:
+		options.DuplicateDetectionMatchFrequency = v
+	default:
+		options.DuplicateDetectionMatchFrequency = defaults.options.duplicateDetectionMatchFrequency
+	}
+
+	switch v := m["duplicateDetectionMatchSource"].(type) {
+	case bool:
+		options.DuplicateDetectionMatchSource = v
+	default:
+		options.DuplicateDetectionMatchSource = defaults.options.duplicateDetectionMatchSource
+	}
+
+	switch v := m["duplicateDetectionMode"].(type) {
+	case float64:
+		options.DuplicateDetectionMode = uint(v)
+	default:
+		options.DuplicateDetectionMode = defaults.options.duplicateDetectionMode
+	}
+
 	switch v := m["duplicateDetectionTimeFrame"].(type) {
 	case float64:
 		options.DuplicateDetectionTimeFrame = uint(v)
@@ -135,6 +225,27 @@ func (options *Options) FromMap(m map[string]any) *Options {
 		options.DuplicateDetectionTimeFrame = defaults.options.duplicateDetectionTimeFrame
 	}
 
+	switch v := m["ffmpegTimeout"].(type) {
+	case float64:
+		options.FFMpegTimeout = uint(v)
+	default:
+		options.FFMpegTimeout = defaults.options.ffmpegTimeout
+	}
+
+	switch v := m["ffmpegWorkers"].(type) {
+	case float64:
+		options.FFMpegWorkers = uint(v)
+	default:
+		options.FFMpegWorkers = defaults.options.ffmpegWorkers
+	}
+
+	switch v := m["keepOriginalAudio"].(type) {
+	case bool:
+		options.KeepOriginalAudio = v
+	default:
+		options.KeepOriginalAudio = defaults.options.keepOriginalAudio
+	}
+
 	switch v := m["keypadBeeps"].(type) {
 	case string:
 		options.KeypadBeeps = v
@@ -203,9 +314,63 @@ func (options *Options) FromMap(m map[string]any) *Options {
 		options.Time12hFormat = defaults.options.time12hFormat
 	}
 
+	switch v := m["timeZone"].(type) {
+	case string:
+		options.TimeZone = v
+	default:
+		options.TimeZone = defaults.options.timeZone
+	}
+
+	options.location, _ = loadLocation(options.TimeZone)
+
+	switch v := m["transcriptionApiKey"].(type) {
+	case string:
+		options.TranscriptionApiKey = v
+	default:
+		options.TranscriptionApiKey = defaults.options.transcriptionApiKey
+	}
+
+	switch v := m["transcriptionBackend"].(type) {
+	case string:
+		options.TranscriptionBackend = v
+	default:
+		options.TranscriptionBackend = defaults.options.transcriptionBackend
+	}
+
+	switch v := m["transcriptionLanguage"].(type) {
+	case string:
+		options.TranscriptionLanguage = v
+	default:
+		options.TranscriptionLanguage = defaults.options.transcriptionLanguage
+	}
+
+	switch v := m["transcriptionModel"].(type) {
+	case string:
+		options.TranscriptionModel = v
+	default:
+		options.TranscriptionModel = defaults.options.transcriptionModel
+	}
+
+	switch v := m["transcriptionUrl"].(type) {
+	case string:
+		options.TranscriptionUrl = v
+	default:
+		options.TranscriptionUrl = defaults.options.transcriptionUrl
+	}
+
 	return options
 }
 
+// GetLocation returns the time zone in which recorder time stamps without an
+// offset are read, which is the server time zone unless configured otherwise.
+func (options *Options) GetLocation() *time.Location {
+	if options.location != nil {
+		return options.location
+	}
+
+	return time.Local
+}
+
 func (options *Options) Read(db *Database) error {
 	var (
 		defaultPassword []byte
@@ -222,10 +387,22 @@ func (options *Options) Read(db *Database) error {
 	options.adminPasswordNeedChange = defaults.adminPasswordNeedChange
 	options.AudioConversion = defaults.options.audioConversion
 	options.AudioBitrate = defaults.options.audioBitrate
+	options.AudioConversionFailure = defaults.options.audioConversionFailure
 	options.AutoPopulate = defaults.options.autoPopulate
+	options.BackupCalls = defaults.options.backupCalls
+	options.BackupInterval = defaults.options.backupInterval
+	options.BackupKeep = defaults.options.backupKeep
+	options.BackupLogs = defaults.options.backupLogs
+	options.BestCopyWindow = defaults.options.bestCopyWindow
 	options.DimmerDelay = defaults.options.dimmerDelay
 	options.DisableDuplicateDetection = defaults.options.disableDuplicateDetection
+	options.DuplicateDetectionMatchFrequency = defaults.options.duplicateDetectionMatchFrequency
+	options.DuplicateDetectionMatchSource = defaults.options.duplicateDetectionMatchSource
+	options.DuplicateDetectionMode = defaults.options.duplicateDetectionMode
 	options.DuplicateDetectionTimeFrame = defaults.options.duplicateDetectionTimeFrame
+	options.FFMpegTimeout = defaults.options.ffmpegTimeout
+	options.FFMpegWorkers = defaults.options.ffmpegWorkers
+	options.KeepOriginalAudio = defaults.options.keepOriginalAudio
 	options.KeypadBeeps = defaults.options.keypadBeeps
 	options.MaxClients = defaults.options.maxClients
 	options.PlaybackGoesLive = defaults.options.playbackGoesLive
@@ -235,23 +412,21 @@ func (options *Options) Read(db *Database) error {
 	options.ShowListenersCount = defaults.options.showListenersCount
 	options.SortTalkgroups = defaults.options.sortTalkgroups
 	options.TagsToggle = defaults.options.tagsToggle
-
-	q := "select `val` from `rdioScannerConfigs` where `key` = 'adminPassword'"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select val from rdioScannerConfigs where key = 'adminPassword'"
-	}
-	err = db.Sql.QueryRow(q).Scan(&s)
+	options.TimeZone = defaults.options.timeZone
+	options.TranscriptionApiKey = defaults.options.transcriptionApiKey
+	options.TranscriptionBackend = defaults.options.transcriptionBackend
+	options.TranscriptionLanguage = defaults.options.transcriptionLanguage
+	options.TranscriptionModel = defaults.options.transcriptionModel
+	options.TranscriptionUrl = defaults.options.transcriptionUrl
+
+	err = db.NewQuery("select `val` from `rdioScannerConfigs` where `key` = ?", "adminPassword").QueryRow().Scan(&s)
 	if err == nil {
 		if err = json.Unmarshal([]byte(s), &s); err == nil {
 			options.adminPassword = s
 		}
 	}
 
-	q = "select `val` from `rdioScannerConfigs` where `key` = 'adminPasswordNeedChange'"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select val from rdioScannerConfigs where key = 'adminPasswordNeedChange'"
-	}
-	err = db.Sql.QueryRow(q).Scan(&s)
+	err = db.NewQuery("select `val` from `rdioScannerConfigs` where `key` = ?", "adminPasswordNeedChange").QueryRow().Scan(&s)
 	if err == nil {
 		var b bool
 		if err = json.Unmarshal([]byte(s), &b); err == nil {
@@ -259,11 +434,7 @@ func (options *Options) Read(db *Database) error {
 		}
 	}
 
-	q = "select `val` from `rdioScannerConfigs` where `key` = 'options'"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select val from rdioScannerConfigs where key = 'options'"
-	}
-	err = db.Sql.QueryRow(q).Scan(&s)
+	err = db.NewQuery("select `val` from `rdioScannerConfigs` where `key` = ?", "options").QueryRow().Scan(&s)
 	if err == nil {
 		var m map[string]any
 
@@ -285,11 +456,41 @@ func (options *Options) Read(db *Database) error {
 				options.AudioBitrate = uint(v)
 			}
 
+			switch v := m["audioConversionFailure"].(type) {
+			case float64:
+				options.AudioConversionFailure = uint(v)
+			}
+
 			switch v := m["autoPopulate"].(type) {
 			case bool:
 				options.AutoPopulate = v
 			}
 
+			switch v := m["backupCalls"].(type) {
+			case bool:
+				options.BackupCalls = v
+			}
+
+			switch v := m["backupInterval"].(type) {
+			case float64:
+				options.BackupInterval = uint(v)
+			}
+
+			switch v := m["backupKeep"].(type) {
+			case float64:
+				options.BackupKeep = uint(v)
+			}
+
+			switch v := m["backupLogs"].(type) {
+			case bool:
+				options.BackupLogs = v
+			}
+
+			switch v := m["bestCopyWindow"].(type) {
+			case float64:
+				options.BestCopyWindow = uint(v)
+			}
+
 			switch v := m["branding"].(type) {
 			case string:
 				options.Branding = v
@@ -305,11 +506,41 @@ func (options *Options) Read(db *Database) error {
 				options.DisableDuplicateDetection = v
 			}
 
+			switch v := m["duplicateDetectionMatchFrequency"].(type) {
+			case bool:
+				options.DuplicateDetectionMatchFrequency = v
+			}
+
+			switch v := m["duplicateDetectionMatchSource"].(type) {
+			case bool:
+				options.DuplicateDetectionMatchSource = v
+			}
+
+			switch v := m["duplicateDetectionMode"].(type) {
+			case float64:
+				options.DuplicateDetectionMode = uint(v)
+			}
+
 			switch v := m["duplicateDetectionTimeFrame"].(type) {
 			case float64:
 				options.DuplicateDetectionTimeFrame = uint(v)
 			}
 
+			switch v := m["ffmpegTimeout"].(type) {
+			case float64:
+				options.FFMpegTimeout = uint(v)
+			}
+
+			switch v := m["ffmpegWorkers"].(type) {
+			case float64:
+				options.FFMpegWorkers = uint(v)
+			}
+
+			switch v := m["keepOriginalAudio"].(type) {
+			case bool:
+				options.KeepOriginalAudio = v
+			}
+
 			switch v := m["keypadBeeps"].(type) {
 			case string:
 				options.KeypadBeeps = v
@@ -359,14 +590,42 @@ func (options *Options) Read(db *Database) error {
 			case bool:
 				options.Time12hFormat = v
 			}
+
+			switch v := m["timeZone"].(type) {
+			case string:
+				options.TimeZone = v
+			}
+
+			switch v := m["transcriptionApiKey"].(type) {
+			case string:
+				options.TranscriptionApiKey = v
+			}
+
+			switch v := m["transcriptionBackend"].(type) {
+			case string:
+				options.TranscriptionBackend = v
+			}
+
+			switch v := m["transcriptionLanguage"].(type) {
+			case string:
+				options.TranscriptionLanguage = v
+			}
+
+			switch v := m["transcriptionModel"].(type) {
+			case string:
+				options.TranscriptionModel = v
+			}
+
+			switch v := m["transcriptionUrl"].(type) {
+			case string:
+				options.TranscriptionUrl = v
+			}
 		}
 	}
 
-	q = "select `val` from `rdioScannerConfigs` where `key` = 'secret'"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select val from rdioScannerConfigs where key = 'secret'"
-	}
-	err = db.Sql.QueryRow(q).Scan(&s)
+	options.location, _ = loadLocation(options.TimeZone)
+
+	err = db.NewQuery("select `val` from `rdioScannerConfigs` where `key` = ?", "secret").QueryRow().Scan(&s)
 	if err == nil {
 		if err = json.Unmarshal([]byte(s), &s); err == nil {
 			options.secret = s
@@ -395,80 +654,88 @@ func (options *Options) Write(db *Database) error {
 		return formatError(err)
 	}
 
-	q := "update `rdioScannerConfigs` set `val` = ? where `key` = 'adminPassword'"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "update rdioScannerConfigs set val = $1 where key = 'adminPassword'"
-	}
-	if res, err = db.Sql.Exec(q, string(b)); err != nil {
+	if res, err = db.NewQuery("update `rdioScannerConfigs` set `val` = ? where `key` = ?", string(b), "adminPassword").Exec(); err != nil {
 		return formatError(err)
 	}
 
 	if i, err = res.RowsAffected(); err == nil && i == 0 {
-		q = "insert into `rdioScannerConfigs` (`key`, `val`) values (?, ?)"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "insert into rdioScannerConfigs (key, val) values ($1, $2)"
-		}
-		db.Sql.Exec(q, "adminPassword", string(b))
+		db.NewQuery("insert into `rdioScannerConfigs` (`key`, `val`) values (?, ?)", "adminPassword", string(b)).Exec()
 	}
 
 	if b, err = json.Marshal(options.adminPasswordNeedChange); err != nil {
 		return formatError(err)
 	}
 
-	q = "update `rdioScannerConfigs` set `val` = ? where `key` = 'adminPasswordNeedChange'"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "update rdioScannerConfigs set val = $1 where key = 'adminPasswordNeedChange'"
-	}
-	if res, err = db.Sql.Exec(q, string(b)); err != nil {
+	if res, err = db.NewQuery("update `rdioScannerConfigs` set `val` = ? where `key` = ?", string(b), "adminPasswordNeedChange").Exec(); err != nil {
 		return formatError(err)
 	}
 
 	if i, err = res.RowsAffected(); err == nil && i == 0 {
-		q = "insert into `rdioScannerConfigs` (`key`, `val`) values (?, ?)"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "insert into rdioScannerConfigs (key, val) values ($1, $2)"
-		}
-		db.Sql.Exec(q, "adminPasswordNeedChange", string(b))
+		db.NewQuery("insert into `rdioScannerConfigs` (`key`, `val`) values (?, ?)", "adminPasswordNeedChange", string(b)).Exec()
 	}
 
 	if b, err = json.Marshal(map[string]any{
-		"afsSystems":                  options.AfsSystems,
-		"audioConversion":             options.AudioConversion,
-		"audioBitrate":                options.AudioBitrate,
-		"autoPopulate":                options.AutoPopulate,
-		"branding":                    options.Branding,
-		"dimmerDelay":                 options.DimmerDelay,
-		"disableDuplicateDetection":   options.DisableDuplicateDetection,
-		"duplicateDetectionTimeFrame": options.DuplicateDetectionTimeFrame,
-		"keypadBeeps":                 options.KeypadBeeps,
-		"maxClients":                  options.MaxClients,
-		"playbackGoesLive":            options.PlaybackGoesLive,
-		"pruneLogDays":                options.PruneLogDays,
-		"pruneCallDays":               options.PruneCallDays,
-		"searchPatchedTalkgroups":     options.SearchPatchedTalkgroups,
-		"showListenersCount":          options.ShowListenersCount,
-		"sortTalkgroups":              options.SortTalkgroups,
-		"tagsToggle":                  options.TagsToggle,
-		"time12hFormat":               options.Time12hFormat,
+		"afsSystems":                       options.AfsSystems,
+		"audioConversion":                  options.AudioConversion,
+		"audioBitrate":                     options.AudioBitrate,
+		"audioConversionFailure":           options.AudioConversionFailure,
+		"autoPopulate":                     options.AutoPopulate,
+		"backupCalls":                      options.BackupCalls,
+		"backupInterval":                   options.BackupInterval,
+		"backupKeep":                       options.BackupKeep,
+		"backupLogs":                       options.BackupLogs,
+		"bestCopyWindow":                   options.BestCopyWindow,
+		"branding":                         options.Branding,
+		"dimmerDelay":                      options.DimmerDelay,
+		"disableDuplicateDetection":        options.DisableDuplicateDetection,
+		"duplicateDetectionMatchFrequency": options.DuplicateDetectionMatchFrequency,
+		"duplicateDetectionMatchSource":    options.DuplicateDetectionMatchSource,
+		"duplicateDetectionMode":           options.DuplicateDetectionMode,
+		"duplicateDetectionTimeFrame":      options.DuplicateDetectionTimeFrame,
+		"ffmpegTimeout":                    options.FFMpegTimeout,
+		"ffmpegWorkers":                    options.FFMpegWorkers,
+		"keepOriginalAudio":                options.KeepOriginalAudio,
+		"keypadBeeps":                      options.KeypadBeeps,
+		"maxClients":                       options.MaxClients,
+		"playbackGoesLive":                 options.PlaybackGoesLive,
+		"pruneLogDays":                     options.PruneLogDays,
+		"pruneCallDays":                    options.PruneCallDays,
+		"searchPatchedTalkgroups":          options.SearchPatchedTalkgroups,
+		"showListenersCount":               options.ShowListenersCount,
+		"sortTalkgroups":                   options.SortTalkgroups,
+		"tagsToggle":                       options.TagsToggle,
+		"time12hFormat":                    options.Time12hFormat,
+		"timeZone":                         options.TimeZone,
+		"transcriptionApiKey":              options.TranscriptionApiKey,
+		"transcriptionBackend":             options.TranscriptionBackend,
+		"transcriptionLanguage":            options.TranscriptionLanguage,
+		"transcriptionModel":               options.TranscriptionModel,
+		"transcriptionUrl":                 options.TranscriptionUrl,
 	}); err != nil {
 		return formatError(err)
 	}
 
-	q = "update `rdioScannerConfigs` set `val` = ? where `key` = 'options'"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "update rdioScannerConfigs set val = $1 where key = 'options'"
-	}
-	if res, err = db.Sql.Exec(q, string(b)); err != nil {
+	if res, err = db.NewQuery("update `rdioScannerConfigs` set `val` = ? where `key` = ?", string(b), "options").Exec(); err != nil {
 		return formatError(err)
 	}
 
 	if i, err = res.RowsAffected(); err == nil && i == 0 {
-		q := "insert into `rdioScannerConfigs` (`key`, `val`) values (?, ?)"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "insert into rdioScannerConfigs (key, val) values ($1, $2)"
-		}
-		db.Sql.Exec(q, "options", string(b))
+		db.NewQuery("insert into `rdioScannerConfigs` (`key`, `val`) values (?, ?)", "options", string(b)).Exec()
 	}
 
 	return nil
 }
+
+// loadLocation returns the time zone named by a config value, or nil when
+// none is configured. The time zones are resolved when the config is loaded,
+// the invalid ones being refused by the admin config handler.
+func loadLocation(f any) (*time.Location, error) {
+	switch v := f.(type) {
+	case string:
+		if len(v) > 0 {
+			return time.LoadLocation(v)
+		}
+	}
+
+	return nil, nil
+}
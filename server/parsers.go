@@ -31,7 +31,7 @@ import (
 	"github.com/dhowden/tag"
 )
 
-func ParseDSDPlusMeta(call *Call, fp string) error {
+func ParseDSDPlusMeta(call *Call, fp string, loc *time.Location) error {
 	dir := filepath.Dir(fp)
 	base := strings.TrimSuffix(filepath.Base(fp), filepath.Ext(fp))
 	meta := []string{""}
@@ -60,7 +60,7 @@ func ParseDSDPlusMeta(call *Call, fp string) error {
 						if th, err := strconv.Atoi(t[1][0:2]); err == nil {
 							if tm, err := strconv.Atoi(t[1][2:4]); err == nil {
 								if ts, err := strconv.Atoi(t[1][4:6]); err == nil {
-									call.DateTime = time.Date(dy, time.Month(dm), dd, th, tm, ts, 0, time.Now().Location()).UTC()
+									call.DateTime = time.Date(dy, time.Month(dm), dd, th, tm, ts, 0, loc).UTC()
 								}
 							}
 						}
@@ -132,7 +132,7 @@ func ParseDSDPlusMeta(call *Call, fp string) error {
 	return nil
 }
 
-func ParseSdrTrunkMeta(call *Call, controller *Controller) error {
+func ParseSdrTrunkMeta(call *Call, controller *Controller, loc *time.Location) error {
 	var (
 		s   []string
 		err error
@@ -167,7 +167,7 @@ func ParseSdrTrunkMeta(call *Call, controller *Controller) error {
 
 	s = regexp.MustCompile(`Date:([^;]+);`).FindStringSubmatch(m.Comment())
 	if len(s) == 2 {
-		if t, err = time.ParseInLocation("2006-01-02 15:04:05.999", s[1], time.Now().Location()); err != nil {
+		if t, err = time.ParseInLocation("2006-01-02 15:04:05.999", s[1], loc); err != nil {
 			return err
 		}
 		call.DateTime = t.UTC()
@@ -234,7 +234,9 @@ func ParseSdrTrunkMeta(call *Call, controller *Controller) error {
 	return nil
 }
 
-func ParseMultipartContent(call *Call, p *multipart.Part, b []byte) {
+// ParseMultipartContent reads one part of a call upload. A dateTime sent
+// without an offset is read in loc.
+func ParseMultipartContent(call *Call, p *multipart.Part, b []byte, loc *time.Location) {
 	switch p.FormName() {
 	case "audio":
 		call.Audio = b
@@ -249,9 +251,10 @@ func ParseMultipartContent(call *Call, p *multipart.Part, b []byte) {
 			if i, err := strconv.Atoi(string(b)); err == nil {
 				call.DateTime = time.Unix(int64(i), 0).UTC()
 			}
-		} else {
-			call.DateTime, _ = time.Parse(time.RFC3339, string(b))
-			call.DateTime = call.DateTime.UTC()
+		} else if t, err := time.Parse(time.RFC3339, string(b)); err == nil {
+			call.DateTime = t.UTC()
+		} else if t, err := time.ParseInLocation("2006-01-02T15:04:05", strings.Replace(string(b), " ", "T", 1), loc); err == nil {
+			call.DateTime = t.UTC()
 		}
 
 	case "frequencies":
@@ -406,6 +409,14 @@ func ParseMultipartContent(call *Call, p *multipart.Part, b []byte) {
 		if s := string(b); len(s) > 0 && s != "-" {
 			call.talkgroupTag = s
 		}
+
+	case "transcript":
+		transcript := &Transcript{}
+		if err := json.Unmarshal(b, transcript); err == nil {
+			call.Transcript = transcript
+		} else if s := strings.TrimSpace(string(b)); len(s) > 0 {
+			call.Transcript = &Transcript{Text: s}
+		}
 	}
 }
 
@@ -0,0 +1,374 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+const (
+	ProfileCodecAac  = "aac"
+	ProfileCodecMp3  = "mp3"
+	ProfileCodecOpus = "opus"
+
+	ProfileContainerAdts = "adts"
+	ProfileContainerM4a  = "m4a"
+	ProfileContainerMp3  = "mp3"
+	ProfileContainerOgg  = "ogg"
+)
+
+// Profile is a named ffmpeg encoding profile which can be assigned to a system
+// or a talkgroup. Calls without a profile are encoded with the global options.
+type Profile struct {
+	Id         any    `json:"_id"`
+	Bitrate    any    `json:"bitrate"`
+	Channels   any    `json:"channels"`
+	Codec      string `json:"codec"`
+	Container  any    `json:"container"`
+	Filters    any    `json:"filters"`
+	Label      string `json:"label"`
+	Order      any    `json:"order"`
+	SampleRate any    `json:"sampleRate"`
+}
+
+func NewProfile() *Profile {
+	return &Profile{Codec: ProfileCodecOpus}
+}
+
+func (profile *Profile) FromMap(m map[string]any) *Profile {
+	switch v := m["_id"].(type) {
+	case float64:
+		profile.Id = uint(v)
+	}
+
+	switch v := m["bitrate"].(type) {
+	case float64:
+		profile.Bitrate = uint(v)
+	}
+
+	switch v := m["channels"].(type) {
+	case float64:
+		profile.Channels = uint(v)
+	}
+
+	switch v := m["codec"].(type) {
+	case string:
+		profile.Codec = v
+	}
+
+	switch v := m["container"].(type) {
+	case string:
+		profile.Container = v
+	}
+
+	switch v := m["filters"].(type) {
+	case string:
+		profile.Filters = v
+	}
+
+	switch v := m["label"].(type) {
+	case string:
+		profile.Label = v
+	}
+
+	switch v := m["order"].(type) {
+	case float64:
+		profile.Order = uint(v)
+	}
+
+	switch v := m["sampleRate"].(type) {
+	case float64:
+		profile.SampleRate = uint(v)
+	}
+
+	return profile
+}
+
+// GetEncoderArgs returns the ffmpeg output arguments of the profile along with
+// the mime type and file extension of the resulting audio.
+func (profile *Profile) GetEncoderArgs() (args []string, audioType string, ext string) {
+	var container string
+
+	switch v := profile.Container.(type) {
+	case string:
+		container = v
+	}
+
+	switch profile.Codec {
+	case ProfileCodecAac:
+		args = []string{"-c:a", "aac"}
+		if container == ProfileContainerAdts {
+			args = append(args, "-f", "adts")
+			audioType, ext = "audio/aac", ".aac"
+		} else {
+			args = append(args, "-movflags", "+frag_keyframe+empty_moov+default_base_moof", "-f", "ipod")
+			audioType, ext = "audio/mp4", ".m4a"
+		}
+
+	case ProfileCodecMp3:
+		args = []string{"-c:a", "libmp3lame", "-f", "mp3"}
+		audioType, ext = "audio/mpeg", ".mp3"
+
+	default:
+		args = []string{"-c:a", "libopus", "-vbr", "on", "-compression_level", "10", "-f", "opus"}
+		audioType, ext = "application/ogg", ".opus"
+	}
+
+	switch v := profile.Bitrate.(type) {
+	case uint:
+		if v > 0 {
+			args = append(args, "-b:a", fmt.Sprintf("%dk", v))
+		}
+	}
+
+	switch v := profile.SampleRate.(type) {
+	case uint:
+		if v > 0 {
+			args = append(args, "-ar", fmt.Sprintf("%d", v))
+		}
+	}
+
+	switch v := profile.Channels.(type) {
+	case uint:
+		if v > 0 {
+			args = append(args, "-ac", fmt.Sprintf("%d", v))
+		}
+	}
+
+	return args, audioType, ext
+}
+
+type Profiles struct {
+	List  []*Profile
+	mutex sync.Mutex
+}
+
+func NewProfiles() *Profiles {
+	return &Profiles{
+		List:  []*Profile{},
+		mutex: sync.Mutex{},
+	}
+}
+
+func (profiles *Profiles) FromMap(f []any) *Profiles {
+	profiles.mutex.Lock()
+	defer profiles.mutex.Unlock()
+
+	profiles.List = []*Profile{}
+
+	for _, r := range f {
+		switch m := r.(type) {
+		case map[string]any:
+			profile := NewProfile().FromMap(m)
+			profiles.List = append(profiles.List, profile)
+		}
+	}
+
+	return profiles
+}
+
+func (profiles *Profiles) GetProfile(f any) (profile *Profile, ok bool) {
+	profiles.mutex.Lock()
+	defer profiles.mutex.Unlock()
+
+	switch v := f.(type) {
+	case uint:
+		for _, profile := range profiles.List {
+			if profile.Id == v {
+				return profile, true
+			}
+		}
+	case string:
+		for _, profile := range profiles.List {
+			if profile.Label == v {
+				return profile, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// GetCallProfile returns the profile of the call talkgroup, or else the one of
+// its system.
+func (profiles *Profiles) GetCallProfile(call *Call, systems *Systems) (profile *Profile, ok bool) {
+	if system, ok := systems.GetSystem(call.System); ok {
+		if talkgroup, ok := system.Talkgroups.GetTalkgroup(call.Talkgroup); ok {
+			if profile, ok := profiles.GetProfile(talkgroup.ProfileId); ok {
+				return profile, true
+			}
+		}
+
+		return profiles.GetProfile(system.ProfileId)
+	}
+
+	return nil, false
+}
+
+func (profiles *Profiles) Read(db *Database) error {
+	var (
+		bitrate    sql.NullFloat64
+		channels   sql.NullFloat64
+		container  sql.NullString
+		err        error
+		filters    sql.NullString
+		id         sql.NullFloat64
+		order      sql.NullFloat64
+		rows       *sql.Rows
+		sampleRate sql.NullFloat64
+	)
+
+	profiles.mutex.Lock()
+	defer profiles.mutex.Unlock()
+
+	profiles.List = []*Profile{}
+
+	formatError := func(err error) error {
+		return fmt.Errorf("profiles.read: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id`, `bitrate`, `channels`, `codec`, `container`, `filters`, `label`, `order`, `sampleRate` from `rdioScannerProfiles`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		profile := NewProfile()
+
+		if err = rows.Scan(&id, &bitrate, &channels, &profile.Codec, &container, &filters, &profile.Label, &order, &sampleRate); err != nil {
+			break
+		}
+
+		if id.Valid && id.Float64 > 0 {
+			profile.Id = uint(id.Float64)
+		}
+
+		if bitrate.Valid && bitrate.Float64 > 0 {
+			profile.Bitrate = uint(bitrate.Float64)
+		}
+
+		if channels.Valid && channels.Float64 > 0 {
+			profile.Channels = uint(channels.Float64)
+		}
+
+		if container.Valid && len(container.String) > 0 {
+			profile.Container = container.String
+		}
+
+		if filters.Valid && len(filters.String) > 0 {
+			profile.Filters = filters.String
+		}
+
+		if order.Valid && order.Float64 > 0 {
+			profile.Order = uint(order.Float64)
+		}
+
+		if sampleRate.Valid && sampleRate.Float64 > 0 {
+			profile.SampleRate = uint(sampleRate.Float64)
+		}
+
+		profiles.List = append(profiles.List, profile)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+func (profiles *Profiles) Write(db *Database) error {
+	var (
+		count  uint
+		err    error
+		rows   *sql.Rows
+		rowIds = []any{}
+	)
+
+	profiles.mutex.Lock()
+	defer profiles.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("profiles.write: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerProfiles`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		var rowId uint
+		if err = rows.Scan(&rowId); err != nil {
+			break
+		}
+		remove := true
+		for _, profile := range profiles.List {
+			if profile.Id == nil || profile.Id == rowId {
+				remove = false
+				break
+			}
+		}
+		if remove {
+			rowIds = append(rowIds, rowId)
+		}
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	if len(rowIds) > 0 {
+		if _, err = db.NewQuery("delete from `rdioScannerProfiles` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
+		}
+	}
+
+	for _, profile := range profiles.List {
+		if err = db.NewQuery("select count(*) from `rdioScannerProfiles` where `_id` = ?", profile.Id).QueryRow().Scan(&count); err != nil {
+			break
+		}
+
+		if count == 0 {
+			query := db.NewQuery("insert into `rdioScannerProfiles` (`bitrate`, `channels`, `codec`, `container`, `filters`, `label`, `order`, `sampleRate`", profile.Bitrate, profile.Channels, profile.Codec, profile.Container, profile.Filters, profile.Label, profile.Order, profile.SampleRate)
+			if profile.Id != nil {
+				query.Append(", `_id`", profile.Id)
+			}
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
+			}
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerProfiles` set `_id` = ?, `bitrate` = ?, `channels` = ?, `codec` = ?, `container` = ?, `filters` = ?, `label` = ?, `order` = ?, `sampleRate` = ? where `_id` = ?", profile.Id, profile.Bitrate, profile.Channels, profile.Codec, profile.Container, profile.Filters, profile.Label, profile.Order, profile.SampleRate, profile.Id).Exec(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerProfiles"))
+	}
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// postgresQuotedIdentifiers are the reserved words of postgres which were
+// quoted when their columns were created.
+var postgresQuotedIdentifiers = map[string]bool{
+	"interval": true,
+	"limit":    true,
+	"order":    true,
+}
+
+// Query is a sql statement along with its arguments. It is written with the
+// identifiers between backticks and ? as placeholders, as for sqlite and
+// mysql, and rewritten for the database type when run. Values are always
+// passed as arguments, never written into the statement.
+type Query struct {
+	Args []any
+	Text string
+	db   *Database
+}
+
+func (db *Database) NewQuery(text string, args ...any) *Query {
+	return &Query{Args: append([]any{}, args...), Text: text, db: db}
+}
+
+func (query *Query) Append(text string, args ...any) *Query {
+	query.Text += text
+	query.Args = append(query.Args, args...)
+
+	return query
+}
+
+func (query *Query) AppendQuery(other *Query) *Query {
+	return query.Append(other.Text, other.Args...)
+}
+
+func (query *Query) Exec() (sql.Result, error) {
+	return query.db.Sql.Exec(query.String(), query.Args...)
+}
+
+func (query *Query) ExecTx(tx *sql.Tx) (sql.Result, error) {
+	return tx.Exec(query.String(), query.Args...)
+}
+
+// ExecInsert runs an insert and returns the id generated for the key column,
+// which postgres returns from the statement rather than as the last insert id.
+func (query *Query) ExecInsert(key string) (uint, error) {
+	var id int64
+
+	if query.db.Config.DbType == DbTypePostgresql {
+		if err := query.db.NewQuery(query.Text+" returning `"+key+"`", query.Args...).QueryRow().Scan(&id); err != nil {
+			return 0, err
+		}
+		return uint(id), nil
+	}
+
+	res, err := query.Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	if id, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	return uint(id), nil
+}
+
+func (query *Query) Query() (*sql.Rows, error) {
+	return query.db.Sql.Query(query.String(), query.Args...)
+}
+
+func (query *Query) QueryTx(tx *sql.Tx) (*sql.Rows, error) {
+	return tx.Query(query.String(), query.Args...)
+}
+
+func (query *Query) QueryRowTx(tx *sql.Tx) *sql.Row {
+	return tx.QueryRow(query.String(), query.Args...)
+}
+
+func (query *Query) QueryRow() *sql.Row {
+	return query.db.Sql.QueryRow(query.String(), query.Args...)
+}
+
+func (query *Query) String() string {
+	return query.db.Rebind(query.Text)
+}
+
+// JoinQueries joins the queries with the separator, as with strings.Join.
+func (db *Database) JoinQueries(queries []*Query, sep string) *Query {
+	query := db.NewQuery("")
+
+	for i, q := range queries {
+		if i > 0 {
+			query.Append(sep)
+		}
+		query.AppendQuery(q)
+	}
+
+	return query
+}
+
+// Rebind rewrites a statement written for sqlite and mysql for the database
+// type. For postgres, the identifiers are unquoted unless they are reserved
+// words, and the placeholders are numbered. String literals are left as is.
+func (db *Database) Rebind(text string) string {
+	var (
+		b      strings.Builder
+		n      int
+		quoted bool
+	)
+
+	if db.Config.DbType != DbTypePostgresql {
+		return text
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch {
+		case c == '\'':
+			quoted = !quoted
+			b.WriteByte(c)
+
+		case quoted:
+			b.WriteByte(c)
+
+		case c == '`':
+			j := strings.IndexByte(text[i+1:], '`')
+			if j < 0 {
+				b.WriteString(text[i+1:])
+				return b.String()
+			}
+
+			identifier := text[i+1 : i+1+j]
+			if postgresQuotedIdentifiers[strings.ToLower(identifier)] {
+				b.WriteString(fmt.Sprintf("\"%s\"", strings.ToLower(identifier)))
+			} else {
+				b.WriteString(identifier)
+			}
+
+			i += j + 1
+
+		case c == '?':
+			n++
+			b.WriteString(fmt.Sprintf("$%d", n))
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// Placeholders returns the placeholders of a list of values, as in
+// `id` in (?, ?, ?).
+func Placeholders(n int) string {
+	return fmt.Sprintf("(%s)", strings.TrimSuffix(strings.Repeat("?, ", n), ", "))
+}
+
+// toSqlId returns an id typed as an integer or decoded from json, and false
+// for any other value.
+func toSqlId(f any) (uint, bool) {
+	switch v := f.(type) {
+	case float64:
+		if v >= 0 && v == math.Trunc(v) {
+			return uint(v), true
+		}
+	case int:
+		if v >= 0 {
+			return uint(v), true
+		}
+	case uint:
+		return v, true
+	}
+
+	return 0, false
+}
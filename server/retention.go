@@ -0,0 +1,424 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	RETENTION_LEVEL_TALKGROUP = iota
+	RETENTION_LEVEL_GROUP
+	RETENTION_LEVEL_TAG
+	RETENTION_LEVEL_SYSTEM
+	RETENTION_LEVEL_NONE
+)
+
+// RetentionRule keeps the calls of a talkgroup, a group, a tag or a system for
+// a number of days, or forever. The rule applies at the level of its most
+// specific scope, a talkgroup being given with its system.
+type RetentionRule struct {
+	Id          any    `json:"_id"`
+	Days        uint   `json:"days"`
+	Disabled    bool   `json:"disabled"`
+	GroupId     any    `json:"groupId"`
+	KeepForever bool   `json:"keepForever"`
+	Label       string `json:"label"`
+	Order       any    `json:"order"`
+	SystemId    any    `json:"systemId"`
+	TagId       any    `json:"tagId"`
+	TalkgroupId any    `json:"talkgroupId"`
+}
+
+func NewRetentionRule() *RetentionRule {
+	return &RetentionRule{}
+}
+
+func (retentionRule *RetentionRule) FromMap(m map[string]any) *RetentionRule {
+	switch v := m["_id"].(type) {
+	case float64:
+		retentionRule.Id = uint(v)
+	}
+
+	switch v := m["days"].(type) {
+	case float64:
+		retentionRule.Days = uint(v)
+	}
+
+	switch v := m["disabled"].(type) {
+	case bool:
+		retentionRule.Disabled = v
+	}
+
+	switch v := m["groupId"].(type) {
+	case float64:
+		retentionRule.GroupId = uint(v)
+	}
+
+	switch v := m["keepForever"].(type) {
+	case bool:
+		retentionRule.KeepForever = v
+	}
+
+	switch v := m["label"].(type) {
+	case string:
+		retentionRule.Label = v
+	}
+
+	switch v := m["order"].(type) {
+	case float64:
+		retentionRule.Order = uint(v)
+	}
+
+	switch v := m["systemId"].(type) {
+	case float64:
+		retentionRule.SystemId = uint(v)
+	}
+
+	switch v := m["tagId"].(type) {
+	case float64:
+		retentionRule.TagId = uint(v)
+	}
+
+	switch v := m["talkgroupId"].(type) {
+	case float64:
+		retentionRule.TalkgroupId = uint(v)
+	}
+
+	return retentionRule
+}
+
+// GetLevel returns the level of the most specific scope of the rule, or
+// RETENTION_LEVEL_NONE when the rule has no scope or no retention.
+func (retentionRule *RetentionRule) GetLevel() int {
+	if retentionRule.Disabled || (retentionRule.Days == 0 && !retentionRule.KeepForever) {
+		return RETENTION_LEVEL_NONE
+	}
+
+	_, system := retentionRule.SystemId.(uint)
+
+	switch {
+	case system && retentionRule.TalkgroupId != nil:
+		return RETENTION_LEVEL_TALKGROUP
+	case retentionRule.GroupId != nil:
+		return RETENTION_LEVEL_GROUP
+	case retentionRule.TagId != nil:
+		return RETENTION_LEVEL_TAG
+	case system:
+		return RETENTION_LEVEL_SYSTEM
+	default:
+		return RETENTION_LEVEL_NONE
+	}
+}
+
+// getScope returns the condition matching the calls within the scope of the
+// rule. Groups and tags are resolved to the talkgroups which have them, within
+// the system of the rule if any.
+func (retentionRule *RetentionRule) getScope(db *Database, systems *Systems) *Query {
+	switch retentionRule.GetLevel() {
+	case RETENTION_LEVEL_TALKGROUP:
+		return db.NewQuery("(`system` = ? and `talkgroup` = ?)", retentionRule.SystemId, retentionRule.TalkgroupId)
+
+	case RETENTION_LEVEL_GROUP, RETENTION_LEVEL_TAG:
+		scopes := []*Query{}
+
+		for _, system := range systems.List {
+			if systemId, ok := retentionRule.SystemId.(uint); ok && systemId != system.Id {
+				continue
+			}
+			args := []any{system.Id}
+			for _, talkgroup := range system.Talkgroups.List {
+				if retentionRule.GroupId == talkgroup.GroupId || (retentionRule.GroupId == nil && retentionRule.TagId == talkgroup.TagId) {
+					args = append(args, talkgroup.Id)
+				}
+			}
+			if len(args) > 1 {
+				scopes = append(scopes, db.NewQuery("(`system` = ? and `talkgroup` in "+Placeholders(len(args)-1)+")", args...))
+			}
+		}
+
+		if len(scopes) == 0 {
+			return db.NewQuery("false")
+		}
+
+		return db.NewQuery("(").AppendQuery(db.JoinQueries(scopes, " or ")).Append(")")
+
+	case RETENTION_LEVEL_SYSTEM:
+		return db.NewQuery("`system` = ?", retentionRule.SystemId)
+
+	default:
+		return db.NewQuery("false")
+	}
+}
+
+type RetentionRules struct {
+	List  []*RetentionRule
+	mutex sync.Mutex
+}
+
+func NewRetentionRules() *RetentionRules {
+	return &RetentionRules{
+		List:  []*RetentionRule{},
+		mutex: sync.Mutex{},
+	}
+}
+
+func (retentionRules *RetentionRules) FromMap(f []any) *RetentionRules {
+	retentionRules.mutex.Lock()
+	defer retentionRules.mutex.Unlock()
+
+	retentionRules.List = []*RetentionRule{}
+
+	for _, r := range f {
+		switch m := r.(type) {
+		case map[string]any:
+			retentionRule := NewRetentionRule().FromMap(m)
+			retentionRules.List = append(retentionRules.List, retentionRule)
+		}
+	}
+
+	return retentionRules
+}
+
+// GetPolicies returns the calls each rule is to prune, the most specific rules
+// coming first and leaving out of the next ones the calls they apply to. The
+// last policy has no rule and prunes the remaining calls after pruneDays.
+func (retentionRules *RetentionRules) GetPolicies(db *Database, systems *Systems, pruneDays uint) []*RetentionPolicy {
+	retentionRules.mutex.Lock()
+	defer retentionRules.mutex.Unlock()
+
+	rules := []*RetentionRule{}
+	for _, retentionRule := range retentionRules.List {
+		if retentionRule.GetLevel() != RETENTION_LEVEL_NONE {
+			rules = append(rules, retentionRule)
+		}
+	}
+
+	sort.SliceStable(rules, func(i int, j int) bool {
+		a, b := rules[i].GetLevel(), rules[j].GetLevel()
+		if a != b {
+			return a < b
+		}
+		oa, _ := rules[i].Order.(uint)
+		ob, _ := rules[j].Order.(uint)
+		return oa < ob
+	})
+
+	policies := []*RetentionPolicy{}
+	covered := []*Query{}
+
+	scope := func(q *Query) *Query {
+		if len(covered) == 0 {
+			return q
+		}
+		return db.NewQuery("(").AppendQuery(q).Append(" and not (").AppendQuery(db.JoinQueries(covered, " or ")).Append("))")
+	}
+
+	for _, retentionRule := range rules {
+		q := retentionRule.getScope(db, systems)
+		policies = append(policies, &RetentionPolicy{
+			Days:        retentionRule.Days,
+			KeepForever: retentionRule.KeepForever,
+			Rule:        retentionRule,
+			Scope:       scope(q),
+		})
+		covered = append(covered, q)
+	}
+
+	policies = append(policies, &RetentionPolicy{
+		Days:        pruneDays,
+		KeepForever: pruneDays == 0,
+		Scope:       scope(db.NewQuery("true")),
+	})
+
+	return policies
+}
+
+func (retentionRules *RetentionRules) Read(db *Database) error {
+	var (
+		err         error
+		groupId     sql.NullFloat64
+		id          sql.NullFloat64
+		order       sql.NullFloat64
+		rows        *sql.Rows
+		systemId    sql.NullFloat64
+		tagId       sql.NullFloat64
+		talkgroupId sql.NullFloat64
+	)
+
+	retentionRules.mutex.Lock()
+	defer retentionRules.mutex.Unlock()
+
+	retentionRules.List = []*RetentionRule{}
+
+	formatError := func(err error) error {
+		return fmt.Errorf("retentionrules.read: %v", err)
+	}
+
+	query := db.NewQuery("select `_id`, `days`, `disabled`, `groupId`, `keepForever`, `label`, `order`, `systemId`, `tagId`, `talkgroupId` from `rdioScannerRetentionRules`")
+	if rows, err = query.Query(); err != nil {
+		return formatError(err)
+	}
+
+	toUint := func(f sql.NullFloat64) any {
+		if f.Valid {
+			return uint(f.Float64)
+		}
+		return nil
+	}
+
+	for rows.Next() {
+		retentionRule := NewRetentionRule()
+
+		if err = rows.Scan(&id, &retentionRule.Days, &retentionRule.Disabled, &groupId, &retentionRule.KeepForever, &retentionRule.Label, &order, &systemId, &tagId, &talkgroupId); err != nil {
+			break
+		}
+
+		if id.Valid && id.Float64 > 0 {
+			retentionRule.Id = uint(id.Float64)
+		}
+
+		if order.Valid && order.Float64 > 0 {
+			retentionRule.Order = uint(order.Float64)
+		}
+
+		retentionRule.GroupId = toUint(groupId)
+		retentionRule.SystemId = toUint(systemId)
+		retentionRule.TagId = toUint(tagId)
+		retentionRule.TalkgroupId = toUint(talkgroupId)
+
+		retentionRules.List = append(retentionRules.List, retentionRule)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+func (retentionRules *RetentionRules) Write(db *Database) error {
+	var (
+		count  uint
+		err    error
+		rows   *sql.Rows
+		rowIds = []any{}
+	)
+
+	retentionRules.mutex.Lock()
+	defer retentionRules.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("retentionrules.write: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerRetentionRules`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		var rowId uint
+		if err = rows.Scan(&rowId); err != nil {
+			break
+		}
+		remove := true
+		for _, retentionRule := range retentionRules.List {
+			if retentionRule.Id == nil || retentionRule.Id == rowId {
+				remove = false
+				break
+			}
+		}
+		if remove {
+			rowIds = append(rowIds, rowId)
+		}
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	if len(rowIds) > 0 {
+		if _, err = db.NewQuery("delete from `rdioScannerRetentionRules` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
+		}
+	}
+
+	for _, retentionRule := range retentionRules.List {
+		if err = db.NewQuery("select count(*) from `rdioScannerRetentionRules` where `_id` = ?", retentionRule.Id).QueryRow().Scan(&count); err != nil {
+			break
+		}
+
+		args := []any{retentionRule.Days, retentionRule.Disabled, retentionRule.GroupId, retentionRule.KeepForever, retentionRule.Label, retentionRule.Order, retentionRule.SystemId, retentionRule.TagId, retentionRule.TalkgroupId}
+
+		if count == 0 {
+			query := db.NewQuery("insert into `rdioScannerRetentionRules` (`days`, `disabled`, `groupId`, `keepForever`, `label`, `order`, `systemId`, `tagId`, `talkgroupId`")
+			if retentionRule.Id != nil {
+				query.Append(", `_id`")
+				args = append(args, retentionRule.Id)
+			}
+			query.Append(") values "+Placeholders(len(args)), args...)
+			if _, err = query.Exec(); err != nil {
+				break
+			}
+
+		} else {
+			query := db.NewQuery("update `rdioScannerRetentionRules` set `days` = ?, `disabled` = ?, `groupId` = ?, `keepForever` = ?, `label` = ?, `order` = ?, `systemId` = ?, `tagId` = ?, `talkgroupId` = ? where `_id` = ?", append(args, retentionRule.Id)...)
+			if _, err = query.Exec(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerRetentionRules"))
+	}
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+// RetentionPolicy is the retention applied to the calls of a scope, by a rule
+// or by the prune call days option when the rule is nil.
+type RetentionPolicy struct {
+	Days        uint
+	KeepForever bool
+	Rule        *RetentionRule
+	Scope       *Query
+}
+
+// GetWhere returns the condition matching the calls to prune, or nil when the
+// calls are kept forever. The calls restored from the archive are kept for the
+// retention period from the time they were restored.
+func (policy *RetentionPolicy) GetWhere(db *Database, now time.Time) *Query {
+	if policy.KeepForever || policy.Days == 0 {
+		return nil
+	}
+
+	date := now.Add(-24 * time.Hour * time.Duration(policy.Days)).Format(db.DateTimeFormat)
+
+	return db.NewQuery("`dateTime` < ? and (`restoredAt` is null or `restoredAt` < ?) and ", date, date).AppendQuery(policy.Scope)
+}
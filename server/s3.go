@@ -0,0 +1,302 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Client is a minimal client for S3-compatible object storage. Requests are
+// signed with AWS signature version 4 and use path-style addressing so that
+// self-hosted servers such as MinIO work without DNS setup.
+type S3Client struct {
+	AccessKey string
+	Endpoint  string
+	Region    string
+	SecretKey string
+	http      *http.Client
+}
+
+type S3Object struct {
+	ETag         string    `xml:"ETag"`
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
+}
+
+func NewS3Client(endpoint string, region string, accessKey string, secretKey string) *S3Client {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+
+	return &S3Client{
+		AccessKey: accessKey,
+		Endpoint:  strings.TrimSuffix(endpoint, "/"),
+		Region:    region,
+		SecretKey: secretKey,
+		http:      &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (client *S3Client) DeleteObject(bucket string, key string) error {
+	_, err := client.do(http.MethodDelete, bucket, key, url.Values{}, nil, nil)
+	return err
+}
+
+func (client *S3Client) GetObject(bucket string, key string) ([]byte, error) {
+	return client.do(http.MethodGet, bucket, key, url.Values{}, nil, nil)
+}
+
+func (client *S3Client) ListObjects(bucket string, prefix string) ([]S3Object, error) {
+	var (
+		objects = []S3Object{}
+		token   string
+	)
+
+	for {
+		var result struct {
+			Contents              []S3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if len(prefix) > 0 {
+			query.Set("prefix", prefix)
+		}
+		if len(token) > 0 {
+			query.Set("continuation-token", token)
+		}
+
+		b, err := client.do(http.MethodGet, bucket, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = xml.Unmarshal(b, &result); err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, result.Contents...)
+
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			break
+		}
+
+		token = result.NextContinuationToken
+	}
+
+	return objects, nil
+}
+
+func (client *S3Client) PutObject(bucket string, key string, body []byte, contentType string) error {
+	headers := map[string]string{}
+
+	if len(contentType) > 0 {
+		headers["content-type"] = contentType
+	}
+
+	_, err := client.do(http.MethodPut, bucket, key, url.Values{}, headers, body)
+	return err
+}
+
+func (client *S3Client) PutObjectTagging(bucket string, key string, tags map[string]string) error {
+	type tag struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	}
+
+	var tagging struct {
+		XMLName xml.Name `xml:"Tagging"`
+		TagSet  []tag    `xml:"TagSet>Tag"`
+	}
+
+	for k, v := range tags {
+		tagging.TagSet = append(tagging.TagSet, tag{Key: k, Value: v})
+	}
+
+	body, err := xml.Marshal(tagging)
+	if err != nil {
+		return err
+	}
+
+	sum := md5.Sum(body)
+
+	headers := map[string]string{
+		"content-md5":  base64.StdEncoding.EncodeToString(sum[:]),
+		"content-type": "application/xml",
+	}
+
+	query := url.Values{}
+	query.Set("tagging", "")
+
+	_, err = client.do(http.MethodPut, bucket, key, query, headers, body)
+	return err
+}
+
+func (client *S3Client) do(method string, bucket string, key string, query url.Values, headers map[string]string, body []byte) ([]byte, error) {
+	var (
+		now     = time.Now().UTC()
+		amzDate = now.Format("20060102T150405Z")
+		day     = now.Format("20060102")
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("s3.%s: %w", strings.ToLower(method), err)
+	}
+
+	endpoint, err := url.Parse(client.Endpoint)
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	p := strings.TrimSuffix(endpoint.EscapedPath(), "/") + "/" + s3Escape(bucket, false)
+	if len(key) > 0 {
+		p += "/" + s3Escape(key, true)
+	}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := []string{}
+	for _, k := range keys {
+		params = append(params, fmt.Sprintf("%s=%s", s3Escape(k, false), s3Escape(query.Get(k), false)))
+	}
+	rawQuery := strings.Join(params, "&")
+
+	payloadHash := sha256.Sum256(body)
+
+	h := map[string]string{
+		"host":                 endpoint.Host,
+		"x-amz-content-sha256": hex.EncodeToString(payloadHash[:]),
+		"x-amz-date":           amzDate,
+	}
+	for k, v := range headers {
+		h[strings.ToLower(k)] = v
+	}
+
+	names := make([]string, 0, len(h))
+	for k := range h {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, k := range names {
+		canonicalHeaders += fmt.Sprintf("%s:%s\n", k, strings.TrimSpace(h[k]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{method, p, rawQuery, canonicalHeaders, signedHeaders, h["x-amz-content-sha256"]}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, client.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	signingKey := s3Hmac([]byte("AWS4"+client.SecretKey), day)
+	signingKey = s3Hmac(signingKey, client.Region)
+	signingKey = s3Hmac(signingKey, "s3")
+	signingKey = s3Hmac(signingKey, "aws4_request")
+	signature := hex.EncodeToString(s3Hmac(signingKey, stringToSign))
+
+	u := fmt.Sprintf("%s://%s%s", endpoint.Scheme, endpoint.Host, p)
+	if len(rawQuery) > 0 {
+		u += "?" + rawQuery
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	for k, v := range h {
+		if k != "host" {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", client.AccessKey, scope, signedHeaders, signature))
+
+	res, err := client.http.Do(req)
+	if err != nil {
+		return nil, formatError(err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var e struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(b, &e) == nil && len(e.Code) > 0 {
+			// a missing object reads as a missing file to the callers
+			if e.Code == "NoSuchKey" {
+				return nil, formatError(fmt.Errorf("%s: %w", key, fs.ErrNotExist))
+			}
+			return nil, formatError(fmt.Errorf("%s: %s", e.Code, e.Message))
+		}
+		return nil, formatError(errors.New(res.Status))
+	}
+
+	return b, nil
+}
+
+func s3Escape(s string, keepSlash bool) string {
+	var sb strings.Builder
+
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+
+	return sb.String()
+}
+
+func s3Hmac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
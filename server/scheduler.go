@@ -18,6 +18,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 )
@@ -37,20 +38,87 @@ func NewScheduler(controller *Controller) *Scheduler {
 	}
 }
 
-func (scheduler *Scheduler) pruneCallDatabase() error {
-	if scheduler.Controller.Options.PruneCallDays == 0 {
+// backupDatabase writes a backup in the backup folder when the last one is
+// older than the backup interval, then deletes the ones beyond the number of
+// backups to keep.
+func (scheduler *Scheduler) backupDatabase() error {
+	var (
+		controller = scheduler.Controller
+		dir        = controller.Config.GetBackupDirPath()
+		options    = controller.Options
+	)
+
+	if options.BackupInterval == 0 {
 		return nil
 	}
 
-	scheduler.Controller.Logs.LogEvent(LogLevelInfo, "database call pruning")
+	files, err := GetBackupFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	// the scheduler runs hourly, a few minutes early is still on time
+	if len(files) > 0 {
+		if info, err := os.Stat(files[0]); err == nil && time.Since(info.ModTime()) < time.Duration(options.BackupInterval)*time.Hour-5*time.Minute {
+			return nil
+		}
+	}
+
+	p, _, err := controller.Database.WriteBackupFile(dir, options.BackupCalls, options.BackupLogs)
+	if err != nil {
+		return err
+	}
 
-	if err := scheduler.Controller.Calls.Prune(scheduler.Controller.Database, scheduler.Controller.Options.PruneCallDays); err != nil {
+	controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("database backup saved to %s", p))
+
+	if files, err = GetBackupFiles(dir); err != nil {
 		return err
 	}
 
+	if options.BackupKeep > 0 && len(files) > int(options.BackupKeep) {
+		for _, f := range files[options.BackupKeep:] {
+			if err = os.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
+// pruneCallDatabase applies the retention rules, then the prune call days
+// option to the calls no rule applies to.
+func (scheduler *Scheduler) pruneCallDatabase() error {
+	var (
+		controller = scheduler.Controller
+		db         = controller.Database
+		errs       = []error{}
+		now        = time.Now()
+	)
+
+	policies := controller.RetentionRules.GetPolicies(db, controller.Systems, controller.Options.PruneCallDays)
+
+	for _, policy := range policies {
+		where := policy.GetWhere(db, now)
+		if where == nil {
+			continue
+		}
+
+		count, err := controller.Calls.Prune(db, where)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if policy.Rule != nil {
+			controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("database call pruning, %d calls older than %d days pruned by retention rule %s", count, policy.Days, policy.Rule.Label))
+		} else {
+			controller.Logs.LogEvent(LogLevelInfo, fmt.Sprintf("database call pruning, %d calls older than %d days pruned", count, policy.Days))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func (scheduler *Scheduler) pruneLogDatabase() error {
 	if scheduler.Controller.Options.PruneLogDays == 0 {
 		return nil
@@ -80,6 +148,10 @@ func (scheduler *Scheduler) run() {
 	if err := scheduler.pruneLogDatabase(); err != nil {
 		logError(err)
 	}
+
+	if err := scheduler.backupDatabase(); err != nil {
+		logError(err)
+	}
 }
 
 func (scheduler *Scheduler) Start() error {
@@ -17,7 +17,6 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
@@ -26,15 +25,19 @@ import (
 )
 
 type System struct {
-	Id           uint        `json:"id"`
-	AutoPopulate bool        `json:"autoPopulate"`
-	Blacklists   Blacklists  `json:"blacklists"`
-	Label        string      `json:"label"`
-	Led          any         `json:"led"`
-	Order        uint        `json:"order"`
-	RowId        any         `json:"_id"`
-	Talkgroups   *Talkgroups `json:"talkgroups"`
-	Units        *Units      `json:"units"`
+	Id               uint          `json:"id"`
+	AudioFilters     *AudioFilters `json:"audioFilters"`
+	AutoPopulate     bool          `json:"autoPopulate"`
+	Blacklists       Blacklists    `json:"blacklists"`
+	Label            string        `json:"label"`
+	Led              any           `json:"led"`
+	MinVoiceDuration any           `json:"minVoiceDuration"`
+	Order            uint          `json:"order"`
+	ProfileId        any           `json:"profileId"`
+	RowId            any           `json:"_id"`
+	Talkgroups       *Talkgroups   `json:"talkgroups"`
+	TrimSilence      bool          `json:"trimSilence"`
+	Units            *Units        `json:"units"`
 }
 
 func NewSystem() *System {
@@ -55,6 +58,11 @@ func (system *System) FromMap(m map[string]any) *System {
 		system.Id = uint(v)
 	}
 
+	switch v := m["audioFilters"].(type) {
+	case map[string]any:
+		system.AudioFilters = NewAudioFilters().FromMap(v)
+	}
+
 	switch v := m["autoPopulate"].(type) {
 	case bool:
 		system.AutoPopulate = v
@@ -75,16 +83,31 @@ func (system *System) FromMap(m map[string]any) *System {
 		system.Led = v
 	}
 
+	switch v := m["minVoiceDuration"].(type) {
+	case float64:
+		system.MinVoiceDuration = uint(v)
+	}
+
 	switch v := m["order"].(type) {
 	case float64:
 		system.Order = uint(v)
 	}
 
+	switch v := m["profileId"].(type) {
+	case float64:
+		system.ProfileId = uint(v)
+	}
+
 	switch v := m["talkgroups"].(type) {
 	case []any:
 		system.Talkgroups.FromMap(v)
 	}
 
+	switch v := m["trimSilence"].(type) {
+	case bool:
+		system.TrimSilence = v
+	}
+
 	switch v := m["units"].(type) {
 	case []any:
 		system.Units.FromMap(v)
@@ -322,12 +345,16 @@ func (systems *Systems) GetScopedSystems(client *Client, groups *Groups, tags *T
 
 func (systems *Systems) Read(db *Database) error {
 	var (
-		blacklists sql.NullString
-		err        error
-		led        sql.NullString
-		order      sql.NullFloat64
-		rowId      sql.NullFloat64
-		rows       *sql.Rows
+		audioFilters sql.NullString
+		blacklists   sql.NullString
+		err          error
+		led          sql.NullString
+		minVoice     sql.NullFloat64
+		order        sql.NullFloat64
+		profileId    sql.NullFloat64
+		rowId        sql.NullFloat64
+		rows         *sql.Rows
+		trim         sql.NullBool
 	)
 
 	systems.mutex.Lock()
@@ -339,11 +366,7 @@ func (systems *Systems) Read(db *Database) error {
 		return fmt.Errorf("systems.read: %v", err)
 	}
 
-	q := "select `_id`, `autoPopulate`, `blacklists`, `id`, `label`, `led`, `order` from `rdioScannerSystems`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id, autoPopulate, blacklists, id, label, led, \"order\" from rdioScannerSystems"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `audioFilters`, `autoPopulate`, `blacklists`, `id`, `label`, `led`, `minVoiceDuration`, `order`, `profileId`, `trimSilence` from `rdioScannerSystems`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -353,7 +376,7 @@ func (systems *Systems) Read(db *Database) error {
 			Units:      NewUnits(),
 		}
 
-		if err = rows.Scan(&rowId, &system.AutoPopulate, &blacklists, &system.Id, &system.Label, &led, &order); err != nil {
+		if err = rows.Scan(&rowId, &audioFilters, &system.AutoPopulate, &blacklists, &system.Id, &system.Label, &led, &minVoice, &order, &profileId, &trim); err != nil {
 			break
 		}
 
@@ -361,6 +384,10 @@ func (systems *Systems) Read(db *Database) error {
 			system.RowId = uint(rowId.Float64)
 		}
 
+		if audioFilters.Valid && len(audioFilters.String) > 0 {
+			system.AudioFilters = NewAudioFilters().FromJson(audioFilters.String)
+		}
+
 		if blacklists.Valid && len(blacklists.String) > 0 {
 			blacklists.String = strings.ReplaceAll(blacklists.String, "[", "")
 			blacklists.String = strings.ReplaceAll(blacklists.String, "]", "")
@@ -371,10 +398,22 @@ func (systems *Systems) Read(db *Database) error {
 			system.Led = led.String
 		}
 
+		if minVoice.Valid && minVoice.Float64 > 0 {
+			system.MinVoiceDuration = uint(minVoice.Float64)
+		}
+
 		if order.Valid && order.Float64 > 0 {
 			system.Order = uint(order.Float64)
 		}
 
+		if profileId.Valid && profileId.Float64 > 0 {
+			system.ProfileId = uint(profileId.Float64)
+		}
+
+		if trim.Valid {
+			system.TrimSilence = trim.Bool
+		}
+
 		if err = system.Talkgroups.Read(db, system.Id); err != nil {
 			return err
 		}
@@ -405,8 +444,8 @@ func (systems *Systems) Write(db *Database) error {
 		count      uint
 		err        error
 		rows       *sql.Rows
-		rowIds     = []uint{}
-		systemIds  = []uint{}
+		rowIds     = []any{}
+		systemIds  = []any{}
 	)
 
 	systems.mutex.Lock()
@@ -416,11 +455,7 @@ func (systems *Systems) Write(db *Database) error {
 		return fmt.Errorf("systems.write: %v", err)
 	}
 
-	q := "select `_id`, `id` from `rdioScannerSystems`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id, id from rdioScannerSystems"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `id` from `rdioScannerSystems`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -450,39 +485,17 @@ func (systems *Systems) Write(db *Database) error {
 	}
 
 	if len(rowIds) > 0 {
-		if b, err := json.Marshal(rowIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerSystems` where `_id` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerSystems where _id in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerSystems` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
 	if len(systemIds) > 0 {
-		if b, err := json.Marshal(systemIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerTalkgroups` where `systemId` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerTalkgroups where systemId in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
-			q = fmt.Sprintf("delete from `rdioScannerUnits` where `systemId` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerUnits where systemId in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerTalkgroups` where `systemId` in "+Placeholders(len(systemIds)), systemIds...).Exec(); err != nil {
+			return formatError(err)
+		}
+		if _, err = db.NewQuery("delete from `rdioScannerUnits` where `systemId` in "+Placeholders(len(systemIds)), systemIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
@@ -493,33 +506,22 @@ func (systems *Systems) Write(db *Database) error {
 			blacklists = "[]"
 		}
 
-		q = "select count(*) from `rdioScannerSystems` where `_id` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerSystems where _id = $1"
-		}
-		if err = db.Sql.QueryRow(q, system.RowId).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerSystems` where `_id` = ?", system.RowId).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerSystems (autoPopulate, blacklists, id, label, led, \"order\") values ($1, $2, $3, $4, $5, $6)"
-				if _, err = db.Sql.Exec(q, system.AutoPopulate, blacklists, system.Id, system.Label, system.Led, system.Order); err != nil {
-					break
-				}
-			} else {
-				q = "insert into `rdioScannerSystems` (`_id`, `autoPopulate`, `blacklists`, `id`, `label`, `led`, `order`) values (?, ?, ?, ?, ?, ?, ?)"
-				if _, err = db.Sql.Exec(q, system.RowId, system.AutoPopulate, blacklists, system.Id, system.Label, system.Led, system.Order); err != nil {
-					break
-				}
+			query := db.NewQuery("insert into `rdioScannerSystems` (`audioFilters`, `autoPopulate`, `blacklists`, `id`, `label`, `led`, `minVoiceDuration`, `order`, `profileId`, `trimSilence`", system.AudioFilters.Value(), system.AutoPopulate, blacklists, system.Id, system.Label, system.Led, system.MinVoiceDuration, system.Order, system.ProfileId, system.TrimSilence)
+			if system.RowId != nil {
+				query.Append(", `_id`", system.RowId)
+			}
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
 			}
 
 		} else {
-			q = "update `rdioScannerSystems` set `_id` = ?, `autoPopulate` = ?, `blacklists` = ?, `id` = ?, `label` = ?, `led` = ?, `order` = ? where `_id` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerSystems set _id = $1, autoPopulate = $2, blacklists = $3, id = $4, label = $5, led = $6, \"order\" = $7 where _id = $8"
-			}
-			if _, err = db.Sql.Exec(q, system.RowId, system.AutoPopulate, blacklists, system.Id, system.Label, system.Led, system.Order, system.RowId); err != nil {
+			if _, err = db.NewQuery("update `rdioScannerSystems` set `_id` = ?, `audioFilters` = ?, `autoPopulate` = ?, `blacklists` = ?, `id` = ?, `label` = ?, `led` = ?, `minVoiceDuration` = ?, `order` = ?, `profileId` = ?, `trimSilence` = ? where `_id` = ?", system.RowId, system.AudioFilters.Value(), system.AutoPopulate, blacklists, system.Id, system.Label, system.Led, system.MinVoiceDuration, system.Order, system.ProfileId, system.TrimSilence, system.RowId).Exec(); err != nil {
 				break
 			}
 		}
@@ -533,6 +535,10 @@ func (systems *Systems) Write(db *Database) error {
 		}
 	}
 
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerSystems"))
+	}
+
 	if err != nil {
 		return formatError(err)
 	}
@@ -17,9 +17,7 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 )
 
@@ -178,11 +176,7 @@ func (tags *Tags) Read(db *Database) error {
 		return fmt.Errorf("tags read: %v", err)
 	}
 
-	q := "select `_id`, `label` from `rdioScannerTags`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id, label from rdioScannerTags"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id`, `label` from `rdioScannerTags`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -214,7 +208,7 @@ func (tags *Tags) Write(db *Database) error {
 		count  uint
 		err    error
 		rows   *sql.Rows
-		rowIds = []uint{}
+		rowIds = []any{}
 	)
 
 	tags.mutex.Lock()
@@ -224,11 +218,7 @@ func (tags *Tags) Write(db *Database) error {
 		return fmt.Errorf("tags write %v", err)
 	}
 
-	q := "select `_id` from `rdioScannerTags`"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select _id from rdioScannerTags"
-	}
-	if rows, err = db.Sql.Query(q); err != nil {
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerTags`").Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -256,52 +246,36 @@ func (tags *Tags) Write(db *Database) error {
 	}
 
 	if len(rowIds) > 0 {
-		if b, err := json.Marshal(rowIds); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerTags` where `_id` in %v", s)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerTags where _id in %v", s)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerTags` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
 	for _, tag := range tags.List {
-		q = "select count(*) from `rdioScannerTags` where `_id` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerTags where _id = $1"
-		}
-		if err = db.Sql.QueryRow(q, tag.Id).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerTags` where `_id` = ?", tag.Id).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerTags (label) values ($1)"
-				if _, err = db.Sql.Exec(q, tag.Label); err != nil {
-					break
-				}
-			} else {
-				q = "insert into `rdioScannerTags` (`_id`, `label`) values (?, ?)"
-				if _, err = db.Sql.Exec(q, tag.Id, tag.Label); err != nil {
-					break
-				}
+			query := db.NewQuery("insert into `rdioScannerTags` (`label`", tag.Label)
+			if tag.Id != nil {
+				query.Append(", `_id`", tag.Id)
 			}
-		} else {
-			q = "update `rdioScannerTags` set `_id` = ?, `label` = ? where `_id` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerTags set _id = $1, label = $2 where _id = $3"
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
 			}
-			if _, err = db.Sql.Exec(q, tag.Id, tag.Label, tag.Id); err != nil {
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerTags` set `_id` = ?, `label` = ? where `_id` = ?", tag.Id, tag.Label, tag.Id).Exec(); err != nil {
 				break
 			}
 		}
 	}
 
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerTags"))
+	}
+
 	if err != nil {
 		return formatError(err)
 	}
@@ -17,24 +17,24 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"sort"
-	"strings"
 	"sync"
 )
 
 type Talkgroup struct {
-	Frequency any `json:"frequency"`
-	group     string
-	GroupId   uint   `json:"groupId"`
-	Id        uint   `json:"id"`
-	Label     string `json:"label"`
-	Led       any    `json:"led"`
-	Name      string `json:"name"`
-	Order     uint   `json:"order"`
-	TagId     uint   `json:"tagId"`
-	tag       string
+	AudioFilters *AudioFilters `json:"audioFilters"`
+	Frequency    any           `json:"frequency"`
+	group        string
+	GroupId      uint   `json:"groupId"`
+	Id           uint   `json:"id"`
+	Label        string `json:"label"`
+	Led          any    `json:"led"`
+	Name         string `json:"name"`
+	Order        uint   `json:"order"`
+	ProfileId    any    `json:"profileId"`
+	TagId        uint   `json:"tagId"`
+	tag          string
 }
 
 func (talkgroup *Talkgroup) FromMap(m map[string]any) *Talkgroup {
@@ -43,6 +43,11 @@ func (talkgroup *Talkgroup) FromMap(m map[string]any) *Talkgroup {
 		talkgroup.Id = uint(v)
 	}
 
+	switch v := m["audioFilters"].(type) {
+	case map[string]any:
+		talkgroup.AudioFilters = NewAudioFilters().FromMap(v)
+	}
+
 	switch v := m["frequency"].(type) {
 	case float64:
 		talkgroup.Frequency = uint(v)
@@ -78,6 +83,11 @@ func (talkgroup *Talkgroup) FromMap(m map[string]any) *Talkgroup {
 		talkgroup.Order = uint(v)
 	}
 
+	switch v := m["profileId"].(type) {
+	case float64:
+		talkgroup.ProfileId = uint(v)
+	}
+
 	switch v := m["tag"].(type) {
 	case string:
 		talkgroup.tag = v
@@ -147,10 +157,12 @@ func (talkgroups *Talkgroups) GetTalkgroup(f any) (system *Talkgroup, ok bool) {
 
 func (talkgroups *Talkgroups) Read(db *Database, systemId uint) error {
 	var (
-		err       error
-		frequency sql.NullFloat64
-		led       sql.NullString
-		rows      *sql.Rows
+		audioFilters sql.NullString
+		err          error
+		frequency    sql.NullFloat64
+		led          sql.NullString
+		profileId    sql.NullFloat64
+		rows         *sql.Rows
 	)
 
 	talkgroups.mutex.Lock()
@@ -162,21 +174,21 @@ func (talkgroups *Talkgroups) Read(db *Database, systemId uint) error {
 		return fmt.Errorf("talkgroups.read: %v", err)
 	}
 
-	q := "select `frequency`, `groupId`, `id`, `label`, `led`, `name`, `order`, `tagId` from `rdioScannerTalkgroups` where `systemId` = ?"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select frequency, groupId, id, label, led, name, \"order\", tagId from rdioScannerTalkgroups where systemId = $1"
-	}
-	if rows, err = db.Sql.Query(q, systemId); err != nil {
+	if rows, err = db.NewQuery("select `audioFilters`, `frequency`, `groupId`, `id`, `label`, `led`, `name`, `order`, `profileId`, `tagId` from `rdioScannerTalkgroups` where `systemId` = ?", systemId).Query(); err != nil {
 		return formatError(err)
 	}
 
 	for rows.Next() {
 		talkgroup := &Talkgroup{}
 
-		if err = rows.Scan(&frequency, &talkgroup.GroupId, &talkgroup.Id, &talkgroup.Label, &led, &talkgroup.Name, &talkgroup.Order, &talkgroup.TagId); err != nil {
+		if err = rows.Scan(&audioFilters, &frequency, &talkgroup.GroupId, &talkgroup.Id, &talkgroup.Label, &led, &talkgroup.Name, &talkgroup.Order, &profileId, &talkgroup.TagId); err != nil {
 			break
 		}
 
+		if audioFilters.Valid && len(audioFilters.String) > 0 {
+			talkgroup.AudioFilters = NewAudioFilters().FromJson(audioFilters.String)
+		}
+
 		if frequency.Valid && frequency.Float64 > 0 {
 			talkgroup.Frequency = uint(frequency.Float64)
 		}
@@ -185,6 +197,10 @@ func (talkgroups *Talkgroups) Read(db *Database, systemId uint) error {
 			talkgroup.Led = led.String
 		}
 
+		if profileId.Valid && profileId.Float64 > 0 {
+			talkgroup.ProfileId = uint(profileId.Float64)
+		}
+
 		talkgroups.List = append(talkgroups.List, talkgroup)
 	}
 
@@ -205,7 +221,7 @@ func (talkgroups *Talkgroups) Write(db *Database, systemId uint) error {
 	var (
 		count uint
 		err   error
-		ids   = []uint{}
+		ids   = []any{}
 		rows  *sql.Rows
 	)
 
@@ -216,11 +232,7 @@ func (talkgroups *Talkgroups) Write(db *Database, systemId uint) error {
 		return fmt.Errorf("talkgroups.write: %v", err)
 	}
 
-	q := "select `id` from `rdioScannerTalkgroups` where `systemId` = ?"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select id from rdioScannerTalkgroups where systemId = $1"
-	}
-	if rows, err = db.Sql.Query(q, systemId); err != nil {
+	if rows, err = db.NewQuery("select `id` from `rdioScannerTalkgroups` where `systemId` = ?", systemId).Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -248,44 +260,23 @@ func (talkgroups *Talkgroups) Write(db *Database, systemId uint) error {
 	}
 
 	if len(ids) > 0 {
-		if b, err := json.Marshal(ids); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerTalkgroups` where `id` in %v and `systemId` = %v", s, systemId)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerTalkgroups where id in %v and systemId = %v", s, systemId)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerTalkgroups` where `id` in "+Placeholders(len(ids))+" and `systemId` = ?", append(ids, systemId)...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
 	for _, talkgroup := range talkgroups.List {
-		q := "select count(*) from `rdioScannerTalkgroups` where `id` = ? and `systemId` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerTalkgroups where id = $1 and systemId = $2"
-		}
-		if err = db.Sql.QueryRow(q, talkgroup.Id, systemId).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerTalkgroups` where `id` = ? and `systemId` = ?", talkgroup.Id, systemId).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			q = "insert into `rdioScannerTalkgroups` (`frequency`, `groupId`, `id`, `label`, `led`, `name`, `order`, `systemId`, `tagId`) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerTalkgroups (frequency, groupId, id, label, led, name, \"order\", systemId, tagId) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
-			}
-			if _, err = db.Sql.Exec(q, talkgroup.Frequency, talkgroup.GroupId, talkgroup.Id, talkgroup.Label, talkgroup.Led, talkgroup.Name, talkgroup.Order, systemId, talkgroup.TagId); err != nil {
+			if _, err = db.NewQuery("insert into `rdioScannerTalkgroups` (`audioFilters`, `frequency`, `groupId`, `id`, `label`, `led`, `name`, `order`, `profileId`, `systemId`, `tagId`) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", talkgroup.AudioFilters.Value(), talkgroup.Frequency, talkgroup.GroupId, talkgroup.Id, talkgroup.Label, talkgroup.Led, talkgroup.Name, talkgroup.Order, talkgroup.ProfileId, systemId, talkgroup.TagId).Exec(); err != nil {
 				break
 			}
 
 		} else {
-			q = "update `rdioScannerTalkgroups` set `frequency` = ?, `groupId` = ?, `label` = ?, `led` = ?, `name` = ?, `order` = ?, `tagId` = ? where `id` = ? and `systemId` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerTalkgroups set frequency = $1, groupId = $2, label = $3, led = $4, name = $5, \"order\" = $6, tagId = $7 where id = $8 and systemId = $9"
-			}
-			if _, err = db.Sql.Exec(q, talkgroup.Frequency, talkgroup.GroupId, talkgroup.Label, talkgroup.Led, talkgroup.Name, talkgroup.Order, talkgroup.TagId, talkgroup.Id, systemId); err != nil {
+			if _, err = db.NewQuery("update `rdioScannerTalkgroups` set `audioFilters` = ?, `frequency` = ?, `groupId` = ?, `label` = ?, `led` = ?, `name` = ?, `order` = ?, `profileId` = ?, `tagId` = ? where `id` = ? and `systemId` = ?", talkgroup.AudioFilters.Value(), talkgroup.Frequency, talkgroup.GroupId, talkgroup.Label, talkgroup.Led, talkgroup.Name, talkgroup.Order, talkgroup.ProfileId, talkgroup.TagId, talkgroup.Id, systemId).Exec(); err != nil {
 				break
 			}
 		}
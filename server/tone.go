@@ -0,0 +1,546 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+)
+
+const (
+	TONE_DEFAULT_TOLERANCE = 1.5
+
+	// 100ms frames every 50ms, which gives a 10Hz resolution at 8kHz
+	toneFrameDuration = 100
+	toneFrameStep     = 50
+
+	// share of the frame energy the tone must hold, and minimum RMS level
+	toneMinLevel  = 300
+	toneMinPurity = 0.5
+)
+
+// ToneSet is a paging tone sequence, either a single long tone or a two-tone
+// sequential page such as Motorola Quick Call II, which is looked for in the
+// calls of the talkgroups in its scope.
+type ToneSet struct {
+	Id        any     `json:"_id"`
+	ADuration uint    `json:"aDuration"`
+	ATone     float64 `json:"aTone"`
+	BDuration any     `json:"bDuration"`
+	BTone     any     `json:"bTone"`
+	Label     string  `json:"label"`
+	Order     any     `json:"order"`
+	Systems   any     `json:"systems"`
+	Tolerance any     `json:"tolerance"`
+}
+
+type toneRun struct {
+	start uint
+	stop  uint
+}
+
+func NewToneSet() *ToneSet {
+	return &ToneSet{Systems: []any{}}
+}
+
+func (toneSet *ToneSet) FromMap(m map[string]any) *ToneSet {
+	switch v := m["_id"].(type) {
+	case float64:
+		toneSet.Id = uint(v)
+	}
+
+	switch v := m["aDuration"].(type) {
+	case float64:
+		toneSet.ADuration = uint(v)
+	}
+
+	switch v := m["aTone"].(type) {
+	case float64:
+		toneSet.ATone = v
+	}
+
+	switch v := m["bDuration"].(type) {
+	case float64:
+		toneSet.BDuration = uint(v)
+	}
+
+	switch v := m["bTone"].(type) {
+	case float64:
+		toneSet.BTone = v
+	}
+
+	switch v := m["label"].(type) {
+	case string:
+		toneSet.Label = v
+	}
+
+	switch v := m["order"].(type) {
+	case float64:
+		toneSet.Order = uint(v)
+	}
+
+	switch v := m["systems"].(type) {
+	case []any:
+		toneSet.Systems = v
+	case string:
+		toneSet.Systems = v
+	}
+
+	switch v := m["tolerance"].(type) {
+	case float64:
+		toneSet.Tolerance = v
+	}
+
+	return toneSet
+}
+
+func (toneSet *ToneSet) HasAccess(call *Call) bool {
+	switch v := toneSet.Systems.(type) {
+	case []any:
+		for _, f := range v {
+			switch v := f.(type) {
+			case map[string]any:
+				switch id := v["id"].(type) {
+				case float64:
+					if id == float64(call.System) {
+						switch tg := v["talkgroups"].(type) {
+						case string:
+							if tg == "*" {
+								return true
+							}
+						case []any:
+							for _, f := range tg {
+								switch tg := f.(type) {
+								case float64:
+									if tg == float64(call.Talkgroup) {
+										return true
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+
+	case string:
+		if v == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match tells whether the samples hold the A tone for at least its duration,
+// followed right away by the B tone for at least its duration when the tone
+// set has one.
+func (toneSet *ToneSet) Match(samples []int16, sampleRate uint) bool {
+	tolerance := TONE_DEFAULT_TOLERANCE
+
+	switch v := toneSet.Tolerance.(type) {
+	case float64:
+		tolerance = v
+	}
+
+	if toneSet.ATone <= 0 {
+		return false
+	}
+
+	aRuns := getToneRuns(samples, sampleRate, toneSet.ATone, tolerance)
+
+	bTone, ok := toneSet.BTone.(float64)
+	if !ok || bTone <= 0 {
+		for _, a := range aRuns {
+			if a.duration() >= toneSet.ADuration {
+				return true
+			}
+		}
+		return false
+	}
+
+	var bDuration uint
+
+	switch v := toneSet.BDuration.(type) {
+	case uint:
+		bDuration = v
+	}
+
+	bRuns := getToneRuns(samples, sampleRate, bTone, tolerance)
+
+	for _, a := range aRuns {
+		if a.duration() < toneSet.ADuration {
+			continue
+		}
+
+		for _, b := range bRuns {
+			// the B tone must follow the A tone with at most a short gap
+			if b.start > a.start && b.start <= a.stop+2*toneFrameDuration && b.duration() >= bDuration {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// duration returns the length of the run in milliseconds, from the start of
+// its first frame to the end of its last one, giving it the benefit of one
+// frame step since the tone edges rarely align with frames.
+func (run toneRun) duration() uint {
+	return run.stop - run.start + toneFrameDuration + toneFrameStep
+}
+
+type ToneSets struct {
+	List  []*ToneSet
+	mutex sync.Mutex
+}
+
+func NewToneSets() *ToneSets {
+	return &ToneSets{
+		List:  []*ToneSet{},
+		mutex: sync.Mutex{},
+	}
+}
+
+// Detect returns the tone sets in the scope of the call which are found in its
+// samples.
+func (toneSets *ToneSets) Detect(call *Call, samples []int16, sampleRate uint) []*ToneSet {
+	toneSets.mutex.Lock()
+	defer toneSets.mutex.Unlock()
+
+	matches := []*ToneSet{}
+
+	for _, toneSet := range toneSets.List {
+		if toneSet.HasAccess(call) && toneSet.Match(samples, sampleRate) {
+			matches = append(matches, toneSet)
+		}
+	}
+
+	return matches
+}
+
+// HasAccess tells whether any tone set is to be looked for in the call, which
+// spares decoding its audio when none is.
+func (toneSets *ToneSets) HasAccess(call *Call) bool {
+	toneSets.mutex.Lock()
+	defer toneSets.mutex.Unlock()
+
+	for _, toneSet := range toneSets.List {
+		if toneSet.HasAccess(call) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (toneSets *ToneSets) FromMap(f []any) *ToneSets {
+	toneSets.mutex.Lock()
+	defer toneSets.mutex.Unlock()
+
+	toneSets.List = []*ToneSet{}
+
+	for _, r := range f {
+		switch m := r.(type) {
+		case map[string]any:
+			toneSet := NewToneSet().FromMap(m)
+			toneSets.List = append(toneSets.List, toneSet)
+		}
+	}
+
+	return toneSets
+}
+
+func (toneSets *ToneSets) GetToneSet(id uint) (toneSet *ToneSet, ok bool) {
+	toneSets.mutex.Lock()
+	defer toneSets.mutex.Unlock()
+
+	for _, toneSet := range toneSets.List {
+		if toneSet.Id == id {
+			return toneSet, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetToneSetsList returns the identifiers and labels of the tone sets, which is
+// all the clients need to know about them.
+func (toneSets *ToneSets) GetToneSetsList() []map[string]any {
+	toneSets.mutex.Lock()
+	defer toneSets.mutex.Unlock()
+
+	list := []map[string]any{}
+	for _, toneSet := range toneSets.List {
+		list = append(list, map[string]any{"id": toneSet.Id, "label": toneSet.Label})
+	}
+
+	return list
+}
+
+func (toneSets *ToneSets) Read(db *Database) error {
+	var (
+		bDuration sql.NullFloat64
+		bTone     sql.NullFloat64
+		err       error
+		id        sql.NullFloat64
+		order     sql.NullFloat64
+		rows      *sql.Rows
+		systems   string
+		tolerance sql.NullFloat64
+	)
+
+	toneSets.mutex.Lock()
+	defer toneSets.mutex.Unlock()
+
+	toneSets.List = []*ToneSet{}
+
+	formatError := func(err error) error {
+		return fmt.Errorf("tonesets.read: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id`, `aDuration`, `aTone`, `bDuration`, `bTone`, `label`, `order`, `systems`, `tolerance` from `rdioScannerToneSets`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		toneSet := NewToneSet()
+
+		if err = rows.Scan(&id, &toneSet.ADuration, &toneSet.ATone, &bDuration, &bTone, &toneSet.Label, &order, &systems, &tolerance); err != nil {
+			break
+		}
+
+		if id.Valid && id.Float64 > 0 {
+			toneSet.Id = uint(id.Float64)
+		}
+
+		if bDuration.Valid && bDuration.Float64 > 0 {
+			toneSet.BDuration = uint(bDuration.Float64)
+		}
+
+		if bTone.Valid && bTone.Float64 > 0 {
+			toneSet.BTone = bTone.Float64
+		}
+
+		if order.Valid && order.Float64 > 0 {
+			toneSet.Order = uint(order.Float64)
+		}
+
+		if err := json.Unmarshal([]byte(systems), &toneSet.Systems); err != nil {
+			toneSet.Systems = []any{}
+		}
+
+		if tolerance.Valid && tolerance.Float64 > 0 {
+			toneSet.Tolerance = tolerance.Float64
+		}
+
+		toneSets.List = append(toneSets.List, toneSet)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+func (toneSets *ToneSets) Write(db *Database) error {
+	var (
+		count   uint
+		err     error
+		rows    *sql.Rows
+		rowIds  = []any{}
+		systems any
+	)
+
+	toneSets.mutex.Lock()
+	defer toneSets.mutex.Unlock()
+
+	formatError := func(err error) error {
+		return fmt.Errorf("tonesets.write: %v", err)
+	}
+
+	if rows, err = db.NewQuery("select `_id` from `rdioScannerToneSets`").Query(); err != nil {
+		return formatError(err)
+	}
+
+	for rows.Next() {
+		var rowId uint
+		if err = rows.Scan(&rowId); err != nil {
+			break
+		}
+		remove := true
+		for _, toneSet := range toneSets.List {
+			if toneSet.Id == nil || toneSet.Id == rowId {
+				remove = false
+				break
+			}
+		}
+		if remove {
+			rowIds = append(rowIds, rowId)
+		}
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	if len(rowIds) > 0 {
+		if _, err = db.NewQuery("delete from `rdioScannerToneSets` where `_id` in "+Placeholders(len(rowIds)), rowIds...).Exec(); err != nil {
+			return formatError(err)
+		}
+	}
+
+	for _, toneSet := range toneSets.List {
+		switch v := toneSet.Systems.(type) {
+		case []any:
+			if b, err := json.Marshal(v); err == nil {
+				systems = string(b)
+			} else {
+				systems = "[]"
+			}
+		case string:
+			if v == "*" {
+				systems = `"*"`
+			} else {
+				systems = v
+			}
+		default:
+			systems = "[]"
+		}
+
+		if err = db.NewQuery("select count(*) from `rdioScannerToneSets` where `_id` = ?", toneSet.Id).QueryRow().Scan(&count); err != nil {
+			break
+		}
+
+		if count == 0 {
+			query := db.NewQuery("insert into `rdioScannerToneSets` (`aDuration`, `aTone`, `bDuration`, `bTone`, `label`, `order`, `systems`, `tolerance`", toneSet.ADuration, toneSet.ATone, toneSet.BDuration, toneSet.BTone, toneSet.Label, toneSet.Order, systems, toneSet.Tolerance)
+			if toneSet.Id != nil {
+				query.Append(", `_id`", toneSet.Id)
+			}
+			query.Append(") values " + Placeholders(len(query.Args)))
+			if _, err = query.Exec(); err != nil {
+				break
+			}
+		} else {
+			if _, err = db.NewQuery("update `rdioScannerToneSets` set `_id` = ?, `aDuration` = ?, `aTone` = ?, `bDuration` = ?, `bTone` = ?, `label` = ?, `order` = ?, `systems` = ?, `tolerance` = ? where `_id` = ?", toneSet.Id, toneSet.ADuration, toneSet.ATone, toneSet.BDuration, toneSet.BTone, toneSet.Label, toneSet.Order, systems, toneSet.Tolerance, toneSet.Id).Exec(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err == nil {
+		err = db.ResetSequence(nil, GetDatabaseTable("rdioScannerToneSets"))
+	}
+
+	if err != nil {
+		return formatError(err)
+	}
+
+	return nil
+}
+
+// getToneRuns returns the time spans, in milliseconds, during which a tone
+// within the tolerance (in percent) of the frequency dominates the audio.
+func getToneRuns(samples []int16, sampleRate uint, frequency float64, tolerance float64) []toneRun {
+	var (
+		run  *toneRun
+		runs = []toneRun{}
+	)
+
+	frameSize := int(sampleRate * toneFrameDuration / 1000)
+	frameStep := int(sampleRate * toneFrameStep / 1000)
+	if frameSize == 0 || frameStep == 0 {
+		return runs
+	}
+
+	// probe the tolerance band every half frequency bin so that no tone within
+	// it falls between two probes
+	binWidth := float64(sampleRate) / float64(frameSize)
+	low := frequency * (1 - tolerance/100)
+	high := frequency * (1 + tolerance/100)
+	probes := []float64{}
+	for f := low; f < high; f += binWidth / 2 {
+		probes = append(probes, f)
+	}
+	probes = append(probes, high)
+
+	for pos := 0; pos+frameSize <= len(samples); pos += frameStep {
+		frame := samples[pos : pos+frameSize]
+		at := uint(pos * 1000 / int(sampleRate))
+
+		if isToneInFrame(frame, sampleRate, probes) {
+			if run == nil {
+				run = &toneRun{start: at}
+			}
+			run.stop = at
+
+		} else if run != nil {
+			runs = append(runs, *run)
+			run = nil
+		}
+	}
+
+	if run != nil {
+		runs = append(runs, *run)
+	}
+
+	return runs
+}
+
+// goertzel returns the power of the frequency in the frame.
+func goertzel(frame []int16, sampleRate uint, frequency float64) float64 {
+	var s1, s2 float64
+
+	coeff := 2 * math.Cos(2*math.Pi*frequency/float64(sampleRate))
+
+	for _, sample := range frame {
+		s0 := float64(sample) + coeff*s1 - s2
+		s2 = s1
+		s1 = s0
+	}
+
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
+
+func isToneInFrame(frame []int16, sampleRate uint, probes []float64) bool {
+	var energy float64
+
+	for _, sample := range frame {
+		energy += float64(sample) * float64(sample)
+	}
+
+	if energy/float64(len(frame)) < toneMinLevel*toneMinLevel {
+		return false
+	}
+
+	// a pure tone gives a goertzel power of energy * n / 2
+	for _, f := range probes {
+		if goertzel(frame, sampleRate, f)/(energy*float64(len(frame))/2) >= toneMinPurity {
+			return true
+		}
+	}
+
+	return false
+}
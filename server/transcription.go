@@ -0,0 +1,271 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	TRANSCRIPTION_BACKEND_DISABLED = ""
+	TRANSCRIPTION_BACKEND_HTTP     = "http"
+
+	transcriptionQueueSize = 1024
+	transcriptionTimeout   = 2 * time.Minute
+)
+
+type Transcript struct {
+	Language string              `json:"language,omitempty"`
+	Segments []TranscriptSegment `json:"segments,omitempty"`
+	Text     string              `json:"text"`
+}
+
+// TranscriptSegment is a part of a transcript, with its start and end offsets
+// in seconds from the beginning of the call.
+type TranscriptSegment struct {
+	End   float64 `json:"end"`
+	Start float64 `json:"start"`
+	Text  string  `json:"text"`
+}
+
+// Transcriber is implemented by the speech to text backends.
+type Transcriber interface {
+	Transcribe(call *Call) (*Transcript, error)
+}
+
+// NewTranscriber returns the backend selected in the options, if any.
+func NewTranscriber(options *Options) (Transcriber, error) {
+	switch options.TranscriptionBackend {
+	case TRANSCRIPTION_BACKEND_DISABLED:
+		return nil, nil
+
+	case TRANSCRIPTION_BACKEND_HTTP:
+		if len(options.TranscriptionUrl) == 0 {
+			return nil, errors.New("no transcription url")
+		}
+		return &HttpTranscriber{
+			ApiKey:   options.TranscriptionApiKey,
+			Language: options.TranscriptionLanguage,
+			Model:    options.TranscriptionModel,
+			Url:      options.TranscriptionUrl,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown transcription backend %v", options.TranscriptionBackend)
+	}
+}
+
+// HttpTranscriber posts the call audio to an OpenAI style transcription
+// endpoint, such as the one of a whisper.cpp server.
+type HttpTranscriber struct {
+	ApiKey   string
+	Language string
+	Model    string
+	Url      string
+}
+
+func (transcriber *HttpTranscriber) Transcribe(call *Call) (*Transcript, error) {
+	var (
+		audioName = "audio"
+		buf       = bytes.Buffer{}
+		res       struct {
+			Language string `json:"language"`
+			Segments []struct {
+				End   float64 `json:"end"`
+				Start float64 `json:"start"`
+				Text  string  `json:"text"`
+			} `json:"segments"`
+			Text string `json:"text"`
+		}
+	)
+
+	formatError := func(err error) error {
+		return fmt.Errorf("httptranscriber.transcribe: %v", err)
+	}
+
+	switch v := call.AudioName.(type) {
+	case string:
+		audioName = v
+	}
+
+	mw := multipart.NewWriter(&buf)
+
+	if w, err := mw.CreateFormFile("file", audioName); err == nil {
+		if _, err = w.Write(call.Audio); err != nil {
+			return nil, formatError(err)
+		}
+	} else {
+		return nil, formatError(err)
+	}
+
+	fields := map[string]string{
+		"language":        transcriber.Language,
+		"model":           transcriber.Model,
+		"response_format": "verbose_json",
+	}
+
+	for name, value := range fields {
+		if len(value) == 0 {
+			continue
+		}
+		if err := mw.WriteField(name, value); err != nil {
+			return nil, formatError(err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, formatError(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, transcriber.Url, &buf)
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	if len(transcriber.ApiKey) > 0 {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", transcriber.ApiKey))
+	}
+
+	c := http.Client{Timeout: transcriptionTimeout}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, formatError(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, formatError(fmt.Errorf("bad status: %s, %s", resp.Status, strings.TrimSpace(string(b))))
+	}
+
+	if err = json.Unmarshal(b, &res); err != nil {
+		return nil, formatError(err)
+	}
+
+	transcript := &Transcript{
+		Language: res.Language,
+		Segments: []TranscriptSegment{},
+		Text:     strings.TrimSpace(res.Text),
+	}
+
+	for _, segment := range res.Segments {
+		transcript.Segments = append(transcript.Segments, TranscriptSegment{
+			End:   segment.End,
+			Start: segment.Start,
+			Text:  strings.TrimSpace(segment.Text),
+		})
+	}
+
+	return transcript, nil
+}
+
+// Transcriptions transcribes the stored calls one at a time, away from the
+// ingest path, then pushes the transcripts to the clients and forwards the
+// calls to the downstreams.
+type Transcriptions struct {
+	controller *Controller
+	queue      chan *Call
+}
+
+func NewTranscriptions(controller *Controller) *Transcriptions {
+	return &Transcriptions{
+		controller: controller,
+		queue:      make(chan *Call, transcriptionQueueSize),
+	}
+}
+
+// Enqueue returns false when the call won't be transcribed, either because
+// transcription is disabled or because the queue is full.
+func (transcriptions *Transcriptions) Enqueue(call *Call) bool {
+	if transcriptions.controller.Options.TranscriptionBackend == TRANSCRIPTION_BACKEND_DISABLED {
+		return false
+	}
+
+	select {
+	case transcriptions.queue <- call:
+		return true
+	default:
+		transcriptions.controller.logCall(call, LogLevelWarn, "transcription queue is full")
+		return false
+	}
+}
+
+func (transcriptions *Transcriptions) Start() {
+	go func() {
+		for call := range transcriptions.queue {
+			transcriptions.transcribe(call)
+		}
+	}()
+}
+
+// transcribe works on a copy of the call, which may still be marshalled for
+// the clients when it is transcribed.
+func (transcriptions *Transcriptions) transcribe(call *Call) {
+	controller := transcriptions.controller
+
+	defer func() {
+		controller.Downstreams.Send(controller, call)
+	}()
+
+	transcriber, err := NewTranscriber(controller.Options)
+	if err != nil {
+		controller.Logs.LogEvent(LogLevelError, fmt.Sprintf("transcriptions.transcribe: %v", err))
+		return
+	} else if transcriber == nil {
+		return
+	}
+
+	transcript, err := transcriber.Transcribe(call)
+	if err != nil {
+		controller.logCall(call, LogLevelError, fmt.Sprintf("transcription failed, %v", err))
+		return
+	}
+
+	transcribed := *call
+	transcribed.Transcript = transcript
+	call = &transcribed
+
+	if err = controller.Calls.UpdateTranscript(call, controller.Database); err != nil {
+		controller.Logs.LogEvent(LogLevelError, err.Error())
+		return
+	}
+
+	if system, ok := controller.Systems.GetSystem(call.System); ok {
+		talkgroup, _ := system.Talkgroups.GetTalkgroup(call.Talkgroup)
+		if err = controller.Calls.IndexText(call, system, talkgroup, controller.Database); err != nil {
+			controller.Logs.LogEvent(LogLevelError, err.Error())
+		}
+	}
+
+	controller.Clients.EmitTranscript(call, controller.Accesses.IsRestricted())
+
+	controller.Alerts.Check(call, map[string][]string{AlertFieldTranscript: {call.Transcript.Text}})
+}
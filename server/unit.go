@@ -17,10 +17,8 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"sort"
-	"strings"
 	"sync"
 )
 
@@ -78,6 +76,21 @@ func (units *Units) Add(id uint, label string) (*Units, bool) {
 	return units, added
 }
 
+// GetLabel returns the label of the unit, which is safe while the units are
+// being merged by the ingest of another call.
+func (units *Units) GetLabel(id uint) (string, bool) {
+	units.mutex.Lock()
+	defer units.mutex.Unlock()
+
+	for _, unit := range units.List {
+		if unit.Id == id && len(unit.Label) > 0 {
+			return unit.Label, true
+		}
+	}
+
+	return "", false
+}
+
 func (units *Units) FromMap(f []any) *Units {
 	units.mutex.Lock()
 	defer units.mutex.Unlock()
@@ -128,11 +141,7 @@ func (units *Units) Read(db *Database, systemId uint) error {
 		return fmt.Errorf("units.read: %v", err)
 	}
 
-	q := "select `id`, `label`, `order` from `rdioScannerUnits` where `systemId` = ?"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select id, label, \"order\" from rdioScannerUnits where systemId = $1"
-	}
-	if rows, err = db.Sql.Query(q, systemId); err != nil {
+	if rows, err = db.NewQuery("select `id`, `label`, `order` from `rdioScannerUnits` where `systemId` = ?", systemId).Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -163,7 +172,7 @@ func (units *Units) Write(db *Database, systemId uint) error {
 	var (
 		count uint
 		err   error
-		ids   = []uint{}
+		ids   = []any{}
 		rows  *sql.Rows
 	)
 
@@ -174,11 +183,7 @@ func (units *Units) Write(db *Database, systemId uint) error {
 		return fmt.Errorf("units.write: %v", err)
 	}
 
-	q := "select `id` from `rdioScannerUnits` where `systemId` = ?"
-	if db.Config.DbType == DbTypePostgresql {
-		q = "select id from rdioScannerUnits where systemId = $1"
-	}
-	if rows, err = db.Sql.Query(q, systemId); err != nil {
+	if rows, err = db.NewQuery("select `id` from `rdioScannerUnits` where `systemId` = ?", systemId).Query(); err != nil {
 		return formatError(err)
 	}
 
@@ -206,44 +211,23 @@ func (units *Units) Write(db *Database, systemId uint) error {
 	}
 
 	if len(ids) > 0 {
-		if b, err := json.Marshal(ids); err == nil {
-			s := string(b)
-			s = strings.ReplaceAll(s, "[", "(")
-			s = strings.ReplaceAll(s, "]", ")")
-			q := fmt.Sprintf("delete from `rdioScannerUnits` where `id` in %v and `systemId` = %v", s, systemId)
-			if db.Config.DbType == DbTypePostgresql {
-				q = fmt.Sprintf("delete from rdioScannerUnits where id in %v and systemId = %v", s, systemId)
-			}
-			if _, err = db.Sql.Exec(q); err != nil {
-				return formatError(err)
-			}
+		if _, err = db.NewQuery("delete from `rdioScannerUnits` where `id` in "+Placeholders(len(ids))+" and `systemId` = ?", append(ids, systemId)...).Exec(); err != nil {
+			return formatError(err)
 		}
 	}
 
 	for _, unit := range units.List {
-		q = "select count(*) from `rdioScannerUnits` where `id` = ? and `systemId` = ?"
-		if db.Config.DbType == DbTypePostgresql {
-			q = "select count(*) from rdioScannerUnits where id = $1 and systemId = $2"
-		}
-		if err = db.Sql.QueryRow(q, unit.Id, systemId).Scan(&count); err != nil {
+		if err = db.NewQuery("select count(*) from `rdioScannerUnits` where `id` = ? and `systemId` = ?", unit.Id, systemId).QueryRow().Scan(&count); err != nil {
 			break
 		}
 
 		if count == 0 {
-			q = "insert into `rdioScannerUnits` (`id`, `label`, `order`, `systemId`) values (?, ?, ?, ?)"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "insert into rdioScannerUnits (id, label, \"order\", systemId) values ($1, $2, $3, $4)"
-			}
-			if _, err = db.Sql.Exec(q, unit.Id, unit.Label, unit.Order, systemId); err != nil {
+			if _, err = db.NewQuery("insert into `rdioScannerUnits` (`id`, `label`, `order`, `systemId`) values (?, ?, ?, ?)", unit.Id, unit.Label, unit.Order, systemId).Exec(); err != nil {
 				break
 			}
 
 		} else {
-			q = "update `rdioScannerUnits` set `label` = ?, `order` = ? where `id` = ? and `systemId` = ?"
-			if db.Config.DbType == DbTypePostgresql {
-				q = "update rdioScannerUnits set label = $1, order = $2 where id = $3 and systemId = $4"
-			}
-			if _, err = db.Sql.Exec(q, unit.Label, unit.Order, unit.Id, systemId); err != nil {
+			if _, err = db.NewQuery("update `rdioScannerUnits` set `label` = ?, `order` = ? where `id` = ? and `systemId` = ?", unit.Label, unit.Order, unit.Id, systemId).Exec(); err != nil {
 				break
 			}
 		}
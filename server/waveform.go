@@ -0,0 +1,73 @@
+// Copyright (C) 2019-2022 Chrystian Huot <chrystian.huot@saubeo.solutions>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+)
+
+const (
+	WAVEFORM_PEAKS       = 200
+	WAVEFORM_SAMPLE_RATE = 8000
+)
+
+// Waveform holds the peak level of each slice of a call, from 0 to 255, for
+// the clients to draw it without decoding the audio.
+type Waveform []byte
+
+func NewWaveform(samples []int16) Waveform {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	peaks := WAVEFORM_PEAKS
+	if len(samples) < peaks {
+		peaks = len(samples)
+	}
+
+	waveform := make(Waveform, peaks)
+
+	for i := range waveform {
+		var peak int
+
+		for _, sample := range samples[i*len(samples)/peaks : (i+1)*len(samples)/peaks] {
+			if v := int(sample); v > peak {
+				peak = v
+			} else if -v > peak {
+				peak = -v
+			}
+		}
+
+		waveform[i] = byte(math.Min(255, math.Round(float64(peak)*255/math.MaxInt16)))
+	}
+
+	return waveform
+}
+
+// MarshalJSON encodes the peaks as an array of numbers rather than base64.
+func (waveform Waveform) MarshalJSON() ([]byte, error) {
+	if waveform == nil {
+		return []byte("null"), nil
+	}
+
+	peaks := make([]uint, len(waveform))
+	for i, peak := range waveform {
+		peaks[i] = uint(peak)
+	}
+
+	return json.Marshal(peaks)
+}